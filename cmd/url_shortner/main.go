@@ -3,22 +3,35 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"golang.org/x/sync/errgroup"
 
+	"github.com/ilyakharev/url-short/internal/clicks"
 	"github.com/ilyakharev/url-short/internal/hasher"
+	"github.com/ilyakharev/url-short/internal/outbox"
 	"github.com/ilyakharev/url-short/internal/server"
 	grpchandler "github.com/ilyakharev/url-short/internal/server/grpc/grpc_handler"
 	grpcserver "github.com/ilyakharev/url-short/internal/server/grpc/grpc_server"
 	httphandler "github.com/ilyakharev/url-short/internal/server/http/http_handler"
 	httpserver "github.com/ilyakharev/url-short/internal/server/http/http_server"
 	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/bolt"
+	"github.com/ilyakharev/url-short/internal/storage/cache"
 	"github.com/ilyakharev/url-short/internal/storage/inmemory"
 	"github.com/ilyakharev/url-short/internal/storage/postgres"
+	"github.com/ilyakharev/url-short/internal/storage/sqlite"
+	"github.com/ilyakharev/url-short/internal/storage/tiered"
+	"github.com/ilyakharev/url-short/internal/tokenpool"
+	"github.com/ilyakharev/url-short/internal/webhook"
 )
 
 var logger *zap.Logger
@@ -43,12 +56,165 @@ func initLogger() {
 	}
 }
 
+func envInt(name string, defaultValue int) int {
+	raw, found := os.LookupEnv(name)
+	if !found {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		logger.Panic("'"+name+"' must be an integer", zap.Error(err))
+	}
+	return value
+}
+
+func envFloat(name string, defaultValue float64) float64 {
+	raw, found := os.LookupEnv(name)
+	if !found {
+		return defaultValue
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		logger.Panic("'"+name+"' must be a number", zap.Error(err))
+	}
+	return value
+}
+
+func envDuration(name string, defaultValue time.Duration) time.Duration {
+	raw, found := os.LookupEnv(name)
+	if !found {
+		return defaultValue
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil {
+		logger.Panic("'"+name+"' must be a duration", zap.Error(err))
+	}
+	return value
+}
+
+func postgresConfig() postgres.Config {
+	return postgres.Config{
+		URL:             os.Getenv("POSTGRES_URL"),
+		MaxOpenConns:    envInt("POSTGRES_MAX_OPEN_CONNS", 0),
+		MaxIdleConns:    envInt("POSTGRES_MAX_IDLE_CONNS", 0),
+		ConnMaxLifetime: envDuration("POSTGRES_CONN_MAX_LIFETIME", 0),
+		ConnMaxIdleTime: envDuration("POSTGRES_CONN_MAX_IDLE_TIME", 0),
+		ConnectAttempts: envInt("POSTGRES_CONNECT_ATTEMPTS", 5),
+		ConnectBackoff:  envDuration("POSTGRES_CONNECT_BACKOFF", time.Second),
+		SkipMigrations:  os.Getenv("POSTGRES_AUTO_MIGRATE") == "false",
+
+		ReplicaURLs:          envList("POSTGRES_REPLICA_URLS"),
+		MaxReplicaLag:        envDuration("POSTGRES_MAX_REPLICA_LAG", 0),
+		ReplicaCheckInterval: envDuration("POSTGRES_REPLICA_CHECK_INTERVAL", 0),
+
+		Outbox:       os.Getenv("OUTBOX") == "true",
+		OutboxClicks: os.Getenv("OUTBOX_CLICKS") == "true",
+	}
+}
+
+// envList splits a comma separated variable, skipping empty items.
+func envList(name string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func sqliteConfig() sqlite.Config {
+	path, found := os.LookupEnv("SQLITE_PATH")
+	if !found {
+		path = "url_short.db"
+	}
+	return sqlite.Config{
+		Path:           path,
+		BusyTimeout:    envDuration("SQLITE_BUSY_TIMEOUT", 0),
+		SkipMigrations: os.Getenv("SQLITE_AUTO_MIGRATE") == "false",
+	}
+}
+
+func inmemoryLimits() (limits inmemory.Limits, bounded bool) {
+	limits = inmemory.Limits{
+		MaxLinks:   envInt("INMEMORY_MAX_LINKS", 0),
+		MaxBytes:   int64(envInt("INMEMORY_MAX_BYTES", 0)),
+		Policy:     inmemory.EvictionPolicy(os.Getenv("INMEMORY_EVICTION_POLICY")),
+		MaxEvicted: envInt("INMEMORY_MAX_EVICTED", 0),
+	}
+	return limits, limits.MaxLinks > 0 || limits.MaxBytes > 0
+}
+
+// hotTier puts an in-memory tier in front of cold, bounded by the same
+// limits as the inmemory storage.
+func hotTier(ctx context.Context, cold storage.Storager) *tiered.Tiered {
+	hot := inmemory.New()
+	if limits, bounded := inmemoryLimits(); bounded {
+		var err error
+		hot, err = inmemory.NewBounded(limits)
+		if err != nil {
+			logger.Panic("unable to use bounded hot tier", zap.Error(err))
+		}
+	}
+	cfg := tiered.Config{
+		WarmLinks:     envInt("HOT_TIER_WARM_LINKS", 1000),
+		Mode:          tiered.WriteMode(os.Getenv("HOT_TIER_WRITE_MODE")),
+		QueueSize:     envInt("HOT_TIER_QUEUE_SIZE", 0),
+		WriteAttempts: envInt("HOT_TIER_WRITE_ATTEMPTS", 0),
+		RetryInterval: envDuration("HOT_TIER_RETRY_INTERVAL", 0),
+		ClickInterval: envDuration("CLICKS_FLUSH_INTERVAL", 0),
+	}
+	logger.Info("Create hot tier", zap.String("mode", string(cfg.Mode)),
+		zap.Int("warm_links", cfg.WarmLinks))
+	st, err := tiered.New(ctx, hot, cold, cfg, logger)
+	if err != nil {
+		logger.Panic("unable to use hot tier", zap.Error(err))
+	}
+	go st.Run(ctx)
+	return st
+}
+
+// follower is a copy of links in memory that must drop the links other
+// replicas change.
+type follower interface {
+	Invalidate(token string)
+	Flush()
+}
+
+// followChanges passes the link changes of other Postgres replicas to
+// followers in order until ctx is done.
+func followChanges(ctx context.Context, followers []follower) {
+	logger.Info("Follow link changes of other replicas")
+	err := postgres.NewListener(postgresConfig(), logger).Listen(ctx,
+		func(token string) {
+			for _, f := range followers {
+				f.Invalidate(token)
+			}
+		},
+		func() {
+			for _, f := range followers {
+				f.Flush()
+			}
+		})
+	if err != nil {
+		logger.Error("unable to follow link changes", zap.Error(err))
+	}
+}
+
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
 	initLogger()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(ctx, os.Args[2:], os.Stdout)
+		if err != nil {
+			logger.Fatal("unable to migrate", zap.Error(err))
+		}
+		return
+	}
+
 	portFlag, found := os.LookupEnv("PORT")
 	if !found {
 		portFlag = "80"
@@ -60,15 +226,91 @@ func main() {
 	switch storageType {
 	case "postgres":
 		logger.Info("Create postgres storager")
-		storager, err = postgres.New(os.Getenv("POSTGRES_URL"))
+		var st *postgres.Storage
+		st, err = postgres.New(ctx, postgresConfig())
 		if err != nil {
 			logger.Panic("unable to use postgres", zap.Error(err))
 		}
+		go st.Run(ctx)
+		storager = st
+	case "sqlite":
+		logger.Info("Create sqlite storager")
+		storager, err = sqlite.New(ctx, sqliteConfig())
+		if err != nil {
+			logger.Panic("unable to use sqlite", zap.Error(err))
+		}
+	case "bolt":
+		path, found := os.LookupEnv("BOLT_PATH")
+		if !found {
+			path = "url_short.bolt"
+		}
+		logger.Info("Create bolt storager", zap.String("path", path))
+		storager, err = bolt.New(path)
+		if err != nil {
+			logger.Panic("unable to use bolt", zap.Error(err))
+		}
 	case "inmemory":
-		logger.Info("Create in memory storager")
-		storager = inmemory.New()
+		dir, durable := os.LookupEnv("INMEMORY_DATA_DIR")
+		limits, bounded := inmemoryLimits()
+		if bounded && durable {
+			logger.Panic("'INMEMORY_MAX_LINKS' and 'INMEMORY_MAX_BYTES' " +
+				"are not supported with 'INMEMORY_DATA_DIR'")
+		}
+		if bounded {
+			logger.Info("Create bounded in memory storager",
+				zap.Int("max_links", limits.MaxLinks),
+				zap.Int64("max_bytes", limits.MaxBytes),
+				zap.String("policy", string(limits.Policy)))
+			storager, err = inmemory.NewBounded(limits)
+			if err != nil {
+				logger.Panic("unable to use bounded in memory storage", zap.Error(err))
+			}
+			break
+		}
+		if !durable {
+			logger.Info("Create in memory storager")
+			storager = inmemory.New()
+			break
+		}
+		logger.Info("Create durable in memory storager", zap.String("dir", dir))
+		var st *inmemory.Durable
+		st, err = inmemory.NewDurable(inmemory.DurableConfig{
+			Dir:              dir,
+			Sync:             inmemory.SyncPolicy(os.Getenv("INMEMORY_SYNC")),
+			SyncInterval:     envDuration("INMEMORY_SYNC_INTERVAL", 0),
+			SnapshotInterval: envDuration("INMEMORY_SNAPSHOT_INTERVAL", 0),
+		}, logger)
+		if err != nil {
+			logger.Panic("unable to use durable in memory storage", zap.Error(err))
+		}
+		go st.Run(ctx)
+		storager = st
 	default:
-		logger.Panic("'STORAGE_TYPE' must be 'postgres' or 'inmemory'")
+		logger.Panic("'STORAGE_TYPE' must be 'postgres', 'sqlite', 'bolt' or 'inmemory'")
+	}
+	// followers keep copies of links in memory, the hot tier before the
+	// cache in front of it.
+	var followers []follower
+	if os.Getenv("HOT_TIER") == "true" {
+		if storageType == "inmemory" {
+			logger.Panic("'HOT_TIER' needs a persistent 'STORAGE_TYPE'")
+		}
+		hot := hotTier(ctx, storager)
+		followers = append(followers, hot)
+		storager = hot
+	}
+	if size := envInt("CACHE_SIZE", 0); size > 0 {
+		logger.Info("Create storage cache", zap.Int("size", size))
+		linkCache := cache.New(storager, cache.Config{
+			Size:        size,
+			TTL:         envDuration("CACHE_TTL", time.Minute),
+			NegativeTTL: envDuration("CACHE_NEGATIVE_TTL", 10*time.Second),
+		})
+		followers = append(followers, linkCache)
+		storager = linkCache
+	}
+	if storageType == "postgres" && len(followers) > 0 {
+		go followChanges(ctx, followers)
 	}
 	defer func() {
 		err = storager.Close()
@@ -77,24 +319,185 @@ func main() {
 		}
 	}()
 
-	hash := hasher.New()
-	var srv server.Server
+	var hash hasher.Hasher
+	hasherType, _ := os.LookupEnv("HASHER_TYPE")
+	switch hasherType {
+	case "hmac":
+		logger.Info("Create HMAC hasher")
+		hash, err = hasher.NewHMAC([]byte(os.Getenv("HASHER_SECRET")))
+		if err != nil {
+			logger.Panic("unable to use hmac hasher", zap.Error(err))
+		}
+		// Another length would give URLs other tokens than the ones other
+		// deployments with the same secret give them.
+		for _, name := range []string{"TOKEN_LENGTH", "TOKEN_GROWTH_THRESHOLD"} {
+			if _, found := os.LookupEnv(name); found {
+				logger.Panic("'" + name + "' can not be used with 'hmac' hasher")
+			}
+		}
+	case "", "random":
+		logger.Info("Create random hasher")
+		hash = hasher.New()
+	default:
+		logger.Panic("'HASHER_TYPE' must be 'random' or 'hmac'")
+	}
+	filter := hasher.DefaultFilter()
+	if wordlist, found := os.LookupEnv("TOKEN_WORDLIST"); found {
+		filter, err = hasher.LoadFilter(wordlist)
+		if err != nil {
+			logger.Panic("unable to load token wordlist", zap.Error(err))
+		}
+	}
+	filtered := hasher.NewFiltered(hash, filter)
+	filtered.SetTokenLength(envInt("TOKEN_LENGTH", hasher.DefaultTokenLength))
+	hash = filtered
+
+	counter, _ := storage.As[storage.Counter](storager)
+	keyspace := tokenpool.NewKeyspace(hash, counter, envFloat("TOKEN_GROWTH_THRESHOLD", 0), logger)
+	go keyspace.Run(ctx)
+
+	var tokens tokenpool.Source = tokenpool.NewGenerator(storager, hash, keyspace,
+		envInt("TOKEN_MAX_ATTEMPTS", 20))
+	if os.Getenv("TOKEN_POOL") == "true" {
+		store, ok := storage.As[storage.TokenPooler](storager)
+		if !ok {
+			logger.Panic("token pool is not supported by storage", zap.String("storage", storageType))
+		}
+		if hasherType == "hmac" {
+			logger.Panic("token pool can not be used with 'hmac' hasher")
+		}
+		logger.Info("Create token pool")
+		pool := tokenpool.NewPool(store, hash, tokens, keyspace,
+			envInt("TOKEN_POOL_LOW_WATERMARK", 1000),
+			envInt("TOKEN_POOL_HIGH_WATERMARK", 10000),
+			logger)
+		go pool.Run(ctx)
+		tokens = pool
+	}
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	// Closing the hub ends the streams of click watchers, which would keep
+	// the servers from shutting down.
+	hub := clicks.NewHub(envInt("CLICKS_HISTORY", 1000))
+	go func() {
+		<-groupCtx.Done()
+		hub.Close()
+	}()
+
+	// Clicks are written in the background, so a redirect served from the
+	// cache does not wait for a write to the storage.
+	var clickCounter *clicks.Counter
+	if counted, ok := storage.As[storage.ClickCounter](storager); ok {
+		clickCounter = clicks.NewCounter(counted, envDuration("CLICKS_FLUSH_INTERVAL", 0), logger)
+		group.Go(func() error {
+			clickCounter.Run(groupCtx)
+			return nil
+		})
+	}
+
+	var dispatcher *webhook.Dispatcher
+	if os.Getenv("WEBHOOKS") == "true" {
+		logger.Info("Create webhook dispatcher")
+		dispatcher, err = webhook.New(storager, hub, webhook.Config{
+			MaxAttempts:      envInt("WEBHOOK_MAX_ATTEMPTS", 0),
+			RetryInterval:    envDuration("WEBHOOK_RETRY_INTERVAL", 0),
+			MaxRetryInterval: envDuration("WEBHOOK_MAX_RETRY_INTERVAL", 0),
+			PollInterval:     envDuration("WEBHOOK_POLL_INTERVAL", 0),
+			RefreshInterval:  envDuration("WEBHOOK_REFRESH_INTERVAL", 0),
+			Timeout:          envDuration("WEBHOOK_TIMEOUT", 0),
+			Concurrency:      envInt("WEBHOOK_CONCURRENCY", 0),
+		}, logger)
+		if err != nil {
+			logger.Panic("unable to use webhooks", zap.Error(err), zap.String("storage", storageType))
+		}
+		storager = webhook.NewStorage(storager, dispatcher)
+		group.Go(func() error {
+			return dispatcher.Run(groupCtx)
+		})
+	}
+
+	if os.Getenv("OUTBOX") == "true" {
+		logger.Info("Create outbox relay")
+		path, found := os.LookupEnv("OUTBOX_FILE")
+		if !found {
+			path = "outbox.jsonl"
+		}
+		var publisher *outbox.FilePublisher
+		publisher, err = outbox.NewFilePublisher(path)
+		if err != nil {
+			logger.Panic("unable to open outbox file", zap.Error(err))
+		}
+		defer func() {
+			_ = publisher.Close()
+		}()
+		var relay *outbox.Relay
+		relay, err = outbox.NewRelay(storager, publisher, outbox.Config{
+			BatchSize:    envInt("OUTBOX_BATCH_SIZE", 0),
+			PollInterval: envDuration("OUTBOX_POLL_INTERVAL", 0),
+		}, logger)
+		if err != nil {
+			logger.Panic("unable to use outbox", zap.Error(err), zap.String("storage", storageType))
+		}
+		group.Go(func() error {
+			return relay.Run(groupCtx)
+		})
+	}
+
+	var servers []server.Server
 	transportType, _ := os.LookupEnv("TRANSPORT_TYPE")
+	grpcPort, withGrpc := os.LookupEnv("GRPC_PORT")
 	switch transportType {
 	case "grpc":
 		logger.Info("Create gRPC handler")
-		handler := grpchandler.New(storager, hash, logger)
+		handler := grpchandler.New(storager, tokens, filter, hub, logger)
 		logger.Info("Create gRPC server")
-		srv = grpcserver.New(portFlag, handler, logger)
+		servers = append(servers, grpcserver.New(portFlag, handler, logger))
 	case "http":
 		logger.Info("Create HTTP handler")
-		handler := httphandler.New(storager, hash, logger)
+		redirects := httphandler.Redirects{
+			DefaultCode: envInt("REDIRECT_CODE", http.StatusFound),
+			MaxAge:      envDuration("REDIRECT_CACHE_MAX_AGE", 0),
+		}
+		if redirects.DefaultCode == 0 || storage.CheckRedirectCode(redirects.DefaultCode) != nil {
+			logger.Panic("'REDIRECT_CODE' must be 301, 302, 307 or 308")
+		}
+		handler := httphandler.New(storager, tokens, httphandler.Config{
+			Keyspace:  keyspace,
+			Filter:    filter,
+			Hub:       hub,
+			Counter:   clickCounter,
+			Webhooks:  dispatcher,
+			Redirects: redirects,
+		}, logger)
 		logger.Info("Create HTTP server")
-		srv = httpserver.New(portFlag, handler, logger)
+		servers = append(servers, httpserver.New(portFlag, handler, logger))
+		if withGrpc {
+			logger.Info("Create gRPC server", zap.String("port", grpcPort))
+			servers = append(servers,
+				grpcserver.New(grpcPort, grpchandler.New(storager, tokens, filter, hub, logger), logger))
+		}
 	default:
 		logger.Panic("'TRANSPORT_TYPE' must be 'grpc' or 'http'")
 	}
-	err = srv.Run(ctx)
+	if adminPort, found := os.LookupEnv("ADMIN_PORT"); found {
+		adminToken := os.Getenv("ADMIN_TOKEN")
+		if adminToken == "" {
+			logger.Panic("'ADMIN_TOKEN' must be set with 'ADMIN_PORT'")
+		}
+		logger.Info("Create admin HTTP server", zap.String("port", adminPort))
+		admin := httphandler.New(storager, tokens, httphandler.Config{
+			Keyspace: keyspace,
+			Hub:      hub,
+			Webhooks: dispatcher,
+		}, logger)
+		servers = append(servers, httpserver.NewAdmin(adminPort, admin, adminToken, logger))
+	}
+	for _, srv := range servers {
+		group.Go(func() error {
+			return srv.Run(groupCtx)
+		})
+	}
+	err = group.Wait()
 	if err != nil {
 		logger.Error("error in server", zap.Error(err))
 	}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ilyakharev/url-short/internal/storage/migrate"
+	"github.com/ilyakharev/url-short/internal/storage/postgres"
+	"github.com/ilyakharev/url-short/internal/storage/sqlite"
+)
+
+const migrateUsage = "usage: url_shortner migrate up|down|status"
+
+// runMigrate handles "migrate up", "migrate down" and "migrate status" of
+// the database chosen by STORAGE_TYPE, postgres by default.
+func runMigrate(ctx context.Context, args []string, out io.Writer) (err error) {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	db, migrator, err := openMigrator(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, db.Close())
+	}()
+
+	switch args[0] {
+	case "up":
+		return migrateUp(ctx, migrator, out)
+	case "down":
+		return migrateDown(ctx, migrator, out)
+	case "status":
+		return migrateStatus(ctx, migrator, out)
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+func openMigrator(ctx context.Context) (*sql.DB, *migrate.Migrator, error) {
+	open, newMigrator := func(ctx context.Context) (*sql.DB, error) {
+		return postgres.Open(ctx, postgresConfig())
+	}, postgres.Migrator
+	if os.Getenv("STORAGE_TYPE") == "sqlite" {
+		open, newMigrator = func(ctx context.Context) (*sql.DB, error) {
+			return sqlite.Open(ctx, sqliteConfig())
+		}, sqlite.Migrator
+	}
+
+	db, err := open(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	migrator, err := newMigrator(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, err
+	}
+	return db, migrator, nil
+}
+
+func migrateUp(ctx context.Context, migrator *migrate.Migrator, out io.Writer) error {
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+	for _, migration := range applied {
+		_, _ = fmt.Fprintf(out, "applied %d_%s\n", migration.Version, migration.Name)
+	}
+	if len(applied) == 0 {
+		_, _ = fmt.Fprintln(out, "no pending migrations")
+	}
+	return nil
+}
+
+func migrateDown(ctx context.Context, migrator *migrate.Migrator, out io.Writer) error {
+	migration, err := migrator.Down(ctx)
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(out, "rolled back %d_%s\n", migration.Version, migration.Name)
+	return nil
+}
+
+func migrateStatus(ctx context.Context, migrator *migrate.Migrator, out io.Writer) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.Applied {
+			appliedAt = status.AppliedAt.Format(time.RFC3339)
+		}
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+	}
+	return w.Flush()
+}
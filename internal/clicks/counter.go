@@ -0,0 +1,134 @@
+package clicks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+const (
+	defaultFlushInterval = time.Second
+	flushTimeout         = 10 * time.Second
+)
+
+// Counter adds the clicks of redirects to the storage in the background, so
+// that a redirect does not wait for a write. Clicks are summed per token and
+// written every flush interval, in one write when the storage is a
+// storage.ClickBatcher. The nil Counter drops every click.
+type Counter struct {
+	storage  storage.ClickCounter
+	interval time.Duration
+	logger   *zap.Logger
+
+	mutex sync.Mutex
+	// pending are the clicks not written yet.
+	pending map[string]int64
+}
+
+// NewCounter writes the clicks every interval, every second when it is not
+// positive.
+func NewCounter(st storage.ClickCounter, interval time.Duration, logger *zap.Logger) *Counter {
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	return &Counter{
+		storage:  st,
+		interval: interval,
+		logger:   logger,
+		pending:  make(map[string]int64),
+	}
+}
+
+// Add counts a click of token, it is written by the next flush.
+func (counter *Counter) Add(token string) {
+	if counter == nil {
+		return
+	}
+	counter.mutex.Lock()
+	counter.pending[token]++
+	counter.mutex.Unlock()
+}
+
+// Run flushes the clicks every interval until ctx is done, then flushes the
+// last ones.
+func (counter *Counter) Run(ctx context.Context) {
+	ticker := time.NewTicker(counter.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			counter.flushLogged(ctx)
+		case <-ctx.Done():
+			// The last flush outlives ctx, or the clicks of the last
+			// interval would be lost on every shutdown.
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), flushTimeout)
+			counter.flushLogged(flushCtx)
+			cancel()
+			return
+		}
+	}
+}
+
+func (counter *Counter) flushLogged(ctx context.Context) {
+	err := counter.Flush(ctx)
+	if err != nil {
+		counter.logger.Error("error on write clicks", zap.Error(err))
+	}
+}
+
+// Flush writes the pending clicks. Clicks that could not be written are
+// kept for the next flush.
+func (counter *Counter) Flush(ctx context.Context) error {
+	counter.mutex.Lock()
+	pending := counter.pending
+	counter.pending = make(map[string]int64)
+	counter.mutex.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := counter.write(ctx, pending)
+	if err != nil {
+		hubStats.Add("click_write_errors", 1)
+		counter.restore(pending)
+		return err
+	}
+	hubStats.Add("click_flushes", 1)
+	return nil
+}
+
+// write removes from clicks the ones it has written.
+func (counter *Counter) write(ctx context.Context, clicks map[string]int64) error {
+	if batcher, ok := counter.storage.(storage.ClickBatcher); ok {
+		err := batcher.AddClicks(ctx, clicks)
+		if err != nil {
+			return err
+		}
+		clear(clicks)
+		return nil
+	}
+	for token, count := range clicks {
+		for ; count > 0; count-- {
+			err := counter.storage.AddClick(ctx, token)
+			if err != nil {
+				clicks[token] = count
+				return err
+			}
+		}
+		delete(clicks, token)
+	}
+	return nil
+}
+
+// restore puts clicks back to be written by the next flush.
+func (counter *Counter) restore(clicks map[string]int64) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	for token, count := range clicks {
+		counter.pending[token] += count
+	}
+}
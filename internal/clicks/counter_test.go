@@ -0,0 +1,82 @@
+package clicks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+	mock_storage "github.com/ilyakharev/url-short/internal/storage/mock"
+)
+
+type batchingCounter struct {
+	*mock_storage.MockClickCounter
+	*mock_storage.MockClickBatcher
+}
+
+func TestCounter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("batched", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		st := batchingCounter{mock_storage.NewMockClickCounter(ctrl), mock_storage.NewMockClickBatcher(ctrl)}
+		failed := errors.New("connection refused")
+		gomock.InOrder(
+			st.MockClickBatcher.EXPECT().AddClicks(gomock.Any(), map[string]int64{"a": 2, "b": 1}).Return(failed),
+			st.MockClickBatcher.EXPECT().AddClicks(gomock.Any(), map[string]int64{"a": 3, "b": 1}).Return(nil),
+		)
+		counter := NewCounter(st, time.Hour, zap.NewNop())
+
+		counter.Add("a")
+		counter.Add("b")
+		counter.Add("a")
+		require.ErrorIs(t, counter.Flush(ctx), failed)
+		counter.Add("a")
+		require.NoError(t, counter.Flush(ctx))
+		require.NoError(t, counter.Flush(ctx), "nothing is left to write")
+	})
+	t.Run("one by one", func(t *testing.T) {
+		memory := inmemory.New()
+		require.NoError(t, memory.CreateShortURL(ctx, "https://a.ru", "a"))
+		counter := NewCounter(memory, time.Hour, zap.NewNop())
+
+		for i := 0; i < 3; i++ {
+			counter.Add("a")
+		}
+		clicks, err := memory.Clicks(ctx, "a")
+		require.NoError(t, err)
+		assert.Zero(t, clicks)
+		require.NoError(t, counter.Flush(ctx))
+		clicks, err = memory.Clicks(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), clicks)
+	})
+	t.Run("flushed on stop", func(t *testing.T) {
+		memory := inmemory.New()
+		require.NoError(t, memory.CreateShortURL(ctx, "https://a.ru", "a"))
+		counter := NewCounter(memory, time.Hour, zap.NewNop())
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			counter.Run(runCtx)
+		}()
+
+		counter.Add("a")
+		cancel()
+		<-done
+		clicks, err := memory.Clicks(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), clicks)
+	})
+	t.Run("nil", func(t *testing.T) {
+		var counter *Counter
+		counter.Add("a")
+	})
+}
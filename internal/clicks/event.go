@@ -0,0 +1,72 @@
+package clicks
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Classes of user agents, coarse enough to not identify anybody.
+const (
+	UserAgentBot     = "bot"
+	UserAgentMobile  = "mobile"
+	UserAgentTablet  = "tablet"
+	UserAgentDesktop = "desktop"
+	UserAgentOther   = "other"
+)
+
+// Event is a redirect by a link.
+type Event struct {
+	// ID is set by Hub.Publish and grows with every event.
+	ID     uint64
+	Time   time.Time
+	Token  string
+	Tenant string
+	// ReferrerHost is the host of the Referer header, empty without one.
+	ReferrerHost   string
+	UserAgentClass string
+}
+
+// NewEvent keeps only the host of referrer and the class of userAgent.
+func NewEvent(now time.Time, token string, tenant string, referrer string, userAgent string) *Event {
+	return &Event{
+		Time:           now,
+		Token:          token,
+		Tenant:         tenant,
+		ReferrerHost:   referrerHost(referrer),
+		UserAgentClass: ClassifyUserAgent(userAgent),
+	}
+}
+
+func referrerHost(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+	parsed, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+var botMarkers = []string{"bot", "crawler", "spider", "slurp", "headless", "curl/", "wget/", "python-", "go-http-client"}
+
+// ClassifyUserAgent guesses the kind of client from its User-Agent.
+func ClassifyUserAgent(userAgent string) string {
+	agent := strings.ToLower(userAgent)
+	for _, marker := range botMarkers {
+		if strings.Contains(agent, marker) {
+			return UserAgentBot
+		}
+	}
+	switch {
+	case strings.Contains(agent, "ipad") || strings.Contains(agent, "tablet"),
+		strings.Contains(agent, "android") && !strings.Contains(agent, "mobile"):
+		return UserAgentTablet
+	case strings.Contains(agent, "mobi") || strings.Contains(agent, "iphone"):
+		return UserAgentMobile
+	case strings.HasPrefix(agent, "mozilla/"):
+		return UserAgentDesktop
+	}
+	return UserAgentOther
+}
@@ -0,0 +1,175 @@
+package clicks
+
+import (
+	"expvar"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var hubStats = expvar.NewMap("clicks")
+
+// Filter selects the events of a subscription, an empty field matches any
+// event.
+type Filter struct {
+	Token  string
+	Tenant string
+	// SampleRate is the share of matching events to deliver, from 0 to 1,
+	// all of them when 0.
+	SampleRate float64
+}
+
+func (filter *Filter) match(event *Event) bool {
+	if filter.Token != "" && filter.Token != event.Token {
+		return false
+	}
+	if filter.Tenant != "" && filter.Tenant != event.Tenant {
+		return false
+	}
+	if filter.SampleRate > 0 && filter.SampleRate < 1 {
+		//nolint:gosec // sampling does not need a secure source
+		return rand.Float64() < filter.SampleRate
+	}
+	return true
+}
+
+// Hub delivers click events from redirects to subscribers in the process.
+// Publish never blocks: an event is dropped for a subscriber whose buffer
+// is full. The nil Hub drops every event.
+type Hub struct {
+	mutex       sync.Mutex
+	subscribers map[*Subscription]struct{}
+	closed      bool
+	// lastID is the ID of the last published event. IDs start from the
+	// time the hub is created in microseconds, so that they keep growing
+	// after a restart and a stale ID does not skip new events.
+	lastID uint64
+	// recent is a ring of the last published events, next is where the
+	// next event goes.
+	recent []Event
+	next   int
+}
+
+// NewHub keeps the last recent events for subscribers resuming after a
+// disconnect.
+func NewHub(recent int) *Hub {
+	return &Hub{
+		subscribers: make(map[*Subscription]struct{}),
+		lastID:      uint64(time.Now().UnixMicro()),
+		recent:      make([]Event, 0, recent),
+	}
+}
+
+// Subscription receives the events matching its filter until it is closed.
+type Subscription struct {
+	hub     *Hub
+	filter  Filter
+	events  chan Event
+	dropped atomic.Uint64
+}
+
+// Subscribe starts delivering events matching filter, up to buffer of them
+// wait to be received.
+func (hub *Hub) Subscribe(filter Filter, buffer int) *Subscription {
+	subscription, _ := hub.SubscribeAfter(filter, buffer, 0)
+	return subscription
+}
+
+// SubscribeAfter is Subscribe that also returns the recent events matching
+// filter published after the event with lastID, so that a subscriber
+// resuming with the ID of the last event it got misses none of those kept.
+func (hub *Hub) SubscribeAfter(filter Filter, buffer int,
+	lastID uint64,
+) (subscription *Subscription, missed []Event) {
+	subscription = &Subscription{hub: hub, filter: filter, events: make(chan Event, buffer)}
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if hub.closed {
+		close(subscription.events)
+		return subscription, nil
+	}
+	hub.subscribers[subscription] = struct{}{}
+	hubStats.Add("subscribers", 1)
+	if lastID == 0 {
+		return subscription, nil
+	}
+	for i := range hub.recent {
+		event := &hub.recent[(hub.next+i)%len(hub.recent)]
+		if event.ID > lastID && filter.match(event) {
+			missed = append(missed, *event)
+		}
+	}
+	return subscription, missed
+}
+
+// Publish sets the ID of event and delivers it.
+func (hub *Hub) Publish(event *Event) {
+	if hub == nil {
+		return
+	}
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.lastID++
+	event.ID = hub.lastID
+	if len(hub.recent) < cap(hub.recent) {
+		hub.recent = append(hub.recent, *event)
+	} else if len(hub.recent) > 0 {
+		hub.recent[hub.next] = *event
+		hub.next = (hub.next + 1) % len(hub.recent)
+	}
+	hubStats.Add("published", 1)
+	for subscription := range hub.subscribers {
+		if !subscription.filter.match(event) {
+			continue
+		}
+		select {
+		case subscription.events <- *event:
+			hubStats.Add("delivered", 1)
+		default:
+			subscription.dropped.Add(1)
+			hubStats.Add("dropped", 1)
+		}
+	}
+}
+
+// Close ends every subscription, so that watchers finish on shutdown.
+func (hub *Hub) Close() {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.closed = true
+	for subscription := range hub.subscribers {
+		hub.remove(subscription)
+	}
+}
+
+func (hub *Hub) remove(subscription *Subscription) {
+	if _, ok := hub.subscribers[subscription]; !ok {
+		return
+	}
+	delete(hub.subscribers, subscription)
+	close(subscription.events)
+	hubStats.Add("subscribers", -1)
+}
+
+// Events is closed when the subscription or the hub is closed.
+func (subscription *Subscription) Events() <-chan Event {
+	return subscription.events
+}
+
+// Dropped is how many matching events were not delivered because the
+// buffer was full.
+func (subscription *Subscription) Dropped() uint64 {
+	return subscription.dropped.Load()
+}
+
+func (subscription *Subscription) Close() {
+	subscription.hub.mutex.Lock()
+	defer subscription.hub.mutex.Unlock()
+
+	subscription.hub.remove(subscription)
+}
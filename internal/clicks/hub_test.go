@@ -0,0 +1,121 @@
+package clicks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub(t *testing.T) {
+	hub := NewHub(0)
+	all := hub.Subscribe(Filter{}, 10)
+	byToken := hub.Subscribe(Filter{Token: "a"}, 10)
+	byTenant := hub.Subscribe(Filter{Tenant: "acme"}, 10)
+	slow := hub.Subscribe(Filter{}, 1)
+
+	now := time.Now()
+	hub.Publish(NewEvent(now, "a", "", "", ""))
+	hub.Publish(NewEvent(now, "b", "acme", "", ""))
+
+	assert.Len(t, all.Events(), 2)
+	require.Len(t, byToken.Events(), 1)
+	assert.Equal(t, "a", (<-byToken.Events()).Token)
+	require.Len(t, byTenant.Events(), 1)
+	assert.Equal(t, "b", (<-byTenant.Events()).Token)
+	assert.Equal(t, uint64(1), slow.Dropped())
+	assert.Equal(t, uint64(0), all.Dropped())
+
+	byToken.Close()
+	byToken.Close()
+	hub.Publish(NewEvent(now, "a", "", "", ""))
+	_, open := <-byToken.Events()
+	assert.False(t, open)
+
+	hub.Close()
+	for range all.Events() {
+	}
+	assert.Empty(t, hub.subscribers)
+	_, open = <-hub.Subscribe(Filter{}, 1).Events()
+	assert.False(t, open)
+
+	var noHub *Hub
+	noHub.Publish(NewEvent(now, "a", "", "", ""))
+}
+
+func TestSampling(t *testing.T) {
+	hub := NewHub(0)
+	const published = 10000
+	sampled := hub.Subscribe(Filter{SampleRate: 0.1}, published)
+	for i := 0; i < published; i++ {
+		hub.Publish(&Event{Token: "a"})
+	}
+	assert.InDelta(t, published/10, len(sampled.Events()), published/20)
+}
+
+func TestNewEvent(t *testing.T) {
+	event := NewEvent(time.Unix(1, 0), "a", "acme", "https://News.Example.com:8080/item?id=1",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) Mobile/15E148")
+	assert.Equal(t, Event{
+		Time:           time.Unix(1, 0),
+		Token:          "a",
+		Tenant:         "acme",
+		ReferrerHost:   "news.example.com",
+		UserAgentClass: UserAgentMobile,
+	}, *event)
+	assert.Empty(t, NewEvent(time.Now(), "a", "", "::not a url", "").ReferrerHost)
+}
+
+func TestClassifyUserAgent(t *testing.T) {
+	cases := map[string]string{
+		"":               UserAgentOther,
+		"curl/8.4.0":     UserAgentBot,
+		"grpc-go/1.61.0": UserAgentOther,
+
+		"Googlebot/2.1 (+http://www.google.com/bot.html)":                         UserAgentBot,
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) Mobile Safari/537.36":           UserAgentMobile,
+		"Mozilla/5.0 (Linux; Android 13; SM-X700) Safari/537.36":                  UserAgentTablet,
+		"Mozilla/5.0 (iPad; CPU OS 17_0 like Mac OS X)":                           UserAgentTablet,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0 Safari/537.36":    UserAgentDesktop,
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 HeadlessChrome/120.0": UserAgentBot,
+	}
+	for userAgent, class := range cases {
+		assert.Equal(t, class, ClassifyUserAgent(userAgent), userAgent)
+	}
+}
+
+func TestSubscribeAfter(t *testing.T) {
+	hub := NewHub(3)
+	events := make([]*Event, 5)
+	for i := range events {
+		events[i] = &Event{Token: string(rune('a' + i%2))}
+		hub.Publish(events[i])
+	}
+	for i := 1; i < len(events); i++ {
+		require.Equal(t, events[i-1].ID+1, events[i].ID)
+	}
+
+	ids := func(missed []Event) (ids []uint64) {
+		for i := range missed {
+			ids = append(ids, missed[i].ID)
+		}
+		return ids
+	}
+	_, missed := hub.SubscribeAfter(Filter{}, 1, events[0].ID)
+	assert.Equal(t, []uint64{events[2].ID, events[3].ID, events[4].ID}, ids(missed),
+		"only the recent events are kept")
+	_, missed = hub.SubscribeAfter(Filter{Token: "a"}, 1, events[2].ID)
+	assert.Equal(t, []uint64{events[4].ID}, ids(missed))
+	_, missed = hub.SubscribeAfter(Filter{}, 1, events[4].ID)
+	assert.Empty(t, missed)
+	_, missed = hub.SubscribeAfter(Filter{}, 1, 0)
+	assert.Empty(t, missed, "a new subscriber gets only new events")
+
+	// IDs start from the time, which moves on more than by one per event.
+	time.Sleep(time.Millisecond)
+	restarted := NewHub(3)
+	restarted.Publish(&Event{Token: "a"})
+	_, missed = restarted.SubscribeAfter(Filter{}, 1, events[4].ID)
+	assert.Len(t, missed, 1, "an ID from before a restart must not hide new events")
+}
@@ -6,14 +6,20 @@ import (
 	"strings"
 )
 
-type CryptoRandHash struct{}
+type CryptoRandHash struct {
+	resizable
+}
 
-var _ Hasher = CryptoRandHash{}
+var (
+	_ Hasher  = CryptoRandHash{}
+	_ Resizer = CryptoRandHash{}
+)
 
-func (h CryptoRandHash) GenerateToken() (token string, err error) {
+func (h CryptoRandHash) GenerateToken(_ string, _ int) (token string, err error) {
 	var b strings.Builder
 
-	for i := 0; i < tokenLength; i++ {
+	length := h.TokenLength()
+	for i := 0; i < length; i++ {
 		n, _ := rand.Int(rand.Reader, alphabetSize)
 
 		_, _ = fmt.Fprint(&b, string(alphabet[n.Int64()]))
@@ -23,5 +29,5 @@ func (h CryptoRandHash) GenerateToken() (token string, err error) {
 }
 
 func New() CryptoRandHash {
-	return CryptoRandHash{}
+	return CryptoRandHash{resizable: newResizable()}
 }
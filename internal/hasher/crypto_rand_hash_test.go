@@ -18,7 +18,7 @@ func TestEncode(t *testing.T) {
 	r := regexp.MustCompile(shortURLPattern)
 	t.Run("shortUrl consists of provided alphabet", func(t *testing.T) {
 		for i := 0; i < 10; i++ {
-			token, err := h.GenerateToken()
+			token, err := h.GenerateToken("https://ya.ru", i)
 			require.NoError(t, err)
 			assert.Regexp(t, r, token)
 		}
@@ -26,9 +26,20 @@ func TestEncode(t *testing.T) {
 
 	t.Run("shortUrl has a specified length", func(t *testing.T) {
 		for i := 0; i < 10; i++ {
-			token, err := h.GenerateToken()
+			token, err := h.GenerateToken("https://ya.ru", i)
 			require.NoError(t, err)
 			assert.Len(t, token, lenShortURLPattern)
 		}
 	})
+	t.Run("shortUrl length can be changed", func(t *testing.T) {
+		h := New()
+		h.SetTokenLength(12)
+		assert.Equal(t, 12, h.TokenLength())
+		token, err := h.GenerateToken("https://ya.ru", 0)
+		require.NoError(t, err)
+		assert.Len(t, token, 12)
+
+		h.SetTokenLength(MaxTokenLength + 1)
+		assert.Equal(t, MaxTokenLength, h.TokenLength())
+	})
 }
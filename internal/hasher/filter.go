@@ -0,0 +1,180 @@
+package hasher
+
+import (
+	"bufio"
+	_ "embed" // for default wordlist
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const maxFilterAttempts = 100
+
+var (
+	ErrTokenRejected = errors.New("unable to generate token accepted by filter")
+	ErrInvalidAlias  = fmt.Errorf("alias must be 1 to %d letters, digits or underscores", MaxTokenLength)
+	ErrAliasRejected = errors.New("alias is not allowed")
+
+	//go:embed wordlist.txt
+	defaultWordlist string
+
+	// reservedWords can not be used as tokens as they clash with routes.
+	reservedWords = []string{"create", "api", "admin", "debug"}
+
+	filterStats = expvar.NewMap("token_filter")
+)
+
+// leet maps look-alike characters of the token alphabet to letters. Digits
+// that read as several letters have a variant per letter.
+var leet = []*strings.Replacer{
+	strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "6", "b", "7", "t", "8", "b", "9", "g"),
+	strings.NewReplacer("0", "o", "1", "l", "3", "e", "4", "a", "5", "s", "6", "g", "7", "t", "8", "b", "9", "g"),
+}
+
+// Filter rejects tokens containing words from a wordlist, including their
+// leetspeak spellings, and tokens equal to a reserved word.
+type Filter struct {
+	words []string
+}
+
+func NewFilter(words []string) *Filter {
+	filter := &Filter{}
+	for _, word := range words {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		filter.words = append(filter.words, word)
+	}
+	return filter
+}
+
+// DefaultFilter uses the wordlist embedded into the binary.
+func DefaultFilter() *Filter {
+	filter, _ := ReadFilter(strings.NewReader(defaultWordlist))
+	return filter
+}
+
+// ReadFilter reads a wordlist with one word per line.
+func ReadFilter(r io.Reader) (*Filter, error) {
+	var words []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		words = append(words, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewFilter(words), nil
+}
+
+func LoadFilter(path string) (*Filter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	return ReadFilter(file)
+}
+
+// Allowed reports whether token may be used, either generated or chosen by
+// a user.
+func (filter *Filter) Allowed(token string) bool {
+	filterStats.Add("checked", 1)
+
+	normalized := strings.ReplaceAll(strings.ToLower(token), "_", "")
+	for _, reserved := range reservedWords {
+		if normalized == reserved {
+			filterStats.Add("rejected", 1)
+			return false
+		}
+	}
+
+	variants := make([]string, 0, len(leet)+1)
+	variants = append(variants, normalized)
+	for _, replacer := range leet {
+		variants = append(variants, replacer.Replace(normalized))
+	}
+	for _, word := range filter.words {
+		for _, variant := range variants {
+			if strings.Contains(variant, word) {
+				filterStats.Add("rejected", 1)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// CheckAlias returns an error if alias can not be used as a token chosen by
+// a user. A nil filter only checks the characters and the length.
+func (filter *Filter) CheckAlias(alias string) error {
+	if alias == "" || len(alias) > MaxTokenLength {
+		return ErrInvalidAlias
+	}
+	for _, char := range alias {
+		if !inAlphabet(char) {
+			return ErrInvalidAlias
+		}
+	}
+	if filter != nil && !filter.Allowed(alias) {
+		return ErrAliasRejected
+	}
+	return nil
+}
+
+func inAlphabet(char rune) bool {
+	for _, allowed := range alphabet {
+		if char == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// FilteredHash regenerates tokens of the wrapped hasher until the filter
+// accepts one.
+type FilteredHash struct {
+	hasher Hasher
+	filter *Filter
+}
+
+var (
+	_ Hasher  = FilteredHash{}
+	_ Resizer = FilteredHash{}
+)
+
+func (h FilteredHash) GenerateToken(fullURL string, attempt int) (token string, err error) {
+	for i := 0; i < maxFilterAttempts; i++ {
+		token, err = h.hasher.GenerateToken(fullURL, attempt+i)
+		if err != nil {
+			return "", err
+		}
+		if h.filter.Allowed(token) {
+			return token, nil
+		}
+	}
+	return "", ErrTokenRejected
+}
+
+func (h FilteredHash) TokenLength() int {
+	if resizer, ok := h.hasher.(Resizer); ok {
+		return resizer.TokenLength()
+	}
+	return DefaultTokenLength
+}
+
+func (h FilteredHash) SetTokenLength(length int) {
+	if resizer, ok := h.hasher.(Resizer); ok {
+		resizer.SetTokenLength(length)
+	}
+}
+
+func NewFiltered(h Hasher, filter *Filter) FilteredHash {
+	return FilteredHash{hasher: h, filter: filter}
+}
@@ -0,0 +1,100 @@
+package hasher
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	mock_hasher "github.com/ilyakharev/url-short/internal/hasher/mock"
+)
+
+func TestFilter(t *testing.T) {
+	filter := NewFilter([]string{"# comment", "", "Bad", "slut"})
+	cases := []struct {
+		token   string
+		allowed bool
+	}{
+		{token: "aaaaaaaaaa", allowed: true},
+		{token: "xxBADxxxxx", allowed: false},
+		{token: "xxb4dxxxxx", allowed: false},
+		{token: "xx_b_a_d_x", allowed: false},
+		{token: "q5lu7qqqqq", allowed: false},
+		{token: "q51u7qqqqq", allowed: false},
+		{token: "create", allowed: false},
+		{token: "Creat3", allowed: true},
+		{token: "createxxxx", allowed: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.token, func(t *testing.T) {
+			assert.Equal(t, tc.allowed, filter.Allowed(tc.token))
+		})
+	}
+}
+
+func TestCheckAlias(t *testing.T) {
+	filter := NewFilter([]string{"bad"})
+	cases := []struct {
+		alias string
+		err   error
+	}{
+		{alias: "spring_sale2024"},
+		{alias: "", err: ErrInvalidAlias},
+		{alias: strings.Repeat("a", MaxTokenLength+1), err: ErrInvalidAlias},
+		{alias: "spring-sale", err: ErrInvalidAlias},
+		{alias: "весна", err: ErrInvalidAlias},
+		{alias: "b4d_alias", err: ErrAliasRejected},
+		{alias: "admin", err: ErrAliasRejected},
+	}
+	for _, tc := range cases {
+		t.Run(tc.alias, func(t *testing.T) {
+			assert.ErrorIs(t, filter.CheckAlias(tc.alias), tc.err)
+		})
+	}
+	var noFilter *Filter
+	assert.NoError(t, noFilter.CheckAlias("b4d_alias"))
+}
+
+func TestReadFilter(t *testing.T) {
+	filter, err := ReadFilter(strings.NewReader("# words\nfoo\n\nbar\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"foo", "bar"}, filter.words)
+
+	assert.NotEmpty(t, DefaultFilter().words)
+}
+
+func TestFilteredHash(t *testing.T) {
+	filter := NewFilter([]string{"bad"})
+
+	t.Run("skip rejected tokens", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		h := mock_hasher.NewMockHasher(ctrl)
+		gomock.InOrder(
+			h.EXPECT().GenerateToken("http://ya.ru", 1).Return("xxxxxxxbad", nil),
+			h.EXPECT().GenerateToken("http://ya.ru", 2).Return("xxxxxxxgud", nil),
+		)
+
+		token, err := NewFiltered(h, filter).GenerateToken("http://ya.ru", 1)
+		require.NoError(t, err)
+		assert.Equal(t, "xxxxxxxgud", token)
+	})
+	t.Run("give up", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		h := mock_hasher.NewMockHasher(ctrl)
+		h.EXPECT().GenerateToken(gomock.Any(), gomock.Any()).Return("xxxxxxxbad", nil).Times(maxFilterAttempts)
+
+		_, err := NewFiltered(h, filter).GenerateToken("http://ya.ru", 0)
+		require.ErrorIs(t, err, ErrTokenRejected)
+	})
+	t.Run("hasher error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		h := mock_hasher.NewMockHasher(ctrl)
+		h.EXPECT().GenerateToken(gomock.Any(), gomock.Any()).Return("", errors.New("any"))
+
+		_, err := NewFiltered(h, filter).GenerateToken("http://ya.ru", 0)
+		require.Error(t, err)
+	})
+}
@@ -1,16 +1,57 @@
 package hasher
 
 import (
+	"math"
 	"math/big"
+	"sync/atomic"
+)
+
+const (
+	DefaultTokenLength = 10
+	// MaxTokenLength is bounded by the HMAC-SHA256 digest size and the
+	// width of the token columns in storages.
+	MaxTokenLength = 32
 )
 
 var (
 	alphabet     = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_0123456789")
 	alphabetSize = big.NewInt(int64(len(alphabet)))
-	tokenLength  = 10
 )
 
 //go:generate mockgen -source=hasher.go -destination=./mock/hasher.go
 type Hasher interface {
-	GenerateToken() (token string, err error)
+	// GenerateToken returns a token for fullURL. attempt is the number of
+	// collisions seen so far for this URL, so that deterministic hashers
+	// can produce a different token on retry.
+	GenerateToken(fullURL string, attempt int) (token string, err error)
+}
+
+// Resizer is implemented by hashers whose token length can be changed while
+// they are in use.
+type Resizer interface {
+	TokenLength() int
+	SetTokenLength(length int)
+}
+
+// Capacity returns the number of distinct tokens of the given length.
+func Capacity(length int) float64 {
+	return math.Pow(float64(len(alphabet)), float64(length))
+}
+
+type resizable struct {
+	length *atomic.Int32
+}
+
+func newResizable() resizable {
+	r := resizable{length: &atomic.Int32{}}
+	r.length.Store(DefaultTokenLength)
+	return r
+}
+
+func (r resizable) TokenLength() int {
+	return int(r.length.Load())
+}
+
+func (r resizable) SetTokenLength(length int) {
+	r.length.Store(int32(min(max(length, 1), MaxTokenLength)))
 }
@@ -0,0 +1,100 @@
+package hasher
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var ErrEmptySecret = errors.New("hmac secret must not be empty")
+
+// HMACHash derives the token from HMAC-SHA256 of the canonical URL, so the
+// same URL maps to the same token in every deployment sharing the secret.
+// Tokens are always DefaultTokenLength long: with another length a URL would
+// not get the token other deployments give it, so the hasher is no Resizer.
+type HMACHash struct {
+	secret []byte
+}
+
+var _ Hasher = HMACHash{}
+
+func (h HMACHash) GenerateToken(fullURL string, attempt int) (token string, err error) {
+	canonical, err := Canonical(fullURL)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, h.secret)
+	_, _ = mac.Write([]byte(canonical))
+	if attempt > 0 {
+		// Salt with the attempt number so every retry after a collision
+		// yields the same sequence of tokens.
+		_, _ = mac.Write([]byte{0})
+		_, _ = mac.Write([]byte(strconv.Itoa(attempt)))
+	}
+	sum := mac.Sum(nil)
+
+	var b strings.Builder
+	length := DefaultTokenLength
+	for count := 0; count < length; {
+		for _, value := range sum {
+			if count == length {
+				break
+			}
+			// Bytes above the largest multiple of the alphabet size are
+			// skipped, so that every symbol is equally likely.
+			if int(value) >= unbiasedLimit {
+				continue
+			}
+			b.WriteRune(alphabet[int(value)%len(alphabet)])
+			count++
+		}
+		// A digest may run out of usable bytes, the next one is the HMAC of
+		// the previous, so tokens stay deterministic.
+		mac = hmac.New(sha256.New, h.secret)
+		_, _ = mac.Write(sum)
+		sum = mac.Sum(nil)
+	}
+
+	return b.String(), nil
+}
+
+// unbiasedLimit is the largest multiple of the alphabet size a byte holds.
+var unbiasedLimit = 256 / len(alphabet) * len(alphabet)
+
+// Canonical normalizes a URL so that trivially different spellings of the
+// same address hash equally: scheme and host are lower-cased, default ports
+// are dropped, an empty path becomes "/" and query parameters are sorted.
+func Canonical(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	port := u.Port()
+	if port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	u.Host = host
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawQuery = u.Query().Encode()
+
+	return u.String(), nil
+}
+
+func NewHMAC(secret []byte) (HMACHash, error) {
+	if len(secret) == 0 {
+		return HMACHash{}, ErrEmptySecret
+	}
+	return HMACHash{secret: secret}, nil
+}
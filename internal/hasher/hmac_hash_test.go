@@ -0,0 +1,117 @@
+package hasher
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHMACHash(t *testing.T) {
+	r := regexp.MustCompile(shortURLPattern)
+
+	t.Run("empty secret", func(t *testing.T) {
+		_, err := NewHMAC(nil)
+		require.ErrorIs(t, err, ErrEmptySecret)
+	})
+
+	t.Run("same URL gives same token", func(t *testing.T) {
+		h, err := NewHMAC([]byte("secret"))
+		require.NoError(t, err)
+		other, err := NewHMAC([]byte("secret"))
+		require.NoError(t, err)
+
+		token, err := h.GenerateToken("https://ya.ru/path?b=2&a=1", 0)
+		require.NoError(t, err)
+		assert.Regexp(t, r, token)
+
+		again, err := other.GenerateToken("HTTPS://YA.RU:443/path?a=1&b=2", 0)
+		require.NoError(t, err)
+		assert.Equal(t, token, again)
+	})
+
+	t.Run("retry is deterministic and differs", func(t *testing.T) {
+		h, err := NewHMAC([]byte("secret"))
+		require.NoError(t, err)
+
+		first, err := h.GenerateToken("https://ya.ru", 0)
+		require.NoError(t, err)
+		retry, err := h.GenerateToken("https://ya.ru", 1)
+		require.NoError(t, err)
+		assert.NotEqual(t, first, retry)
+
+		again, err := h.GenerateToken("https://ya.ru", 1)
+		require.NoError(t, err)
+		assert.Equal(t, retry, again)
+	})
+
+	t.Run("token length is fixed", func(t *testing.T) {
+		h, err := NewHMAC([]byte("secret"))
+		require.NoError(t, err)
+		filtered := NewFiltered(h, DefaultFilter())
+
+		token, err := filtered.GenerateToken("https://ya.ru", 0)
+		require.NoError(t, err)
+		filtered.SetTokenLength(MaxTokenLength)
+		assert.Equal(t, DefaultTokenLength, filtered.TokenLength())
+		again, err := filtered.GenerateToken("https://ya.ru", 0)
+		require.NoError(t, err)
+		assert.Equal(t, token, again)
+	})
+
+	t.Run("symbols are uniform", func(t *testing.T) {
+		h, err := NewHMAC([]byte("secret"))
+		require.NoError(t, err)
+
+		const urls = 12000
+		counts := make(map[rune]int)
+		for i := 0; i < urls; i++ {
+			token, err := h.GenerateToken("https://ya.ru/"+strconv.Itoa(i), 0)
+			require.NoError(t, err)
+			require.Len(t, token, DefaultTokenLength)
+			for _, symbol := range token {
+				counts[symbol]++
+			}
+		}
+		require.Len(t, counts, len(alphabet))
+		expected := float64(urls*DefaultTokenLength) / float64(len(alphabet))
+		for symbol, count := range counts {
+			// With modulo bias the first symbols come up 25% more often.
+			assert.InEpsilon(t, expected, float64(count), 0.1, string(symbol))
+		}
+	})
+
+	t.Run("secret changes token", func(t *testing.T) {
+		h, err := NewHMAC([]byte("secret"))
+		require.NoError(t, err)
+		other, err := NewHMAC([]byte("another"))
+		require.NoError(t, err)
+
+		token, err := h.GenerateToken("https://ya.ru", 0)
+		require.NoError(t, err)
+		otherToken, err := other.GenerateToken("https://ya.ru", 0)
+		require.NoError(t, err)
+		assert.NotEqual(t, token, otherToken)
+	})
+}
+
+func TestCanonical(t *testing.T) {
+	cases := []struct {
+		rawURL string
+		expect string
+	}{
+		{rawURL: "https://ya.ru", expect: "https://ya.ru/"},
+		{rawURL: "HTTP://Ya.Ru:80/Path", expect: "http://ya.ru/Path"},
+		{rawURL: "https://ya.ru:8443/?b=1&a=2", expect: "https://ya.ru:8443/?a=2&b=1"},
+		{rawURL: "http://[::1]:80/", expect: "http://[::1]/"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.rawURL, func(t *testing.T) {
+			canonical, err := Canonical(tc.rawURL)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expect, canonical)
+		})
+	}
+}
@@ -39,16 +39,65 @@ func (m *MockHasher) EXPECT() *MockHasherMockRecorder {
 }
 
 // GenerateToken mocks base method.
-func (m *MockHasher) GenerateToken() (string, error) {
+func (m *MockHasher) GenerateToken(fullURL string, attempt int) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GenerateToken")
+	ret := m.ctrl.Call(m, "GenerateToken", fullURL, attempt)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GenerateToken indicates an expected call of GenerateToken.
-func (mr *MockHasherMockRecorder) GenerateToken() *gomock.Call {
+func (mr *MockHasherMockRecorder) GenerateToken(fullURL, attempt any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateToken", reflect.TypeOf((*MockHasher)(nil).GenerateToken))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateToken", reflect.TypeOf((*MockHasher)(nil).GenerateToken), fullURL, attempt)
+}
+
+// MockResizer is a mock of Resizer interface.
+type MockResizer struct {
+	ctrl     *gomock.Controller
+	recorder *MockResizerMockRecorder
+}
+
+// MockResizerMockRecorder is the mock recorder for MockResizer.
+type MockResizerMockRecorder struct {
+	mock *MockResizer
+}
+
+// NewMockResizer creates a new mock instance.
+func NewMockResizer(ctrl *gomock.Controller) *MockResizer {
+	mock := &MockResizer{ctrl: ctrl}
+	mock.recorder = &MockResizerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockResizer) EXPECT() *MockResizerMockRecorder {
+	return m.recorder
+}
+
+// SetTokenLength mocks base method.
+func (m *MockResizer) SetTokenLength(length int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetTokenLength", length)
+}
+
+// SetTokenLength indicates an expected call of SetTokenLength.
+func (mr *MockResizerMockRecorder) SetTokenLength(length any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTokenLength", reflect.TypeOf((*MockResizer)(nil).SetTokenLength), length)
+}
+
+// TokenLength mocks base method.
+func (m *MockResizer) TokenLength() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TokenLength")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// TokenLength indicates an expected call of TokenLength.
+func (mr *MockResizerMockRecorder) TokenLength() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TokenLength", reflect.TypeOf((*MockResizer)(nil).TokenLength))
 }
@@ -0,0 +1,49 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FilePublisher appends events to a file, one JSON object per line. A
+// batch is synced to disk before Publish returns.
+type FilePublisher struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+var _ Publisher = &FilePublisher{}
+
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FilePublisher{file: file}, nil
+}
+
+func (publisher *FilePublisher) Publish(_ context.Context, events []Event) error {
+	var buf []byte
+	for i := range events {
+		line, err := json.Marshal(&events[i])
+		if err != nil {
+			return err
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	_, err := publisher.file.Write(buf)
+	if err != nil {
+		return err
+	}
+	return publisher.file.Sync()
+}
+
+func (publisher *FilePublisher) Close() error {
+	return publisher.file.Close()
+}
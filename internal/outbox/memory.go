@@ -0,0 +1,48 @@
+package outbox
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// MemoryPublisher keeps the published events, for tests.
+type MemoryPublisher struct {
+	mutex  sync.Mutex
+	events []Event
+	err    error
+}
+
+var _ Publisher = &MemoryPublisher{}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (publisher *MemoryPublisher) Publish(_ context.Context, events []Event) error {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	if publisher.err != nil {
+		return publisher.err
+	}
+	publisher.events = append(publisher.events, events...)
+	return nil
+}
+
+// Fail makes Publish return err, or succeed again when err is nil.
+func (publisher *MemoryPublisher) Fail(err error) {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	publisher.err = err
+}
+
+// Events returns the events published so far.
+func (publisher *MemoryPublisher) Events() []Event {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	return slices.Clone(publisher.events)
+}
+
+func (publisher *MemoryPublisher) Close() error {
+	return nil
+}
@@ -0,0 +1,124 @@
+// Package outbox publishes the events a storage records in its outbox along
+// with the changes of links, see storage.Outboxer. An event is deleted from
+// the outbox only once it is published, so it is published at least once
+// even when the process stops in between.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+var outboxStats = expvar.NewMap("outbox")
+
+const (
+	defaultBatchSize    = 100
+	defaultPollInterval = time.Second
+)
+
+// Event is an event as it is published.
+type Event struct {
+	// ID is unique, an event published again keeps it, so consumers drop
+	// the IDs they have seen. IDs are not published in order: an event can
+	// commit after one with a higher ID, and relays of other replicas skip
+	// the rows locked by this one, so the highest ID seen is no watermark.
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Token     string          `json:"token"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Publisher sends events to a message broker. Publish either sends all
+// events or returns an error, then they are published again.
+type Publisher interface {
+	Publish(ctx context.Context, events []Event) error
+	Close() error
+}
+
+type Config struct {
+	// BatchSize is how many events are published at once.
+	BatchSize int
+	// PollInterval is how often the outbox is checked once it is empty.
+	PollInterval time.Duration
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+}
+
+// Relay moves events from the outbox of a storage to a publisher.
+type Relay struct {
+	store     storage.Outboxer
+	publisher Publisher
+	cfg       Config
+	logger    *zap.Logger
+}
+
+// NewRelay returns a relay of the outbox of st, which has to implement
+// storage.Outboxer.
+func NewRelay(st storage.Storager, publisher Publisher, cfg Config, logger *zap.Logger) (*Relay, error) {
+	store, ok := storage.As[storage.Outboxer](st)
+	if !ok {
+		return nil, errors.New("outbox is not supported by storage")
+	}
+	cfg.setDefaults()
+	return &Relay{store: store, publisher: publisher, cfg: cfg, logger: logger}, nil
+}
+
+// Run publishes events until ctx is done. A full batch is followed by the
+// next one right away, so that a backlog is published without waiting.
+func (relay *Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(relay.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		relayed, err := relay.RelayOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			relay.logger.Error("error on relay outbox", zap.Error(err))
+		}
+		if err == nil && relayed == relay.cfg.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce publishes one batch of events.
+func (relay *Relay) RelayOnce(ctx context.Context) (relayed int, err error) {
+	relayed, err = relay.store.RelayOutbox(ctx, relay.cfg.BatchSize,
+		func(ctx context.Context, recorded []storage.OutboxEvent) error {
+			events := make([]Event, len(recorded))
+			for i := range recorded {
+				events[i] = Event{
+					ID:        recorded[i].ID,
+					Type:      recorded[i].Type,
+					Token:     recorded[i].Token,
+					Payload:   recorded[i].Payload,
+					CreatedAt: recorded[i].CreatedAt,
+				}
+			}
+			return relay.publisher.Publish(ctx, events)
+		})
+	if err != nil {
+		outboxStats.Add("failed", 1)
+		return 0, err
+	}
+	outboxStats.Add("published", int64(relayed))
+	return relayed, nil
+}
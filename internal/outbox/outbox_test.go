@@ -0,0 +1,156 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+)
+
+// fakeOutbox is an outbox of a storage, it keeps the events until they are
+// published.
+type fakeOutbox struct {
+	*inmemory.Inmemory
+
+	mutex  sync.Mutex
+	events []storage.OutboxEvent
+}
+
+func newFakeOutbox(count int) *fakeOutbox {
+	fake := &fakeOutbox{Inmemory: inmemory.New()}
+	for i := 0; i < count; i++ {
+		fake.events = append(fake.events, storage.OutboxEvent{
+			ID:        int64(i + 1),
+			Type:      storage.OutboxLinkClicked,
+			Token:     "a",
+			Payload:   []byte(`{}`),
+			CreatedAt: time.Unix(1700000000, 0).UTC(),
+		})
+	}
+	return fake
+}
+
+func (fake *fakeOutbox) RelayOutbox(ctx context.Context, limit int,
+	publish func(ctx context.Context, events []storage.OutboxEvent) error,
+) (int, error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	batch := fake.events[:min(limit, len(fake.events))]
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	err := publish(ctx, batch)
+	if err != nil {
+		return 0, err
+	}
+	fake.events = fake.events[len(batch):]
+	return len(batch), nil
+}
+
+func (fake *fakeOutbox) left() int {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return len(fake.events)
+}
+
+func TestRelayOnce(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeOutbox(3)
+	publisher := NewMemoryPublisher()
+	relay, err := NewRelay(fake, publisher, Config{BatchSize: 2}, zap.NewNop())
+	require.NoError(t, err)
+
+	publisher.Fail(errors.New("broker is down"))
+	_, err = relay.RelayOnce(ctx)
+	require.Error(t, err)
+	assert.Equal(t, 3, fake.left(), "events are kept until published")
+	assert.Empty(t, publisher.Events())
+
+	publisher.Fail(nil)
+	relayed, err := relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, relayed)
+	relayed, err = relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, relayed)
+
+	events := publisher.Events()
+	require.Len(t, events, 3)
+	assert.Equal(t, []int64{1, 2, 3}, []int64{events[0].ID, events[1].ID, events[2].ID})
+	assert.Equal(t, storage.OutboxLinkClicked, events[0].Type)
+	assert.JSONEq(t, `{}`, string(events[0].Payload))
+}
+
+func TestRun(t *testing.T) {
+	fake := newFakeOutbox(25)
+	publisher := NewMemoryPublisher()
+	relay, err := NewRelay(fake, publisher, Config{BatchSize: 10, PollInterval: time.Hour}, zap.NewNop())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- relay.Run(ctx)
+	}()
+	assert.Eventually(t, func() bool {
+		return fake.left() == 0
+	}, time.Second, time.Millisecond, "a backlog is published without waiting for the poll interval")
+	cancel()
+	require.NoError(t, <-done)
+	assert.Len(t, publisher.Events(), 25)
+}
+
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	publisher, err := NewFilePublisher(path)
+	require.NoError(t, err)
+	created := time.Unix(1700000000, 0).UTC()
+	require.NoError(t, publisher.Publish(context.Background(), []Event{
+		{ID: 1, Type: storage.OutboxLinkCreated, Token: "a", Payload: json.RawMessage(`{"url":"http://a.ru"}`),
+			CreatedAt: created},
+		{ID: 2, Type: storage.OutboxLinkClicked, Token: "a", Payload: json.RawMessage(`{}`), CreatedAt: created},
+	}))
+	require.NoError(t, publisher.Close())
+
+	publisher, err = NewFilePublisher(path)
+	require.NoError(t, err)
+	require.NoError(t, publisher.Publish(context.Background(), []Event{
+		{ID: 3, Type: storage.OutboxLinkDeleted, Token: "a", Payload: json.RawMessage(`{}`), CreatedAt: created},
+	}))
+	require.NoError(t, publisher.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() {
+		_ = file.Close()
+	}()
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, events, 3, "the file is appended to")
+	assert.Equal(t, storage.OutboxLinkCreated, events[0].Type)
+	assert.JSONEq(t, `{"url":"http://a.ru"}`, string(events[0].Payload))
+	assert.Equal(t, created, events[2].CreatedAt)
+}
+
+func TestNewRelayRequiresOutboxer(t *testing.T) {
+	_, err := NewRelay(inmemory.New(), NewMemoryPublisher(), Config{}, zap.NewNop())
+	require.Error(t, err)
+}
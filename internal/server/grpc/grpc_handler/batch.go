@@ -0,0 +1,280 @@
+package grpchandler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/tokenpool"
+	"github.com/ilyakharev/url-short/proto"
+)
+
+const (
+	// batchSize is how many links are written in one storage transaction,
+	// and how many received requests wait for it before the stream stops
+	// reading, so that a fast client is slowed down by flow control.
+	batchSize = 500
+	// batchLinger is how long a batch waits for more requests before it is
+	// written.
+	batchLinger  = 10 * time.Millisecond
+	batchTimeout = 10 * time.Second
+)
+
+// batchItem is a request and its position in the stream.
+type batchItem struct {
+	index   uint32
+	request *proto.BatchCreateShortURLRequest
+}
+
+// batch is the links waiting to be written and the responses to them.
+type batch struct {
+	links     []storage.NewLink
+	responses []*proto.BatchCreateShortURLResponse
+	// generated[i] tells whether links[i] has a generated token.
+	generated []bool
+	// pending maps the URL of a link with a generated token and no
+	// attributes to its response, duplicates are the responses to later
+	// requests of the same URL.
+	pending    map[string]*proto.BatchCreateShortURLResponse
+	duplicates map[*proto.BatchCreateShortURLResponse][]*proto.BatchCreateShortURLResponse
+}
+
+// BatchCreateShortURL creates links for the requests of the stream. A
+// request that fails does not stop the others. Requests without alias and
+// attributes reuse the token of an existing link to the same URL, like
+// CreateShortURL does.
+func (handler GrpcHandler) BatchCreateShortURL(stream proto.GrpcHandler_BatchCreateShortURLServer) error {
+	ctx := stream.Context()
+	items := make(chan batchItem, batchSize)
+	recvErr := make(chan error, 1)
+	go func() {
+		defer close(items)
+		for index := uint32(0); ; index++ {
+			request, err := stream.Recv()
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					recvErr <- err
+				}
+				return
+			}
+			select {
+			case items <- batchItem{index: index, request: request}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	pending := newBatch()
+	// linger is nil while the batch is empty.
+	var linger <-chan time.Time
+	for {
+		select {
+		case item, ok := <-items:
+			if !ok {
+				err := handler.flush(ctx, stream, pending)
+				if err != nil {
+					return err
+				}
+				select {
+				case err = <-recvErr:
+					return err
+				default:
+					return nil
+				}
+			}
+			if len(pending.links) == 0 {
+				linger = time.After(batchLinger)
+			}
+			response := handler.prepare(ctx, pending, item)
+			if response != nil {
+				err := stream.Send(response)
+				if err != nil {
+					return err
+				}
+			}
+			if len(pending.links) < batchSize {
+				continue
+			}
+		case <-linger:
+		}
+		err := handler.flush(ctx, stream, pending)
+		if err != nil {
+			return err
+		}
+		linger = nil
+	}
+}
+
+func newBatch() *batch {
+	return &batch{
+		pending:    make(map[string]*proto.BatchCreateShortURLResponse),
+		duplicates: make(map[*proto.BatchCreateShortURLResponse][]*proto.BatchCreateShortURLResponse),
+	}
+}
+
+// prepare adds the link of item to pending, or returns the response to it
+// when there is nothing to write.
+func (handler GrpcHandler) prepare(ctx context.Context, pending *batch,
+	item batchItem,
+) *proto.BatchCreateShortURLResponse {
+	response := &proto.BatchCreateShortURLResponse{Index: item.index}
+	link, err := handler.parseItem(item.request)
+	if err != nil {
+		return failItem(response, status.Convert(err))
+	}
+	err = handler.applyCampaign(ctx, item.request.Campaign, &link.Attributes)
+	if err != nil {
+		return failItem(response, handler.itemStatus(err))
+	}
+	generated := link.Token == ""
+	if generated {
+		shared := link.Attributes.IsZero()
+		if shared {
+			if first, ok := pending.pending[link.FullURL]; ok {
+				pending.duplicates[first] = append(pending.duplicates[first], response)
+				return nil
+			}
+			token, exists, err := handler.storage.AlreadyExists(ctx, link.FullURL)
+			if err != nil {
+				return failItem(response, handler.itemStatus(err))
+			}
+			if exists {
+				response.Token, response.Existed = token, true
+				return response
+			}
+		}
+		link.Token, err = handler.tokens.Token(ctx, link.FullURL)
+		if err != nil {
+			return failItem(response, handler.itemStatus(err))
+		}
+		if shared {
+			pending.pending[link.FullURL] = response
+		}
+	}
+	response.Token = link.Token
+	pending.links = append(pending.links, link)
+	pending.responses = append(pending.responses, response)
+	pending.generated = append(pending.generated, generated)
+	return nil
+}
+
+// flush writes the links of pending and sends the responses to them.
+func (handler GrpcHandler) flush(ctx context.Context, stream proto.GrpcHandler_BatchCreateShortURLServer,
+	pending *batch,
+) error {
+	if len(pending.links) == 0 {
+		return nil
+	}
+	writeCtx, cancel := context.WithTimeout(ctx, batchTimeout)
+	errs, err := storage.CreateLinks(writeCtx, handler.storage, pending.links)
+	cancel()
+	for i, response := range pending.responses {
+		itemErr := err
+		if itemErr == nil {
+			itemErr = errs[i]
+		}
+		if itemErr != nil {
+			if errors.Is(itemErr, storage.ErrTokenExists) && pending.generated[i] {
+				itemErr = status.Error(codes.Aborted, "generated token is taken, retry the request")
+			}
+			failItem(response, handler.itemStatus(itemErr))
+		}
+		sendErr := stream.Send(response)
+		if sendErr != nil {
+			return sendErr
+		}
+		for _, duplicate := range pending.duplicates[response] {
+			duplicate.Token, duplicate.Existed = response.Token, response.Code == uint32(codes.OK)
+			duplicate.Code, duplicate.Message = response.Code, response.Message
+			sendErr = stream.Send(duplicate)
+			if sendErr != nil {
+				return sendErr
+			}
+		}
+	}
+	*pending = *newBatch()
+	return nil
+}
+
+func (handler GrpcHandler) parseItem(request *proto.BatchCreateShortURLRequest) (link storage.NewLink, err error) {
+	_, err = url.ParseRequestURI(request.RawFullURL)
+	if err != nil {
+		return storage.NewLink{}, status.Error(codes.InvalidArgument, "invalid URL")
+	}
+	link.FullURL = request.RawFullURL
+	if request.Alias != "" {
+		err = handler.filter.CheckAlias(request.Alias)
+		if err != nil {
+			return storage.NewLink{}, status.Error(codes.InvalidArgument, err.Error())
+		}
+		link.Token = request.Alias
+	}
+	if request.ExpiresAt != nil {
+		err = request.ExpiresAt.CheckValid()
+		if err != nil {
+			return storage.NewLink{}, status.Error(codes.InvalidArgument, "invalid expiresAt")
+		}
+		link.Attributes.ExpiresAt = request.ExpiresAt.AsTime()
+		if !link.Attributes.ExpiresAt.After(time.Now()) {
+			return storage.NewLink{}, status.Error(codes.InvalidArgument, "expiresAt is in the past")
+		}
+	}
+	link.Attributes.Tags, err = storage.NormalizeTags(request.Tags)
+	if err != nil {
+		return storage.NewLink{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if request.Tenant != "" {
+		err = storage.CheckTenant(request.Tenant)
+		if err != nil {
+			return storage.NewLink{}, status.Error(codes.InvalidArgument, err.Error())
+		}
+		link.Attributes.Tenant = request.Tenant
+	}
+	err = parseOptions(request, &link.Attributes)
+	if err != nil {
+		return storage.NewLink{}, err
+	}
+	return link, nil
+}
+
+// itemStatus turns err into the status of a failed item. Unexpected errors
+// are logged and reported without details.
+func (handler GrpcHandler) itemStatus(err error) *status.Status {
+	if itemStatus, ok := status.FromError(err); ok {
+		return itemStatus
+	}
+	switch {
+	case errors.Is(err, storage.ErrTokenExists):
+		return status.New(codes.AlreadyExists, "alias is taken")
+	case errors.Is(err, storage.ErrNoAttributes):
+		return status.New(codes.FailedPrecondition, "link attributes are not supported by storage")
+	case errors.Is(err, storage.ErrUnavailable):
+		return status.New(codes.Unavailable, err.Error())
+	case errors.Is(err, storage.ErrLinkTooLarge):
+		return status.New(codes.InvalidArgument, err.Error())
+	case errors.Is(err, tokenpool.ErrKeyspaceExhausted):
+		return status.New(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.New(codes.DeadlineExceeded, "request timed out")
+	case errors.Is(err, context.Canceled):
+		return status.New(codes.Canceled, err.Error())
+	}
+	handler.logger.Error("error on batch create", zap.Error(err))
+	return status.New(codes.Internal, "internal error")
+}
+
+func failItem(response *proto.BatchCreateShortURLResponse,
+	itemStatus *status.Status,
+) *proto.BatchCreateShortURLResponse {
+	response.Token = ""
+	response.Code, response.Message = uint32(itemStatus.Code()), itemStatus.Message()
+	return response
+}
@@ -0,0 +1,211 @@
+package grpchandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/ilyakharev/url-short/internal/clicks"
+	"github.com/ilyakharev/url-short/internal/hasher"
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+	mock_tokenpool "github.com/ilyakharev/url-short/internal/tokenpool/mock"
+	"github.com/ilyakharev/url-short/proto"
+)
+
+// newClient serves a handler over an in-memory connection. Generated
+// tokens are "t" and the number of the call.
+func newClient(t *testing.T, st storage.Storager, hub *clicks.Hub) proto.GrpcHandlerClient {
+	ctrl := gomock.NewController(t)
+	tokens := mock_tokenpool.NewMockSource(ctrl)
+	generated := 0
+	tokens.EXPECT().Token(gomock.Any(), gomock.Any()).AnyTimes().
+		DoAndReturn(func(context.Context, string) (string, error) {
+			generated++
+			return fmt.Sprintf("t%d", generated), nil
+		})
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	proto.RegisterGrpcHandlerServer(server, New(st, tokens, hasher.NewFilter([]string{"bad"}), hub, zap.NewNop()))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return proto.NewGrpcHandlerClient(conn)
+}
+
+// batchCreate sends requests and returns the responses by index.
+func batchCreate(t *testing.T, client proto.GrpcHandlerClient,
+	requests []*proto.BatchCreateShortURLRequest,
+) []*proto.BatchCreateShortURLResponse {
+	t.Helper()
+	stream, err := client.BatchCreateShortURL(context.Background())
+	require.NoError(t, err)
+	go func() {
+		for _, request := range requests {
+			if stream.Send(request) != nil {
+				return
+			}
+		}
+		_ = stream.CloseSend()
+	}()
+
+	responses := make([]*proto.BatchCreateShortURLResponse, len(requests))
+	for {
+		response, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		require.Nil(t, responses[response.Index], "two responses to %d", response.Index)
+		responses[response.Index] = response
+	}
+	for i, response := range responses {
+		require.NotNil(t, response, "no response to %d", i)
+	}
+	return responses
+}
+
+func TestBatchCreateShortURL(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	require.NoError(t, memory.CreateShortURL(ctx, "https://existing.ru", "existing"))
+	require.NoError(t, memory.CreateShortURL(ctx, "https://taken.ru", "taken"))
+	require.NoError(t, memory.SaveCampaign(ctx, &storage.Campaign{Tenant: "acme", Name: "spring",
+		UTM: storage.UTM{Source: "newsletter", Campaign: "spring_sale"}}))
+	client := newClient(t, memory, nil)
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	responses := batchCreate(t, client, []*proto.BatchCreateShortURLRequest{
+		{RawFullURL: "https://a.ru"},
+		{RawFullURL: "https://existing.ru"},
+		{RawFullURL: "https://b.ru", Alias: "spring", ExpiresAt: timestamppb.New(expiresAt), Tags: []string{"promo"},
+			RedirectCode: http.StatusMovedPermanently},
+		{RawFullURL: "not a url"},
+		{RawFullURL: "https://c.ru", Alias: "taken"},
+		{RawFullURL: "https://d.ru", Alias: "b4d"},
+		{RawFullURL: "https://e.ru", ExpiresAt: timestamppb.New(time.Now().Add(-time.Hour))},
+		{RawFullURL: "https://a.ru"},
+		{RawFullURL: "https://f.ru", RedirectCode: http.StatusSeeOther},
+		{RawFullURL: "https://g.ru", Alias: "sale", Tenant: "acme", Campaign: "spring",
+			Utm: &proto.UTM{Content: "banner"}},
+		{RawFullURL: "https://h.ru", Tenant: "acme", Campaign: "winter"},
+	})
+
+	type result struct {
+		token   string
+		existed bool
+		code    codes.Code
+	}
+	results := make([]result, len(responses))
+	for i, response := range responses {
+		results[i] = result{token: response.Token, existed: response.Existed, code: codes.Code(response.Code)}
+	}
+	assert.Equal(t, []result{
+		{token: "t1", code: codes.OK},
+		{token: "existing", existed: true, code: codes.OK},
+		{token: "spring", code: codes.OK},
+		{code: codes.InvalidArgument},
+		{code: codes.AlreadyExists},
+		{code: codes.InvalidArgument},
+		{code: codes.InvalidArgument},
+		{token: "t1", existed: true, code: codes.OK},
+		{code: codes.InvalidArgument},
+		{token: "sale", code: codes.OK},
+		{code: codes.InvalidArgument},
+	}, results)
+	assert.Equal(t, hasher.ErrAliasRejected.Error(), responses[5].Message)
+
+	_, attrs, found, err := memory.GetWithAttributes(ctx, "spring")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, storage.Attributes{
+		ExpiresAt: expiresAt, Tags: []string{"promo"}, RedirectCode: http.StatusMovedPermanently,
+	}, attrs)
+	_, attrs, _, err = memory.GetWithAttributes(ctx, "sale")
+	require.NoError(t, err)
+	assert.Equal(t, storage.UTM{Source: "newsletter", Campaign: "spring_sale", Content: "banner"}, attrs.UTM)
+}
+
+func TestBatchCreateShortURLAttributesWithoutAlias(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	require.NoError(t, memory.CreateShortURL(ctx, "https://a.ru", "existing"))
+	client := newClient(t, memory, nil)
+
+	responses := batchCreate(t, client, []*proto.BatchCreateShortURLRequest{
+		{RawFullURL: "https://a.ru", Tags: []string{"promo"}},
+		{RawFullURL: "https://a.ru", Tenant: "acme", RedirectCode: http.StatusMovedPermanently},
+		{RawFullURL: "https://a.ru"},
+	})
+	tokens := make([]string, len(responses))
+	for i, response := range responses {
+		require.Equal(t, uint32(codes.OK), response.Code, response.Message)
+		tokens[i] = response.Token
+	}
+	assert.Equal(t, []string{"t1", "t2", "existing"}, tokens)
+	assert.False(t, responses[0].Existed)
+	assert.True(t, responses[2].Existed)
+
+	for token, attrs := range map[string]storage.Attributes{
+		"t1": {Tags: []string{"promo"}},
+		"t2": {Tenant: "acme", RedirectCode: http.StatusMovedPermanently},
+	} {
+		fullURL, stored, found, err := memory.GetWithAttributes(ctx, token)
+		require.NoError(t, err)
+		require.True(t, found, token)
+		assert.Equal(t, "https://a.ru", fullURL)
+		assert.Equal(t, attrs, stored, token)
+	}
+	_, found, err := memory.GetFullURL(ctx, "")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestBatchCreateShortURLManyBatches(t *testing.T) {
+	memory := inmemory.New()
+	client := newClient(t, memory, nil)
+
+	requests := make([]*proto.BatchCreateShortURLRequest, 3*batchSize+1)
+	for i := range requests {
+		requests[i] = &proto.BatchCreateShortURLRequest{RawFullURL: fmt.Sprintf("https://%d.ru", i)}
+	}
+	responses := batchCreate(t, client, requests)
+
+	tokens := make(map[string]bool, len(responses))
+	for i, response := range responses {
+		require.Equal(t, uint32(codes.OK), response.Code, response.Message)
+		require.False(t, tokens[response.Token])
+		tokens[response.Token] = true
+		fullURL, found, err := memory.GetFullURL(context.Background(), response.Token)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, requests[i].RawFullURL, fullURL)
+	}
+}
@@ -7,17 +7,26 @@ import (
 	"time"
 
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
+	"github.com/ilyakharev/url-short/internal/clicks"
 	"github.com/ilyakharev/url-short/internal/hasher"
 	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/tokenpool"
 	"github.com/ilyakharev/url-short/proto"
 )
 
 type GrpcHandler struct {
 	proto.UnimplementedGrpcHandlerServer
 	storage storage.Storager
-	hasher  hasher.Hasher
-	logger  *zap.Logger
+	tokens  tokenpool.Source
+	filter  *hasher.Filter
+	// hub gets a click for every found link, nil when clicks are not
+	// watched.
+	hub    *clicks.Hub
+	logger *zap.Logger
 }
 
 func (handler GrpcHandler) CreateShortURL(ctx context.Context,
@@ -36,35 +45,55 @@ func (handler GrpcHandler) CreateShortURL(ctx context.Context,
 		handler.logger.Error("error on check URL:", zap.Error(err))
 		return nil, err
 	}
-
-	token, exists, err := handler.storage.AlreadyExists(ctx, request.RawFullURL)
+	var attrs storage.Attributes
+	if request.Tenant != "" {
+		err = storage.CheckTenant(request.Tenant)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		attrs.Tenant = request.Tenant
+	}
+	err = parseOptions(request, &attrs)
 	if err != nil {
-		handler.logger.Error("error on check URL on exists:", zap.Error(err))
 		return nil, err
 	}
-	if exists {
-		return &proto.CreateShortURLResponse{
-			Token: token,
-		}, nil
+	err = handler.applyCampaign(ctx, request.Campaign, &attrs)
+	if err != nil {
+		return nil, err
 	}
-	exists = true
-	for exists {
-		token, err = handler.hasher.GenerateToken()
+
+	// A link with attributes is not shared with the existing link to the
+	// same URL, which may have other ones.
+	if attrs.IsZero() {
+		token, exists, err := handler.storage.AlreadyExists(ctx, request.RawFullURL)
 		if err != nil {
-			handler.logger.Error("error on generate expectToken:", zap.Error(err))
-			return nil, err
+			handler.logger.Error("error on check URL on exists:", zap.Error(err))
+			return nil, storageError(err)
 		}
-		_, exists, err = handler.storage.GetFullURL(ctx, token)
-		if err != nil {
-			handler.logger.Error("error on check URL:", zap.Error(err))
-			return nil, err
+		if exists {
+			return &proto.CreateShortURLResponse{
+				Token: token,
+			}, nil
 		}
 	}
-	err = handler.storage.CreateShortURL(ctx, request.RawFullURL, token)
+	token, err := handler.tokens.Token(ctx, request.RawFullURL)
+	if errors.Is(err, tokenpool.ErrKeyspaceExhausted) {
+		handler.logger.Error("error on generate expectToken:", zap.Error(err))
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
 	if err != nil {
-		handler.logger.Error("error on save expectToken:", zap.Error(err))
+		handler.logger.Error("error on generate expectToken:", zap.Error(err))
 		return nil, err
 	}
+	err = storage.CreateLink(ctx, handler.storage,
+		&storage.NewLink{Token: token, FullURL: request.RawFullURL, Attributes: attrs})
+	if errors.Is(err, storage.ErrNoAttributes) {
+		return nil, status.Error(codes.FailedPrecondition, "link options are not supported by storage")
+	}
+	if err != nil {
+		handler.logger.Error("error on save expectToken:", zap.Error(err))
+		return nil, storageError(err)
+	}
 	return &proto.CreateShortURLResponse{
 		Token: token,
 	}, nil
@@ -77,25 +106,117 @@ func (handler GrpcHandler) GetFullURL(ctx context.Context,
 		"GetFullURL grpc request",
 		zap.Any("raw_token", request.RawToken),
 	)
-	fullURL, ok, err := handler.storage.GetFullURL(ctx, request.RawToken)
+	fullURL, attrs, ok, err := storage.GetLink(ctx, handler.storage, request.RawToken)
 	if err != nil {
 		handler.logger.Error("error on get full URL:", zap.Error(err))
-		return nil, err
+		return nil, storageError(err)
 	}
 	if !ok {
+		if reporter, canReport := storage.As[storage.EvictionReporter](handler.storage); canReport {
+			evicted, err := reporter.Evicted(ctx, request.RawToken)
+			if err != nil {
+				handler.logger.Error("error on check eviction:", zap.Error(err))
+			}
+			if evicted {
+				return nil, status.Error(codes.NotFound, "link was evicted")
+			}
+		}
 		return nil, errors.New("not found")
 	}
+	now := time.Now()
+	if attrs.Expired(now) {
+		return nil, status.Error(codes.NotFound, "link has expired")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	handler.hub.Publish(clicks.NewEvent(now, request.RawToken, attrs.Tenant,
+		firstValue(md, "referer"), firstValue(md, "user-agent")))
 	return &proto.GetFullURLResponse{
 		FullURL: fullURL,
 	}, nil
 }
 
-func New(storage storage.Storager, hasher hasher.Hasher,
-	logger *zap.Logger,
+// linkOptions are the options of the requests creating links.
+type linkOptions interface {
+	GetRedirectCode() uint32
+	GetQueryPassthrough() string
+	GetPathPassthrough() bool
+	GetUtm() *proto.UTM
+}
+
+// parseOptions checks the options of request and sets them to attrs.
+func parseOptions(request linkOptions, attrs *storage.Attributes) error {
+	code := int(request.GetRedirectCode())
+	if storage.CheckRedirectCode(code) != nil {
+		return status.Error(codes.InvalidArgument, storage.ErrInvalidRedirectCode.Error())
+	}
+	err := storage.CheckQueryPassthrough(request.GetQueryPassthrough())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	attrs.RedirectCode = code
+	attrs.QueryPassthrough = request.GetQueryPassthrough()
+	attrs.PathPassthrough = request.GetPathPassthrough()
+	utm := request.GetUtm()
+	attrs.UTM = storage.UTM{
+		Source:   utm.GetSource(),
+		Medium:   utm.GetMedium(),
+		Campaign: utm.GetCampaign(),
+		Term:     utm.GetTerm(),
+		Content:  utm.GetContent(),
+	}
+	err = storage.CheckUTM(attrs.UTM)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return nil
+}
+
+// applyCampaign fills the UTM parameters of attrs not set by the request
+// from the campaign template of the tenant, nothing when campaign is empty.
+func (handler GrpcHandler) applyCampaign(ctx context.Context, campaign string, attrs *storage.Attributes) error {
+	if campaign == "" {
+		return nil
+	}
+	template, err := storage.CampaignUTM(ctx, handler.storage, attrs.Tenant, campaign)
+	switch {
+	case errors.Is(err, storage.ErrUnknownCampaign), errors.Is(err, storage.ErrCampaignWithoutTenant):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, storage.ErrNoCampaigns):
+		return status.Error(codes.FailedPrecondition, "campaign templates are not supported by storage")
+	case err != nil:
+		return storageError(err)
+	}
+	attrs.UTM = attrs.UTM.Merge(template)
+	return nil
+}
+
+// storageError asks to retry later when the storage has lost its backend,
+// and rejects the request for a link too large to be stored.
+func storageError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrUnavailable):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, storage.ErrLinkTooLarge):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return err
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func New(storage storage.Storager, tokens tokenpool.Source, filter *hasher.Filter,
+	hub *clicks.Hub, logger *zap.Logger,
 ) *GrpcHandler {
 	return &GrpcHandler{
 		storage: storage,
-		hasher:  hasher,
+		tokens:  tokens,
+		filter:  filter,
+		hub:     hub,
 		logger:  logger,
 	}
 }
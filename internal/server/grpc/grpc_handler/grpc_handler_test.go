@@ -3,14 +3,22 @@ package grpchandler
 import (
 	"context"
 	"errors"
+	"net/http"
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
-	mock_hasher "github.com/ilyakharev/url-short/internal/hasher/mock"
+	"github.com/ilyakharev/url-short/internal/storage"
 	"github.com/ilyakharev/url-short/internal/storage/inmemory"
 	mock_storage "github.com/ilyakharev/url-short/internal/storage/mock"
+	"github.com/ilyakharev/url-short/internal/tokenpool"
+	mock_tokenpool "github.com/ilyakharev/url-short/internal/tokenpool/mock"
 	"github.com/ilyakharev/url-short/proto"
 )
 
@@ -70,19 +78,6 @@ func TestSaveHandler(t *testing.T) {
 				mockMemory.EXPECT().AlreadyExists(gomock.Any(), gomock.Any()).Return("", false, errors.New("some"))
 			},
 		},
-		{
-			name:        "Check get error in storager GetFullURL",
-			expectErr:   true,
-			failStorage: true,
-			hashToken:   "0123456789",
-			request: &proto.CreateShortURLRequest{
-				RawFullURL: "http://wro.ng",
-			},
-			prepareMock: func(ctx context.Context, mockMemory *mock_storage.MockStorager) {
-				mockMemory.EXPECT().AlreadyExists(gomock.Any(), gomock.Any()).Return("", false, nil)
-				mockMemory.EXPECT().GetFullURL(gomock.Any(), gomock.Any()).Return("", false, errors.New("some"))
-			},
-		},
 		{
 			name:        "Check get error in storager CreateShortURL",
 			expectErr:   true,
@@ -93,7 +88,6 @@ func TestSaveHandler(t *testing.T) {
 			},
 			prepareMock: func(ctx context.Context, mockMemory *mock_storage.MockStorager) {
 				mockMemory.EXPECT().AlreadyExists(gomock.Any(), gomock.Any()).Return("", false, nil)
-				mockMemory.EXPECT().GetFullURL(gomock.Any(), gomock.Any()).Return("", false, nil)
 				mockMemory.EXPECT().CreateShortURL(gomock.Any(), gomock.Any(),
 					gomock.Any()).Return(errors.New("some"))
 			},
@@ -104,20 +98,20 @@ func TestSaveHandler(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			ctx := context.Background()
 			ctrl := gomock.NewController(t)
-			hasher := mock_hasher.NewMockHasher(ctrl)
+			tokens := mock_tokenpool.NewMockSource(ctrl)
 			if tc.failHash {
-				hasher.EXPECT().GenerateToken().Return("", errors.New("any")).AnyTimes()
+				tokens.EXPECT().Token(gomock.Any(), gomock.Any()).Return("", errors.New("any")).AnyTimes()
 			} else {
-				hasher.EXPECT().GenerateToken().Return(tc.hashToken, nil).AnyTimes()
+				tokens.EXPECT().Token(gomock.Any(), gomock.Any()).Return(tc.hashToken, nil).AnyTimes()
 			}
 
 			var handler *GrpcHandler
 			if tc.failStorage {
 				mockMemory := mock_storage.NewMockStorager(ctrl)
 				tc.prepareMock(ctx, mockMemory)
-				handler = New(mockMemory, hasher, zap.NewNop())
+				handler = New(mockMemory, tokens, nil, nil, zap.NewNop())
 			} else {
-				handler = New(memory, hasher, zap.NewNop())
+				handler = New(memory, tokens, nil, nil, zap.NewNop())
 			}
 
 			res, err := handler.CreateShortURL(ctx, tc.request)
@@ -134,6 +128,82 @@ func TestSaveHandler(t *testing.T) {
 	}
 }
 
+func TestKeyspaceExhausted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	tokens := mock_tokenpool.NewMockSource(ctrl)
+	tokens.EXPECT().Token(gomock.Any(), gomock.Any()).Return("", tokenpool.ErrKeyspaceExhausted)
+	handler := New(inmemory.New(), tokens, nil, nil, zap.NewNop())
+
+	_, err := handler.CreateShortURL(context.Background(),
+		&proto.CreateShortURLRequest{RawFullURL: "http://ya.ru"})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("handler returned wrong code: got %v want %v",
+			status.Code(err), codes.ResourceExhausted)
+	}
+}
+
+func TestCreateWithOptions(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	require.NoError(t, memory.CreateShortURL(ctx, "http://ya.ru", "existing"))
+	ctrl := gomock.NewController(t)
+	tokens := mock_tokenpool.NewMockSource(ctrl)
+	handler := New(memory, tokens, nil, nil, zap.NewNop())
+
+	_, err := handler.CreateShortURL(ctx,
+		&proto.CreateShortURLRequest{RawFullURL: "http://ya.ru", RedirectCode: http.StatusNotModified})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = handler.CreateShortURL(ctx,
+		&proto.CreateShortURLRequest{RawFullURL: "http://ya.ru", QueryPassthrough: "merge"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	tokens.EXPECT().Token(gomock.Any(), "http://ya.ru").Return("new", nil)
+	res, err := handler.CreateShortURL(ctx, &proto.CreateShortURLRequest{
+		RawFullURL: "http://ya.ru", RedirectCode: http.StatusTemporaryRedirect,
+		QueryPassthrough: storage.QueryOverride, PathPassthrough: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "new", res.Token, "a link with options is not shared with the existing one")
+	_, attrs, found, err := memory.GetWithAttributes(ctx, "new")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, storage.Attributes{
+		RedirectCode: http.StatusTemporaryRedirect, QueryPassthrough: storage.QueryOverride, PathPassthrough: true,
+	}, attrs)
+}
+
+func TestCreateWithUTM(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	require.NoError(t, memory.SaveCampaign(ctx, &storage.Campaign{Tenant: "acme", Name: "spring",
+		UTM: storage.UTM{Source: "newsletter", Medium: "email", Campaign: "spring_sale"}}))
+	ctrl := gomock.NewController(t)
+	tokens := mock_tokenpool.NewMockSource(ctrl)
+	handler := New(memory, tokens, nil, nil, zap.NewNop())
+
+	for _, request := range []*proto.CreateShortURLRequest{
+		{RawFullURL: "http://ya.ru", Campaign: "spring"},
+		{RawFullURL: "http://ya.ru", Tenant: "acme", Campaign: "winter"},
+		{RawFullURL: "http://ya.ru", Tenant: "not a tenant"},
+		{RawFullURL: "http://ya.ru", Utm: &proto.UTM{Term: strings.Repeat("x", storage.MaxUTMLength+1)}},
+	} {
+		_, err := handler.CreateShortURL(ctx, request)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), request.String())
+	}
+
+	tokens.EXPECT().Token(gomock.Any(), "http://ya.ru").Return("new", nil)
+	_, err := handler.CreateShortURL(ctx, &proto.CreateShortURLRequest{
+		RawFullURL: "http://ya.ru", Tenant: "acme", Campaign: "spring", Utm: &proto.UTM{Medium: "sms"},
+	})
+	require.NoError(t, err)
+	_, attrs, found, err := memory.GetWithAttributes(ctx, "new")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, storage.Attributes{Tenant: "acme", UTM: storage.UTM{
+		Source: "newsletter", Medium: "sms", Campaign: "spring_sale",
+	}}, attrs)
+}
+
 func TestGetFullURL(t *testing.T) {
 	cases := []*struct {
 		name        string
@@ -170,15 +240,15 @@ func TestGetFullURL(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
-			hasher := mock_hasher.NewMockHasher(ctrl)
+			tokens := mock_tokenpool.NewMockSource(ctrl)
 
 			var handler *GrpcHandler
 			if tc.failStorage {
 				mockMemory := mock_storage.NewMockStorager(ctrl)
 				tc.prepareMock(ctx, mockMemory)
-				handler = New(mockMemory, hasher, zap.NewNop())
+				handler = New(mockMemory, tokens, nil, nil, zap.NewNop())
 			} else {
-				handler = New(memory, hasher, zap.NewNop())
+				handler = New(memory, tokens, nil, nil, zap.NewNop())
 			}
 
 			res, err := handler.GetFullURL(ctx, tc.request)
@@ -0,0 +1,68 @@
+package grpchandler
+
+import (
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/ilyakharev/url-short/internal/clicks"
+	"github.com/ilyakharev/url-short/proto"
+)
+
+// watchBuffer is how many clicks wait to be sent to a watcher before the
+// next ones are dropped.
+const watchBuffer = 256
+
+// keepaliveInterval is how long a watcher waits for a click before a
+// keepalive is sent, so that proxies do not close an idle stream.
+var keepaliveInterval = 15 * time.Second
+
+// WatchClicks streams the clicks matching request until the client leaves
+// or the hub is closed on shutdown.
+func (handler GrpcHandler) WatchClicks(request *proto.WatchClicksRequest,
+	stream proto.GrpcHandler_WatchClicksServer,
+) error {
+	if request.SampleRate < 0 || request.SampleRate > 1 {
+		return status.Error(codes.InvalidArgument, "sampleRate must be from 0 to 1")
+	}
+	if handler.hub == nil {
+		return status.Error(codes.Unimplemented, "clicks are not published")
+	}
+	subscription := handler.hub.Subscribe(clicks.Filter{
+		Token:      request.Token,
+		Tenant:     request.Tenant,
+		SampleRate: request.SampleRate,
+	}, watchBuffer)
+	defer subscription.Close()
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+	for {
+		response := &proto.WatchClicksResponse{}
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return nil
+			}
+			response.Message = &proto.WatchClicksResponse_Click{Click: &proto.ClickEvent{
+				Timestamp:      timestamppb.New(event.Time),
+				Token:          event.Token,
+				Tenant:         event.Tenant,
+				ReferrerHost:   event.ReferrerHost,
+				UserAgentClass: event.UserAgentClass,
+			}}
+			keepalive.Reset(keepaliveInterval)
+		case now := <-keepalive.C:
+			response.Message = &proto.WatchClicksResponse_Keepalive{Keepalive: timestamppb.New(now)}
+		}
+		response.Dropped = subscription.Dropped()
+		err := stream.Send(response)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package grpchandler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/ilyakharev/url-short/internal/clicks"
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+	"github.com/ilyakharev/url-short/proto"
+)
+
+func TestWatchClicks(t *testing.T) {
+	defer func(interval time.Duration) {
+		keepaliveInterval = interval
+	}(keepaliveInterval)
+	keepaliveInterval = 10 * time.Millisecond
+
+	ctx := context.Background()
+	memory := inmemory.New()
+	require.NoError(t, memory.CreateShortURL(ctx, "https://a.ru", "a"))
+	require.NoError(t, memory.CreateWithAttributes(ctx, "https://b.ru", "b", storage.Attributes{Tenant: "acme"}))
+	hub := clicks.NewHub(0)
+	client := newClient(t, memory, hub)
+
+	stream, err := client.WatchClicks(ctx, &proto.WatchClicksRequest{SampleRate: 2})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	stream, err = client.WatchClicks(ctx, &proto.WatchClicksRequest{Tenant: "acme"})
+	require.NoError(t, err)
+	// A keepalive shows that the watcher is subscribed.
+	response, err := stream.Recv()
+	require.NoError(t, err)
+	require.NotNil(t, response.GetKeepalive())
+
+	redirectCtx := metadata.AppendToOutgoingContext(ctx, "referer", "https://news.example.com/item")
+	for _, token := range []string{"a", "b"} {
+		_, err = client.GetFullURL(redirectCtx, &proto.GetFullURLRequest{RawToken: token})
+		require.NoError(t, err)
+	}
+	for {
+		response, err = stream.Recv()
+		require.NoError(t, err)
+		if response.GetClick() != nil {
+			break
+		}
+	}
+	click := response.GetClick()
+	assert.Equal(t, "b", click.Token)
+	assert.Equal(t, "acme", click.Tenant)
+	assert.Equal(t, "news.example.com", click.ReferrerHost)
+	// The user agent of a gRPC client is grpc-go.
+	assert.Equal(t, clicks.UserAgentOther, click.UserAgentClass)
+	assert.WithinDuration(t, time.Now(), click.Timestamp.AsTime(), time.Minute)
+
+	hub.Close()
+	for {
+		_, err = stream.Recv()
+		if err != nil {
+			break
+		}
+	}
+	assert.True(t, errors.Is(err, io.EOF), err)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net"
 	"net/http"
+	"time"
 
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
@@ -12,6 +13,9 @@ import (
 	api "github.com/ilyakharev/url-short/proto"
 )
 
+// shutdownTimeout is how long a graceful stop waits for running calls.
+const shutdownTimeout = time.Minute
+
 type GrpcServer struct {
 	port   string
 	server *grpc.Server
@@ -44,7 +48,17 @@ func (server *GrpcServer) Run(ctx context.Context) error {
 
 		server.logger.Info("Shutting down server gracefully")
 
-		server.server.GracefulStop()
+		stopped := make(chan struct{})
+		go func() {
+			server.server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(shutdownTimeout):
+			server.logger.Warn("Streams did not finish, closing them")
+			server.server.Stop()
+		}
 
 		return nil
 	}
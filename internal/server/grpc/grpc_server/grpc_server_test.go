@@ -9,17 +9,17 @@ import (
 	"go.uber.org/mock/gomock"
 	"go.uber.org/zap"
 
-	mock_hasher "github.com/ilyakharev/url-short/internal/hasher/mock"
 	grpchandler "github.com/ilyakharev/url-short/internal/server/grpc/grpc_handler"
 	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+	mock_tokenpool "github.com/ilyakharev/url-short/internal/tokenpool/mock"
 )
 
 func TestServer(t *testing.T) {
 	t.Run("Create server", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
-		hasher := mock_hasher.NewMockHasher(ctrl)
+		tokens := mock_tokenpool.NewMockSource(ctrl)
 		memory := inmemory.New()
-		handler := grpchandler.New(memory, hasher, zap.NewNop())
+		handler := grpchandler.New(memory, tokens, nil, nil, zap.NewNop())
 		srv := New("81", handler, zap.NewNop())
 		ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
 		defer cancel()
@@ -0,0 +1,481 @@
+package httphandler
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/tokenpool"
+)
+
+const (
+	maxBulkBody = 16 << 20
+	maxBulkRows = 10_000
+	// bulkBatchSize is how many links are written in one storage transaction.
+	bulkBatchSize = 500
+	bulkTimeout   = time.Minute
+
+	// tagSeparator separates tags in a CSV cell.
+	tagSeparator = ";"
+)
+
+const (
+	statusCreated = "created"
+	statusExists  = "exists"
+	statusFailed  = "failed"
+)
+
+var bulkColumns = []string{
+	"url", "alias", "expiry", "tags", "tenant", "redirect", "query_passthrough", "path_passthrough",
+	"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content", "campaign",
+}
+
+// bulkRow is a link to create. Expiry is an RFC 3339 time or a duration
+// from now, like 720h.
+type bulkRow struct {
+	URL    string   `json:"url"`
+	Alias  string   `json:"alias,omitempty"`
+	Expiry string   `json:"expiry,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	Tenant string   `json:"tenant,omitempty"`
+	// Redirect is the redirect code of the link, empty for the default.
+	Redirect         json.Number `json:"redirect,omitempty"`
+	QueryPassthrough string      `json:"query_passthrough,omitempty"`
+	PathPassthrough  bool        `json:"path_passthrough,omitempty"`
+	UTM              storage.UTM `json:"utm,omitempty"`
+	// Campaign is the template of tenant the UTM parameters not set in the
+	// row are taken from.
+	Campaign string `json:"campaign,omitempty"`
+	// err is the error of reading a CSV row, reported as its result.
+	err error
+}
+
+type bulkResult struct {
+	// Row is the number of the row in the request, starting from 1.
+	Row    int    `json:"row"`
+	URL    string `json:"url"`
+	Token  string `json:"token,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type bulkResponse struct {
+	Created int          `json:"created"`
+	Exists  int          `json:"exists"`
+	Failed  int          `json:"failed"`
+	Results []bulkResult `json:"results"`
+}
+
+// BulkCreate creates links from a JSON array or a CSV file with the url,
+// alias, expiry, tags, tenant, redirect, query_passthrough,
+// path_passthrough, utm_ and campaign columns, uploaded as the body or as the "file" field of
+// a form. A row that fails does not stop the others, the result of every
+// row is returned as JSON, or as CSV when asked by Accept or ?format=csv.
+func (handler *HTTPHandler) BulkCreate(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), bulkTimeout)
+	defer cancel()
+
+	handler.logger.Debug(
+		"BulkCreate http request",
+		zap.Any("address", request.RemoteAddr),
+		zap.Any("method", request.Method),
+		zap.Any("url", request.URL),
+	)
+
+	if request.Method != http.MethodPost {
+		writer.Header().Add("Content-Type", "application/json")
+		handler.sendResponse(http.StatusMethodNotAllowed, writer, "Method is not allowed")
+		return
+	}
+	request.Body = http.MaxBytesReader(writer, request.Body, maxBulkBody)
+	rows, err := readBulkRows(request)
+	if err != nil {
+		writer.Header().Add("Content-Type", "application/json")
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			handler.sendResponse(http.StatusRequestEntityTooLarge, writer, "Request body is too large")
+		case errors.Is(err, errUnsupportedMediaType):
+			handler.sendResponse(http.StatusUnsupportedMediaType, writer, err.Error())
+		default:
+			handler.sendResponse(http.StatusBadRequest, writer, err.Error())
+		}
+		return
+	}
+
+	results := handler.createRows(ctx, rows)
+	if wantsCSV(request) {
+		handler.writeCSVResults(writer, results)
+		return
+	}
+	response := bulkResponse{Results: results}
+	for i := range results {
+		switch results[i].Status {
+		case statusCreated:
+			response.Created++
+		case statusExists:
+			response.Exists++
+		default:
+			response.Failed++
+		}
+	}
+	writer.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(writer).Encode(response)
+	if err != nil {
+		handler.logger.Error("error while write response", zap.Error(err))
+	}
+}
+
+var errUnsupportedMediaType = errors.New("content type must be application/json, text/csv or multipart/form-data")
+
+func readBulkRows(request *http.Request) (rows []bulkRow, err error) {
+	contentType := request.Header.Get("Content-Type")
+	mediaType := "application/json"
+	if contentType != "" {
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, errUnsupportedMediaType
+		}
+	}
+	switch mediaType {
+	case "application/json":
+		err = json.NewDecoder(request.Body).Decode(&rows)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	case "text/csv":
+		rows, err = readCSVRows(request.Body)
+	case "multipart/form-data":
+		var file io.ReadCloser
+		file, _, err = request.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("form has no file: %w", err)
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		rows, err = readCSVRows(file)
+	default:
+		return nil, errUnsupportedMediaType
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("no rows")
+	}
+	if len(rows) > maxBulkRows {
+		return nil, fmt.Errorf("more than %d rows", maxBulkRows)
+	}
+	return rows, nil
+}
+
+// readCSVRows reads rows after a header naming the columns, in any order.
+func readCSVRows(r io.Reader) ([]bulkRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("no rows")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(bulkColumns, name) {
+			return nil, fmt.Errorf("unknown column %q, columns are %s", name, strings.Join(bulkColumns, ", "))
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, errors.New("no url column")
+	}
+
+	var rows []bulkRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if len(rows) == maxBulkRows {
+			return nil, fmt.Errorf("more than %d rows", maxBulkRows)
+		}
+		cell := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row := bulkRow{URL: cell("url"), Alias: cell("alias"), Expiry: cell("expiry"), Tenant: cell("tenant"),
+			Redirect: json.Number(cell("redirect"))}
+		if tags := cell("tags"); tags != "" {
+			row.Tags = strings.Split(tags, tagSeparator)
+		}
+		row.QueryPassthrough = cell("query_passthrough")
+		row.UTM = storage.UTM{Source: cell("utm_source"), Medium: cell("utm_medium"),
+			Campaign: cell("utm_campaign"), Term: cell("utm_term"), Content: cell("utm_content")}
+		row.Campaign = cell("campaign")
+		if path := cell("path_passthrough"); path != "" {
+			row.PathPassthrough, err = strconv.ParseBool(path)
+			if err != nil {
+				row.err = errors.New("path_passthrough must be true or false")
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// createRows creates links of valid rows in batches. Rows without alias and
+// attributes reuse the token of an existing link to the same URL, like
+// CreateShortURL does.
+func (handler *HTTPHandler) createRows(ctx context.Context, rows []bulkRow) []bulkResult {
+	results := make([]bulkResult, len(rows))
+	links := make([]storage.NewLink, 0, min(len(rows), bulkBatchSize))
+	// indexes[i] is the row of links[i].
+	indexes := make([]int, 0, cap(links))
+	// firstRow maps a URL to the row that creates it, duplicateOf maps the
+	// later rows of the same URL to that row.
+	firstRow := make(map[string]int)
+	duplicateOf := make(map[int]int)
+	templates := make(map[campaignKey]campaignTemplate)
+
+	flush := func() {
+		errs, err := storage.CreateLinks(ctx, handler.storager, links)
+		for i, index := range indexes {
+			rowErr := err
+			if rowErr == nil {
+				rowErr = errs[i]
+			}
+			switch {
+			case rowErr == nil:
+				results[index].Status = statusCreated
+			case errors.Is(rowErr, storage.ErrTokenExists) && rows[index].Alias == "":
+				results[index].fail(errors.New("generated token is taken, retry the row"))
+			default:
+				results[index].fail(handler.rowError(rowErr))
+			}
+		}
+		links, indexes = links[:0], indexes[:0]
+	}
+
+	for i := range rows {
+		row := &rows[i]
+		result := &results[i]
+		result.Row, result.URL = i+1, row.URL
+
+		link, err := handler.parseRow(row)
+		if err != nil {
+			result.fail(err)
+			continue
+		}
+		if row.Campaign != "" {
+			key := campaignKey{tenant: row.Tenant, name: row.Campaign}
+			template, ok := templates[key]
+			if !ok {
+				template.utm, template.err = storage.CampaignUTM(ctx, handler.storager, key.tenant, key.name)
+				templates[key] = template
+			}
+			if template.err != nil {
+				result.fail(handler.rowError(template.err))
+				continue
+			}
+			link.Attributes.UTM = link.Attributes.UTM.Merge(template.utm)
+		}
+		if row.Alias == "" {
+			shared := link.Attributes.IsZero()
+			if shared {
+				if first, ok := firstRow[row.URL]; ok {
+					duplicateOf[i] = first
+					continue
+				}
+				token, exists, err := handler.storager.AlreadyExists(ctx, row.URL)
+				if err != nil {
+					result.fail(handler.rowError(err))
+					continue
+				}
+				if exists {
+					result.Token, result.Status = token, statusExists
+					continue
+				}
+			}
+			link.Token, err = handler.tokens.Token(ctx, row.URL)
+			if err != nil {
+				result.fail(handler.rowError(err))
+				continue
+			}
+			if shared {
+				firstRow[row.URL] = i
+			}
+		}
+
+		result.Token = link.Token
+		links = append(links, link)
+		indexes = append(indexes, i)
+		if len(links) == bulkBatchSize {
+			flush()
+		}
+	}
+	if len(links) > 0 {
+		flush()
+	}
+
+	for i, first := range duplicateOf {
+		results[i].Token = results[first].Token
+		results[i].Status, results[i].Error = results[first].Status, results[first].Error
+		if results[i].Status == statusCreated {
+			results[i].Status = statusExists
+		}
+	}
+	return results
+}
+
+// parseRow validates row. The token of a row without alias is left empty.
+func (handler *HTTPHandler) parseRow(row *bulkRow) (link storage.NewLink, err error) {
+	if row.err != nil {
+		return storage.NewLink{}, row.err
+	}
+	_, err = url.ParseRequestURI(row.URL)
+	if err != nil {
+		return storage.NewLink{}, errors.New("invalid URL")
+	}
+	link.FullURL = row.URL
+	if row.Alias != "" {
+		err = handler.filter.CheckAlias(row.Alias)
+		if err != nil {
+			return storage.NewLink{}, err
+		}
+		link.Token = row.Alias
+	}
+	if row.Expiry != "" {
+		link.Attributes.ExpiresAt, err = parseExpiry(row.Expiry, time.Now())
+		if err != nil {
+			return storage.NewLink{}, err
+		}
+	}
+	link.Attributes.Tags, err = storage.NormalizeTags(row.Tags)
+	if err != nil {
+		return storage.NewLink{}, err
+	}
+	if row.Tenant != "" {
+		err = storage.CheckTenant(row.Tenant)
+		if err != nil {
+			return storage.NewLink{}, err
+		}
+		link.Attributes.Tenant = row.Tenant
+	}
+	if row.Redirect != "" {
+		link.Attributes.RedirectCode, err = strconv.Atoi(row.Redirect.String())
+		if err != nil || storage.CheckRedirectCode(link.Attributes.RedirectCode) != nil {
+			return storage.NewLink{}, storage.ErrInvalidRedirectCode
+		}
+	}
+	err = storage.CheckQueryPassthrough(row.QueryPassthrough)
+	if err != nil {
+		return storage.NewLink{}, err
+	}
+	link.Attributes.QueryPassthrough = row.QueryPassthrough
+	link.Attributes.PathPassthrough = row.PathPassthrough
+	err = storage.CheckUTM(row.UTM)
+	if err != nil {
+		return storage.NewLink{}, err
+	}
+	link.Attributes.UTM = row.UTM
+	return link, nil
+}
+
+// campaignKey and campaignTemplate cache the campaign templates used by the
+// rows of one request.
+type campaignKey struct {
+	tenant string
+	name   string
+}
+
+type campaignTemplate struct {
+	utm storage.UTM
+	err error
+}
+
+func parseExpiry(expiry string, now time.Time) (time.Time, error) {
+	expiresAt, err := time.Parse(time.RFC3339, expiry)
+	if err != nil {
+		duration, durationErr := time.ParseDuration(expiry)
+		if durationErr != nil {
+			return time.Time{}, errors.New("expiry must be an RFC 3339 time or a duration")
+		}
+		expiresAt = now.Add(duration)
+	}
+	if !expiresAt.After(now) {
+		return time.Time{}, errors.New("expiry is in the past")
+	}
+	return expiresAt.UTC(), nil
+}
+
+// rowError turns err into the message of a failed row. Unexpected errors
+// are logged and reported without details, they are repeated in every row
+// of a batch.
+func (handler *HTTPHandler) rowError(err error) error {
+	switch {
+	case errors.Is(err, storage.ErrTokenExists):
+		return errors.New("alias is taken")
+	case errors.Is(err, storage.ErrNoAttributes):
+		return errors.New("link attributes are not supported by storage")
+	case errors.Is(err, storage.ErrUnknownCampaign), errors.Is(err, storage.ErrCampaignWithoutTenant),
+		errors.Is(err, storage.ErrNoCampaigns), errors.Is(err, storage.ErrLinkTooLarge):
+		return err
+	case errors.Is(err, storage.ErrUnavailable):
+		return errors.New("storage is unavailable")
+	case errors.Is(err, tokenpool.ErrKeyspaceExhausted):
+		return tokenpool.ErrKeyspaceExhausted
+	case errors.Is(err, context.DeadlineExceeded):
+		return errors.New("request timed out")
+	}
+	handler.logger.Error("error on bulk create", zap.Error(err))
+	return errors.New("internal error")
+}
+
+func (result *bulkResult) fail(err error) {
+	result.Token = ""
+	result.Status, result.Error = statusFailed, err.Error()
+}
+
+func wantsCSV(request *http.Request) bool {
+	if format := request.URL.Query().Get("format"); format != "" {
+		return format == "csv"
+	}
+	return strings.Contains(request.Header.Get("Accept"), "text/csv")
+}
+
+func (handler *HTTPHandler) writeCSVResults(writer http.ResponseWriter, results []bulkResult) {
+	writer.Header().Add("Content-Type", "text/csv; charset=utf-8")
+	writer.Header().Add("Content-Disposition", `attachment; filename="links.csv"`)
+	csvWriter := csv.NewWriter(writer)
+	_ = csvWriter.Write([]string{"row", "url", "token", "status", "error"})
+	for i := range results {
+		result := &results[i]
+		_ = csvWriter.Write([]string{
+			strconv.Itoa(result.Row), result.URL, result.Token, result.Status, result.Error,
+		})
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		handler.logger.Error("error while write response", zap.Error(err))
+	}
+}
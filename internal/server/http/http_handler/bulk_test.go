@@ -0,0 +1,296 @@
+package httphandler
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/hasher"
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+	mock_storage "github.com/ilyakharev/url-short/internal/storage/mock"
+	mock_tokenpool "github.com/ilyakharev/url-short/internal/tokenpool/mock"
+)
+
+// newBulkHandler returns a handler whose generated tokens are "t" and the
+// number of the call.
+func newBulkHandler(t *testing.T, st storage.Storager) *HTTPHandler {
+	ctrl := gomock.NewController(t)
+	tokens := mock_tokenpool.NewMockSource(ctrl)
+	generated := 0
+	tokens.EXPECT().Token(gomock.Any(), gomock.Any()).AnyTimes().
+		DoAndReturn(func(context.Context, string) (string, error) {
+			generated++
+			return "t" + string(rune('0'+generated)), nil
+		})
+	return New(st, tokens, Config{Filter: hasher.NewFilter([]string{"bad"})}, zap.NewNop())
+}
+
+func postBulk(t *testing.T, handler *HTTPHandler, contentType string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "/api/v1/links/bulk",
+		strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	handler.CreateRouter().ServeHTTP(rr, req)
+	return rr
+}
+
+func decodeBulk(t *testing.T, rr *httptest.ResponseRecorder) bulkResponse {
+	t.Helper()
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var response bulkResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return response
+}
+
+func TestBulkCreate(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	require.NoError(t, memory.CreateShortURL(ctx, "https://existing.ru", "existing"))
+	require.NoError(t, memory.CreateShortURL(ctx, "https://taken.ru", "taken"))
+	handler := newBulkHandler(t, memory)
+
+	rr := postBulk(t, handler, "application/json", `[
+		{"url": "https://a.ru"},
+		{"url": "https://existing.ru"},
+		{"url": "https://b.ru", "alias": "spring_sale", "expiry": "2030-01-02T03:04:05Z", "tags": ["promo", " spring "], "tenant": "acme", "redirect": 308},
+		{"url": "not a url"},
+		{"url": "https://c.ru", "alias": "taken"},
+		{"url": "https://d.ru", "alias": "b4d"},
+		{"url": "https://e.ru", "expiry": "-1h"},
+		{"url": "https://a.ru"},
+		{"url": "https://f.ru", "tenant": "not a tenant"},
+		{"url": "https://g.ru", "redirect": 303}
+	]`)
+	response := decodeBulk(t, rr)
+
+	assert.Equal(t, []bulkResult{
+		{Row: 1, URL: "https://a.ru", Token: "t1", Status: statusCreated},
+		{Row: 2, URL: "https://existing.ru", Token: "existing", Status: statusExists},
+		{Row: 3, URL: "https://b.ru", Token: "spring_sale", Status: statusCreated},
+		{Row: 4, URL: "not a url", Status: statusFailed, Error: "invalid URL"},
+		{Row: 5, URL: "https://c.ru", Status: statusFailed, Error: "alias is taken"},
+		{Row: 6, URL: "https://d.ru", Status: statusFailed, Error: hasher.ErrAliasRejected.Error()},
+		{Row: 7, URL: "https://e.ru", Status: statusFailed, Error: "expiry is in the past"},
+		{Row: 8, URL: "https://a.ru", Token: "t1", Status: statusExists},
+		{Row: 9, URL: "https://f.ru", Status: statusFailed, Error: storage.ErrInvalidTenant.Error()},
+		{Row: 10, URL: "https://g.ru", Status: statusFailed, Error: storage.ErrInvalidRedirectCode.Error()},
+	}, response.Results)
+	assert.Equal(t, 2, response.Created)
+	assert.Equal(t, 2, response.Exists)
+	assert.Equal(t, 6, response.Failed)
+
+	_, attrs, found, err := memory.GetWithAttributes(ctx, "spring_sale")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, storage.Attributes{
+		ExpiresAt:    time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tags:         []string{"promo", "spring"},
+		Tenant:       "acme",
+		RedirectCode: http.StatusPermanentRedirect,
+	}, attrs)
+}
+
+func TestBulkCreateAttributesWithoutAlias(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	require.NoError(t, memory.CreateShortURL(ctx, "https://a.ru", "existing"))
+	handler := newBulkHandler(t, memory)
+
+	response := decodeBulk(t, postBulk(t, handler, "application/json", `[
+		{"url": "https://a.ru", "tags": ["promo"]},
+		{"url": "https://a.ru", "tenant": "acme"},
+		{"url": "https://a.ru"}
+	]`))
+	assert.Equal(t, []bulkResult{
+		{Row: 1, URL: "https://a.ru", Token: "t1", Status: statusCreated},
+		{Row: 2, URL: "https://a.ru", Token: "t2", Status: statusCreated},
+		{Row: 3, URL: "https://a.ru", Token: "existing", Status: statusExists},
+	}, response.Results)
+
+	for token, attrs := range map[string]storage.Attributes{
+		"t1": {Tags: []string{"promo"}},
+		"t2": {Tenant: "acme"},
+	} {
+		fullURL, stored, found, err := memory.GetWithAttributes(ctx, token)
+		require.NoError(t, err)
+		require.True(t, found, token)
+		assert.Equal(t, "https://a.ru", fullURL)
+		assert.Equal(t, attrs, stored, token)
+	}
+	_, found, err := memory.GetFullURL(ctx, "")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestBulkCreateCSV(t *testing.T) {
+	handler := newBulkHandler(t, inmemory.New())
+	upload := "tags,url,alias,redirect\n\"promo;spring\",https://a.ru,spring,301\n,https://b.ru,,\n"
+
+	t.Run("body", func(t *testing.T) {
+		response := decodeBulk(t, postBulk(t, handler, "text/csv", upload))
+		assert.Equal(t, 2, response.Created)
+	})
+	t.Run("form file, csv results", func(t *testing.T) {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		file, err := form.CreateFormFile("file", "links.csv")
+		require.NoError(t, err)
+		_, err = file.Write([]byte(strings.ReplaceAll(upload, "spring", "summer")))
+		require.NoError(t, err)
+		require.NoError(t, form.Close())
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost,
+			"/api/v1/links/bulk?format=csv", &body)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rr := httptest.NewRecorder()
+		handler.CreateRouter().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Contains(t, rr.Header().Get("Content-Disposition"), "links.csv")
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"row", "url", "token", "status", "error"},
+			{"1", "https://a.ru", "summer", statusCreated, ""},
+			{"2", "https://b.ru", "t1", statusExists, ""},
+		}, records)
+	})
+	t.Run("bad header", func(t *testing.T) {
+		rr := postBulk(t, handler, "text/csv", "url,owner\nhttps://a.ru,me\n")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestBulkCreatePassthrough(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	handler := newBulkHandler(t, memory)
+	upload := "url,alias,query_passthrough,path_passthrough\n" +
+		"https://a.ru,docs,keep,true\n" +
+		"https://b.ru,,merge,\n" +
+		"https://c.ru,,,maybe\n"
+
+	response := decodeBulk(t, postBulk(t, handler, "text/csv", upload))
+	require.Len(t, response.Results, 3)
+	assert.Equal(t, statusCreated, response.Results[0].Status)
+	assert.Equal(t, storage.ErrInvalidQueryPassthrough.Error(), response.Results[1].Error)
+	assert.Equal(t, "path_passthrough must be true or false", response.Results[2].Error)
+
+	_, attrs, found, err := memory.GetWithAttributes(ctx, "docs")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, storage.Attributes{QueryPassthrough: storage.QueryKeep, PathPassthrough: true}, attrs)
+}
+
+func TestBulkCreateUTM(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	require.NoError(t, memory.SaveCampaign(ctx, &storage.Campaign{Tenant: "acme", Name: "spring",
+		UTM: storage.UTM{Source: "newsletter", Medium: "email", Campaign: "spring_sale"}}))
+	handler := newBulkHandler(t, memory)
+	upload := "url,alias,tenant,campaign,utm_source,utm_content\n" +
+		"https://a.ru,a,acme,spring,,\n" +
+		"https://b.ru,b,acme,spring,ads,banner\n" +
+		"https://c.ru,c,acme,winter,,\n" +
+		"https://d.ru,d,,spring,,\n" +
+		"https://e.ru,e,,,direct,\n"
+
+	response := decodeBulk(t, postBulk(t, handler, "text/csv", upload))
+	require.Len(t, response.Results, 5)
+	assert.Equal(t, 3, response.Created)
+	assert.Equal(t, storage.ErrUnknownCampaign.Error(), response.Results[2].Error)
+	assert.Equal(t, storage.ErrCampaignWithoutTenant.Error(), response.Results[3].Error)
+
+	for token, utm := range map[string]storage.UTM{
+		"a": {Source: "newsletter", Medium: "email", Campaign: "spring_sale"},
+		"b": {Source: "ads", Medium: "email", Campaign: "spring_sale", Content: "banner"},
+		"e": {Source: "direct"},
+	} {
+		_, attrs, found, err := memory.GetWithAttributes(ctx, token)
+		require.NoError(t, err)
+		require.True(t, found, token)
+		assert.Equal(t, utm, attrs.UTM, token)
+	}
+
+	response = decodeBulk(t, postBulk(t, handler, "application/json",
+		`[{"url": "https://f.ru", "alias": "f", "tenant": "acme", "campaign": "spring", "utm": {"term": "shoes"}}]`))
+	require.Equal(t, statusCreated, response.Results[0].Status, response.Results[0].Error)
+	_, attrs, _, err := memory.GetWithAttributes(ctx, "f")
+	require.NoError(t, err)
+	assert.Equal(t, storage.UTM{Source: "newsletter", Medium: "email", Campaign: "spring_sale", Term: "shoes"},
+		attrs.UTM)
+}
+
+func TestBulkCreateErrors(t *testing.T) {
+	cases := []struct {
+		name        string
+		contentType string
+		body        string
+		statusCode  int
+	}{
+		{name: "empty", contentType: "application/json", body: "[]", statusCode: http.StatusBadRequest},
+		{name: "invalid json", contentType: "application/json", body: "{", statusCode: http.StatusBadRequest},
+		{name: "xml", contentType: "application/xml", body: "<links/>", statusCode: http.StatusUnsupportedMediaType},
+		{
+			name:        "too many rows",
+			contentType: "text/csv",
+			body:        "url\n" + strings.Repeat("https://a.ru\n", maxBulkRows+1),
+			statusCode:  http.StatusBadRequest,
+		},
+	}
+	handler := newBulkHandler(t, inmemory.New())
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := postBulk(t, handler, tc.contentType, tc.body)
+			assert.Equal(t, tc.statusCode, rr.Code, rr.Body.String())
+		})
+	}
+}
+
+func TestBulkCreateWithoutAttributes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	st := mock_storage.NewMockStorager(ctrl)
+	st.EXPECT().CreateShortURL(gomock.Any(), "https://a.ru", "alias").Return(nil)
+	handler := newBulkHandler(t, st)
+
+	response := decodeBulk(t, postBulk(t, handler, "application/json", `[
+		{"url": "https://a.ru", "alias": "alias"},
+		{"url": "https://b.ru", "alias": "tagged", "tags": ["promo"]}
+	]`))
+	assert.Equal(t, statusCreated, response.Results[0].Status)
+	assert.Equal(t, "link attributes are not supported by storage", response.Results[1].Error)
+}
+
+func TestExpired(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	require.NoError(t, memory.CreateWithAttributes(ctx, "https://a.ru", "expired",
+		storage.Attributes{ExpiresAt: time.Now().Add(-time.Minute)}))
+	require.NoError(t, memory.CreateWithAttributes(ctx, "https://a.ru", "active",
+		storage.Attributes{ExpiresAt: time.Now().Add(time.Hour)}))
+	handler := newBulkHandler(t, memory)
+
+	for path, code := range map[string]int{"/expired": http.StatusGone, "/active": http.StatusFound} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, http.NoBody)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		handler.CreateRouter().ServeHTTP(rr, req)
+		assert.Equal(t, code, rr.Code, path)
+	}
+}
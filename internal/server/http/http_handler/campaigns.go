@@ -0,0 +1,245 @@
+package httphandler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+const (
+	campaignsPath         = "/api/v1/campaigns"
+	campaignAnalyticsPath = "/api/v1/analytics/campaigns"
+	// maxCampaignBody bounds the body of a saved campaign template.
+	maxCampaignBody = 16 << 10
+)
+
+type campaignRequest struct {
+	Tenant string      `json:"tenant"`
+	Name   string      `json:"name"`
+	UTM    storage.UTM `json:"utm"`
+}
+
+type campaignResponse struct {
+	Tenant    string      `json:"tenant"`
+	Name      string      `json:"name"`
+	UTM       storage.UTM `json:"utm"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+type campaignClicksResponse struct {
+	Campaign string `json:"campaign"`
+	Links    int    `json:"links"`
+	Clicks   int64  `json:"clicks"`
+}
+
+func newCampaignResponse(campaign *storage.Campaign) campaignResponse {
+	return campaignResponse{
+		Tenant:    campaign.Tenant,
+		Name:      campaign.Name,
+		UTM:       campaign.UTM,
+		UpdatedAt: campaign.UpdatedAt,
+	}
+}
+
+// Campaigns saves a campaign template from POST /api/v1/campaigns, replacing
+// the one of the tenant with the same name, and lists the templates of a
+// tenant from GET /api/v1/campaigns?tenant=.
+func (handler *HTTPHandler) Campaigns(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), time.Second)
+	defer cancel()
+
+	handler.logger.Debug(
+		"Campaigns http request",
+		zap.Any("address", request.RemoteAddr),
+		zap.Any("method", request.Method),
+		zap.Any("url", request.URL),
+	)
+
+	writer.Header().Add("Content-Type", "application/json")
+	campaigns, ok := storage.As[storage.CampaignStorer](handler.storager)
+	if !ok {
+		handler.sendResponse(http.StatusNotImplemented, writer, "Campaign templates are not supported by storage")
+		return
+	}
+	switch request.Method {
+	case http.MethodPost:
+		handler.saveCampaign(ctx, writer, request, campaigns)
+	case http.MethodGet:
+		tenant, ok := handler.tenantParam(writer, request)
+		if !ok {
+			return
+		}
+		saved, err := campaigns.Campaigns(ctx, tenant)
+		if err != nil {
+			handler.logger.Error("error on list campaigns", zap.Error(err))
+			handler.sendResponse(storageErrorCode(err), writer, err.Error())
+			return
+		}
+		response := struct {
+			Campaigns []campaignResponse `json:"campaigns"`
+		}{Campaigns: make([]campaignResponse, 0, len(saved))}
+		for i := range saved {
+			response.Campaigns = append(response.Campaigns, newCampaignResponse(&saved[i]))
+		}
+		handler.writeJSON(writer, http.StatusOK, response)
+	default:
+		handler.sendResponse(http.StatusMethodNotAllowed, writer, "Method is not allowed")
+	}
+}
+
+func (handler *HTTPHandler) saveCampaign(ctx context.Context, writer http.ResponseWriter, request *http.Request,
+	campaigns storage.CampaignStorer,
+) {
+	var body campaignRequest
+	err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, maxCampaignBody)).Decode(&body)
+	if err != nil {
+		handler.sendResponse(http.StatusBadRequest, writer, "Invalid JSON: "+err.Error())
+		return
+	}
+	for _, check := range []error{
+		storage.CheckTenant(body.Tenant), storage.CheckCampaignName(body.Name), storage.CheckUTM(body.UTM),
+	} {
+		if check != nil {
+			handler.sendResponse(http.StatusBadRequest, writer, check.Error())
+			return
+		}
+	}
+	if body.UTM.IsZero() {
+		handler.sendResponse(http.StatusBadRequest, writer, "Campaign template sets no UTM parameters")
+		return
+	}
+	campaign := storage.Campaign{Tenant: body.Tenant, Name: body.Name, UTM: body.UTM, UpdatedAt: time.Now().UTC()}
+	err = campaigns.SaveCampaign(ctx, &campaign)
+	if err != nil {
+		handler.logger.Error("error on save campaign", zap.Error(err))
+		handler.sendResponse(storageErrorCode(err), writer, err.Error())
+		return
+	}
+	handler.writeJSON(writer, http.StatusOK, newCampaignResponse(&campaign))
+}
+
+// Campaign returns the campaign template from GET
+// /api/v1/campaigns/{name}?tenant= and deletes it on DELETE.
+func (handler *HTTPHandler) Campaign(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), time.Second)
+	defer cancel()
+
+	handler.logger.Debug(
+		"Campaign http request",
+		zap.Any("address", request.RemoteAddr),
+		zap.Any("method", request.Method),
+		zap.Any("url", request.URL),
+	)
+
+	writer.Header().Add("Content-Type", "application/json")
+	campaigns, ok := storage.As[storage.CampaignStorer](handler.storager)
+	if !ok {
+		handler.sendResponse(http.StatusNotImplemented, writer, "Campaign templates are not supported by storage")
+		return
+	}
+	name := strings.TrimPrefix(request.URL.Path, campaignsPath+"/")
+	if name == "" || strings.Contains(name, "/") {
+		handler.sendResponse(http.StatusNotFound, writer, "Not found")
+		return
+	}
+	if request.Method != http.MethodGet && request.Method != http.MethodDelete {
+		handler.sendResponse(http.StatusMethodNotAllowed, writer, "Method is not allowed")
+		return
+	}
+	tenant, ok := handler.tenantParam(writer, request)
+	if !ok {
+		return
+	}
+
+	if request.Method == http.MethodDelete {
+		found, err := campaigns.DeleteCampaign(ctx, tenant, name)
+		if err != nil {
+			handler.logger.Error("error on delete campaign", zap.Error(err))
+			handler.sendResponse(storageErrorCode(err), writer, err.Error())
+			return
+		}
+		if !found {
+			handler.sendResponse(http.StatusNotFound, writer, "Not found")
+			return
+		}
+		handler.sendResponse(http.StatusOK, writer, "Deleted")
+		return
+	}
+	campaign, found, err := campaigns.Campaign(ctx, tenant, name)
+	if err != nil {
+		handler.logger.Error("error on get campaign", zap.Error(err))
+		handler.sendResponse(storageErrorCode(err), writer, err.Error())
+		return
+	}
+	if !found {
+		handler.sendResponse(http.StatusNotFound, writer, "Not found")
+		return
+	}
+	handler.writeJSON(writer, http.StatusOK, newCampaignResponse(&campaign))
+}
+
+// CampaignClicks returns from GET /api/v1/analytics/campaigns?tenant= the
+// clicks of the links of the tenant grouped by their utm_campaign.
+func (handler *HTTPHandler) CampaignClicks(writer http.ResponseWriter, request *http.Request) {
+	handler.campaignClicks(writer, request, true)
+}
+
+// AllCampaignClicks returns from GET /admin/campaigns the clicks of the links
+// of every tenant grouped by their utm_campaign, or of one with ?tenant=.
+// The rollup spans tenants, so it is only served on the admin router.
+func (handler *HTTPHandler) AllCampaignClicks(writer http.ResponseWriter, request *http.Request) {
+	handler.campaignClicks(writer, request, false)
+}
+
+func (handler *HTTPHandler) campaignClicks(writer http.ResponseWriter, request *http.Request, tenantRequired bool) {
+	ctx, cancel := context.WithTimeout(request.Context(), 10*time.Second)
+	defer cancel()
+
+	handler.logger.Debug(
+		"CampaignClicks http request",
+		zap.Any("address", request.RemoteAddr),
+		zap.Any("method", request.Method),
+		zap.Any("url", request.URL),
+	)
+
+	writer.Header().Add("Content-Type", "application/json")
+	if request.Method != http.MethodGet {
+		handler.sendResponse(http.StatusMethodNotAllowed, writer, "Method is not allowed")
+		return
+	}
+	counter, ok := storage.As[storage.CampaignCounter](handler.storager)
+	if !ok {
+		handler.sendResponse(http.StatusNotImplemented, writer, "Campaign analytics are not supported by storage")
+		return
+	}
+	tenant := request.URL.Query().Get("tenant")
+	if tenant != "" || tenantRequired {
+		tenant, ok = handler.tenantParam(writer, request)
+		if !ok {
+			return
+		}
+	}
+	stats, err := counter.CampaignClicks(ctx, tenant)
+	if err != nil {
+		handler.logger.Error("error on count campaign clicks", zap.Error(err))
+		handler.sendResponse(storageErrorCode(err), writer, err.Error())
+		return
+	}
+	response := struct {
+		Campaigns []campaignClicksResponse `json:"campaigns"`
+	}{Campaigns: make([]campaignClicksResponse, 0, len(stats))}
+	for _, stat := range stats {
+		response.Campaigns = append(response.Campaigns, campaignClicksResponse{
+			Campaign: stat.Campaign,
+			Links:    stat.Links,
+			Clicks:   stat.Clicks,
+		})
+	}
+	handler.writeJSON(writer, http.StatusOK, response)
+}
@@ -0,0 +1,159 @@
+package httphandler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+	mock_storage "github.com/ilyakharev/url-short/internal/storage/mock"
+	mock_tokenpool "github.com/ilyakharev/url-short/internal/tokenpool/mock"
+)
+
+func serveCampaigns(handler *HTTPHandler, method string, path string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler.CreateRouter().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCampaignTemplates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	handler := New(inmemory.New(), mock_tokenpool.NewMockSource(ctrl), Config{}, zap.NewNop())
+
+	for _, body := range []string{
+		`{"tenant":"acme","name":"spring sale","utm":{"source":"x"}}`,
+		`{"name":"spring","utm":{"source":"x"}}`,
+		`{"tenant":"acme","name":"spring","utm":{}}`,
+		`{"tenant":"acme","name":"spring","utm":{"source":"` + strings.Repeat("x", storage.MaxUTMLength+1) + `"}}`,
+		`not json`,
+	} {
+		rr := serveCampaigns(handler, http.MethodPost, "/api/v1/campaigns", body)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+	}
+
+	rr := serveCampaigns(handler, http.MethodPost, "/api/v1/campaigns",
+		`{"tenant":"acme","name":"spring","utm":{"source":"newsletter","medium":"email","campaign":"spring_sale"}}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	rr = serveCampaigns(handler, http.MethodPost, "/api/v1/campaigns",
+		`{"tenant":"acme","name":"autumn","utm":{"campaign":"autumn_sale"}}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	rr = serveCampaigns(handler, http.MethodGet, "/api/v1/campaigns?tenant=acme", "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var listed struct {
+		Campaigns []campaignResponse `json:"campaigns"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+	require.Len(t, listed.Campaigns, 2)
+	assert.Equal(t, "autumn", listed.Campaigns[0].Name)
+	assert.Equal(t, storage.UTM{Source: "newsletter", Medium: "email", Campaign: "spring_sale"},
+		listed.Campaigns[1].UTM)
+
+	rr = serveCampaigns(handler, http.MethodGet, "/api/v1/campaigns/spring?tenant=other", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code, "templates of other tenants are not seen")
+	rr = serveCampaigns(handler, http.MethodGet, "/api/v1/campaigns/spring?tenant=acme", "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Contains(t, rr.Body.String(), `"campaign":"spring_sale"`)
+
+	rr = serveCampaigns(handler, http.MethodDelete, "/api/v1/campaigns/spring?tenant=acme", "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	rr = serveCampaigns(handler, http.MethodDelete, "/api/v1/campaigns/spring?tenant=acme", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestCampaignsNotSupported(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	handler := New(mock_storage.NewMockStorager(ctrl), mock_tokenpool.NewMockSource(ctrl), Config{}, zap.NewNop())
+
+	for _, target := range []string{"/api/v1/campaigns?tenant=acme", "/api/v1/analytics/campaigns?tenant=acme"} {
+		rr := serveCampaigns(handler, http.MethodGet, target, "")
+		assert.Equal(t, http.StatusNotImplemented, rr.Code, target)
+	}
+	rr := serveCampaigns(handler, http.MethodPost, "/create?tenant=acme&campaign=spring", "http://a.ru")
+	assert.Equal(t, http.StatusNotImplemented, rr.Code, rr.Body.String())
+}
+
+func TestCreateWithUTM(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	require.NoError(t, memory.SaveCampaign(ctx, &storage.Campaign{Tenant: "acme", Name: "spring",
+		UTM: storage.UTM{Source: "newsletter", Medium: "email", Campaign: "spring_sale"}}))
+	ctrl := gomock.NewController(t)
+	tokens := mock_tokenpool.NewMockSource(ctrl)
+	handler := New(memory, tokens, Config{}, zap.NewNop())
+
+	for _, query := range []string{"?campaign=spring", "?tenant=acme&campaign=winter",
+		"?utm_source=" + strings.Repeat("x", storage.MaxUTMLength+1)} {
+		rr := serveCampaigns(handler, http.MethodPost, "/create"+query, "http://a.ru")
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+
+	tokens.EXPECT().Token(gomock.Any(), "http://a.ru").Return("a", nil)
+	rr := serveCampaigns(handler, http.MethodPost, "/create?tenant=acme&campaign=spring&utm_source=ads&utm_content=banner",
+		"http://a.ru")
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	_, attrs, found, err := memory.GetWithAttributes(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, storage.Attributes{Tenant: "acme", UTM: storage.UTM{
+		Source: "ads", Medium: "email", Campaign: "spring_sale", Content: "banner",
+	}}, attrs, "parameters of the request override the template")
+
+	rr = serveCampaigns(handler, http.MethodGet, "/a", "")
+	require.Equal(t, http.StatusFound, rr.Code, rr.Body.String())
+	assert.Equal(t, "http://a.ru?utm_campaign=spring_sale&utm_content=banner&utm_medium=email&utm_source=ads",
+		rr.Header().Get("Location"))
+}
+
+func TestCampaignClicks(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	for token, attrs := range map[string]storage.Attributes{
+		"a": {Tenant: "acme", UTM: storage.UTM{Campaign: "spring_sale", Source: "newsletter"}},
+		"b": {Tenant: "acme", UTM: storage.UTM{Campaign: "spring_sale", Source: "ads"}},
+		"c": {Tenant: "other", UTM: storage.UTM{Campaign: "spring_sale"}},
+	} {
+		require.NoError(t, memory.CreateWithAttributes(ctx, "http://"+token+".ru", token, attrs))
+	}
+	for _, token := range []string{"a", "a", "b", "c"} {
+		require.NoError(t, memory.AddClick(ctx, token))
+	}
+	ctrl := gomock.NewController(t)
+	handler := New(memory, mock_tokenpool.NewMockSource(ctrl), Config{}, zap.NewNop())
+
+	rr := serveCampaigns(handler, http.MethodGet, "/api/v1/analytics/campaigns?tenant=acme", "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{"campaigns":[{"campaign":"spring_sale","links":2,"clicks":3}]}`, rr.Body.String())
+
+	rr = serveCampaigns(handler, http.MethodGet, "/api/v1/analytics/campaigns", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "the public route does not sum the clicks of every tenant")
+
+	rr = serveCampaigns(handler, http.MethodGet, "/api/v1/analytics/campaigns?tenant=a/b", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	serveAdmin := func(target string, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, http.NoBody)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.CreateAdminRouter("secret").ServeHTTP(rr, req)
+		return rr
+	}
+	rr = serveAdmin("/admin/campaigns", "secret")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{"campaigns":[{"campaign":"spring_sale","links":3,"clicks":4}]}`, rr.Body.String())
+	rr = serveAdmin("/admin/campaigns?tenant=other", "secret")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{"campaigns":[{"campaign":"spring_sale","links":1,"clicks":1}]}`, rr.Body.String())
+	rr = serveAdmin("/admin/campaigns", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
@@ -0,0 +1,161 @@
+package httphandler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/clicks"
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+const (
+	linksPrefix = "/api/v1/links/"
+	eventsPath  = "/events"
+	// eventsBuffer is how many clicks wait to be sent to a stream before
+	// the next ones are dropped.
+	eventsBuffer = 256
+	// eventsRetry is how long a browser waits before reconnecting.
+	eventsRetry = 3 * time.Second
+)
+
+// eventsKeepalive is how long a stream waits for a click before a comment
+// is sent, so that proxies do not close an idle connection.
+var eventsKeepalive = 15 * time.Second
+
+type clickEvent struct {
+	Time           time.Time `json:"time"`
+	Token          string    `json:"token"`
+	Tenant         string    `json:"tenant,omitempty"`
+	ReferrerHost   string    `json:"referrer_host,omitempty"`
+	UserAgentClass string    `json:"user_agent_class"`
+}
+
+// LinkEvents streams the clicks of a link as Server-Sent Events, from
+// GET /api/v1/links/{token}/events on the admin router. A browser reconnecting with Last-Event-ID first gets the clicks it missed, if
+// the hub still keeps them. Streams end when the server shuts down.
+func (handler *HTTPHandler) LinkEvents(writer http.ResponseWriter, request *http.Request) {
+	handler.logger.Debug(
+		"LinkEvents http request",
+		zap.Any("address", request.RemoteAddr),
+		zap.Any("method", request.Method),
+		zap.Any("url", request.URL),
+	)
+
+	token, ok := strings.CutSuffix(strings.TrimPrefix(request.URL.Path, linksPrefix), eventsPath)
+	if !ok || token == "" || strings.Contains(token, "/") {
+		writer.Header().Add("Content-Type", "application/json")
+		handler.sendResponse(http.StatusNotFound, writer, "Not found")
+		return
+	}
+	if request.Method != http.MethodGet {
+		writer.Header().Add("Content-Type", "application/json")
+		handler.sendResponse(http.StatusMethodNotAllowed, writer, "Method is not allowed")
+		return
+	}
+	flusher, canFlush := writer.(http.Flusher)
+	if handler.hub == nil || !canFlush {
+		writer.Header().Add("Content-Type", "application/json")
+		handler.sendResponse(http.StatusNotImplemented, writer, "Click events are not published")
+		return
+	}
+	var lastID uint64
+	if raw := request.Header.Get("Last-Event-ID"); raw != "" {
+		var err error
+		lastID, err = strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			writer.Header().Add("Content-Type", "application/json")
+			handler.sendResponse(http.StatusBadRequest, writer, "Invalid Last-Event-ID")
+			return
+		}
+	}
+	tenant := request.URL.Query().Get("tenant")
+	code, message := handler.checkLink(request.Context(), token, tenant)
+	if code != http.StatusOK {
+		writer.Header().Add("Content-Type", "application/json")
+		handler.sendResponse(code, writer, message)
+		return
+	}
+
+	subscription, missed := handler.hub.SubscribeAfter(clicks.Filter{Token: token, Tenant: tenant}, eventsBuffer,
+		lastID)
+	defer subscription.Close()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+	_, err := fmt.Fprintf(writer, "retry: %d\n\n", eventsRetry.Milliseconds())
+	for i := 0; err == nil && i < len(missed); i++ {
+		err = writeClick(writer, &missed[i])
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(eventsKeepalive)
+	defer keepalive.Stop()
+	for err == nil {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-handler.closing:
+			return
+		case event, open := <-subscription.Events():
+			if !open {
+				return
+			}
+			err = writeClick(writer, &event)
+			keepalive.Reset(eventsKeepalive)
+		case <-keepalive.C:
+			_, err = fmt.Fprint(writer, ": keepalive\n\n")
+		}
+		flusher.Flush()
+	}
+	handler.logger.Debug("error while write event", zap.Error(err))
+}
+
+// checkLink allows streaming the events of links that exist, expired ones
+// included. The admin token authorizes the request, tenant only scopes it:
+// a link of another tenant, or of none, is answered as an unknown token.
+func (handler *HTTPHandler) checkLink(ctx context.Context, token string, tenant string) (code int, message string) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	_, attrs, found, err := storage.GetLink(ctx, handler.storager, token)
+	if err != nil {
+		handler.logger.Error("error on get link", zap.Error(err))
+		return storageErrorCode(err), err.Error()
+	}
+	if !found || attrs.Tenant != tenant {
+		return http.StatusNotFound, "Not found"
+	}
+	return http.StatusOK, ""
+}
+
+func writeClick(writer http.ResponseWriter, event *clicks.Event) error {
+	data, err := json.Marshal(clickEvent{
+		Time:           event.Time,
+		Token:          event.Token,
+		Tenant:         event.Tenant,
+		ReferrerHost:   event.ReferrerHost,
+		UserAgentClass: event.UserAgentClass,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "id: %d\nevent: click\ndata: %s\n\n", event.ID, data)
+	return err
+}
+
+// CloseStreams ends the event streams, which would otherwise keep a
+// graceful shutdown waiting.
+func (handler *HTTPHandler) CloseStreams() {
+	handler.closeOnce.Do(func() {
+		close(handler.closing)
+	})
+}
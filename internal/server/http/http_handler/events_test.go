@@ -0,0 +1,185 @@
+package httphandler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/clicks"
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+	mock_tokenpool "github.com/ilyakharev/url-short/internal/tokenpool/mock"
+)
+
+// sseEvent is an event read from a stream, comments are skipped.
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+func readEvent(t *testing.T, reader *bufio.Reader) (event sseEvent, ok bool) {
+	t.Helper()
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return sseEvent{}, false
+		}
+		line = strings.TrimSuffix(line, "\n")
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "":
+			if event.event != "" {
+				return event, true
+			}
+		case "id":
+			event.id = value
+		case "event":
+			event.event = value
+		case "data":
+			event.data = value
+		}
+	}
+}
+
+func TestLinkEvents(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	require.NoError(t, memory.CreateShortURL(ctx, "https://a.ru", "a"))
+	require.NoError(t, memory.CreateShortURL(ctx, "https://b.ru", "b"))
+	ctrl := gomock.NewController(t)
+	handler := New(memory, mock_tokenpool.NewMockSource(ctrl), Config{Hub: clicks.NewHub(10)}, zap.NewNop())
+	server := httptest.NewServer(handler.CreateRouter())
+	defer server.Close()
+	admin := httptest.NewServer(handler.CreateAdminRouter("secret"))
+	defer admin.Close()
+	client := server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	redirect := func(token string) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/"+token, http.NoBody)
+		require.NoError(t, err)
+		req.Header.Set("Referer", "https://t.me/channel")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusFound, resp.StatusCode)
+	}
+	watch := func(lastEventID string) (*http.Response, *bufio.Reader) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, admin.URL+"/api/v1/links/a/events", http.NoBody)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		return resp, bufio.NewReader(resp.Body)
+	}
+
+	resp, reader := watch("")
+	redirect("b")
+	redirect("a")
+	event, ok := readEvent(t, reader)
+	require.True(t, ok)
+	assert.Equal(t, "click", event.event)
+	var click clickEvent
+	require.NoError(t, json.Unmarshal([]byte(event.data), &click))
+	assert.Equal(t, "a", click.Token)
+	assert.Equal(t, "t.me", click.ReferrerHost)
+	_ = resp.Body.Close()
+
+	redirect("a")
+	redirect("a")
+	resp, reader = watch(event.id)
+	var resumed []string
+	for len(resumed) < 2 {
+		event, ok = readEvent(t, reader)
+		require.True(t, ok)
+		resumed = append(resumed, event.id)
+	}
+	assert.NotEqual(t, resumed[0], resumed[1])
+
+	t.Run("link of tenant", func(t *testing.T) {
+		require.NoError(t, memory.CreateWithAttributes(ctx, "https://t.ru", "t", storage.Attributes{Tenant: "acme"}))
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, admin.URL+"/api/v1/links/t/events?tenant=acme",
+			http.NoBody)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	handler.CloseStreams()
+	_, ok = readEvent(t, reader)
+	assert.False(t, ok, "stream must end on shutdown")
+	_ = resp.Body.Close()
+}
+
+func TestLinkEventsErrors(t *testing.T) {
+	memory := inmemory.New()
+	require.NoError(t, memory.CreateShortURL(context.Background(), "https://a.ru", "a"))
+	require.NoError(t, memory.CreateWithAttributes(context.Background(), "https://t.ru", "t",
+		storage.Attributes{Tenant: "acme"}))
+	ctrl := gomock.NewController(t)
+	hub := clicks.NewHub(0)
+
+	cases := []struct {
+		name        string
+		method      string
+		path        string
+		lastEventID string
+		token       string
+		hub         *clicks.Hub
+		statusCode  int
+	}{
+		{name: "no token", path: "/api/v1/links/a/events", token: "-", hub: hub, statusCode: http.StatusUnauthorized},
+		{name: "unknown token", path: "/api/v1/links/b/events", hub: hub, statusCode: http.StatusNotFound},
+		{name: "no events", path: "/api/v1/links/a/clicks", hub: hub, statusCode: http.StatusNotFound},
+		{name: "post", method: http.MethodPost, path: "/api/v1/links/a/events", hub: hub,
+			statusCode: http.StatusMethodNotAllowed},
+		{name: "bad last event ID", path: "/api/v1/links/a/events", lastEventID: "x", hub: hub,
+			statusCode: http.StatusBadRequest},
+		{name: "no hub", path: "/api/v1/links/a/events", statusCode: http.StatusNotImplemented},
+		{name: "link of tenant", path: "/api/v1/links/t/events", hub: hub, statusCode: http.StatusNotFound},
+		{name: "link of other tenant", path: "/api/v1/links/t/events?tenant=other", hub: hub,
+			statusCode: http.StatusNotFound},
+		{name: "tenant of link without tenant", path: "/api/v1/links/a/events?tenant=acme", hub: hub,
+			statusCode: http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := New(memory, mock_tokenpool.NewMockSource(ctrl), Config{Hub: tc.hub}, zap.NewNop())
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req, err := http.NewRequestWithContext(context.Background(), method, tc.path, http.NoBody)
+			require.NoError(t, err)
+			if tc.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tc.lastEventID)
+			}
+			if tc.token == "" {
+				req.Header.Set("Authorization", "Bearer secret")
+			}
+			rr := httptest.NewRecorder()
+			handler.CreateAdminRouter("secret").ServeHTTP(rr, req)
+			assert.Equal(t, tc.statusCode, rr.Code, rr.Body.String())
+		})
+	}
+}
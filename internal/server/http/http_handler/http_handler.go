@@ -2,36 +2,115 @@ package httphandler
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/ilyakharev/url-short/internal/clicks"
 	"github.com/ilyakharev/url-short/internal/hasher"
 	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/tokenpool"
+	"github.com/ilyakharev/url-short/internal/webhook"
 )
 
 //go:generate mockgen -source=httpHandler.go -destination=./mock/httpHandler.go
 type HTTPHandler struct {
 	storager storage.Storager
-	hasher   hasher.Hasher
-	logger   *zap.Logger
+	tokens   tokenpool.Source
+	keyspace *tokenpool.Keyspace
+	// filter checks aliases chosen by users, nil only checks their form.
+	filter *hasher.Filter
+	// hub gets a click for every redirect, nil when clicks are not watched.
+	hub *clicks.Hub
+	// counter counts the click of every redirect, nil when clicks are not
+	// counted.
+	counter *clicks.Counter
+	// webhooks manages the webhooks of tenants, nil when they are disabled.
+	webhooks  *webhook.Dispatcher
+	redirects Redirects
+	// closing is closed by CloseStreams.
+	closing   chan struct{}
+	closeOnce sync.Once
+	logger    *zap.Logger
 }
 
-func New(st storage.Storager, h hasher.Hasher, logger *zap.Logger) *HTTPHandler {
-	return &HTTPHandler{storager: st, hasher: h, logger: logger}
+// Config holds the optional parts of the handler, the zero value serves
+// links without them.
+type Config struct {
+	// Keyspace reports the usage of the token space on /admin/keyspace.
+	Keyspace *tokenpool.Keyspace
+	// Filter checks aliases chosen by users, nil only checks their form.
+	Filter *hasher.Filter
+	// Hub gets a click for every redirect, nil when clicks are not watched.
+	Hub *clicks.Hub
+	// Counter counts the click of every redirect in the background, nil
+	// when clicks are not counted.
+	Counter *clicks.Counter
+	// Webhooks manages the webhooks of tenants, nil when they are disabled.
+	Webhooks  *webhook.Dispatcher
+	Redirects Redirects
+}
+
+func New(st storage.Storager, tokens tokenpool.Source, cfg Config, logger *zap.Logger) *HTTPHandler {
+	cfg.Redirects.setDefaults()
+	return &HTTPHandler{
+		storager:  st,
+		tokens:    tokens,
+		keyspace:  cfg.Keyspace,
+		filter:    cfg.Filter,
+		hub:       cfg.Hub,
+		counter:   cfg.Counter,
+		webhooks:  cfg.Webhooks,
+		redirects: cfg.Redirects,
+		closing:   make(chan struct{}),
+		logger:    logger,
+	}
 }
 
 func (handler *HTTPHandler) CreateRouter() *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/create", handler.CreateShortURL)
+	mux.HandleFunc("/api/v1/links/bulk", handler.BulkCreate)
+	mux.HandleFunc(campaignsPath, handler.Campaigns)
+	mux.HandleFunc(campaignsPath+"/", handler.Campaign)
+	mux.HandleFunc(campaignAnalyticsPath, handler.CampaignClicks)
 	mux.HandleFunc("/", handler.GetFullURL)
 	return mux
 }
 
+// CreateAdminRouter serves the endpoints for operators, meant for a listener
+// of its own. Requests must carry token as a bearer credential.
+func (handler *HTTPHandler) CreateAdminRouter(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/admin/keyspace", handler.KeyspaceUsage)
+	mux.HandleFunc("/admin/backup", handler.Backup)
+	mux.HandleFunc("/admin/campaigns", handler.AllCampaignClicks)
+	mux.HandleFunc(linksPrefix, handler.LinkEvents)
+	mux.HandleFunc(webhooksPath, handler.Webhooks)
+	mux.HandleFunc(webhooksPath+"/", handler.Webhook)
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		credential, found := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !found || subtle.ConstantTimeCompare([]byte(credential), []byte(token)) != 1 {
+			writer.Header().Add("Content-Type", "application/json")
+			writer.Header().Add("WWW-Authenticate", "Bearer")
+			handler.sendResponse(http.StatusUnauthorized, writer, "Unauthorized")
+			return
+		}
+		mux.ServeHTTP(writer, request)
+	})
+}
+
 func (handler *HTTPHandler) CreateShortURL(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(request.Context(), time.Second)
 	defer cancel()
@@ -64,42 +143,106 @@ func (handler *HTTPHandler) CreateShortURL(writer http.ResponseWriter, request *
 		handler.sendResponse(http.StatusBadRequest, writer, "Invalid URL")
 		return
 	}
-
-	token, exists, err := handler.storager.AlreadyExists(ctx, rawURL)
+	attrs, err := createOptions(request.URL.Query())
 	if err != nil {
-		handler.logger.Error("error on check url on exists", zap.Error(err))
-		handler.sendResponse(http.StatusInternalServerError, writer, err.Error())
-		return
-	}
-	if exists {
-		handler.sendResponse(http.StatusOK, writer, token)
+		handler.sendResponse(http.StatusBadRequest, writer, err.Error())
 		return
 	}
-	exists = true
-	for exists {
-		token, err = handler.hasher.GenerateToken()
+	if campaign := request.URL.Query().Get("campaign"); campaign != "" {
+		var template storage.UTM
+		template, err = storage.CampaignUTM(ctx, handler.storager, attrs.Tenant, campaign)
 		if err != nil {
-			handler.logger.Error("error on generate token", zap.Error(err))
-			handler.sendResponse(http.StatusInternalServerError, writer, err.Error())
+			code := campaignErrorCode(err)
+			if code >= http.StatusInternalServerError {
+				handler.logger.Error("error on get campaign template", zap.Error(err))
+			}
+			handler.sendResponse(code, writer, err.Error())
 			return
 		}
-		_, exists, err = handler.storager.GetFullURL(ctx, token)
+		attrs.UTM = attrs.UTM.Merge(template)
+	}
+
+	// A link with attributes is not shared with the existing link to the
+	// same URL, which may have other ones.
+	if attrs.IsZero() {
+		var exists bool
+		token, exists, err = handler.storager.AlreadyExists(ctx, rawURL)
 		if err != nil {
-			handler.logger.Error("error on check url:", zap.Error(err))
-			handler.sendResponse(http.StatusInternalServerError, writer, err.Error())
+			handler.logger.Error("error on check url on exists", zap.Error(err))
+			handler.sendResponse(storageErrorCode(err), writer, err.Error())
+			return
+		}
+		if exists {
+			handler.sendResponse(http.StatusOK, writer, token)
 			return
 		}
 	}
+	token, err = handler.tokens.Token(ctx, rawURL)
+	if errors.Is(err, tokenpool.ErrKeyspaceExhausted) {
+		handler.logger.Error("error on generate token", zap.Error(err))
+		handler.sendResponse(http.StatusServiceUnavailable, writer, err.Error())
+		return
+	}
+	if err != nil {
+		handler.logger.Error("error on generate token", zap.Error(err))
+		handler.sendResponse(http.StatusInternalServerError, writer, err.Error())
+		return
+	}
 
-	err = handler.storager.CreateShortURL(ctx, rawURL, token)
+	err = storage.CreateLink(ctx, handler.storager, &storage.NewLink{Token: token, FullURL: rawURL, Attributes: attrs})
+	if errors.Is(err, storage.ErrNoAttributes) {
+		handler.sendResponse(http.StatusNotImplemented, writer, "Link options are not supported by storage")
+		return
+	}
 	if err != nil {
 		handler.logger.Error("error on save token", zap.Error(err))
-		handler.sendResponse(http.StatusInternalServerError, writer, err.Error())
+		handler.sendResponse(storageErrorCode(err), writer, err.Error())
 		return
 	}
 	handler.sendResponse(http.StatusCreated, writer, token)
 }
 
+// createOptions returns the attributes of a link set by the tenant, redirect,
+// query_passthrough, path_passthrough and utm_ parameters of /create.
+func createOptions(query url.Values) (attrs storage.Attributes, err error) {
+	if tenant := query.Get("tenant"); tenant != "" {
+		err = storage.CheckTenant(tenant)
+		if err != nil {
+			return storage.Attributes{}, err
+		}
+		attrs.Tenant = tenant
+	}
+	if raw := query.Get("redirect"); raw != "" {
+		attrs.RedirectCode, err = strconv.Atoi(raw)
+		if err != nil || storage.CheckRedirectCode(attrs.RedirectCode) != nil {
+			return storage.Attributes{}, storage.ErrInvalidRedirectCode
+		}
+	}
+	attrs.QueryPassthrough = query.Get("query_passthrough")
+	err = storage.CheckQueryPassthrough(attrs.QueryPassthrough)
+	if err != nil {
+		return storage.Attributes{}, err
+	}
+	if raw := query.Get("path_passthrough"); raw != "" {
+		attrs.PathPassthrough, err = strconv.ParseBool(raw)
+		if err != nil {
+			return storage.Attributes{}, errors.New("path_passthrough must be true or false")
+		}
+	}
+	attrs.UTM = storage.UTM{
+		Source:   query.Get("utm_source"),
+		Medium:   query.Get("utm_medium"),
+		Campaign: query.Get("utm_campaign"),
+		Term:     query.Get("utm_term"),
+		Content:  query.Get("utm_content"),
+	}
+	err = storage.CheckUTM(attrs.UTM)
+	if err != nil {
+		return storage.Attributes{}, err
+	}
+	return attrs, nil
+}
+
 func (handler *HTTPHandler) GetFullURL(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(request.Context(), time.Second)
 	defer cancel()
@@ -117,20 +260,132 @@ func (handler *HTTPHandler) GetFullURL(writer http.ResponseWriter, request *http
 	}
 	writer.Header().Add("Content-Type", "application/json")
 
-	rawShortURL := request.URL.Path[1:]
+	// Tokens have no slashes, the path after one is passed to prefix links.
+	rawShortURL, suffix, prefixed := strings.Cut(request.URL.Path[1:], "/")
 
-	fullURL, ok, err := handler.storager.GetFullURL(ctx, rawShortURL)
+	fullURL, attrs, ok, err := storage.GetLink(ctx, handler.storager, rawShortURL)
 	if err != nil {
 		handler.logger.Error("error on get full url", zap.Error(err))
-		handler.sendResponse(http.StatusInternalServerError, writer, err.Error())
+		handler.sendResponse(storageErrorCode(err), writer, err.Error())
 		return
 	}
 	if !ok {
+		if handler.evicted(ctx, rawShortURL) {
+			handler.sendResponse(http.StatusGone, writer, "Link was evicted")
+			return
+		}
+		handler.sendResponse(http.StatusNotFound, writer, "Not found")
+		return
+	}
+	if prefixed && !attrs.PathPassthrough {
 		handler.sendResponse(http.StatusNotFound, writer, "Not found")
 		return
 	}
+	now := time.Now()
+	if attrs.Expired(now) {
+		handler.sendResponse(http.StatusGone, writer, "Link has expired")
+		return
+	}
+	target, err := redirectTarget(fullURL, &attrs, suffix, request.URL.Query())
+	if err != nil {
+		handler.logger.Error("error on build target url", zap.Error(err))
+		handler.sendResponse(http.StatusInternalServerError, writer, err.Error())
+		return
+	}
+
+	handler.counter.Add(rawShortURL)
+	handler.hub.Publish(clicks.NewEvent(now, rawShortURL, attrs.Tenant, request.Referer(), request.UserAgent()))
+
+	code := handler.redirects.code(&attrs)
+	writer.Header().Set("Cache-Control", handler.redirects.cacheControl(code, &attrs, now))
+	http.Redirect(writer, request, target, code)
+}
+
+// evicted reports if token is unknown because the storage dropped it when
+// full, as opposed to never having it.
+func (handler *HTTPHandler) evicted(ctx context.Context, token string) bool {
+	reporter, ok := storage.As[storage.EvictionReporter](handler.storager)
+	if !ok {
+		return false
+	}
+	evicted, err := reporter.Evicted(ctx, token)
+	if err != nil {
+		handler.logger.Error("error on check eviction", zap.Error(err))
+		return false
+	}
+	return evicted
+}
+
+func (handler *HTTPHandler) KeyspaceUsage(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), time.Second)
+	defer cancel()
+
+	if request.Method != http.MethodGet {
+		handler.sendResponse(http.StatusMethodNotAllowed, writer, "Method is not allowed")
+		return
+	}
+	writer.Header().Add("Content-Type", "application/json")
 
-	http.Redirect(writer, request, fullURL, http.StatusFound)
+	usage, err := handler.keyspace.Usage(ctx)
+	if err != nil {
+		handler.logger.Error("error on get keyspace usage", zap.Error(err))
+		handler.sendResponse(http.StatusInternalServerError, writer, err.Error())
+		return
+	}
+	err = json.NewEncoder(writer).Encode(usage)
+	if err != nil {
+		handler.logger.Error("error while write response", zap.Error(err))
+	}
+}
+
+// Backup streams a consistent copy of the database, if the storage supports
+// online backups. The copy holds the signing secrets of webhooks, it is only
+// served by the admin router.
+func (handler *HTTPHandler) Backup(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		handler.sendResponse(http.StatusMethodNotAllowed, writer, "Method is not allowed")
+		return
+	}
+	backuper, ok := storage.As[storage.Backuper](handler.storager)
+	if !ok {
+		writer.Header().Add("Content-Type", "application/json")
+		handler.sendResponse(http.StatusNotImplemented, writer, "Backup is not supported by storage")
+		return
+	}
+
+	writer.Header().Add("Content-Type", "application/octet-stream")
+	writer.Header().Add("Content-Disposition", `attachment; filename="backup.db"`)
+	written, err := backuper.Backup(request.Context(), writer)
+	if err != nil {
+		// The status is already sent, the client sees a truncated body.
+		handler.logger.Error("error on backup", zap.Error(err), zap.Int64("written", written))
+		return
+	}
+	handler.logger.Info("backup is sent", zap.Int64("written", written))
+}
+
+// campaignErrorCode is the status of an error of getting a campaign template.
+func campaignErrorCode(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrUnknownCampaign), errors.Is(err, storage.ErrCampaignWithoutTenant):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrNoCampaigns):
+		return http.StatusNotImplemented
+	}
+	return storageErrorCode(err)
+}
+
+// storageErrorCode asks to retry later when the storage has lost its
+// backend and rejects links too large to be stored, other storage errors are
+// internal.
+func storageErrorCode(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, storage.ErrLinkTooLarge):
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
 }
 
 func (handler *HTTPHandler) sendResponse(code int, w http.ResponseWriter, message string) {
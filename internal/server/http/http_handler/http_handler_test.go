@@ -8,14 +8,21 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"go.uber.org/mock/gomock"
 	"go.uber.org/zap"
 
-	mock_hasher "github.com/ilyakharev/url-short/internal/hasher/mock"
+	"github.com/ilyakharev/url-short/internal/clicks"
+	"github.com/ilyakharev/url-short/internal/hasher"
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/bolt"
 	"github.com/ilyakharev/url-short/internal/storage/inmemory"
 	mock_storage "github.com/ilyakharev/url-short/internal/storage/mock"
+	"github.com/ilyakharev/url-short/internal/tokenpool"
+	mock_tokenpool "github.com/ilyakharev/url-short/internal/tokenpool/mock"
 )
 
 func TestSaveHandler(t *testing.T) {
@@ -81,20 +88,6 @@ func TestSaveHandler(t *testing.T) {
 				mockMemory.EXPECT().AlreadyExists(gomock.Any(), gomock.Any()).Return("", false, errors.New("some"))
 			},
 		},
-		{
-			name:        "Check get error in storager GetFullURL",
-			rawURL:      "http://ya.ru",
-			expectToken: "1234567890",
-			hashToken:   "1234567890",
-			method:      http.MethodPost,
-			statusCode:  http.StatusInternalServerError,
-			failHash:    false,
-			failStorage: true,
-			prepareMock: func(ctx context.Context, mockMemory *mock_storage.MockStorager) {
-				mockMemory.EXPECT().AlreadyExists(gomock.Any(), gomock.Any()).Return("", false, nil)
-				mockMemory.EXPECT().GetFullURL(gomock.Any(), gomock.Any()).Return("", false, errors.New("some"))
-			},
-		},
 		{
 			name:        "Check get error in storager CreateShortURL",
 			rawURL:      "http://ya.ru",
@@ -106,8 +99,6 @@ func TestSaveHandler(t *testing.T) {
 			failStorage: true,
 			prepareMock: func(ctx context.Context, mockMemory *mock_storage.MockStorager) {
 				mockMemory.EXPECT().AlreadyExists(gomock.Any(), gomock.Any()).Return("", false, nil)
-				mockMemory.EXPECT().GetFullURL(gomock.Any(), gomock.Any()).Return("",
-					false, nil)
 				mockMemory.EXPECT().CreateShortURL(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("some"))
 			},
 		},
@@ -116,14 +107,14 @@ func TestSaveHandler(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
-			hasher := mock_hasher.NewMockHasher(ctrl)
+			tokens := mock_tokenpool.NewMockSource(ctrl)
 			var b bytes.Buffer
 			_, _ = fmt.Fprint(&b, tc.rawURL)
 
 			if tc.failHash {
-				hasher.EXPECT().GenerateToken().Return("", errors.New("any")).AnyTimes()
+				tokens.EXPECT().Token(gomock.Any(), gomock.Any()).Return("", errors.New("any")).AnyTimes()
 			} else {
-				hasher.EXPECT().GenerateToken().Return(tc.hashToken, nil).AnyTimes()
+				tokens.EXPECT().Token(gomock.Any(), gomock.Any()).Return(tc.hashToken, nil).AnyTimes()
 			}
 
 			ctx := context.Background()
@@ -132,9 +123,9 @@ func TestSaveHandler(t *testing.T) {
 			if tc.failStorage {
 				mockMemory := mock_storage.NewMockStorager(ctrl)
 				tc.prepareMock(ctx, mockMemory)
-				handler = New(mockMemory, hasher, zap.NewNop())
+				handler = New(mockMemory, tokens, Config{}, zap.NewNop())
 			} else {
-				handler = New(memory, hasher, zap.NewNop())
+				handler = New(memory, tokens, Config{}, zap.NewNop())
 			}
 			req, err := http.NewRequestWithContext(ctx, tc.method, "/create", &b)
 			if err != nil {
@@ -215,15 +206,15 @@ func TestGetFullUrl(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
-			hasher := mock_hasher.NewMockHasher(ctrl)
+			tokens := mock_tokenpool.NewMockSource(ctrl)
 
 			var handler *HTTPHandler
 			if tc.failStorage {
 				mockMemory := mock_storage.NewMockStorager(ctrl)
 				tc.prepareMock(ctx, mockMemory)
-				handler = New(mockMemory, hasher, zap.NewNop())
+				handler = New(mockMemory, tokens, Config{}, zap.NewNop())
 			} else {
-				handler = New(memory, hasher, zap.NewNop())
+				handler = New(memory, tokens, Config{}, zap.NewNop())
 			}
 
 			req, err := http.NewRequestWithContext(context.Background(), tc.method, "/"+tc.token, http.NoBody)
@@ -241,3 +232,263 @@ func TestGetFullUrl(t *testing.T) {
 		})
 	}
 }
+
+func TestDebugVars(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	handler := New(inmemory.New(), mock_tokenpool.NewMockSource(ctrl), Config{}, zap.NewNop())
+
+	cases := []struct {
+		name       string
+		router     http.Handler
+		credential string
+		statusCode int
+	}{
+		{
+			name:       "admin router",
+			router:     handler.CreateAdminRouter("secret"),
+			credential: "Bearer secret",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "no credential",
+			router:     handler.CreateAdminRouter("secret"),
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong credential",
+			router:     handler.CreateAdminRouter("secret"),
+			credential: "Bearer secreT",
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "no token configured",
+			router:     handler.CreateAdminRouter(""),
+			credential: "Bearer ",
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "public router",
+			router:     handler.CreateRouter(),
+			credential: "Bearer secret",
+			statusCode: http.StatusNotFound,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/debug/vars", http.NoBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.credential != "" {
+				req.Header.Set("Authorization", tc.credential)
+			}
+			rr := httptest.NewRecorder()
+
+			tc.router.ServeHTTP(rr, req)
+			if rr.Code != tc.statusCode {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					rr.Code, tc.statusCode)
+			}
+		})
+	}
+}
+
+func TestKeyspaceExhausted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	tokens := mock_tokenpool.NewMockSource(ctrl)
+	tokens.EXPECT().Token(gomock.Any(), gomock.Any()).Return("", tokenpool.ErrKeyspaceExhausted)
+	handler := New(inmemory.New(), tokens, Config{}, zap.NewNop())
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "/create",
+		bytes.NewBufferString("http://ya.ru"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+
+	handler.CreateShortURL(rr, req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			rr.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestStorageUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	st := mock_storage.NewMockStorager(ctrl)
+	st.EXPECT().AlreadyExists(gomock.Any(), "http://ya.ru").
+		Return("", false, fmt.Errorf("%w: connection refused", storage.ErrUnavailable))
+	handler := New(st, mock_tokenpool.NewMockSource(ctrl), Config{}, zap.NewNop())
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "/create",
+		bytes.NewBufferString("http://ya.ru"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+
+	handler.CreateShortURL(rr, req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			rr.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestKeyspaceUsage(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	_ = memory.CreateShortURL(ctx, "http://ya.ru", "0123456789")
+	keyspace := tokenpool.NewKeyspace(hasher.New(), memory, 0, zap.NewNop())
+	ctrl := gomock.NewController(t)
+	handler := New(memory, mock_tokenpool.NewMockSource(ctrl), Config{Keyspace: keyspace}, zap.NewNop())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/admin/keyspace", http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+
+	handler.CreateAdminRouter("secret").ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v",
+			rr.Code, http.StatusOK)
+	}
+	var usage tokenpool.Usage
+	if err = json.Unmarshal(rr.Body.Bytes(), &usage); err != nil {
+		t.Fatal(err)
+	}
+	if usage.Links != 1 || usage.TokenLength != hasher.DefaultTokenLength {
+		t.Errorf("handler returned wrong usage: %+v", usage)
+	}
+}
+
+func TestClicksAndBackup(t *testing.T) {
+	ctx := context.Background()
+	st, err := bolt.New(filepath.Join(t.TempDir(), "url_short.bolt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = st.Close()
+	}()
+	_ = st.CreateShortURL(ctx, "http://ya.ru", "0123456789")
+	ctrl := gomock.NewController(t)
+	counter := clicks.NewCounter(st, time.Hour, zap.NewNop())
+	handler := New(st, mock_tokenpool.NewMockSource(ctrl), Config{Counter: counter}, zap.NewNop())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/0123456789", http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.CreateRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusFound)
+	}
+	written, err := st.Clicks(ctx, "0123456789")
+	if err != nil || written != 0 {
+		t.Errorf("redirect waits for the click to be written: clicks %v, error %v", written, err)
+	}
+	if err = counter.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	written, err = st.Clicks(ctx, "0123456789")
+	if err != nil || written != 1 {
+		t.Errorf("redirect is not counted: clicks %v, error %v", written, err)
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, "/admin/backup", http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.CreateRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("public router serves backup: code %v", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	handler.CreateAdminRouter("secret").ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("backup is sent without credential: code %v", rr.Code)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	handler.CreateAdminRouter("secret").ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.Len() == 0 {
+		t.Errorf("handler returned wrong backup: code %v, %v bytes", rr.Code, rr.Body.Len())
+	}
+
+	t.Run("not supported", func(t *testing.T) {
+		handler := New(inmemory.New(), mock_tokenpool.NewMockSource(ctrl), Config{}, zap.NewNop())
+		rr := httptest.NewRecorder()
+		handler.CreateAdminRouter("secret").ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotImplemented {
+			t.Errorf("handler returned wrong status code: got %v want %v",
+				rr.Code, http.StatusNotImplemented)
+		}
+	})
+}
+
+func TestEvicted(t *testing.T) {
+	ctx := context.Background()
+	st, err := inmemory.NewBounded(inmemory.Limits{MaxLinks: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = st.CreateShortURL(ctx, "http://ya.ru", "0123456789")
+	_ = st.CreateShortURL(ctx, "http://mai.ru", "9876543210")
+	ctrl := gomock.NewController(t)
+	handler := New(st, mock_tokenpool.NewMockSource(ctrl), Config{}, zap.NewNop())
+
+	for path, code := range map[string]int{
+		"/0123456789": http.StatusGone,
+		"/9876543210": http.StatusFound,
+		"/5555555555": http.StatusNotFound,
+	} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.CreateRouter().ServeHTTP(rr, req)
+		if rr.Code != code {
+			t.Errorf("handler returned wrong status code for %v: got %v want %v", path, rr.Code, code)
+		}
+	}
+}
+
+func TestRedirectPublishesClick(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	err := memory.CreateWithAttributes(ctx, "http://ya.ru", "0123456789", storage.Attributes{Tenant: "acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctrl := gomock.NewController(t)
+	hub := clicks.NewHub(0)
+	subscription := hub.Subscribe(clicks.Filter{}, 1)
+	handler := New(memory, mock_tokenpool.NewMockSource(ctrl), Config{Hub: hub}, zap.NewNop())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/0123456789", http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Referer", "https://t.me/channel/1")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64)")
+	rr := httptest.NewRecorder()
+	handler.CreateRouter().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusFound {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusFound)
+	}
+	select {
+	case event := <-subscription.Events():
+		if event.Token != "0123456789" || event.Tenant != "acme" || event.ReferrerHost != "t.me" ||
+			event.UserAgentClass != clicks.UserAgentDesktop {
+			t.Errorf("handler published wrong event: %+v", event)
+		}
+	default:
+		t.Error("handler did not publish a click")
+	}
+}
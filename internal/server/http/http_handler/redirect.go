@@ -0,0 +1,97 @@
+package httphandler
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+const defaultRedirectMaxAge = time.Hour
+
+// Redirects configures how links redirect.
+type Redirects struct {
+	// DefaultCode is the status of the links created without their own,
+	// 302 when zero.
+	DefaultCode int
+	// MaxAge is how long clients may cache permanent redirects. Temporary
+	// redirects are not cached, so that every click reaches the server and
+	// is counted.
+	MaxAge time.Duration
+}
+
+func (redirects *Redirects) setDefaults() {
+	if redirects.DefaultCode == 0 {
+		redirects.DefaultCode = http.StatusFound
+	}
+	if redirects.MaxAge <= 0 {
+		redirects.MaxAge = defaultRedirectMaxAge
+	}
+}
+
+// code returns the status a link with attrs redirects with.
+func (redirects *Redirects) code(attrs *storage.Attributes) int {
+	if attrs.RedirectCode != 0 {
+		return attrs.RedirectCode
+	}
+	return redirects.DefaultCode
+}
+
+// cacheControl returns the Cache-Control of a redirect with code. A
+// permanent redirect of an expiring link is cached no longer than until it
+// expires.
+func (redirects *Redirects) cacheControl(code int, attrs *storage.Attributes, now time.Time) string {
+	if code != http.StatusMovedPermanently && code != http.StatusPermanentRedirect {
+		return "no-store"
+	}
+	maxAge := redirects.MaxAge
+	if !attrs.ExpiresAt.IsZero() {
+		maxAge = min(maxAge, attrs.ExpiresAt.Sub(now))
+	}
+	if maxAge < time.Second {
+		return "no-store"
+	}
+	return "public, max-age=" + strconv.Itoa(int(maxAge/time.Second))
+}
+
+// redirectTarget returns fullURL with the UTM parameters of the link, and
+// with the path suffix and the query of a redirect passed through as attrs
+// allow. The UTM parameters count as ones of the target when the query is
+// merged.
+func redirectTarget(fullURL string, attrs *storage.Attributes, suffix string, query url.Values) (string, error) {
+	passQuery := attrs.QueryPassthrough != "" && len(query) > 0
+	passPath := attrs.PathPassthrough && suffix != ""
+	if !passQuery && !passPath && attrs.UTM.IsZero() {
+		return fullURL, nil
+	}
+	target, err := url.Parse(fullURL)
+	if err != nil {
+		return "", err
+	}
+	if passPath {
+		target = target.JoinPath(suffix)
+	}
+	if !passQuery && attrs.UTM.IsZero() {
+		return target.String(), nil
+	}
+	merged := target.Query()
+	attrs.UTM.Apply(merged)
+	if passQuery {
+		for key, values := range query {
+			switch attrs.QueryPassthrough {
+			case storage.QueryKeep:
+				if _, ok := merged[key]; !ok {
+					merged[key] = values
+				}
+			case storage.QueryOverride:
+				merged[key] = values
+			case storage.QueryAppend:
+				merged[key] = append(merged[key], values...)
+			}
+		}
+	}
+	target.RawQuery = merged.Encode()
+	return target.String(), nil
+}
@@ -0,0 +1,157 @@
+package httphandler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+	mock_tokenpool "github.com/ilyakharev/url-short/internal/tokenpool/mock"
+)
+
+func TestRedirectCodes(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	require.NoError(t, memory.CreateShortURL(ctx, "http://a.ru", "default"))
+	for _, code := range []int{http.StatusMovedPermanently, http.StatusTemporaryRedirect, http.StatusPermanentRedirect} {
+		require.NoError(t, memory.CreateWithAttributes(ctx, "http://a.ru", http.StatusText(code)[:4],
+			storage.Attributes{RedirectCode: code}))
+	}
+	require.NoError(t, memory.CreateWithAttributes(ctx, "http://a.ru", "expiring", storage.Attributes{
+		RedirectCode: http.StatusMovedPermanently, ExpiresAt: time.Now().Add(10 * time.Minute),
+	}))
+
+	cases := []struct {
+		name         string
+		redirects    Redirects
+		token        string
+		statusCode   int
+		cacheControl string
+	}{
+		{name: "default", token: "default", statusCode: http.StatusFound, cacheControl: "no-store"},
+		{name: "permanent default", redirects: Redirects{DefaultCode: http.StatusMovedPermanently, MaxAge: time.Minute},
+			token: "default", statusCode: http.StatusMovedPermanently, cacheControl: "public, max-age=60"},
+		{name: "301", token: "Move", statusCode: http.StatusMovedPermanently, cacheControl: "public, max-age=3600"},
+		{name: "307", token: "Temp", statusCode: http.StatusTemporaryRedirect, cacheControl: "no-store"},
+		{name: "308 over default", redirects: Redirects{DefaultCode: http.StatusTemporaryRedirect},
+			token: "Perm", statusCode: http.StatusPermanentRedirect, cacheControl: "public, max-age=3600"},
+		{name: "cached until expiry", token: "expiring", statusCode: http.StatusMovedPermanently,
+			cacheControl: "public, max-age=599"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			handler := New(memory, mock_tokenpool.NewMockSource(ctrl), Config{Redirects: tc.redirects}, zap.NewNop())
+			req := httptest.NewRequest(http.MethodGet, "/"+tc.token, http.NoBody)
+			rr := httptest.NewRecorder()
+			handler.CreateRouter().ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.statusCode, rr.Code, rr.Body.String())
+			assert.Equal(t, "http://a.ru", rr.Header().Get("Location"))
+			assert.Equal(t, tc.cacheControl, rr.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestCreateWithOptions(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	require.NoError(t, memory.CreateShortURL(ctx, "http://a.ru", "existing"))
+	ctrl := gomock.NewController(t)
+	tokens := mock_tokenpool.NewMockSource(ctrl)
+	handler := New(memory, tokens, Config{}, zap.NewNop())
+
+	create := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/create"+query, strings.NewReader("http://a.ru"))
+		rr := httptest.NewRecorder()
+		handler.CreateRouter().ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, query := range []string{"?redirect=305", "?redirect=permanent", "?query_passthrough=merge",
+		"?path_passthrough=yes"} {
+		rr := create(query)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+
+	tokens.EXPECT().Token(gomock.Any(), "http://a.ru").Return("new", nil)
+	rr := create("?redirect=308&query_passthrough=append&path_passthrough=true")
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	_, attrs, found, err := memory.GetWithAttributes(ctx, "new")
+	require.NoError(t, err)
+	require.True(t, found, "a link with options is not shared with the existing one")
+	assert.Equal(t, storage.Attributes{
+		RedirectCode: http.StatusPermanentRedirect, QueryPassthrough: storage.QueryAppend, PathPassthrough: true,
+	}, attrs)
+}
+
+func TestRedirectTarget(t *testing.T) {
+	cases := []struct {
+		name   string
+		target string
+		attrs  storage.Attributes
+		path   string
+		expect string
+	}{
+		{name: "dropped", target: "https://a.ru/p?id=1", path: "/t?utm_source=x", expect: "https://a.ru/p?id=1"},
+		{name: "keep", target: "https://a.ru/p?id=1&utm_source=ours",
+			attrs: storage.Attributes{QueryPassthrough: storage.QueryKeep},
+			path:  "/t?utm_source=x&ref=y", expect: "https://a.ru/p?id=1&ref=y&utm_source=ours"},
+		{name: "override", target: "https://a.ru/p?id=1&utm_source=ours",
+			attrs: storage.Attributes{QueryPassthrough: storage.QueryOverride},
+			path:  "/t?utm_source=x", expect: "https://a.ru/p?id=1&utm_source=x"},
+		{name: "append", target: "https://a.ru/p?utm_source=ours",
+			attrs: storage.Attributes{QueryPassthrough: storage.QueryAppend},
+			path:  "/t?utm_source=x", expect: "https://a.ru/p?utm_source=ours&utm_source=x"},
+		{name: "no query to pass", target: "https://a.ru/p?b=2&a=1",
+			attrs: storage.Attributes{QueryPassthrough: storage.QueryOverride},
+			path:  "/t", expect: "https://a.ru/p?b=2&a=1"},
+		{name: "path", target: "https://docs.a.ru/v1/", attrs: storage.Attributes{PathPassthrough: true},
+			path: "/t/docs/page", expect: "https://docs.a.ru/v1/docs/page"},
+		{name: "path and query", target: "https://docs.a.ru/v1#top",
+			attrs: storage.Attributes{PathPassthrough: true, QueryPassthrough: storage.QueryKeep},
+			path:  "/t/guide/?lang=ru", expect: "https://docs.a.ru/v1/guide/?lang=ru#top"},
+		{name: "escaped path", target: "https://a.ru", attrs: storage.Attributes{PathPassthrough: true},
+			path: "/t/a%20b", expect: "https://a.ru/a%20b"},
+		{name: "utm", target: "https://a.ru/p?id=1&utm_source=old",
+			attrs: storage.Attributes{UTM: storage.UTM{Source: "newsletter", Campaign: "spring sale"}},
+			path:  "/t?utm_source=x", expect: "https://a.ru/p?id=1&utm_campaign=spring+sale&utm_source=newsletter"},
+		{name: "utm kept over query", target: "https://a.ru",
+			attrs: storage.Attributes{UTM: storage.UTM{Source: "newsletter"}, QueryPassthrough: storage.QueryKeep},
+			path:  "/t?utm_source=x&utm_medium=y", expect: "https://a.ru?utm_medium=y&utm_source=newsletter"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			memory := inmemory.New()
+			require.NoError(t, storage.CreateLink(ctx, memory,
+				&storage.NewLink{Token: "t", FullURL: tc.target, Attributes: tc.attrs}))
+			ctrl := gomock.NewController(t)
+			handler := New(memory, mock_tokenpool.NewMockSource(ctrl), Config{}, zap.NewNop())
+			rr := httptest.NewRecorder()
+			handler.CreateRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, http.NoBody))
+
+			require.Equal(t, http.StatusFound, rr.Code, rr.Body.String())
+			assert.Equal(t, tc.expect, rr.Header().Get("Location"))
+		})
+	}
+}
+
+func TestPathWithoutPassthrough(t *testing.T) {
+	memory := inmemory.New()
+	require.NoError(t, memory.CreateShortURL(context.Background(), "https://a.ru", "t"))
+	ctrl := gomock.NewController(t)
+	handler := New(memory, mock_tokenpool.NewMockSource(ctrl), Config{}, zap.NewNop())
+	rr := httptest.NewRecorder()
+	handler.CreateRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/t/docs", http.NoBody))
+	assert.Equal(t, http.StatusNotFound, rr.Code, rr.Body.String())
+}
@@ -0,0 +1,272 @@
+package httphandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/webhook"
+)
+
+const (
+	webhooksPath    = "/api/v1/webhooks"
+	deadLettersPath = "dead-letters"
+	// maxWebhookBody bounds the body of a created webhook.
+	maxWebhookBody = 64 << 10
+	// defaultDeadLetters and maxDeadLetters bound the listed dead letters.
+	defaultDeadLetters = 100
+	maxDeadLetters     = 1000
+)
+
+type webhookRequest struct {
+	Tenant          string   `json:"tenant"`
+	URL             string   `json:"url"`
+	Events          []string `json:"events"`
+	ClickSampleRate float64  `json:"click_sample_rate"`
+}
+
+type webhookResponse struct {
+	ID              string    `json:"id"`
+	Tenant          string    `json:"tenant"`
+	URL             string    `json:"url"`
+	Events          []string  `json:"events"`
+	ClickSampleRate float64   `json:"click_sample_rate"`
+	CreatedAt       time.Time `json:"created_at"`
+	// Secret is only returned when the webhook is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+type deadLetterResponse struct {
+	ID        string          `json:"id"`
+	WebhookID string          `json:"webhook_id"`
+	Event     string          `json:"event"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error"`
+	CreatedAt time.Time       `json:"created_at"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+func newWebhookResponse(hook *storage.Webhook) webhookResponse {
+	return webhookResponse{
+		ID:              hook.ID,
+		Tenant:          hook.Tenant,
+		URL:             hook.URL,
+		Events:          hook.Events,
+		ClickSampleRate: hook.ClickSampleRate,
+		CreatedAt:       hook.CreatedAt,
+	}
+}
+
+// Webhooks creates a webhook from POST /api/v1/webhooks and lists the
+// webhooks of a tenant from GET /api/v1/webhooks?tenant=, on the admin
+// router: webhooks send requests from the server, so only operators manage
+// them.
+func (handler *HTTPHandler) Webhooks(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), time.Second)
+	defer cancel()
+
+	handler.logger.Debug(
+		"Webhooks http request",
+		zap.Any("address", request.RemoteAddr),
+		zap.Any("method", request.Method),
+		zap.Any("url", request.URL),
+	)
+
+	writer.Header().Add("Content-Type", "application/json")
+	if handler.webhooks == nil {
+		handler.sendResponse(http.StatusNotImplemented, writer, "Webhooks are disabled")
+		return
+	}
+	switch request.Method {
+	case http.MethodPost:
+		handler.createWebhook(ctx, writer, request)
+	case http.MethodGet:
+		tenant, ok := handler.tenantParam(writer, request)
+		if !ok {
+			return
+		}
+		hooks, err := handler.webhooks.Webhooks(ctx, tenant)
+		if err != nil {
+			handler.logger.Error("error on list webhooks", zap.Error(err))
+			handler.sendResponse(storageErrorCode(err), writer, err.Error())
+			return
+		}
+		response := struct {
+			Webhooks []webhookResponse `json:"webhooks"`
+		}{Webhooks: make([]webhookResponse, 0, len(hooks))}
+		for i := range hooks {
+			response.Webhooks = append(response.Webhooks, newWebhookResponse(&hooks[i]))
+		}
+		handler.writeJSON(writer, http.StatusOK, response)
+	default:
+		handler.sendResponse(http.StatusMethodNotAllowed, writer, "Method is not allowed")
+	}
+}
+
+func (handler *HTTPHandler) createWebhook(ctx context.Context, writer http.ResponseWriter, request *http.Request) {
+	var body webhookRequest
+	err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, maxWebhookBody)).Decode(&body)
+	if err != nil {
+		handler.sendResponse(http.StatusBadRequest, writer, "Invalid JSON: "+err.Error())
+		return
+	}
+	hook, err := handler.webhooks.CreateWebhook(ctx, body.Tenant, body.URL, body.Events, body.ClickSampleRate)
+	if errors.Is(err, webhook.ErrInvalidWebhook) {
+		handler.sendResponse(http.StatusBadRequest, writer, err.Error())
+		return
+	}
+	if err != nil {
+		handler.logger.Error("error on create webhook", zap.Error(err))
+		handler.sendResponse(storageErrorCode(err), writer, err.Error())
+		return
+	}
+	response := newWebhookResponse(&hook)
+	response.Secret = hook.Secret
+	handler.writeJSON(writer, http.StatusCreated, response)
+}
+
+// Webhook serves the routes under /api/v1/webhooks/, all of them take the
+// tenant of the webhook as ?tenant=:
+//
+//	DELETE /api/v1/webhooks/{id}
+//	GET    /api/v1/webhooks/dead-letters
+//	POST   /api/v1/webhooks/dead-letters/{id}/replay
+func (handler *HTTPHandler) Webhook(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), time.Second)
+	defer cancel()
+
+	handler.logger.Debug(
+		"Webhook http request",
+		zap.Any("address", request.RemoteAddr),
+		zap.Any("method", request.Method),
+		zap.Any("url", request.URL),
+	)
+
+	writer.Header().Add("Content-Type", "application/json")
+	if handler.webhooks == nil {
+		handler.sendResponse(http.StatusNotImplemented, writer, "Webhooks are disabled")
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(request.URL.Path, webhooksPath+"/"), "/")
+	var method string
+	switch {
+	case len(parts) == 1 && parts[0] == deadLettersPath:
+		method = http.MethodGet
+	case len(parts) == 3 && parts[0] == deadLettersPath && parts[1] != "" && parts[2] == "replay":
+		method = http.MethodPost
+	case len(parts) == 1 && parts[0] != "":
+		method = http.MethodDelete
+	default:
+		handler.sendResponse(http.StatusNotFound, writer, "Not found")
+		return
+	}
+	if request.Method != method {
+		handler.sendResponse(http.StatusMethodNotAllowed, writer, "Method is not allowed")
+		return
+	}
+	tenant, ok := handler.tenantParam(writer, request)
+	if !ok {
+		return
+	}
+
+	switch len(parts) {
+	case 3:
+		handler.replay(ctx, writer, tenant, parts[1])
+	case 1:
+		if parts[0] == deadLettersPath {
+			handler.deadLetters(ctx, writer, request, tenant)
+			return
+		}
+		found, err := handler.webhooks.DeleteWebhook(ctx, tenant, parts[0])
+		if err != nil {
+			handler.logger.Error("error on delete webhook", zap.Error(err))
+			handler.sendResponse(storageErrorCode(err), writer, err.Error())
+			return
+		}
+		if !found {
+			handler.sendResponse(http.StatusNotFound, writer, "Not found")
+			return
+		}
+		handler.sendResponse(http.StatusOK, writer, "Deleted")
+	}
+}
+
+func (handler *HTTPHandler) deadLetters(ctx context.Context, writer http.ResponseWriter, request *http.Request,
+	tenant string,
+) {
+	limit := defaultDeadLetters
+	if raw := request.URL.Query().Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > maxDeadLetters {
+			handler.sendResponse(http.StatusBadRequest, writer, "Invalid limit")
+			return
+		}
+	}
+	deliveries, err := handler.webhooks.DeadLetters(ctx, tenant, limit)
+	if err != nil {
+		handler.logger.Error("error on list dead letters", zap.Error(err))
+		handler.sendResponse(storageErrorCode(err), writer, err.Error())
+		return
+	}
+	response := struct {
+		DeadLetters []deadLetterResponse `json:"dead_letters"`
+	}{DeadLetters: make([]deadLetterResponse, 0, len(deliveries))}
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		response.DeadLetters = append(response.DeadLetters, deadLetterResponse{
+			ID:        delivery.ID,
+			WebhookID: delivery.WebhookID,
+			Event:     delivery.Event,
+			Attempts:  delivery.Attempts,
+			LastError: delivery.LastError,
+			CreatedAt: delivery.CreatedAt,
+			Payload:   delivery.Payload,
+		})
+	}
+	handler.writeJSON(writer, http.StatusOK, response)
+}
+
+func (handler *HTTPHandler) replay(ctx context.Context, writer http.ResponseWriter, tenant string, id string) {
+	found, err := handler.webhooks.Replay(ctx, tenant, id)
+	if err != nil {
+		handler.logger.Error("error on replay dead letter", zap.Error(err))
+		handler.sendResponse(storageErrorCode(err), writer, err.Error())
+		return
+	}
+	if !found {
+		handler.sendResponse(http.StatusNotFound, writer, "Not found")
+		return
+	}
+	handler.sendResponse(http.StatusAccepted, writer, "Queued")
+}
+
+// tenantParam returns the required ?tenant= of request, or sends an error.
+func (handler *HTTPHandler) tenantParam(writer http.ResponseWriter, request *http.Request) (string, bool) {
+	tenant := request.URL.Query().Get("tenant")
+	if tenant == "" {
+		handler.sendResponse(http.StatusBadRequest, writer, "Tenant is required")
+		return "", false
+	}
+	err := storage.CheckTenant(tenant)
+	if err != nil {
+		handler.sendResponse(http.StatusBadRequest, writer, err.Error())
+		return "", false
+	}
+	return tenant, true
+}
+
+func (handler *HTTPHandler) writeJSON(writer http.ResponseWriter, code int, response any) {
+	writer.WriteHeader(code)
+	err := json.NewEncoder(writer).Encode(response)
+	if err != nil {
+		handler.logger.Error("error while write response", zap.Error(err))
+	}
+}
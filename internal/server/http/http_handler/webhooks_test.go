@@ -0,0 +1,145 @@
+package httphandler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+	mock_tokenpool "github.com/ilyakharev/url-short/internal/tokenpool/mock"
+	"github.com/ilyakharev/url-short/internal/webhook"
+)
+
+func newWebhookHandler(t *testing.T) (*HTTPHandler, *inmemory.Inmemory) {
+	memory := inmemory.New()
+	dispatcher, err := webhook.New(memory, nil, webhook.Config{}, zap.NewNop())
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	return New(memory, mock_tokenpool.NewMockSource(ctrl), Config{Webhooks: dispatcher}, zap.NewNop()), memory
+}
+
+func serveWebhooks(handler *HTTPHandler, method string, path string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	handler.CreateAdminRouter("secret").ServeHTTP(rr, req)
+	return rr
+}
+
+func TestWebhooks(t *testing.T) {
+	handler, memory := newWebhookHandler(t)
+
+	rr := serveWebhooks(handler, http.MethodPost, "/api/v1/webhooks",
+		`{"tenant":"acme","url":"https://acme.ru/hook","events":["link.created","link.clicked"],"click_sample_rate":0.1}`)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var created webhookResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.ID)
+	assert.NotEmpty(t, created.Secret)
+	assert.Equal(t, []string{"link.clicked", "link.created"}, created.Events)
+	assert.InDelta(t, 0.1, created.ClickSampleRate, 1e-9)
+
+	rr = serveWebhooks(handler, http.MethodGet, "/api/v1/webhooks?tenant=acme", "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var listed struct {
+		Webhooks []webhookResponse `json:"webhooks"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listed))
+	require.Len(t, listed.Webhooks, 1)
+	assert.Equal(t, created.ID, listed.Webhooks[0].ID)
+	assert.Empty(t, listed.Webhooks[0].Secret, "the secret is only shown on create")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks",
+		strings.NewReader(`{"tenant":"acme","url":"https://evil.ru","events":["link.created"]}`))
+	rr = httptest.NewRecorder()
+	handler.CreateRouter().ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code, "webhooks are not managed on the public router")
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/webhooks?tenant=acme", http.NoBody)
+	rr = httptest.NewRecorder()
+	handler.CreateAdminRouter("secret").ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	now := time.Now()
+	require.NoError(t, memory.EnqueueDeliveries(context.Background(), []storage.WebhookDelivery{{
+		ID: "d1", WebhookID: created.ID, Tenant: "acme", Event: "link.created", Payload: []byte(`{"id":"d1"}`),
+		Attempts: 8, LastError: "500 Internal Server Error", Dead: true, NextAttemptAt: now, CreatedAt: now,
+	}}))
+	rr = serveWebhooks(handler, http.MethodGet, "/api/v1/webhooks/dead-letters?tenant=acme", "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var dead struct {
+		DeadLetters []deadLetterResponse `json:"dead_letters"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &dead))
+	require.Len(t, dead.DeadLetters, 1)
+	assert.Equal(t, 8, dead.DeadLetters[0].Attempts)
+	assert.JSONEq(t, `{"id":"d1"}`, string(dead.DeadLetters[0].Payload))
+
+	rr = serveWebhooks(handler, http.MethodPost, "/api/v1/webhooks/dead-letters/d1/replay?tenant=other", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code, rr.Body.String())
+	rr = serveWebhooks(handler, http.MethodPost, "/api/v1/webhooks/dead-letters/d1/replay?tenant=acme", "")
+	assert.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+	rr = serveWebhooks(handler, http.MethodGet, "/api/v1/webhooks/dead-letters?tenant=acme", "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{"dead_letters":[]}`, rr.Body.String())
+
+	rr = serveWebhooks(handler, http.MethodDelete, "/api/v1/webhooks/"+created.ID+"?tenant=other", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code, rr.Body.String())
+	rr = serveWebhooks(handler, http.MethodDelete, "/api/v1/webhooks/"+created.ID+"?tenant=acme", "")
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	rr = serveWebhooks(handler, http.MethodGet, "/api/v1/webhooks?tenant=acme", "")
+	assert.JSONEq(t, `{"webhooks":[]}`, rr.Body.String())
+}
+
+func TestWebhooksErrors(t *testing.T) {
+	handler, _ := newWebhookHandler(t)
+	ctrl := gomock.NewController(t)
+	disabled := New(inmemory.New(), mock_tokenpool.NewMockSource(ctrl), Config{}, zap.NewNop())
+
+	cases := []struct {
+		name       string
+		handler    *HTTPHandler
+		method     string
+		path       string
+		body       string
+		statusCode int
+	}{
+		{name: "disabled", handler: disabled, method: http.MethodGet, path: "/api/v1/webhooks?tenant=acme",
+			statusCode: http.StatusNotImplemented},
+		{name: "invalid JSON", method: http.MethodPost, path: "/api/v1/webhooks", body: "{",
+			statusCode: http.StatusBadRequest},
+		{name: "invalid webhook", method: http.MethodPost, path: "/api/v1/webhooks",
+			body: `{"tenant":"acme","url":"https://acme.ru","events":["link.viewed"]}`, statusCode: http.StatusBadRequest},
+		{name: "no tenant", method: http.MethodGet, path: "/api/v1/webhooks", statusCode: http.StatusBadRequest},
+		{name: "bad tenant", method: http.MethodGet, path: "/api/v1/webhooks?tenant=a%20b",
+			statusCode: http.StatusBadRequest},
+		{name: "put", method: http.MethodPut, path: "/api/v1/webhooks", statusCode: http.StatusMethodNotAllowed},
+		{name: "delete dead letters", method: http.MethodDelete, path: "/api/v1/webhooks/dead-letters?tenant=acme",
+			statusCode: http.StatusMethodNotAllowed},
+		{name: "get webhook", method: http.MethodGet, path: "/api/v1/webhooks/w1?tenant=acme",
+			statusCode: http.StatusMethodNotAllowed},
+		{name: "unknown route", method: http.MethodGet, path: "/api/v1/webhooks/w1/deliveries?tenant=acme",
+			statusCode: http.StatusNotFound},
+		{name: "bad limit", method: http.MethodGet, path: "/api/v1/webhooks/dead-letters?tenant=acme&limit=0",
+			statusCode: http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := tc.handler
+			if h == nil {
+				h = handler
+			}
+			rr := serveWebhooks(h, tc.method, tc.path, tc.body)
+			assert.Equal(t, tc.statusCode, rr.Code, rr.Body.String())
+		})
+	}
+}
@@ -19,12 +19,31 @@ type HTTPServer struct {
 func New(port string, handler *httphandler.HTTPHandler,
 	logger *zap.Logger,
 ) *HTTPServer {
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler.CreateRouter(),
+		ReadHeaderTimeout: time.Second,
+	}
+	server.RegisterOnShutdown(handler.CloseStreams)
+	return &HTTPServer{
+		server: server,
+		logger: logger,
+	}
+}
+
+// NewAdmin serves the admin endpoints of handler on port, to requests
+// carrying token.
+func NewAdmin(port string, handler *httphandler.HTTPHandler, token string,
+	logger *zap.Logger,
+) *HTTPServer {
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler.CreateAdminRouter(token),
+		ReadHeaderTimeout: time.Second,
+	}
+	server.RegisterOnShutdown(handler.CloseStreams)
 	return &HTTPServer{
-		server: &http.Server{
-			Addr:              ":" + port,
-			Handler:           handler.CreateRouter(),
-			ReadHeaderTimeout: time.Second,
-		},
+		server: server,
 		logger: logger,
 	}
 }
@@ -44,7 +63,7 @@ func (server *HTTPServer) Run(ctx context.Context) error {
 	case <-ctx.Done():
 		server.logger.Info("Shutting down server gracefully")
 
-		shutdownCtx, cancel := context.WithTimeout(ctx, time.Minute*1)
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute*1)
 		defer cancel()
 
 		if err := server.server.Shutdown(shutdownCtx); err != nil {
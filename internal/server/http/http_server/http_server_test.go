@@ -2,6 +2,10 @@ package httpserver
 
 import (
 	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
 	"testing"
 	"time"
 
@@ -9,17 +13,18 @@ import (
 	"go.uber.org/mock/gomock"
 	"go.uber.org/zap"
 
-	mock_hasher "github.com/ilyakharev/url-short/internal/hasher/mock"
+	"github.com/ilyakharev/url-short/internal/clicks"
 	httphandler "github.com/ilyakharev/url-short/internal/server/http/http_handler"
 	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+	mock_tokenpool "github.com/ilyakharev/url-short/internal/tokenpool/mock"
 )
 
 func TestServer(t *testing.T) {
 	t.Run("Create server", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
-		hasher := mock_hasher.NewMockHasher(ctrl)
+		tokens := mock_tokenpool.NewMockSource(ctrl)
 		memory := inmemory.New()
-		handler := httphandler.New(memory, hasher, zap.NewNop())
+		handler := httphandler.New(memory, tokens, httphandler.Config{}, zap.NewNop())
 		srv := New("81", handler, zap.NewNop())
 		ctx, cancel := context.WithTimeout(context.Background(),
 			time.Nanosecond)
@@ -28,3 +33,47 @@ func TestServer(t *testing.T) {
 		require.NoError(t, err)
 	})
 }
+
+func TestShutdownClosesEventStreams(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+	require.NoError(t, listener.Close())
+
+	ctrl := gomock.NewController(t)
+	memory := inmemory.New()
+	require.NoError(t, memory.CreateShortURL(context.Background(), "https://a.ru", "a"))
+	handler := httphandler.New(memory, mock_tokenpool.NewMockSource(ctrl), httphandler.Config{Hub: clicks.NewHub(0)},
+		zap.NewNop())
+	srv := NewAdmin(port, handler, "secret", zap.NewNop())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- srv.Run(ctx)
+	}()
+
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+			"http://127.0.0.1:"+port+"/api/v1/links/a/events", http.NoBody)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err = http.DefaultClient.Do(req)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	cancel()
+	select {
+	case err = <-stopped:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server waits for the event stream")
+	}
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+}
@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	MaxTags         = 32
+	MaxTagLength    = 64
+	MaxTenantLength = 64
+)
+
+// ErrInvalidTenant is returned for a tenant that is not 1 to MaxTenantLength
+// letters, digits, dashes or underscores.
+var ErrInvalidTenant = fmt.Errorf("tenant must be 1 to %d letters, digits, dashes or underscores", MaxTenantLength)
+
+// ErrInvalidRedirectCode is returned for a redirect code other than 301,
+// 302, 307 and 308.
+var ErrInvalidRedirectCode = errors.New("redirect code must be 301, 302, 307 or 308")
+
+// Policies of merging the query of a redirect into the target URL, for a
+// parameter both of them have.
+const (
+	// QueryKeep keeps the value of the target.
+	QueryKeep = "keep"
+	// QueryOverride replaces it with the value of the redirect.
+	QueryOverride = "override"
+	// QueryAppend keeps both values.
+	QueryAppend = "append"
+)
+
+// ErrInvalidQueryPassthrough is returned for an unknown query policy.
+var ErrInvalidQueryPassthrough = errors.New("query passthrough must be keep, override or append")
+
+// ErrNoAttributes is returned when a link with attributes is created in a
+// storage that does not keep them.
+var ErrNoAttributes = fmt.Errorf("storage does not keep link attributes: %w", errors.ErrUnsupported)
+
+// Attributes are optional settings of a link. The zero value is a link
+// without any.
+type Attributes struct {
+	// ExpiresAt is when the link stops redirecting, zero if it never does.
+	ExpiresAt time.Time
+	Tags      []string
+	// Tenant is who the link belongs to, empty for links of nobody.
+	Tenant string
+	// RedirectCode is the HTTP status the link redirects with, zero for the
+	// default of the server.
+	RedirectCode int
+	// QueryPassthrough is how the query of a redirect is merged into the
+	// target URL, one of QueryKeep, QueryOverride and QueryAppend. The
+	// query is dropped when it is empty.
+	QueryPassthrough string
+	// PathPassthrough makes the link a prefix: the path after the token is
+	// appended to the path of the target URL.
+	PathPassthrough bool
+	// UTM are added to the query of the target URL on redirect.
+	UTM UTM
+}
+
+func (attrs Attributes) IsZero() bool {
+	return attrs.ExpiresAt.IsZero() && len(attrs.Tags) == 0 && attrs.Tenant == "" && attrs.RedirectCode == 0 &&
+		attrs.QueryPassthrough == "" && !attrs.PathPassthrough && attrs.UTM.IsZero()
+}
+
+func (attrs Attributes) Expired(now time.Time) bool {
+	return !attrs.ExpiresAt.IsZero() && !now.Before(attrs.ExpiresAt)
+}
+
+// NormalizeTags trims tags and drops empty and repeated ones.
+func NormalizeTags(raw []string) (tags []string, err error) {
+	for _, tag := range raw {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || slices.Contains(tags, tag) {
+			continue
+		}
+		if len(tag) > MaxTagLength {
+			return nil, fmt.Errorf("tag is longer than %d bytes", MaxTagLength)
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) > MaxTags {
+		return nil, fmt.Errorf("more than %d tags", MaxTags)
+	}
+	return tags, nil
+}
+
+func CheckTenant(tenant string) error {
+	if !isName(tenant, MaxTenantLength) {
+		return ErrInvalidTenant
+	}
+	return nil
+}
+
+// isName reports if name is 1 to maxLength letters, digits, dashes or
+// underscores.
+func isName(name string, maxLength int) bool {
+	if name == "" || len(name) > maxLength {
+		return false
+	}
+	for _, char := range name {
+		switch {
+		case char >= 'a' && char <= 'z', char >= 'A' && char <= 'Z', char >= '0' && char <= '9',
+			char == '-', char == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// CheckRedirectCode accepts the redirect statuses and zero for the default.
+func CheckRedirectCode(code int) error {
+	switch code {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect,
+		http.StatusPermanentRedirect:
+		return nil
+	}
+	return ErrInvalidRedirectCode
+}
+
+// CheckQueryPassthrough accepts the query policies and empty for none.
+func CheckQueryPassthrough(policy string) error {
+	switch policy {
+	case "", QueryKeep, QueryOverride, QueryAppend:
+		return nil
+	}
+	return ErrInvalidQueryPassthrough
+}
+
+// attributesJSON is how attributes are kept by storages, so that fields can
+// be added without migrating the ones already stored.
+type attributesJSON struct {
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	Tags             []string   `json:"tags,omitempty"`
+	Tenant           string     `json:"tenant,omitempty"`
+	RedirectCode     int        `json:"redirect_code,omitempty"`
+	QueryPassthrough string     `json:"query_passthrough,omitempty"`
+	PathPassthrough  bool       `json:"path_passthrough,omitempty"`
+	UTM              *UTM       `json:"utm,omitempty"`
+}
+
+// MarshalAttributes encodes attrs for storing, nil for the zero value.
+func MarshalAttributes(attrs Attributes) ([]byte, error) {
+	if attrs.IsZero() {
+		return nil, nil
+	}
+	var encoded attributesJSON
+	if !attrs.ExpiresAt.IsZero() {
+		expiresAt := attrs.ExpiresAt.UTC()
+		encoded.ExpiresAt = &expiresAt
+	}
+	encoded.Tags = attrs.Tags
+	encoded.Tenant = attrs.Tenant
+	encoded.RedirectCode = attrs.RedirectCode
+	encoded.QueryPassthrough = attrs.QueryPassthrough
+	encoded.PathPassthrough = attrs.PathPassthrough
+	if !attrs.UTM.IsZero() {
+		encoded.UTM = &attrs.UTM
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalAttributes decodes what MarshalAttributes returned.
+func UnmarshalAttributes(data []byte) (attrs Attributes, err error) {
+	if len(data) == 0 {
+		return Attributes{}, nil
+	}
+	var encoded attributesJSON
+	err = json.Unmarshal(data, &encoded)
+	if err != nil {
+		return Attributes{}, fmt.Errorf("decode link attributes: %w", err)
+	}
+	if encoded.ExpiresAt != nil {
+		attrs.ExpiresAt = *encoded.ExpiresAt
+	}
+	attrs.Tags = encoded.Tags
+	attrs.Tenant = encoded.Tenant
+	attrs.RedirectCode = encoded.RedirectCode
+	attrs.QueryPassthrough = encoded.QueryPassthrough
+	attrs.PathPassthrough = encoded.PathPassthrough
+	if encoded.UTM != nil {
+		attrs.UTM = *encoded.UTM
+	}
+	return attrs, nil
+}
+
+// AttributeStorer is implemented by storages that keep Attributes of links.
+type AttributeStorer interface {
+	// CreateWithAttributes is CreateShortURL that also sets attrs of the link.
+	CreateWithAttributes(ctx context.Context, fullURL string, token string, attrs Attributes) (err error)
+	// GetWithAttributes is GetFullURL that also returns attrs of the link.
+	GetWithAttributes(ctx context.Context, token string) (fullURL string, attrs Attributes, found bool, err error)
+}
+
+// NewLink is a link to be created.
+type NewLink struct {
+	Token      string
+	FullURL    string
+	Attributes Attributes
+}
+
+// BatchCreator is implemented by storages able to create many links in one
+// transaction.
+type BatchCreator interface {
+	// CreateBatch creates links. errs[i] is the error of links[i], a link
+	// that fails, with ErrTokenExists for one, does not stop the others.
+	// err is returned when the batch could not be written at all.
+	CreateBatch(ctx context.Context, links []NewLink) (errs []error, err error)
+}
+
+// CreateLinks creates links in one batch when st is a BatchCreator and one
+// by one otherwise. errs[i] is the error of links[i].
+func CreateLinks(ctx context.Context, st Storager, links []NewLink) (errs []error, err error) {
+	if batcher, ok := As[BatchCreator](st); ok {
+		return batcher.CreateBatch(ctx, links)
+	}
+	errs = make([]error, len(links))
+	for i := range links {
+		errs[i] = CreateLink(ctx, st, &links[i])
+	}
+	return errs, nil
+}
+
+// CreateLink creates link with CreateWithAttributes when it has attributes.
+func CreateLink(ctx context.Context, st Storager, link *NewLink) error {
+	if link.Attributes.IsZero() {
+		return st.CreateShortURL(ctx, link.FullURL, link.Token)
+	}
+	attributer, ok := As[AttributeStorer](st)
+	if !ok {
+		return ErrNoAttributes
+	}
+	return attributer.CreateWithAttributes(ctx, link.FullURL, link.Token, link.Attributes)
+}
+
+// GetLink returns the full URL and attributes of token, the attributes are
+// zero when st does not keep them.
+func GetLink(ctx context.Context, st Storager,
+	token string,
+) (fullURL string, attrs Attributes, found bool, err error) {
+	if attributer, ok := As[AttributeStorer](st); ok {
+		return attributer.GetWithAttributes(ctx, token)
+	}
+	fullURL, found, err = st.GetFullURL(ctx, token)
+	return fullURL, Attributes{}, found, err
+}
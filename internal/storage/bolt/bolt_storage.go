@@ -0,0 +1,435 @@
+package bolt
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ilyakharev/url-short/internal/hasher"
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+// lockTimeout is how long to wait for the file lock held by another
+// process before giving up.
+const lockTimeout = time.Second
+
+var (
+	// bucketLinks maps token to full URL.
+	bucketLinks = []byte("links")
+	// bucketCanonical maps canonical full URL to token.
+	bucketCanonical = []byte("canonical")
+	// bucketClicks maps token to the number of redirects as uint64.
+	bucketClicks = []byte("clicks")
+	bucketPool   = []byte("token_pool")
+	// bucketAttributes maps token to storage.MarshalAttributes of the links
+	// that have any.
+	bucketAttributes = []byte("attributes")
+	// bucketWebhooks and bucketDeliveries map IDs to JSON of
+	// storage.Webhook and storage.WebhookDelivery.
+	bucketWebhooks   = []byte("webhooks")
+	bucketDeliveries = []byte("webhook_deliveries")
+	// bucketDue indexes the deliveries that are not dead by the time of
+	// the next attempt, see dueKey.
+	bucketDue = []byte("webhook_due")
+	// bucketCampaigns maps campaignKey to JSON of storage.Campaign.
+	bucketCampaigns = []byte("campaigns")
+
+	buckets = [][]byte{
+		bucketLinks, bucketCanonical, bucketClicks, bucketPool, bucketAttributes,
+		bucketWebhooks, bucketDeliveries, bucketDue, bucketCampaigns,
+	}
+)
+
+// Storage keeps links in an embedded B+tree key-value file.
+type Storage struct {
+	db *bolt.DB
+}
+
+var (
+	_ storage.Storager     = &Storage{}
+	_ storage.TokenPooler  = &Storage{}
+	_ storage.Counter      = &Storage{}
+	_ storage.Editor       = &Storage{}
+	_ storage.ClickCounter = &Storage{}
+	_ storage.ClickBatcher = &Storage{}
+	_ storage.Backuper     = &Storage{}
+	_ storage.TopLinker    = &Storage{}
+
+	_ storage.AttributeStorer = &Storage{}
+	_ storage.BatchCreator    = &Storage{}
+	_ storage.WebhookStorer   = &Storage{}
+	_ storage.CampaignStorer  = &Storage{}
+	_ storage.CampaignCounter = &Storage{}
+)
+
+// New opens the database file, creating it and the buckets if missing.
+func New(path string) (*Storage, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: lockTimeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range buckets {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Storage{db: db}, nil
+}
+
+// canonical returns the key of fullURL in the canonical bucket, so that
+// trivially different spellings of a URL share one token.
+func canonical(fullURL string) []byte {
+	key, err := hasher.Canonical(fullURL)
+	if err != nil {
+		return []byte(fullURL)
+	}
+	return []byte(key)
+}
+
+func (st *Storage) GetFullURL(_ context.Context,
+	token string,
+) (fullURL string, found bool, err error) {
+	err = st.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(bucketLinks).Get([]byte(token))
+		if value == nil {
+			return nil
+		}
+		fullURL, found = string(value), true
+		return nil
+	})
+	return fullURL, found, err
+}
+
+func (st *Storage) GetWithAttributes(_ context.Context,
+	token string,
+) (fullURL string, attrs storage.Attributes, found bool, err error) {
+	err = st.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(bucketLinks).Get([]byte(token))
+		if value == nil {
+			return nil
+		}
+		fullURL, found = string(value), true
+		attrs, err = storage.UnmarshalAttributes(tx.Bucket(bucketAttributes).Get([]byte(token)))
+		return err
+	})
+	return fullURL, attrs, found, err
+}
+
+func (st *Storage) CreateShortURL(ctx context.Context, fullURL string,
+	token string,
+) (err error) {
+	return st.CreateWithAttributes(ctx, fullURL, token, storage.Attributes{})
+}
+
+func (st *Storage) CreateWithAttributes(_ context.Context, fullURL string,
+	token string, attrs storage.Attributes,
+) (err error) {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		return createLink(tx, &storage.NewLink{Token: token, FullURL: fullURL, Attributes: attrs})
+	})
+}
+
+// CreateBatch writes links in one transaction, a taken token only fails its
+// own link.
+func (st *Storage) CreateBatch(_ context.Context,
+	links []storage.NewLink,
+) (errs []error, err error) {
+	err = st.db.Update(func(tx *bolt.Tx) error {
+		errs = make([]error, len(links))
+		for i := range links {
+			err := createLink(tx, &links[i])
+			if errors.Is(err, storage.ErrTokenExists) {
+				errs[i] = err
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+func createLink(tx *bolt.Tx, link *storage.NewLink) error {
+	links := tx.Bucket(bucketLinks)
+	if links.Get([]byte(link.Token)) != nil {
+		return storage.ErrTokenExists
+	}
+	err := links.Put([]byte(link.Token), []byte(link.FullURL))
+	if err != nil {
+		return err
+	}
+	if !link.Attributes.IsZero() {
+		var encoded []byte
+		encoded, err = storage.MarshalAttributes(link.Attributes)
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(bucketAttributes).Put([]byte(link.Token), encoded)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(bucketCanonical).Put(canonical(link.FullURL), []byte(link.Token))
+}
+
+func (st *Storage) AlreadyExists(_ context.Context,
+	fullURL string,
+) (token string, found bool, err error) {
+	err = st.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(bucketCanonical).Get(canonical(fullURL))
+		if value == nil {
+			return nil
+		}
+		token, found = string(value), true
+		return nil
+	})
+	return token, found, err
+}
+
+func (st *Storage) UpdateShortURL(_ context.Context, token string,
+	fullURL string,
+) (found bool, err error) {
+	err = st.db.Update(func(tx *bolt.Tx) error {
+		links := tx.Bucket(bucketLinks)
+		oldURL := links.Get([]byte(token))
+		if oldURL == nil {
+			return nil
+		}
+		found = true
+		err := removeCanonical(tx, oldURL, token)
+		if err != nil {
+			return err
+		}
+		err = links.Put([]byte(token), []byte(fullURL))
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketCanonical).Put(canonical(fullURL), []byte(token))
+	})
+	return found, err
+}
+
+func (st *Storage) DeleteShortURL(_ context.Context,
+	token string,
+) (found bool, err error) {
+	err = st.db.Update(func(tx *bolt.Tx) error {
+		links := tx.Bucket(bucketLinks)
+		fullURL := links.Get([]byte(token))
+		if fullURL == nil {
+			return nil
+		}
+		found = true
+		err := removeCanonical(tx, fullURL, token)
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(bucketClicks).Delete([]byte(token))
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(bucketAttributes).Delete([]byte(token))
+		if err != nil {
+			return err
+		}
+		return links.Delete([]byte(token))
+	})
+	return found, err
+}
+
+// removeCanonical drops the canonical entry of fullURL if it still points
+// to token.
+func removeCanonical(tx *bolt.Tx, fullURL []byte, token string) error {
+	index := tx.Bucket(bucketCanonical)
+	key := canonical(string(fullURL))
+	if string(index.Get(key)) != token {
+		return nil
+	}
+	return index.Delete(key)
+}
+
+// AddClick is batched with concurrent clicks into one write transaction, so
+// redirects do not wait for a disk sync each.
+func (st *Storage) AddClick(_ context.Context, token string) (err error) {
+	return st.db.Batch(func(tx *bolt.Tx) error {
+		clicks := tx.Bucket(bucketClicks)
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], decodeClicks(clicks.Get([]byte(token)))+1)
+		return clicks.Put([]byte(token), buf[:])
+	})
+}
+
+// AddClicks writes the clicks of all tokens in one transaction.
+func (st *Storage) AddClicks(_ context.Context, clicks map[string]int64) (err error) {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		counters := tx.Bucket(bucketClicks)
+		var buf [8]byte
+		for token, count := range clicks {
+			binary.BigEndian.PutUint64(buf[:], decodeClicks(counters.Get([]byte(token)))+uint64(count))
+			if putErr := counters.Put([]byte(token), buf[:]); putErr != nil {
+				return putErr
+			}
+		}
+		return nil
+	})
+}
+
+func (st *Storage) Clicks(_ context.Context, token string) (clicks int64, err error) {
+	err = st.db.View(func(tx *bolt.Tx) error {
+		clicks = int64(decodeClicks(tx.Bucket(bucketClicks).Get([]byte(token))))
+		return nil
+	})
+	return clicks, err
+}
+
+// TopLinks scans the clicks bucket, links never clicked are not returned.
+func (st *Storage) TopLinks(_ context.Context, limit int) (links []storage.Link, err error) {
+	err = st.db.View(func(tx *bolt.Tx) error {
+		urls, attributes := tx.Bucket(bucketLinks), tx.Bucket(bucketAttributes)
+		return tx.Bucket(bucketClicks).ForEach(func(key, value []byte) error {
+			fullURL := urls.Get(key)
+			if fullURL == nil {
+				return nil
+			}
+			attrs, err := storage.UnmarshalAttributes(attributes.Get(key))
+			if err != nil {
+				return err
+			}
+			links = append(links, storage.Link{
+				Token:      string(key),
+				FullURL:    string(fullURL),
+				Clicks:     int64(decodeClicks(value)),
+				Attributes: attrs,
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(links, func(i, j int) bool {
+		return links[i].Clicks > links[j].Clicks
+	})
+	if len(links) > limit {
+		links = links[:limit]
+	}
+	return links, nil
+}
+
+func decodeClicks(value []byte) uint64 {
+	if len(value) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(value)
+}
+
+func (st *Storage) AddTokens(_ context.Context,
+	tokens []string,
+) (added int, err error) {
+	err = st.db.Update(func(tx *bolt.Tx) error {
+		links, pool := tx.Bucket(bucketLinks), tx.Bucket(bucketPool)
+		for _, token := range tokens {
+			key := []byte(token)
+			if links.Get(key) != nil || pool.Get(key) != nil {
+				continue
+			}
+			err := pool.Put(key, []byte{})
+			if err != nil {
+				return err
+			}
+			added++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+func (st *Storage) ClaimToken(_ context.Context) (token string, found bool, err error) {
+	err = st.db.Update(func(tx *bolt.Tx) error {
+		links, pool := tx.Bucket(bucketLinks), tx.Bucket(bucketPool)
+		cursor := pool.Cursor()
+		for key, _ := cursor.First(); key != nil; key, _ = cursor.First() {
+			token = string(key)
+			err := cursor.Delete()
+			if err != nil {
+				return err
+			}
+			if links.Get(key) == nil {
+				found = true
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil || !found {
+		return "", false, err
+	}
+	return token, true, nil
+}
+
+func (st *Storage) PoolSize(_ context.Context) (size int, err error) {
+	err = st.db.View(func(tx *bolt.Tx) error {
+		size = tx.Bucket(bucketPool).Stats().KeyN
+		return nil
+	})
+	return size, err
+}
+
+func (st *Storage) Count(_ context.Context) (count int, err error) {
+	err = st.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(bucketLinks).Stats().KeyN
+		return nil
+	})
+	return count, err
+}
+
+// Backup streams a consistent copy of the database file to w. Writes are
+// not blocked while it runs.
+func (st *Storage) Backup(ctx context.Context, w io.Writer) (written int64, err error) {
+	err = st.db.View(func(tx *bolt.Tx) error {
+		written, err = tx.WriteTo(&contextWriter{ctx: ctx, w: w})
+		return err
+	})
+	if err != nil && ctx.Err() != nil {
+		// bolt loses the error chain of the writer.
+		return written, ctx.Err()
+	}
+	return written, err
+}
+
+// contextWriter stops a long backup once the client has gone.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (writer *contextWriter) Write(p []byte) (int, error) {
+	if err := writer.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return writer.w.Write(p)
+}
+
+func (st *Storage) Close() error {
+	return st.db.Close()
+}
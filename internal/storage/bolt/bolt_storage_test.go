@@ -0,0 +1,197 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+const (
+	fullURL = "https://mai.ru"
+	token   = "mai"
+)
+
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	st, err := New(filepath.Join(t.TempDir(), "url_short.bolt"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = st.Close()
+	})
+	return st
+}
+
+func TestStorage(t *testing.T) {
+	t.Run("create and get", func(t *testing.T) {
+		st := newTestStorage(t)
+		ctx := context.Background()
+
+		_, found, err := st.GetFullURL(ctx, token)
+		require.NoError(t, err)
+		assert.False(t, found)
+
+		require.NoError(t, st.CreateShortURL(ctx, fullURL, token))
+		url, found, err := st.GetFullURL(ctx, token)
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, fullURL, url)
+
+		err = st.CreateShortURL(ctx, "https://ya.ru", token)
+		assert.ErrorIs(t, err, storage.ErrTokenExists)
+	})
+	t.Run("already exists by canonical URL", func(t *testing.T) {
+		st := newTestStorage(t)
+		ctx := context.Background()
+		require.NoError(t, st.CreateShortURL(ctx, "https://Mai.RU:443?b=2&a=1", token))
+
+		existing, found, err := st.AlreadyExists(ctx, "https://mai.ru/?a=1&b=2")
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, token, existing)
+	})
+	t.Run("update and delete", func(t *testing.T) {
+		st := newTestStorage(t)
+		ctx := context.Background()
+		require.NoError(t, st.CreateShortURL(ctx, fullURL, token))
+		require.NoError(t, st.AddClick(ctx, token))
+
+		found, err := st.UpdateShortURL(ctx, token, "https://ya.ru")
+		require.NoError(t, err)
+		assert.True(t, found)
+		_, found, err = st.AlreadyExists(ctx, fullURL)
+		require.NoError(t, err)
+		assert.False(t, found)
+		existing, _, err := st.AlreadyExists(ctx, "https://ya.ru")
+		require.NoError(t, err)
+		assert.Equal(t, token, existing)
+
+		found, err = st.DeleteShortURL(ctx, token)
+		require.NoError(t, err)
+		assert.True(t, found)
+		_, found, err = st.GetFullURL(ctx, token)
+		require.NoError(t, err)
+		assert.False(t, found)
+		clicks, err := st.Clicks(ctx, token)
+		require.NoError(t, err)
+		assert.Zero(t, clicks)
+
+		found, err = st.DeleteShortURL(ctx, token)
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+	t.Run("count", func(t *testing.T) {
+		st := newTestStorage(t)
+		ctx := context.Background()
+		require.NoError(t, st.CreateShortURL(ctx, fullURL, token))
+
+		count, err := st.Count(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+}
+
+func TestClicks(t *testing.T) {
+	st := newTestStorage(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, st.AddClick(ctx, token))
+		}()
+	}
+	wg.Wait()
+
+	clicks, err := st.Clicks(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(50), clicks)
+
+	t.Run("top links", func(t *testing.T) {
+		require.NoError(t, st.CreateShortURL(ctx, fullURL, token))
+		require.NoError(t, st.CreateShortURL(ctx, "https://ya.ru", "ya"))
+		require.NoError(t, st.CreateShortURL(ctx, "https://go.dev", "go"))
+		require.NoError(t, st.AddClick(ctx, "ya"))
+
+		links, err := st.TopLinks(ctx, 5)
+		require.NoError(t, err)
+		require.Len(t, links, 2)
+		assert.Equal(t, token, links[0].Token)
+		assert.Equal(t, fullURL, links[0].FullURL)
+		assert.Equal(t, "ya", links[1].Token)
+
+		links, err = st.TopLinks(ctx, 1)
+		require.NoError(t, err)
+		assert.Len(t, links, 1)
+	})
+}
+
+func TestTokenPool(t *testing.T) {
+	st := newTestStorage(t)
+	ctx := context.Background()
+	require.NoError(t, st.CreateShortURL(ctx, fullURL, "used"))
+
+	added, err := st.AddTokens(ctx, []string{"a", "b", "a", "used"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+
+	size, err := st.PoolSize(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, size)
+
+	claimed := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		claim, found, err := st.ClaimToken(ctx)
+		require.NoError(t, err)
+		require.True(t, found)
+		claimed[claim] = true
+	}
+	assert.Equal(t, map[string]bool{"a": true, "b": true}, claimed)
+
+	_, found, err := st.ClaimToken(ctx)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestBackup(t *testing.T) {
+	st := newTestStorage(t)
+	ctx := context.Background()
+	require.NoError(t, st.CreateShortURL(ctx, fullURL, token))
+	require.NoError(t, st.AddClick(ctx, token))
+
+	var backup bytes.Buffer
+	written, err := st.Backup(ctx, &backup)
+	require.NoError(t, err)
+	assert.Equal(t, int64(backup.Len()), written)
+
+	path := filepath.Join(t.TempDir(), "backup.bolt")
+	require.NoError(t, os.WriteFile(path, backup.Bytes(), 0o600))
+	restored, err := New(path)
+	require.NoError(t, err)
+	defer func() {
+		_ = restored.Close()
+	}()
+	url, found, err := restored.GetFullURL(ctx, token)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, fullURL, url)
+	clicks, err := restored.Clicks(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), clicks)
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := st.Backup(ctx, &bytes.Buffer{})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,107 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+// campaignKey is the tenant and the name of a template separated by a zero
+// byte, so that the templates of a tenant are one range sorted by name.
+func campaignKey(tenant string, name string) []byte {
+	return append(campaignPrefix(tenant), name...)
+}
+
+func campaignPrefix(tenant string) []byte {
+	return append([]byte(tenant), 0)
+}
+
+func (st *Storage) SaveCampaign(_ context.Context, campaign *storage.Campaign) (err error) {
+	value, err := json.Marshal(campaign)
+	if err != nil {
+		return err
+	}
+	return st.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketCampaigns).Put(campaignKey(campaign.Tenant, campaign.Name), value)
+	})
+}
+
+func (st *Storage) Campaign(_ context.Context,
+	tenant string, name string,
+) (campaign storage.Campaign, found bool, err error) {
+	err = st.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(bucketCampaigns).Get(campaignKey(tenant, name))
+		if value == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(value, &campaign)
+	})
+	return campaign, found, err
+}
+
+func (st *Storage) Campaigns(_ context.Context, tenant string) (campaigns []storage.Campaign, err error) {
+	prefix := campaignPrefix(tenant)
+	err = st.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(bucketCampaigns).Cursor()
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			var campaign storage.Campaign
+			err := json.Unmarshal(value, &campaign)
+			if err != nil {
+				return err
+			}
+			campaigns = append(campaigns, campaign)
+		}
+		return nil
+	})
+	return campaigns, err
+}
+
+func (st *Storage) DeleteCampaign(_ context.Context, tenant string, name string) (found bool, err error) {
+	err = st.db.Update(func(tx *bolt.Tx) error {
+		campaigns := tx.Bucket(bucketCampaigns)
+		key := campaignKey(tenant, name)
+		if campaigns.Get(key) == nil {
+			return nil
+		}
+		found = true
+		return campaigns.Delete(key)
+	})
+	return found, err
+}
+
+// CampaignClicks scans the attributes bucket, so it is as slow as there are
+// links with attributes.
+func (st *Storage) CampaignClicks(_ context.Context, tenant string) (stats []storage.CampaignClicks, err error) {
+	byCampaign := make(map[string]int)
+	err = st.db.View(func(tx *bolt.Tx) error {
+		clicks := tx.Bucket(bucketClicks)
+		return tx.Bucket(bucketAttributes).ForEach(func(key, value []byte) error {
+			attrs, err := storage.UnmarshalAttributes(value)
+			if err != nil {
+				return err
+			}
+			if attrs.UTM.Campaign == "" || (tenant != "" && attrs.Tenant != tenant) {
+				return nil
+			}
+			index, found := byCampaign[attrs.UTM.Campaign]
+			if !found {
+				index = len(stats)
+				byCampaign[attrs.UTM.Campaign] = index
+				stats = append(stats, storage.CampaignClicks{Campaign: attrs.UTM.Campaign})
+			}
+			stats[index].Links++
+			stats[index].Clicks += int64(decodeClicks(clicks.Get(key)))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	storage.SortCampaignClicks(stats)
+	return stats, nil
+}
@@ -0,0 +1,250 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+// dueKey orders deliveries by the time of the next attempt, the ID makes
+// the key unique.
+func dueKey(delivery *storage.WebhookDelivery) []byte {
+	key := make([]byte, 8, 8+len(delivery.ID))
+	binary.BigEndian.PutUint64(key, uint64(delivery.NextAttemptAt.UnixNano()))
+	return append(key, delivery.ID...)
+}
+
+func (st *Storage) CreateWebhook(_ context.Context, webhook *storage.Webhook) (err error) {
+	value, err := json.Marshal(webhook)
+	if err != nil {
+		return err
+	}
+	return st.db.Update(func(tx *bolt.Tx) error {
+		webhooks := tx.Bucket(bucketWebhooks)
+		if webhooks.Get([]byte(webhook.ID)) != nil {
+			return storage.ErrTokenExists
+		}
+		return webhooks.Put([]byte(webhook.ID), value)
+	})
+}
+
+func (st *Storage) Webhooks(_ context.Context, tenant string) (webhooks []storage.Webhook, err error) {
+	err = st.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketWebhooks).ForEach(func(_, value []byte) error {
+			var webhook storage.Webhook
+			err := json.Unmarshal(value, &webhook)
+			if err != nil {
+				return err
+			}
+			if tenant == "" || webhook.Tenant == tenant {
+				webhooks = append(webhooks, webhook)
+			}
+			return nil
+		})
+	})
+	sort.SliceStable(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks, err
+}
+
+func (st *Storage) DeleteWebhook(_ context.Context, tenant string, id string) (found bool, err error) {
+	err = st.db.Update(func(tx *bolt.Tx) error {
+		webhooks := tx.Bucket(bucketWebhooks)
+		var webhook storage.Webhook
+		value := webhooks.Get([]byte(id))
+		if value == nil {
+			return nil
+		}
+		err := json.Unmarshal(value, &webhook)
+		if err != nil || webhook.Tenant != tenant {
+			return err
+		}
+		found = true
+		err = webhooks.Delete([]byte(id))
+		if err != nil {
+			return err
+		}
+
+		var deleted []storage.WebhookDelivery
+		err = tx.Bucket(bucketDeliveries).ForEach(func(_, value []byte) error {
+			var delivery storage.WebhookDelivery
+			err := json.Unmarshal(value, &delivery)
+			if err == nil && delivery.WebhookID == id {
+				deleted = append(deleted, delivery)
+			}
+			return err
+		})
+		for i := 0; err == nil && i < len(deleted); i++ {
+			err = deleteDelivery(tx, &deleted[i])
+		}
+		return err
+	})
+	return found, err
+}
+
+func (st *Storage) EnqueueDeliveries(_ context.Context, deliveries []storage.WebhookDelivery) (err error) {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		for i := range deliveries {
+			if tx.Bucket(bucketDeliveries).Get([]byte(deliveries[i].ID)) != nil {
+				return storage.ErrTokenExists
+			}
+			err := putDelivery(tx, &deliveries[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (st *Storage) ClaimDeliveries(_ context.Context, now time.Time, lease time.Duration,
+	limit int,
+) (deliveries []storage.WebhookDelivery, err error) {
+	err = st.db.Update(func(tx *bolt.Tx) error {
+		end := dueKey(&storage.WebhookDelivery{NextAttemptAt: now.Add(time.Nanosecond)})
+		cursor := tx.Bucket(bucketDue).Cursor()
+		for key, _ := cursor.First(); key != nil && len(deliveries) < limit; key, _ = cursor.Next() {
+			if bytes.Compare(key, end) >= 0 {
+				break
+			}
+			delivery, err := getDelivery(tx, string(key[8:]))
+			if err != nil {
+				return err
+			}
+			deliveries = append(deliveries, delivery)
+		}
+		for i := range deliveries {
+			leased := deliveries[i]
+			leased.NextAttemptAt = now.Add(lease)
+			err := updateDelivery(tx, &deliveries[i], &leased)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (st *Storage) UpdateDelivery(_ context.Context, delivery *storage.WebhookDelivery) (err error) {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		stored, err := getDelivery(tx, delivery.ID)
+		if err != nil || stored.ID == "" {
+			return err
+		}
+		updated := stored
+		updated.Attempts = delivery.Attempts
+		updated.NextAttemptAt = delivery.NextAttemptAt
+		updated.LastError = delivery.LastError
+		updated.Dead = delivery.Dead
+		return updateDelivery(tx, &stored, &updated)
+	})
+}
+
+func (st *Storage) DeleteDelivery(_ context.Context, id string) (err error) {
+	return st.db.Update(func(tx *bolt.Tx) error {
+		stored, err := getDelivery(tx, id)
+		if err != nil || stored.ID == "" {
+			return err
+		}
+		return deleteDelivery(tx, &stored)
+	})
+}
+
+func (st *Storage) DeadDeliveries(_ context.Context, tenant string,
+	limit int,
+) (deliveries []storage.WebhookDelivery, err error) {
+	err = st.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketDeliveries).ForEach(func(_, value []byte) error {
+			var delivery storage.WebhookDelivery
+			err := json.Unmarshal(value, &delivery)
+			if err == nil && delivery.Dead && delivery.Tenant == tenant {
+				deliveries = append(deliveries, delivery)
+			}
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID > deliveries[j].ID
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (st *Storage) ReplayDelivery(_ context.Context, tenant string, id string,
+	now time.Time,
+) (found bool, err error) {
+	err = st.db.Update(func(tx *bolt.Tx) error {
+		stored, err := getDelivery(tx, id)
+		if err != nil || !stored.Dead || stored.Tenant != tenant {
+			return err
+		}
+		found = true
+		replayed := stored
+		replayed.Dead = false
+		replayed.Attempts = 0
+		replayed.LastError = ""
+		replayed.NextAttemptAt = now
+		return updateDelivery(tx, &stored, &replayed)
+	})
+	return found, err
+}
+
+// getDelivery returns a zero delivery if there is none with id.
+func getDelivery(tx *bolt.Tx, id string) (delivery storage.WebhookDelivery, err error) {
+	value := tx.Bucket(bucketDeliveries).Get([]byte(id))
+	if value == nil {
+		return delivery, nil
+	}
+	err = json.Unmarshal(value, &delivery)
+	return delivery, err
+}
+
+func putDelivery(tx *bolt.Tx, delivery *storage.WebhookDelivery) error {
+	value, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	err = tx.Bucket(bucketDeliveries).Put([]byte(delivery.ID), value)
+	if err != nil || delivery.Dead {
+		return err
+	}
+	return tx.Bucket(bucketDue).Put(dueKey(delivery), nil)
+}
+
+// updateDelivery replaces stored with updated, moving its key in the due
+// index.
+func updateDelivery(tx *bolt.Tx, stored *storage.WebhookDelivery, updated *storage.WebhookDelivery) error {
+	err := tx.Bucket(bucketDue).Delete(dueKey(stored))
+	if err != nil {
+		return err
+	}
+	return putDelivery(tx, updated)
+}
+
+func deleteDelivery(tx *bolt.Tx, delivery *storage.WebhookDelivery) error {
+	err := tx.Bucket(bucketDue).Delete(dueKey(delivery))
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketDeliveries).Delete([]byte(delivery.ID))
+}
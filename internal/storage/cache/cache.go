@@ -0,0 +1,281 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+var cacheStats = expvar.NewMap("cache")
+
+type Config struct {
+	// Size is the maximal number of cached tokens, found or not.
+	Size int
+	// TTL is how long a found link is served from the cache.
+	TTL time.Duration
+	// NegativeTTL is how long an unknown token is remembered as unknown,
+	// zero disables negative caching.
+	NegativeTTL time.Duration
+}
+
+// Notifier delivers changes of links made by other replicas.
+type Notifier interface {
+	// Listen calls invalidate with every changed token, and flush when
+	// changes could have been missed, until ctx is done.
+	Listen(ctx context.Context, invalidate func(token string), flush func()) error
+}
+
+// Cache is a read-through LRU cache of GetFullURL in front of any storage.
+// Concurrent misses of one token are loaded from the storage once.
+type Cache struct {
+	storager storage.Storager
+	cfg      Config
+	now      func() time.Time
+	group    singleflight.Group
+
+	mutex sync.Mutex
+	items map[string]*list.Element
+	order *list.List
+	// generation changes on every invalidation, so that a load started
+	// before it does not put a stale link back.
+	generation uint64
+}
+
+type entry struct {
+	token   string
+	fullURL string
+	attrs   storage.Attributes
+	found   bool
+	expires time.Time
+}
+
+type loaded struct {
+	fullURL string
+	attrs   storage.Attributes
+	found   bool
+}
+
+var (
+	_ storage.Storager        = &Cache{}
+	_ storage.Editor          = &Cache{}
+	_ storage.Wrapper         = &Cache{}
+	_ storage.AttributeStorer = &Cache{}
+	_ storage.BatchCreator    = &Cache{}
+)
+
+func New(st storage.Storager, cfg Config) *Cache {
+	return &Cache{
+		storager: st,
+		cfg:      cfg,
+		now:      time.Now,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (cache *Cache) GetFullURL(ctx context.Context,
+	token string,
+) (fullURL string, found bool, err error) {
+	fullURL, _, found, err = cache.GetWithAttributes(ctx, token)
+	return fullURL, found, err
+}
+
+// GetWithAttributes caches the attributes along with the link, they are
+// zero when the storage does not keep them.
+func (cache *Cache) GetWithAttributes(ctx context.Context,
+	token string,
+) (fullURL string, attrs storage.Attributes, found bool, err error) {
+	if cached, ok := cache.get(token); ok {
+		if cached.found {
+			cacheStats.Add("hits", 1)
+		} else {
+			cacheStats.Add("negative_hits", 1)
+		}
+		return cached.fullURL, cached.attrs, cached.found, nil
+	}
+	cacheStats.Add("misses", 1)
+
+	result, err, _ := cache.group.Do(token, func() (any, error) {
+		generation := cache.currentGeneration()
+		var link loaded
+		var loadErr error
+		link.fullURL, link.attrs, link.found, loadErr = storage.GetLink(ctx, cache.storager, token)
+		if loadErr != nil {
+			return loaded{}, loadErr
+		}
+		cacheStats.Add("loads", 1)
+		cache.put(token, link, generation)
+		return link, nil
+	})
+	if err != nil {
+		return "", storage.Attributes{}, false, err
+	}
+	link := result.(loaded)
+	return link.fullURL, link.attrs, link.found, nil
+}
+
+// CreateShortURL forgets that token was unknown.
+func (cache *Cache) CreateShortURL(ctx context.Context, fullURL string,
+	token string,
+) (err error) {
+	err = cache.storager.CreateShortURL(ctx, fullURL, token)
+	cache.Invalidate(token)
+	return err
+}
+
+// CreateWithAttributes forgets that token was unknown.
+func (cache *Cache) CreateWithAttributes(ctx context.Context, fullURL string,
+	token string, attrs storage.Attributes,
+) (err error) {
+	err = storage.CreateLink(ctx, cache.storager, &storage.NewLink{Token: token, FullURL: fullURL, Attributes: attrs})
+	cache.Invalidate(token)
+	return err
+}
+
+// CreateBatch forgets that the tokens of links were unknown.
+func (cache *Cache) CreateBatch(ctx context.Context,
+	links []storage.NewLink,
+) (errs []error, err error) {
+	errs, err = storage.CreateLinks(ctx, cache.storager, links)
+	for _, link := range links {
+		cache.Invalidate(link.Token)
+	}
+	return errs, err
+}
+
+func (cache *Cache) AlreadyExists(ctx context.Context,
+	fullURL string,
+) (token string, found bool, err error) {
+	return cache.storager.AlreadyExists(ctx, fullURL)
+}
+
+func (cache *Cache) UpdateShortURL(ctx context.Context, token string,
+	fullURL string,
+) (found bool, err error) {
+	editor, ok := storage.As[storage.Editor](cache.storager)
+	if !ok {
+		return false, errors.ErrUnsupported
+	}
+	found, err = editor.UpdateShortURL(ctx, token, fullURL)
+	cache.Invalidate(token)
+	return found, err
+}
+
+func (cache *Cache) DeleteShortURL(ctx context.Context,
+	token string,
+) (found bool, err error) {
+	editor, ok := storage.As[storage.Editor](cache.storager)
+	if !ok {
+		return false, errors.ErrUnsupported
+	}
+	found, err = editor.DeleteShortURL(ctx, token)
+	cache.Invalidate(token)
+	return found, err
+}
+
+// Invalidate drops token from the cache, so the next read loads it from
+// the storage.
+func (cache *Cache) Invalidate(token string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.generation++
+	if element, found := cache.items[token]; found {
+		cache.remove(element)
+		cacheStats.Add("invalidations", 1)
+	}
+}
+
+// Flush drops every cached token.
+func (cache *Cache) Flush() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.generation++
+	cache.items = make(map[string]*list.Element)
+	cache.order.Init()
+	cacheStats.Add("flushes", 1)
+}
+
+// Follow keeps the cache consistent with changes made by other replicas
+// until ctx is done.
+func (cache *Cache) Follow(ctx context.Context, notifier Notifier) error {
+	return notifier.Listen(ctx, cache.Invalidate, cache.Flush)
+}
+
+func (cache *Cache) Unwrap() storage.Storager {
+	return cache.storager
+}
+
+func (cache *Cache) Close() error {
+	return cache.storager.Close()
+}
+
+func (cache *Cache) get(token string) (entry, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, found := cache.items[token]
+	if !found {
+		return entry{}, false
+	}
+	cached := element.Value.(*entry)
+	if !cache.now().Before(cached.expires) {
+		cache.remove(element)
+		return entry{}, false
+	}
+	cache.order.MoveToFront(element)
+	return *cached, true
+}
+
+func (cache *Cache) put(token string, link loaded, generation uint64) {
+	ttl := cache.cfg.TTL
+	if !link.found {
+		ttl = cache.cfg.NegativeTTL
+	}
+	if ttl <= 0 || cache.cfg.Size <= 0 {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if generation != cache.generation {
+		return
+	}
+	cached := &entry{
+		token:   token,
+		fullURL: link.fullURL,
+		attrs:   link.attrs,
+		found:   link.found,
+		expires: cache.now().Add(ttl),
+	}
+	if element, exists := cache.items[token]; exists {
+		element.Value = cached
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.items[token] = cache.order.PushFront(cached)
+	for cache.order.Len() > cache.cfg.Size {
+		cache.remove(cache.order.Back())
+		cacheStats.Add("evictions", 1)
+	}
+}
+
+func (cache *Cache) remove(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.items, element.Value.(*entry).token)
+}
+
+func (cache *Cache) currentGeneration() uint64 {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.generation
+}
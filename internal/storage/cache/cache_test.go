@@ -0,0 +1,278 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+	mock_storage "github.com/ilyakharev/url-short/internal/storage/mock"
+)
+
+var testConfig = Config{Size: 2, TTL: time.Minute, NegativeTTL: time.Second}
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func newTestCache(st storage.Storager) (*Cache, *clock) {
+	cache := New(st, testConfig)
+	c := &clock{now: time.Unix(0, 0)}
+	cache.now = c.Now
+	return cache, c
+}
+
+func TestCache_GetFullURL(t *testing.T) {
+	ctx := context.Background()
+	t.Run("hit", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		st := mock_storage.NewMockStorager(ctrl)
+		st.EXPECT().GetFullURL(gomock.Any(), "a").Return("https://mai.ru", true, nil).Times(1)
+		cache, _ := newTestCache(st)
+
+		for i := 0; i < 3; i++ {
+			fullURL, found, err := cache.GetFullURL(ctx, "a")
+			require.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, "https://mai.ru", fullURL)
+		}
+	})
+	t.Run("ttl", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		st := mock_storage.NewMockStorager(ctrl)
+		st.EXPECT().GetFullURL(gomock.Any(), "a").Return("https://mai.ru", true, nil).Times(2)
+		cache, c := newTestCache(st)
+
+		_, _, _ = cache.GetFullURL(ctx, "a")
+		c.now = c.now.Add(time.Minute - time.Nanosecond)
+		_, _, _ = cache.GetFullURL(ctx, "a")
+		c.now = c.now.Add(time.Nanosecond)
+		_, _, _ = cache.GetFullURL(ctx, "a")
+	})
+	t.Run("negative", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		st := mock_storage.NewMockStorager(ctrl)
+		st.EXPECT().GetFullURL(gomock.Any(), "a").Return("", false, nil).Times(2)
+		cache, c := newTestCache(st)
+
+		for i := 0; i < 3; i++ {
+			_, found, err := cache.GetFullURL(ctx, "a")
+			require.NoError(t, err)
+			assert.False(t, found)
+		}
+		c.now = c.now.Add(time.Second)
+		_, _, _ = cache.GetFullURL(ctx, "a")
+	})
+	t.Run("errors are not cached", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		st := mock_storage.NewMockStorager(ctrl)
+		st.EXPECT().GetFullURL(gomock.Any(), "a").Return("", false, errors.New("some")).Times(2)
+		cache, _ := newTestCache(st)
+
+		_, _, err := cache.GetFullURL(ctx, "a")
+		require.Error(t, err)
+		_, _, err = cache.GetFullURL(ctx, "a")
+		require.Error(t, err)
+	})
+	t.Run("evict least recently used", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		st := mock_storage.NewMockStorager(ctrl)
+		st.EXPECT().GetFullURL(gomock.Any(), "a").Return("https://a.ru", true, nil).Times(1)
+		st.EXPECT().GetFullURL(gomock.Any(), "b").Return("https://b.ru", true, nil).Times(2)
+		st.EXPECT().GetFullURL(gomock.Any(), "c").Return("https://c.ru", true, nil).Times(1)
+		cache, _ := newTestCache(st)
+
+		_, _, _ = cache.GetFullURL(ctx, "a")
+		_, _, _ = cache.GetFullURL(ctx, "b")
+		_, _, _ = cache.GetFullURL(ctx, "a")
+		_, _, _ = cache.GetFullURL(ctx, "c")
+		_, _, _ = cache.GetFullURL(ctx, "a")
+		_, _, _ = cache.GetFullURL(ctx, "b")
+	})
+}
+
+// blockingStorager counts GetFullURL calls and holds them until released.
+type blockingStorager struct {
+	storage.Storager
+	release chan struct{}
+	mutex   sync.Mutex
+	calls   int
+}
+
+func (st *blockingStorager) GetFullURL(context.Context, string) (string, bool, error) {
+	st.mutex.Lock()
+	st.calls++
+	st.mutex.Unlock()
+	<-st.release
+	return "https://mai.ru", true, nil
+}
+
+func TestCache_Singleflight(t *testing.T) {
+	st := &blockingStorager{release: make(chan struct{})}
+	cache := New(st, testConfig)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fullURL, found, err := cache.GetFullURL(context.Background(), "a")
+			assert.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, "https://mai.ru", fullURL)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(st.release)
+	wg.Wait()
+
+	assert.Equal(t, 1, st.calls)
+}
+
+func TestCache_Invalidate(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	cache := New(memory, testConfig)
+
+	_, found, err := cache.GetFullURL(ctx, "a")
+	require.NoError(t, err)
+	require.False(t, found)
+
+	require.NoError(t, cache.CreateShortURL(ctx, "https://mai.ru", "a"))
+	fullURL, found, err := cache.GetFullURL(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "https://mai.ru", fullURL)
+
+	found, err = cache.UpdateShortURL(ctx, "a", "https://ya.ru")
+	require.NoError(t, err)
+	require.True(t, found)
+	fullURL, _, err = cache.GetFullURL(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "https://ya.ru", fullURL)
+
+	found, err = cache.DeleteShortURL(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, found)
+	_, found, err = cache.GetFullURL(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	t.Run("stale load after invalidation", func(t *testing.T) {
+		cache := New(memory, testConfig)
+		generation := cache.currentGeneration()
+		cache.Invalidate("b")
+		cache.put("b", loaded{fullURL: "https://stale.ru", found: true}, generation)
+
+		_, found, err := cache.GetFullURL(ctx, "b")
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+	t.Run("flush", func(t *testing.T) {
+		require.NoError(t, memory.CreateShortURL(ctx, "https://go.dev", "c"))
+		_, _, _ = cache.GetFullURL(ctx, "c")
+		_, err := memory.UpdateShortURL(ctx, "c", "https://go.dev/doc")
+		require.NoError(t, err)
+
+		cache.Flush()
+		fullURL, _, err := cache.GetFullURL(ctx, "c")
+		require.NoError(t, err)
+		assert.Equal(t, "https://go.dev/doc", fullURL)
+	})
+	t.Run("unsupported edit", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		cache := New(mock_storage.NewMockStorager(ctrl), testConfig)
+		_, err := cache.DeleteShortURL(ctx, "a")
+		assert.ErrorIs(t, err, errors.ErrUnsupported)
+	})
+}
+
+func TestAs(t *testing.T) {
+	cache := New(inmemory.New(), testConfig)
+
+	counter, ok := storage.As[storage.Counter](cache)
+	assert.True(t, ok)
+	assert.NotNil(t, counter)
+	_, ok = storage.As[storage.Backuper](cache)
+	assert.False(t, ok)
+}
+
+// fakeNotifier delivers changes sent to its channels and reports to
+// handled once each is applied.
+type fakeNotifier struct {
+	tokens  chan string
+	flushes chan struct{}
+	handled chan struct{}
+}
+
+func (notifier *fakeNotifier) Listen(ctx context.Context, invalidate func(token string),
+	flush func(),
+) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case token := <-notifier.tokens:
+			invalidate(token)
+		case <-notifier.flushes:
+			flush()
+		}
+		notifier.handled <- struct{}{}
+	}
+}
+
+func TestCache_Follow(t *testing.T) {
+	ctx := context.Background()
+	memory := inmemory.New()
+	require.NoError(t, memory.CreateShortURL(ctx, "https://mai.ru", "a"))
+	require.NoError(t, memory.CreateShortURL(ctx, "https://ya.ru", "b"))
+	cache := New(memory, testConfig)
+	_, _, _ = cache.GetFullURL(ctx, "a")
+	_, _, _ = cache.GetFullURL(ctx, "b")
+
+	notifier := &fakeNotifier{
+		tokens:  make(chan string),
+		flushes: make(chan struct{}),
+		handled: make(chan struct{}),
+	}
+	followCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		done <- cache.Follow(followCtx, notifier)
+	}()
+
+	// Another replica changes the links behind the cache.
+	_, err := memory.UpdateShortURL(ctx, "a", "https://mai.ru/new")
+	require.NoError(t, err)
+	_, err = memory.UpdateShortURL(ctx, "b", "https://ya.ru/new")
+	require.NoError(t, err)
+
+	notifier.tokens <- "a"
+	<-notifier.handled
+	fullURL, _, err := cache.GetFullURL(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "https://mai.ru/new", fullURL)
+	fullURL, _, err = cache.GetFullURL(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "https://ya.ru", fullURL, "b is not notified yet")
+
+	notifier.flushes <- struct{}{}
+	<-notifier.handled
+	fullURL, _, err = cache.GetFullURL(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "https://ya.ru/new", fullURL)
+
+	cancel()
+	require.NoError(t, <-done)
+}
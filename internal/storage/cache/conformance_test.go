@@ -0,0 +1,16 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+	"github.com/ilyakharev/url-short/internal/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storager {
+		return New(inmemory.New(), Config{Size: 100, TTL: time.Minute, NegativeTTL: time.Minute})
+	})
+}
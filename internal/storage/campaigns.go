@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+)
+
+const (
+	MaxUTMLength      = 256
+	MaxCampaignLength = 64
+)
+
+// ErrInvalidUTM is returned for a UTM parameter longer than MaxUTMLength.
+var ErrInvalidUTM = fmt.Errorf("utm parameters must be at most %d bytes", MaxUTMLength)
+
+// ErrInvalidCampaignName is returned for a template name that is not 1 to
+// MaxCampaignLength letters, digits, dashes or underscores.
+var ErrInvalidCampaignName = fmt.Errorf("campaign name must be 1 to %d letters, digits, dashes or underscores",
+	MaxCampaignLength)
+
+// ErrUnknownCampaign is returned for a campaign template the tenant has not
+// saved.
+var ErrUnknownCampaign = errors.New("unknown campaign template")
+
+// ErrCampaignWithoutTenant is returned when a campaign template is used for a
+// link of nobody, templates belong to tenants.
+var ErrCampaignWithoutTenant = errors.New("campaign template needs a tenant")
+
+// ErrNoCampaigns is returned when a campaign template is used with a storage
+// that does not keep them.
+var ErrNoCampaigns = fmt.Errorf("storage does not keep campaign templates: %w", errors.ErrUnsupported)
+
+// UTM are the utm_ parameters a link adds to the query of its target URL,
+// empty ones are not added. The JSON names are the ones queried by the SQL
+// storages in attributes.
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+func (utm UTM) IsZero() bool {
+	return utm == UTM{}
+}
+
+// Merge returns utm with its empty parameters taken from base.
+func (utm UTM) Merge(base UTM) UTM {
+	return UTM{
+		Source:   orDefault(utm.Source, base.Source),
+		Medium:   orDefault(utm.Medium, base.Medium),
+		Campaign: orDefault(utm.Campaign, base.Campaign),
+		Term:     orDefault(utm.Term, base.Term),
+		Content:  orDefault(utm.Content, base.Content),
+	}
+}
+
+func orDefault(value string, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// Apply sets the parameters of utm in query, replacing the values it has.
+func (utm UTM) Apply(query url.Values) {
+	for _, param := range utm.params() {
+		if param.value != "" {
+			query.Set(param.name, param.value)
+		}
+	}
+}
+
+type utmParam struct {
+	name  string
+	value string
+}
+
+func (utm UTM) params() []utmParam {
+	return []utmParam{
+		{"utm_source", utm.Source},
+		{"utm_medium", utm.Medium},
+		{"utm_campaign", utm.Campaign},
+		{"utm_term", utm.Term},
+		{"utm_content", utm.Content},
+	}
+}
+
+// CheckUTM accepts parameters of up to MaxUTMLength bytes.
+func CheckUTM(utm UTM) error {
+	for _, param := range utm.params() {
+		if len(param.value) > MaxUTMLength {
+			return ErrInvalidUTM
+		}
+	}
+	return nil
+}
+
+func CheckCampaignName(name string) error {
+	if !isName(name, MaxCampaignLength) {
+		return ErrInvalidCampaignName
+	}
+	return nil
+}
+
+// Campaign is a template of UTM parameters saved by a tenant, so that links
+// of one campaign are tagged the same way.
+type Campaign struct {
+	Tenant    string
+	Name      string
+	UTM       UTM
+	UpdatedAt time.Time
+}
+
+// CampaignStorer is implemented by storages able to keep campaign templates.
+type CampaignStorer interface {
+	// SaveCampaign creates the template or replaces the one of the tenant
+	// with the same name.
+	SaveCampaign(ctx context.Context, campaign *Campaign) (err error)
+	Campaign(ctx context.Context, tenant string, name string) (campaign Campaign, found bool, err error)
+	// Campaigns lists the templates of tenant by name.
+	Campaigns(ctx context.Context, tenant string) (campaigns []Campaign, err error)
+	DeleteCampaign(ctx context.Context, tenant string, name string) (found bool, err error)
+}
+
+// CampaignClicks are the clicks of the links tagged with one utm_campaign.
+type CampaignClicks struct {
+	Campaign string
+	Links    int
+	Clicks   int64
+}
+
+// CampaignCounter is implemented by storages able to sum clicks by the UTM
+// campaign of links.
+type CampaignCounter interface {
+	// CampaignClicks groups the links of tenant, of every tenant when it is
+	// empty, by UTM campaign, most clicked first. Links without a campaign
+	// are left out.
+	CampaignClicks(ctx context.Context, tenant string) (stats []CampaignClicks, err error)
+}
+
+// SortCampaignClicks orders stats the way CampaignClicks returns them.
+func SortCampaignClicks(stats []CampaignClicks) {
+	slices.SortFunc(stats, func(a, b CampaignClicks) int {
+		if order := cmp.Compare(b.Clicks, a.Clicks); order != 0 {
+			return order
+		}
+		return cmp.Compare(a.Campaign, b.Campaign)
+	})
+}
+
+// CampaignUTM returns the parameters of the campaign template name of
+// tenant, to be merged into the ones set on a link.
+func CampaignUTM(ctx context.Context, st Storager, tenant string, name string) (UTM, error) {
+	if tenant == "" {
+		return UTM{}, ErrCampaignWithoutTenant
+	}
+	campaigns, ok := As[CampaignStorer](st)
+	if !ok {
+		return UTM{}, ErrNoCampaigns
+	}
+	campaign, found, err := campaigns.Campaign(ctx, tenant, name)
+	if err != nil {
+		return UTM{}, err
+	}
+	if !found {
+		return UTM{}, ErrUnknownCampaign
+	}
+	return campaign.UTM, nil
+}
@@ -0,0 +1,117 @@
+package inmemory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+// campaignKey is a template name within its tenant.
+type campaignKey struct {
+	tenant string
+	name   string
+}
+
+// campaignStore keeps campaign templates under one lock, as webhookStore
+// does. Durable does not persist them.
+type campaignStore struct {
+	mutex     sync.Mutex
+	campaigns map[campaignKey]storage.Campaign
+}
+
+func newCampaignStore() *campaignStore {
+	return &campaignStore{campaigns: make(map[campaignKey]storage.Campaign)}
+}
+
+func (storage *Inmemory) SaveCampaign(_ context.Context, campaign *storage.Campaign) (err error) {
+	store := storage.campaigns
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.campaigns[campaignKey{tenant: campaign.Tenant, name: campaign.Name}] = *campaign
+	return nil
+}
+
+func (storage *Inmemory) Campaign(_ context.Context,
+	tenant string, name string,
+) (campaign storage.Campaign, found bool, err error) {
+	store := storage.campaigns
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	campaign, found = store.campaigns[campaignKey{tenant: tenant, name: name}]
+	return campaign, found, nil
+}
+
+func (storage *Inmemory) Campaigns(_ context.Context, tenant string) (campaigns []storage.Campaign, err error) {
+	store := storage.campaigns
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for key, campaign := range store.campaigns {
+		if key.tenant == tenant {
+			campaigns = append(campaigns, campaign)
+		}
+	}
+	sortCampaigns(campaigns)
+	return campaigns, nil
+}
+
+func (storage *Inmemory) DeleteCampaign(_ context.Context, tenant string, name string) (found bool, err error) {
+	store := storage.campaigns
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	key := campaignKey{tenant: tenant, name: name}
+	_, found = store.campaigns[key]
+	delete(store.campaigns, key)
+	return found, nil
+}
+
+// CampaignClicks walks the links, so it is as slow as there are links with
+// attributes.
+func (storage *Inmemory) CampaignClicks(_ context.Context, tenant string) (stats []storage.CampaignClicks, err error) {
+	byCampaign := make(map[string]int)
+	for i := range storage.shortToFull {
+		links := &storage.shortToFull[i]
+		links.mutex.RLock()
+		for token, attrs := range links.attrs {
+			if attrs.UTM.Campaign == "" || (tenant != "" && attrs.Tenant != tenant) {
+				continue
+			}
+			index, found := byCampaign[attrs.UTM.Campaign]
+			if !found {
+				index = len(stats)
+				byCampaign[attrs.UTM.Campaign] = index
+				stats = append(stats, campaignClicks(attrs.UTM.Campaign))
+			}
+			stats[index].Links++
+			stats[index].Clicks += storage.clickCount(token)
+		}
+		links.mutex.RUnlock()
+	}
+	sortCampaignClicks(stats)
+	return stats, nil
+}
+
+func (storage *Inmemory) clickCount(token string) int64 {
+	clicks := &storage.clicks[shardIndex(token)]
+	clicks.mutex.Lock()
+	defer clicks.mutex.Unlock()
+	return clicks.items[token]
+}
+
+func sortCampaigns(campaigns []storage.Campaign) {
+	slices.SortFunc(campaigns, func(a, b storage.Campaign) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+}
+
+// campaignClicks and sortCampaignClicks are reachable from methods, where the
+// receiver hides the storage package.
+func campaignClicks(campaign string) storage.CampaignClicks {
+	return storage.CampaignClicks{Campaign: campaign}
+}
+
+func sortCampaignClicks(stats []storage.CampaignClicks) {
+	storage.SortCampaignClicks(stats)
+}
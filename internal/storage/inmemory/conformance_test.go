@@ -0,0 +1,33 @@
+package inmemory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	t.Run("inmemory", func(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) storage.Storager {
+			return New()
+		})
+	})
+	t.Run("bounded", func(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) storage.Storager {
+			st, err := NewBounded(Limits{MaxLinks: 1000, Policy: EvictLeastClicked})
+			require.NoError(t, err)
+			return st
+		})
+	})
+	t.Run("durable", func(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) storage.Storager {
+			st, err := NewDurable(DurableConfig{Dir: t.TempDir()}, zap.NewNop())
+			require.NoError(t, err)
+			return st
+		})
+	})
+}
@@ -0,0 +1,471 @@
+package inmemory
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+const (
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.db"
+
+	defaultSyncInterval     = time.Second
+	defaultSnapshotInterval = 10 * time.Minute
+)
+
+// SyncPolicy sets when the log is flushed to disk with fsync.
+type SyncPolicy string
+
+const (
+	// SyncAlways flushes every change before it is acknowledged.
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval flushes once per DurableConfig.SyncInterval, a crash
+	// loses at most the changes made during the last interval.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to the operating system.
+	SyncNever SyncPolicy = "never"
+)
+
+var ErrClosed = errors.New("storage is closed")
+
+type DurableConfig struct {
+	// Dir keeps the log and the snapshot, it is created if missing.
+	Dir              string
+	Sync             SyncPolicy
+	SyncInterval     time.Duration
+	SnapshotInterval time.Duration
+}
+
+// links is the part of Inmemory that Durable exposes.
+type links interface {
+	storage.Storager
+	storage.TokenPooler
+	storage.Counter
+	storage.Editor
+	storage.ClickCounter
+	storage.EvictionReporter
+	storage.AttributeStorer
+	RangeWithAttributes(fn func(token string, fullURL string, attrs storage.Attributes) bool)
+	used(token string) bool
+}
+
+// Durable is Inmemory that writes every create, update and delete to an
+// append-only log before applying it, and replays the log on start. The log
+// is periodically compacted into a snapshot. Reads are served from memory
+// exactly as by Inmemory. The token pool is not persisted. Webhooks,
+// campaign templates and clicks are not logged, so Durable is no
+// storage.WebhookStorer, storage.CampaignStorer or storage.CampaignCounter:
+// subscriptions, queued deliveries, templates and clicks by campaign would be
+// lost on restart.
+type Durable struct {
+	links
+	cfg    DurableConfig
+	logger *zap.Logger
+
+	// writeMutex keeps the order of the log the same as the order of
+	// changes in memory, reads do not take it.
+	writeMutex sync.Mutex
+	wal        *os.File
+	walSize    int64
+	dirty      bool
+	closed     bool
+}
+
+var (
+	_ storage.Storager    = &Durable{}
+	_ storage.TokenPooler = &Durable{}
+	_ storage.Counter     = &Durable{}
+	_ storage.Editor      = &Durable{}
+
+	_ storage.AttributeStorer = &Durable{}
+)
+
+func NewDurable(cfg DurableConfig, logger *zap.Logger) (*Durable, error) {
+	switch cfg.Sync {
+	case "":
+		cfg.Sync = SyncInterval
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return nil, fmt.Errorf("unknown sync policy %q", cfg.Sync)
+	}
+	if cfg.SyncInterval <= 0 {
+		cfg.SyncInterval = defaultSyncInterval
+	}
+	if cfg.SnapshotInterval <= 0 {
+		cfg.SnapshotInterval = defaultSnapshotInterval
+	}
+
+	err := os.MkdirAll(cfg.Dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	durable := &Durable{
+		links:  New(),
+		cfg:    cfg,
+		logger: logger,
+	}
+	err = durable.loadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	err = durable.replay()
+	if err != nil {
+		return nil, err
+	}
+	return durable, nil
+}
+
+func (durable *Durable) CreateShortURL(ctx context.Context, fullURL string,
+	token string,
+) (err error) {
+	return durable.CreateWithAttributes(ctx, fullURL, token, storage.Attributes{})
+}
+
+func (durable *Durable) CreateWithAttributes(ctx context.Context, fullURL string,
+	token string, attrs storage.Attributes,
+) (err error) {
+	durable.writeMutex.Lock()
+	defer durable.writeMutex.Unlock()
+
+	if durable.used(token) {
+		return errTokenExists
+	}
+	record, err := createRecord(token, fullURL, attrs)
+	if err != nil {
+		return err
+	}
+	err = durable.append(record)
+	if err != nil {
+		return err
+	}
+	return durable.links.CreateWithAttributes(ctx, fullURL, token, attrs)
+}
+
+func createRecord(token string, fullURL string, attrs storage.Attributes) (walRecord, error) {
+	if attrs.IsZero() {
+		return walRecord{op: opCreate, token: token, fullURL: fullURL}, nil
+	}
+	encoded, err := storage.MarshalAttributes(attrs)
+	if err != nil {
+		return walRecord{}, err
+	}
+	return walRecord{
+		op: opCreateWithAttributes, token: token, fullURL: fullURL, attributes: string(encoded),
+	}, nil
+}
+
+func (durable *Durable) UpdateShortURL(ctx context.Context, token string,
+	fullURL string,
+) (found bool, err error) {
+	durable.writeMutex.Lock()
+	defer durable.writeMutex.Unlock()
+
+	_, found, err = durable.GetFullURL(ctx, token)
+	if err != nil || !found {
+		return false, err
+	}
+	err = durable.append(walRecord{op: opUpdate, token: token, fullURL: fullURL})
+	if err != nil {
+		return false, err
+	}
+	return durable.links.UpdateShortURL(ctx, token, fullURL)
+}
+
+func (durable *Durable) DeleteShortURL(ctx context.Context,
+	token string,
+) (found bool, err error) {
+	durable.writeMutex.Lock()
+	defer durable.writeMutex.Unlock()
+
+	_, found, err = durable.GetFullURL(ctx, token)
+	if err != nil || !found {
+		return false, err
+	}
+	err = durable.append(walRecord{op: opDelete, token: token})
+	if err != nil {
+		return false, err
+	}
+	return durable.links.DeleteShortURL(ctx, token)
+}
+
+// Run flushes the log and writes snapshots in the background until ctx is
+// done.
+func (durable *Durable) Run(ctx context.Context) {
+	var syncTick <-chan time.Time
+	if durable.cfg.Sync == SyncInterval {
+		ticker := time.NewTicker(durable.cfg.SyncInterval)
+		defer ticker.Stop()
+		syncTick = ticker.C
+	}
+	snapshotTicker := time.NewTicker(durable.cfg.SnapshotInterval)
+	defer snapshotTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-syncTick:
+			err := durable.sync()
+			if err != nil {
+				durable.logger.Error("error on sync log", zap.Error(err))
+			}
+		case <-snapshotTicker.C:
+			err := durable.Snapshot()
+			if err != nil {
+				durable.logger.Error("error on write snapshot", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Snapshot writes all links into a new snapshot and empties the log.
+func (durable *Durable) Snapshot() error {
+	durable.writeMutex.Lock()
+	defer durable.writeMutex.Unlock()
+
+	if durable.closed {
+		return ErrClosed
+	}
+	return durable.snapshot()
+}
+
+// Close compacts the log into a snapshot, so the next start does not
+// replay it, and closes the log.
+func (durable *Durable) Close() error {
+	durable.writeMutex.Lock()
+	defer durable.writeMutex.Unlock()
+
+	if durable.closed {
+		return nil
+	}
+	durable.closed = true
+	err := durable.snapshot()
+	if durable.dirty {
+		err = errors.Join(err, durable.wal.Sync())
+	}
+	return errors.Join(err, durable.wal.Close())
+}
+
+func (durable *Durable) append(record walRecord) error {
+	if durable.closed {
+		return ErrClosed
+	}
+	buf := appendRecord(nil, record)
+	// A record replay would reject must not be acknowledged, the store could
+	// not be opened again.
+	if len(buf)-recordHeaderSize > maxRecordSize {
+		return storage.ErrLinkTooLarge
+	}
+	n, err := durable.wal.Write(buf)
+	if err != nil {
+		// Cut the partial record off, or the next ones would be appended
+		// after garbage and lost on replay.
+		return errors.Join(err, durable.wal.Truncate(durable.walSize))
+	}
+	durable.walSize += int64(n)
+	if durable.cfg.Sync == SyncAlways {
+		return durable.wal.Sync()
+	}
+	durable.dirty = true
+	return nil
+}
+
+func (durable *Durable) sync() error {
+	durable.writeMutex.Lock()
+	defer durable.writeMutex.Unlock()
+
+	if durable.closed || !durable.dirty {
+		return nil
+	}
+	durable.dirty = false
+	return durable.wal.Sync()
+}
+
+// snapshot must be called with writeMutex held, so the links do not change
+// while they are written.
+func (durable *Durable) snapshot() error {
+	if durable.walSize == 0 {
+		return nil
+	}
+
+	path := filepath.Join(durable.cfg.Dir, snapshotFileName)
+	links, err := durable.writeSnapshot(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	// A crash between the rename and the truncate only makes the next
+	// start replay changes already in the snapshot, which is harmless.
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		return err
+	}
+	err = syncDir(durable.cfg.Dir)
+	if err != nil {
+		return err
+	}
+
+	err = durable.wal.Truncate(0)
+	if err != nil {
+		return err
+	}
+	durable.walSize = 0
+	durable.dirty = false
+	err = durable.wal.Sync()
+	if err != nil {
+		return err
+	}
+	durable.logger.Info("snapshot is written", zap.Int("links", links))
+	return nil
+}
+
+func (durable *Durable) writeSnapshot(path string) (links int, err error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = file.Close()
+			_ = os.Remove(path)
+		}
+	}()
+
+	writer := bufio.NewWriter(file)
+	var buf []byte
+	durable.RangeWithAttributes(func(token string, fullURL string, attrs storage.Attributes) bool {
+		var record walRecord
+		record, err = createRecord(token, fullURL, attrs)
+		if err != nil {
+			return false
+		}
+		buf = appendRecord(buf[:0], record)
+		_, err = writer.Write(buf)
+		links++
+		return err == nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return 0, err
+	}
+	err = file.Sync()
+	if err != nil {
+		return 0, err
+	}
+	return links, file.Close()
+}
+
+func (durable *Durable) loadSnapshot() error {
+	path := filepath.Join(durable.cfg.Dir, snapshotFileName)
+	_ = os.Remove(path + ".tmp")
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	reader := newRecordReader(file)
+	var record walRecord
+	for {
+		record, err = reader.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			// Snapshots are renamed into place only when complete, so
+			// unlike the log they can not be torn by a crash.
+			return fmt.Errorf("read snapshot at offset %d: %w", reader.offset, err)
+		}
+		durable.apply(record)
+	}
+}
+
+func (durable *Durable) replay() error {
+	path := filepath.Join(durable.cfg.Dir, walFileName)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	reader := newRecordReader(file)
+	records := 0
+	for {
+		var record walRecord
+		record, err = reader.next()
+		if err != nil {
+			break
+		}
+		durable.apply(record)
+		records++
+	}
+	switch {
+	case errors.Is(err, io.EOF):
+	case errors.Is(err, errTornRecord):
+		durable.logger.Warn("log ends with a torn record, it is discarded",
+			zap.Int64("offset", reader.offset))
+		err = file.Truncate(reader.offset)
+		if err == nil {
+			err = file.Sync()
+		}
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+	default:
+		_ = file.Close()
+		return fmt.Errorf("read log at offset %d: %w", reader.offset, err)
+	}
+
+	durable.wal = file
+	durable.walSize = reader.offset
+	durable.logger.Info("log is replayed", zap.Int("records", records))
+	return nil
+}
+
+func (durable *Durable) apply(record walRecord) {
+	ctx := context.Background()
+	switch record.op {
+	case opCreate:
+		_ = durable.links.CreateShortURL(ctx, record.fullURL, record.token)
+	case opCreateWithAttributes:
+		attrs, err := storage.UnmarshalAttributes([]byte(record.attributes))
+		if err != nil {
+			durable.logger.Warn("link attributes are dropped", zap.String("token", record.token),
+				zap.Error(err))
+		}
+		_ = durable.links.CreateWithAttributes(ctx, record.fullURL, record.token, attrs)
+	case opUpdate:
+		_, _ = durable.links.UpdateShortURL(ctx, record.token, record.fullURL)
+	case opDelete:
+		_, _ = durable.links.DeleteShortURL(ctx, record.token)
+	}
+}
+
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = file.Sync()
+	return errors.Join(err, file.Close())
+}
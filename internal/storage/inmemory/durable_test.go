@@ -0,0 +1,264 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+func newTestDurable(t *testing.T, dir string) *Durable {
+	t.Helper()
+	durable, err := NewDurable(DurableConfig{Dir: dir, Sync: SyncAlways}, zap.NewNop())
+	require.NoError(t, err)
+	return durable
+}
+
+func assertLink(t *testing.T, st *Durable, token string, expected string) {
+	t.Helper()
+	fullURL, found, err := st.GetFullURL(context.Background(), token)
+	require.NoError(t, err)
+	if expected == "" {
+		assert.False(t, found, "token %s", token)
+		return
+	}
+	assert.True(t, found, "token %s", token)
+	assert.Equal(t, expected, fullURL)
+}
+
+func TestDurable_Replay(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	durable := newTestDurable(t, dir)
+	require.NoError(t, durable.CreateShortURL(ctx, "https://mai.ru", "a"))
+	require.NoError(t, durable.CreateShortURL(ctx, "https://ya.ru", "b"))
+	require.NoError(t, durable.CreateShortURL(ctx, "https://go.dev", "c"))
+	found, err := durable.UpdateShortURL(ctx, "a", "https://mai.ru/new")
+	require.NoError(t, err)
+	require.True(t, found)
+	found, err = durable.DeleteShortURL(ctx, "b")
+	require.NoError(t, err)
+	require.True(t, found)
+	// Simulate a crash: the log is left as is, without a final snapshot.
+	require.NoError(t, durable.wal.Close())
+
+	durable = newTestDurable(t, dir)
+	defer func() {
+		_ = durable.Close()
+	}()
+	assertLink(t, durable, "a", "https://mai.ru/new")
+	assertLink(t, durable, "b", "")
+	assertLink(t, durable, "c", "https://go.dev")
+	token, found, err := durable.AlreadyExists(ctx, "https://go.dev")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "c", token)
+}
+
+func TestDurable_TornLastRecord(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	durable := newTestDurable(t, dir)
+	require.NoError(t, durable.CreateShortURL(ctx, "https://mai.ru", "a"))
+	require.NoError(t, durable.CreateShortURL(ctx, "https://ya.ru", "b"))
+	size := durable.walSize
+	require.NoError(t, durable.wal.Close())
+
+	path := filepath.Join(dir, walFileName)
+	require.NoError(t, os.Truncate(path, size-3))
+
+	durable = newTestDurable(t, dir)
+	assertLink(t, durable, "a", "https://mai.ru")
+	assertLink(t, durable, "b", "")
+
+	// New records are appended right after the last complete one.
+	require.NoError(t, durable.CreateShortURL(ctx, "https://go.dev", "c"))
+	require.NoError(t, durable.wal.Close())
+	durable = newTestDurable(t, dir)
+	defer func() {
+		_ = durable.Close()
+	}()
+	assertLink(t, durable, "a", "https://mai.ru")
+	assertLink(t, durable, "c", "https://go.dev")
+}
+
+func TestDurable_CorruptedRecord(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	durable := newTestDurable(t, dir)
+	require.NoError(t, durable.CreateShortURL(ctx, "https://mai.ru", "a"))
+	first := durable.walSize
+	require.NoError(t, durable.CreateShortURL(ctx, "https://ya.ru", "b"))
+	require.NoError(t, durable.CreateShortURL(ctx, "https://go.dev", "c"))
+	size := durable.walSize
+	require.NoError(t, durable.wal.Close())
+
+	path := filepath.Join(dir, walFileName)
+	log, err := os.ReadFile(path)
+	require.NoError(t, err)
+	log[first+recordHeaderSize] ^= 0xff
+	require.NoError(t, os.WriteFile(path, log, 0o644))
+
+	_, err = NewDurable(DurableConfig{Dir: dir}, zap.NewNop())
+	require.ErrorIs(t, err, errCorruptRecord)
+	assert.ErrorContains(t, err, fmt.Sprintf("offset %d", first))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, size, info.Size(), "records after the corrupted one are kept")
+}
+
+func TestDurable_RecordTooLarge(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	large := "https://mai.ru/" + strings.Repeat("a", maxRecordSize)
+
+	durable := newTestDurable(t, dir)
+	require.NoError(t, durable.CreateShortURL(ctx, "https://mai.ru", "a"))
+	require.ErrorIs(t, durable.CreateShortURL(ctx, large, "b"), storage.ErrLinkTooLarge)
+	found, err := durable.UpdateShortURL(ctx, "a", large)
+	require.ErrorIs(t, err, storage.ErrLinkTooLarge)
+	assert.False(t, found)
+	assertLink(t, durable, "b", "")
+	require.NoError(t, durable.Close())
+
+	durable = newTestDurable(t, dir)
+	defer func() {
+		_ = durable.Close()
+	}()
+	assertLink(t, durable, "a", "https://mai.ru")
+	assertLink(t, durable, "b", "")
+}
+
+func TestDurable_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	durable := newTestDurable(t, dir)
+	require.NoError(t, durable.CreateShortURL(ctx, "https://mai.ru", "a"))
+	require.NoError(t, durable.CreateShortURL(ctx, "https://ya.ru", "b"))
+	_, err := durable.DeleteShortURL(ctx, "b")
+	require.NoError(t, err)
+
+	require.NoError(t, durable.Snapshot())
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+
+	require.NoError(t, durable.CreateShortURL(ctx, "https://go.dev", "c"))
+	require.NoError(t, durable.wal.Close())
+
+	durable = newTestDurable(t, dir)
+	assertLink(t, durable, "a", "https://mai.ru")
+	assertLink(t, durable, "b", "")
+	assertLink(t, durable, "c", "https://go.dev")
+
+	t.Run("close compacts the log", func(t *testing.T) {
+		require.NoError(t, durable.Close())
+		info, err := os.Stat(filepath.Join(dir, walFileName))
+		require.NoError(t, err)
+		assert.Zero(t, info.Size())
+
+		err = durable.CreateShortURL(ctx, "https://ya.ru", "d")
+		assert.ErrorIs(t, err, ErrClosed)
+	})
+	t.Run("corrupted snapshot", func(t *testing.T) {
+		path := filepath.Join(dir, snapshotFileName)
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.NoError(t, os.Truncate(path, info.Size()-1))
+
+		_, err = NewDurable(DurableConfig{Dir: dir}, zap.NewNop())
+		assert.Error(t, err)
+	})
+}
+
+func TestDurable_Attributes(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	attrs := storage.Attributes{ExpiresAt: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), Tags: []string{"a"}}
+
+	durable := newTestDurable(t, dir)
+	require.NoError(t, durable.CreateWithAttributes(ctx, "https://mai.ru", "a", attrs))
+	require.NoError(t, durable.wal.Close())
+
+	for _, stage := range []string{"log", "snapshot"} {
+		durable = newTestDurable(t, dir)
+		_, stored, found, err := durable.GetWithAttributes(ctx, "a")
+		require.NoError(t, err)
+		require.True(t, found, stage)
+		assert.Equal(t, attrs, stored, stage)
+		require.NoError(t, durable.Close())
+	}
+}
+
+func TestDurable_UnknownSyncPolicy(t *testing.T) {
+	_, err := NewDurable(DurableConfig{Dir: t.TempDir(), Sync: "sometimes"}, zap.NewNop())
+	assert.Error(t, err)
+}
+
+func TestDurable_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	durable, err := NewDurable(DurableConfig{Dir: dir, Sync: SyncNever}, zap.NewNop())
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				token := strconv.Itoa(i*100 + j)
+				assert.NoError(t, durable.CreateShortURL(ctx, "https://mai.ru/"+token, token))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, _, err := durable.GetFullURL(ctx, strconv.Itoa(j))
+				assert.NoError(t, err)
+				if j == 50 {
+					assert.NoError(t, durable.Snapshot())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, durable.Close())
+
+	durable = newTestDurable(t, dir)
+	defer func() {
+		_ = durable.Close()
+	}()
+	count, err := durable.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 400, count)
+}
+
+func TestDurable_NotPersisted(t *testing.T) {
+	durable := newTestDurable(t, t.TempDir())
+	defer func() {
+		_ = durable.Close()
+	}()
+
+	_, ok := storage.As[storage.WebhookStorer](durable)
+	assert.False(t, ok, "webhooks are not logged and must not be accepted")
+	_, ok = storage.As[storage.CampaignStorer](durable)
+	assert.False(t, ok, "campaign templates are not logged and must not be accepted")
+	_, ok = storage.As[storage.CampaignCounter](durable)
+	assert.False(t, ok, "clicks are not logged and must not be counted by campaign")
+}
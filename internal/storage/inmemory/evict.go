@@ -0,0 +1,306 @@
+package inmemory
+
+import (
+	"container/heap"
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// EvictionPolicy chooses the link dropped when a limit is reached.
+type EvictionPolicy string
+
+const (
+	// EvictLRU drops the link redirected to longest ago.
+	EvictLRU EvictionPolicy = "lru"
+	// EvictLeastClicked drops the link with the fewest clicks, the oldest
+	// of them on a tie.
+	EvictLeastClicked EvictionPolicy = "least-clicked"
+	// EvictOldest drops the link created first.
+	EvictOldest EvictionPolicy = "oldest"
+)
+
+// entryOverhead approximates the bytes both index entries of a link take
+// besides the strings themselves.
+const entryOverhead = 128
+
+const defaultMaxEvicted = 100_000
+
+var inmemoryStats = expvar.NewMap("inmemory")
+
+// Limits bound the memory of Inmemory, zero disables a limit.
+type Limits struct {
+	MaxLinks int
+	// MaxBytes limits the estimated memory of the links.
+	MaxBytes int64
+	Policy   EvictionPolicy
+	// MaxEvicted is how many evicted tokens are remembered to tell them
+	// apart from tokens that never existed.
+	MaxEvicted int
+}
+
+func linkSize(token string, fullURL string) int64 {
+	return int64(2*(len(token)+len(fullURL)) + entryOverhead)
+}
+
+type evictItem struct {
+	token  string
+	size   int64
+	clicks int64
+	// seq orders items by creation, or by the last use for EvictLRU.
+	seq   uint64
+	index int
+}
+
+// evictShard keeps the links of one token shard in a heap ordered by the
+// policy, so that a redirect only locks the shard of its token.
+type evictShard struct {
+	mutex sync.Mutex
+	items map[string]*evictItem
+	heap  evictHeap
+	_     [16]byte
+}
+
+// evictor evicts the first link of the shard heaps, comparing their tops.
+type evictor struct {
+	limits Limits
+	shards [shardCount]evictShard
+	// seq is shared by the shards, so that their items can be compared.
+	seq   atomic.Uint64
+	links atomic.Int64
+	bytes atomic.Int64
+
+	// evictMutex lets one writer at a time evict links, so that two writers
+	// do not both evict for the same overflow. It guards the evicted tokens.
+	evictMutex  sync.Mutex
+	evicted     map[string]struct{}
+	evictedRing []string
+	evictedNext int
+}
+
+func newEvictor(limits Limits) (*evictor, error) {
+	switch limits.Policy {
+	case "":
+		limits.Policy = EvictLRU
+	case EvictLRU, EvictLeastClicked, EvictOldest:
+	default:
+		return nil, fmt.Errorf("unknown eviction policy %q", limits.Policy)
+	}
+	if limits.MaxEvicted <= 0 {
+		limits.MaxEvicted = defaultMaxEvicted
+	}
+	evictor := &evictor{
+		limits:      limits,
+		evicted:     make(map[string]struct{}),
+		evictedRing: make([]string, limits.MaxEvicted),
+	}
+	for i := range evictor.shards {
+		evictor.shards[i].items = make(map[string]*evictItem)
+		evictor.shards[i].heap = evictHeap{leastClicked: limits.Policy == EvictLeastClicked}
+	}
+	return evictor, nil
+}
+
+func (evictor *evictor) shard(token string) *evictShard {
+	return &evictor.shards[shardIndex(token)]
+}
+
+// set accounts a created or changed link and returns the links to evict.
+func (evictor *evictor) set(token string, fullURL string) (victims []string) {
+	size := linkSize(token, fullURL)
+	shard := evictor.shard(token)
+	shard.mutex.Lock()
+	if item, found := shard.items[token]; found {
+		evictor.bytes.Add(size - item.size)
+		item.size = size
+	} else {
+		item = &evictItem{token: token, size: size, seq: evictor.seq.Add(1)}
+		shard.items[token] = item
+		heap.Push(&shard.heap, item)
+		evictor.links.Add(1)
+		evictor.bytes.Add(size)
+	}
+	shard.mutex.Unlock()
+
+	evictor.evictMutex.Lock()
+	defer evictor.evictMutex.Unlock()
+
+	delete(evictor.evicted, token)
+	// Never evict the link being written.
+	for evictor.over() {
+		victim, ok := evictor.pop(token)
+		if !ok {
+			break
+		}
+		evictor.remember(victim)
+		victims = append(victims, victim)
+	}
+	inmemoryStats.Add("evictions", int64(len(victims)))
+	return victims
+}
+
+func (evictor *evictor) over() bool {
+	return (evictor.limits.MaxLinks > 0 && evictor.links.Load() > int64(evictor.limits.MaxLinks)) ||
+		(evictor.limits.MaxBytes > 0 && evictor.bytes.Load() > evictor.limits.MaxBytes)
+}
+
+// pop removes the first link of all shards but kept, and reports false when
+// there is none. A link used while the shards are compared may be evicted
+// ahead of a link that is older by then.
+func (evictor *evictor) pop(kept string) (token string, ok bool) {
+	for {
+		var first evictItem
+		var from *evictShard
+		for i := range evictor.shards {
+			shard := &evictor.shards[i]
+			shard.mutex.Lock()
+			if top := shard.heap.first(kept); top != nil && (from == nil || shard.heap.before(top, &first)) {
+				first, from = *top, shard
+			}
+			shard.mutex.Unlock()
+		}
+		if from == nil {
+			return "", false
+		}
+
+		// The link may have been deleted since, then another one is looked
+		// for.
+		from.mutex.Lock()
+		item, found := from.items[first.token]
+		if found {
+			heap.Remove(&from.heap, item.index)
+			evictor.forget(from, item)
+		}
+		from.mutex.Unlock()
+		if found {
+			return item.token, true
+		}
+	}
+}
+
+// touch marks a redirect to token.
+func (evictor *evictor) touch(token string) {
+	if evictor.limits.Policy != EvictLRU {
+		return
+	}
+	shard := evictor.shard(token)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if item, found := shard.items[token]; found {
+		item.seq = evictor.seq.Add(1)
+		heap.Fix(&shard.heap, item.index)
+	}
+}
+
+func (evictor *evictor) click(token string) {
+	if evictor.limits.Policy != EvictLeastClicked {
+		return
+	}
+	shard := evictor.shard(token)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if item, found := shard.items[token]; found {
+		item.clicks++
+		heap.Fix(&shard.heap, item.index)
+	}
+}
+
+func (evictor *evictor) remove(token string) {
+	shard := evictor.shard(token)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if item, found := shard.items[token]; found {
+		heap.Remove(&shard.heap, item.index)
+		evictor.forget(shard, item)
+	}
+}
+
+func (evictor *evictor) wasEvicted(token string) bool {
+	evictor.evictMutex.Lock()
+	defer evictor.evictMutex.Unlock()
+
+	_, evicted := evictor.evicted[token]
+	return evicted
+}
+
+// forget must be called with the mutex of shard held.
+func (evictor *evictor) forget(shard *evictShard, item *evictItem) {
+	delete(shard.items, item.token)
+	evictor.links.Add(-1)
+	evictor.bytes.Add(-item.size)
+}
+
+// remember records an evicted token, forgetting the oldest record once
+// there are MaxEvicted of them.
+func (evictor *evictor) remember(token string) {
+	if old := evictor.evictedRing[evictor.evictedNext]; old != "" {
+		delete(evictor.evicted, old)
+	}
+	evictor.evictedRing[evictor.evictedNext] = token
+	evictor.evictedNext = (evictor.evictedNext + 1) % len(evictor.evictedRing)
+	evictor.evicted[token] = struct{}{}
+}
+
+type evictHeap struct {
+	items        []*evictItem
+	leastClicked bool
+}
+
+func (h *evictHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *evictHeap) Less(i, j int) bool {
+	return h.before(h.items[i], h.items[j])
+}
+
+// before tells whether a is evicted before b.
+func (h *evictHeap) before(a, b *evictItem) bool {
+	if h.leastClicked && a.clicks != b.clicks {
+		return a.clicks < b.clicks
+	}
+	return a.seq < b.seq
+}
+
+// first returns the item evicted next but the one of kept, nil when there
+// is none. The children of the root are the candidates after it.
+func (h *evictHeap) first(kept string) *evictItem {
+	var first *evictItem
+	for i := 0; i < min(len(h.items), 3); i++ {
+		item := h.items[i]
+		if item.token == kept {
+			continue
+		}
+		if i == 0 {
+			return item
+		}
+		if first == nil || h.before(item, first) {
+			first = item
+		}
+	}
+	return first
+}
+
+func (h *evictHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *evictHeap) Push(x any) {
+	item := x.(*evictItem)
+	item.index = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *evictHeap) Pop() any {
+	last := len(h.items) - 1
+	item := h.items[last]
+	h.items[last] = nil
+	h.items = h.items[:last]
+	return item
+}
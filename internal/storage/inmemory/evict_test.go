@@ -0,0 +1,181 @@
+package inmemory
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Evict(t *testing.T) {
+	tests := []struct {
+		name string
+		// use is called after three links are created and before the fourth.
+		use     func(t *testing.T, storage *Inmemory)
+		policy  EvictionPolicy
+		evicted string
+	}{
+		{
+			name:    "oldest",
+			policy:  EvictOldest,
+			use:     func(t *testing.T, storage *Inmemory) { get(t, storage, "a") },
+			evicted: "a",
+		},
+		{
+			name:    "lru",
+			policy:  EvictLRU,
+			use:     func(t *testing.T, storage *Inmemory) { get(t, storage, "a") },
+			evicted: "b",
+		},
+		{
+			name:   "least clicked",
+			policy: EvictLeastClicked,
+			use: func(t *testing.T, storage *Inmemory) {
+				ctx := context.Background()
+				require.NoError(t, storage.AddClick(ctx, "a"))
+				require.NoError(t, storage.AddClick(ctx, "b"))
+				require.NoError(t, storage.AddClick(ctx, "b"))
+			},
+			evicted: "c",
+		},
+		{
+			name:   "least clicked tie",
+			policy: EvictLeastClicked,
+			use: func(t *testing.T, storage *Inmemory) {
+				require.NoError(t, storage.AddClick(context.Background(), "a"))
+			},
+			evicted: "b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage, err := NewBounded(Limits{MaxLinks: 3, Policy: tt.policy})
+			require.NoError(t, err)
+			for _, token := range []string{"a", "b", "c"} {
+				require.NoError(t, storage.CreateShortURL(ctx, "https://"+token+".ru", token))
+			}
+			tt.use(t, storage)
+
+			require.NoError(t, storage.CreateShortURL(ctx, "https://d.ru", "d"))
+
+			count, err := storage.Count(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 3, count)
+			for _, token := range []string{"a", "b", "c", "d"} {
+				_, found, err := storage.GetFullURL(ctx, token)
+				require.NoError(t, err)
+				assert.Equal(t, token != tt.evicted, found, token)
+
+				evicted, err := storage.Evicted(ctx, token)
+				require.NoError(t, err)
+				assert.Equal(t, token == tt.evicted, evicted, token)
+			}
+			_, found, err := storage.AlreadyExists(ctx, "https://"+tt.evicted+".ru")
+			require.NoError(t, err)
+			assert.False(t, found)
+		})
+	}
+}
+
+func get(t *testing.T, storage *Inmemory, token string) {
+	_, found, err := storage.GetFullURL(context.Background(), token)
+	require.NoError(t, err)
+	require.True(t, found)
+}
+
+func Test_EvictBytes(t *testing.T) {
+	ctx := context.Background()
+	size := linkSize("a", "https://a.ru")
+	storage, err := NewBounded(Limits{MaxBytes: 2 * size, Policy: EvictOldest})
+	require.NoError(t, err)
+
+	require.NoError(t, storage.CreateShortURL(ctx, "https://a.ru", "a"))
+	require.NoError(t, storage.CreateShortURL(ctx, "https://b.ru", "b"))
+	count, err := storage.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// Growing a link over the limit evicts the others but never the link
+	// itself.
+	found, err := storage.UpdateShortURL(ctx, "b", "https://b.ru/"+string(make([]byte, size)))
+	require.NoError(t, err)
+	require.True(t, found)
+	count, err = storage.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	get(t, storage, "b")
+	evicted, err := storage.Evicted(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, evicted)
+}
+
+func Test_Evicted(t *testing.T) {
+	ctx := context.Background()
+	storage, err := NewBounded(Limits{MaxLinks: 1, MaxEvicted: 2})
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		token := strconv.Itoa(i)
+		require.NoError(t, storage.CreateShortURL(ctx, "https://mai.ru/"+token, token))
+	}
+
+	for token, expected := range map[string]bool{
+		"0": false, // forgotten, only two are remembered
+		"1": true,
+		"2": true,
+		"3": false, // not evicted
+		"4": false, // never existed
+	} {
+		evicted, err := storage.Evicted(ctx, token)
+		require.NoError(t, err)
+		assert.Equal(t, expected, evicted, token)
+	}
+
+	// Creating the token again makes it not evicted.
+	require.NoError(t, storage.CreateShortURL(ctx, "https://mai.ru/1", "1"))
+	evicted, err := storage.Evicted(ctx, "1")
+	require.NoError(t, err)
+	assert.False(t, evicted)
+
+	// Deleted links are not evicted ones.
+	found, err := storage.DeleteShortURL(ctx, "1")
+	require.NoError(t, err)
+	require.True(t, found)
+	evicted, err = storage.Evicted(ctx, "1")
+	require.NoError(t, err)
+	assert.False(t, evicted)
+}
+
+func Test_EvictUnknownPolicy(t *testing.T) {
+	_, err := NewBounded(Limits{MaxLinks: 1, Policy: "random"})
+	require.Error(t, err)
+}
+
+func Test_EvictParallel(t *testing.T) {
+	ctx := context.Background()
+	storage, err := NewBounded(Limits{MaxLinks: 50, Policy: EvictLeastClicked})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				token := strconv.Itoa(worker) + "-" + strconv.Itoa(i)
+				assert.NoError(t, storage.CreateShortURL(ctx, "https://mai.ru/"+token, token))
+				assert.NoError(t, storage.AddClick(ctx, token))
+				_, _, err := storage.GetFullURL(ctx, token)
+				assert.NoError(t, err)
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	count, err := storage.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 50, count)
+}
@@ -0,0 +1,120 @@
+package inmemory
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+// singleLock is the previous implementation with both maps behind one
+// lock, kept as the baseline of the benchmarks.
+type singleLock struct {
+	mutex       sync.RWMutex
+	shortToFull map[string]string
+	fullToShort map[string]string
+}
+
+func newSingleLock() *singleLock {
+	return &singleLock{
+		shortToFull: make(map[string]string),
+		fullToShort: make(map[string]string),
+	}
+}
+
+func (st *singleLock) GetFullURL(_ context.Context, token string) (string, bool, error) {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	fullURL, found := st.shortToFull[token]
+	return fullURL, found, nil
+}
+
+func (st *singleLock) CreateShortURL(_ context.Context, fullURL string, token string) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.fullToShort[fullURL] = token
+	st.shortToFull[token] = fullURL
+	return nil
+}
+
+func (st *singleLock) AlreadyExists(_ context.Context, fullURL string) (string, bool, error) {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	token, found := st.fullToShort[fullURL]
+	return token, found, nil
+}
+
+func (st *singleLock) Close() error {
+	return nil
+}
+
+const benchLinks = 100_000
+
+var benchTokens = func() []string {
+	tokens := make([]string, benchLinks)
+	for i := range tokens {
+		tokens[i] = strconv.Itoa(i)
+	}
+	return tokens
+}()
+
+func fill(b *testing.B, st storage.Storager) {
+	b.Helper()
+	ctx := context.Background()
+	for _, token := range benchTokens {
+		if err := st.CreateShortURL(ctx, "https://mai.ru/"+token, token); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkMixed runs in parallel one create per writeEvery operations,
+// the rest are redirects.
+func benchmarkMixed(b *testing.B, st storage.Storager, writeEvery int) {
+	fill(b, st)
+	ctx := context.Background()
+	var next atomic.Int64
+	next.Store(benchLinks)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			i++
+			if writeEvery > 0 && i%writeEvery == 0 {
+				token := strconv.FormatInt(next.Add(1), 10)
+				_ = st.CreateShortURL(ctx, "https://mai.ru/"+token, token)
+				continue
+			}
+			_, _, _ = st.GetFullURL(ctx, benchTokens[i%benchLinks])
+		}
+	})
+}
+
+func BenchmarkReadOnly(b *testing.B) {
+	b.Run("single lock", func(b *testing.B) { benchmarkMixed(b, newSingleLock(), 0) })
+	b.Run("sharded", func(b *testing.B) { benchmarkMixed(b, New(), 0) })
+	b.Run("sharded lru", func(b *testing.B) { benchmarkMixed(b, newBenchBounded(b), 0) })
+}
+
+// newBenchBounded tracks recency on every read but never evicts.
+func newBenchBounded(b *testing.B) *Inmemory {
+	st, err := NewBounded(Limits{MaxLinks: 2 * benchLinks, Policy: EvictLRU})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return st
+}
+
+func BenchmarkTenPercentWrites(b *testing.B) {
+	b.Run("single lock", func(b *testing.B) { benchmarkMixed(b, newSingleLock(), 10) })
+	b.Run("sharded", func(b *testing.B) { benchmarkMixed(b, New(), 10) })
+}
+
+func BenchmarkWriteOnly(b *testing.B) {
+	b.Run("single lock", func(b *testing.B) { benchmarkMixed(b, newSingleLock(), 1) })
+	b.Run("sharded", func(b *testing.B) { benchmarkMixed(b, New(), 1) })
+}
@@ -3,63 +3,381 @@ package inmemory
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 
 	"github.com/ilyakharev/url-short/internal/storage"
 )
 
+// shardCount must be a power of two.
+const shardCount = 64
+
+// shard is one lock stripe of an index, padded to a cache line so that
+// locking one shard does not slow down the neighbours.
+type shard struct {
+	mutex sync.RWMutex
+	items map[string]string
+	// attrs are attributes of the links of a token shard, only the links
+	// that have any are there.
+	attrs map[string]storage.Attributes
+	_     [24]byte
+}
+
+type clickShard struct {
+	mutex sync.Mutex
+	items map[string]int64
+	_     [48]byte
+}
+
+// Inmemory keeps links in two indexes, token to full URL and full URL to
+// token, each split into shards with their own locks by the hash of the key.
+// Writers lock the token shard first and then the URL shards in the order of
+// their numbers, so a create or an update is atomic across both indexes and
+// can not deadlock.
 type Inmemory struct {
-	mutex       sync.RWMutex
-	shortToFull map[string]string
-	fullToShort map[string]string
+	shortToFull [shardCount]shard
+	fullToShort [shardCount]shard
+	clicks      [shardCount]clickShard
+	links       atomic.Int64
+	// evictor is nil when the storage is not bounded.
+	evictor *evictor
+
+	poolMutex sync.Mutex
+	tokenPool map[string]struct{}
+
+	webhooks  *webhookStore
+	campaigns *campaignStore
 }
 
-var _ storage.Storager = &Inmemory{}
+var (
+	_ storage.Storager    = &Inmemory{}
+	_ storage.TokenPooler = &Inmemory{}
+	_ storage.Counter     = &Inmemory{}
+	_ storage.Editor      = &Inmemory{}
+
+	_ storage.ClickCounter     = &Inmemory{}
+	_ storage.EvictionReporter = &Inmemory{}
+	_ storage.AttributeStorer  = &Inmemory{}
+	_ storage.WebhookStorer    = &Inmemory{}
+	_ storage.CampaignStorer   = &Inmemory{}
+	_ storage.CampaignCounter  = &Inmemory{}
+)
+
+// errTokenExists and noAttributes are reachable from methods, where the
+// receiver hides the storage package.
+var (
+	errTokenExists = storage.ErrTokenExists
+	noAttributes   = storage.Attributes{}
+)
 
 func New() *Inmemory {
-	return &Inmemory{
-		mutex:       sync.RWMutex{},
-		shortToFull: make(map[string]string),
-		fullToShort: make(map[string]string),
+	st := &Inmemory{
+		tokenPool: make(map[string]struct{}),
+		webhooks:  newWebhookStore(),
+		campaigns: newCampaignStore(),
+	}
+	for i := range st.shortToFull {
+		st.shortToFull[i].items = make(map[string]string)
+		st.shortToFull[i].attrs = make(map[string]storage.Attributes)
+		st.fullToShort[i].items = make(map[string]string)
+		st.clicks[i].items = make(map[string]int64)
 	}
+	return st
 }
 
-func (storage *Inmemory) GetFullURL(_ context.Context,
+// NewBounded creates a storage that evicts links by limits.Policy once
+// one of the limits is reached.
+func NewBounded(limits Limits) (*Inmemory, error) {
+	evictor, err := newEvictor(limits)
+	if err != nil {
+		return nil, err
+	}
+	storage := New()
+	storage.evictor = evictor
+	return storage, nil
+}
+
+// shardIndex is FNV-1a of key, inlined to not allocate on the read path.
+func shardIndex(key string) int {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return int(hash & (shardCount - 1))
+}
+
+func (storage *Inmemory) tokenShard(token string) *shard {
+	return &storage.shortToFull[shardIndex(token)]
+}
+
+func (storage *Inmemory) urlShard(fullURL string) *shard {
+	return &storage.fullToShort[shardIndex(fullURL)]
+}
+
+func (storage *Inmemory) GetFullURL(ctx context.Context,
 	token string,
 ) (fullURL string, found bool, err error) {
-	storage.mutex.RLock()
-	defer storage.mutex.RUnlock()
+	fullURL, _, found, err = storage.GetWithAttributes(ctx, token)
+	return fullURL, found, err
+}
 
-	fullURL, found = storage.shortToFull[token]
+func (storage *Inmemory) GetWithAttributes(_ context.Context,
+	token string,
+) (fullURL string, attrs storage.Attributes, found bool, err error) {
+	links := storage.tokenShard(token)
+	links.mutex.RLock()
+	fullURL, found = links.items[token]
+	attrs = links.attrs[token]
+	links.mutex.RUnlock()
 	if !found {
-		return "", found, err
+		return "", attrs, found, err
 	}
-	return fullURL, found, err
+	if storage.evictor != nil {
+		storage.evictor.touch(token)
+	}
+	return fullURL, attrs, found, err
 }
 
-func (storage *Inmemory) CreateShortURL(_ context.Context, fullURL string,
+func (storage *Inmemory) CreateShortURL(ctx context.Context, fullURL string,
 	token string,
 ) (err error) {
-	storage.mutex.RLock()
-	defer storage.mutex.RUnlock()
-
-	storage.fullToShort[fullURL] = token
-	storage.shortToFull[token] = fullURL
+	return storage.CreateWithAttributes(ctx, fullURL, token, noAttributes)
+}
 
+func (storage *Inmemory) CreateWithAttributes(_ context.Context, fullURL string,
+	token string, attrs storage.Attributes,
+) (err error) {
+	links := storage.tokenShard(token)
+	links.mutex.Lock()
+	if _, exists := links.items[token]; exists {
+		links.mutex.Unlock()
+		return errTokenExists
+	}
+	storage.setLink(links, token, "", false, fullURL)
+	if !attrs.IsZero() {
+		links.attrs[token] = attrs
+	}
+	links.mutex.Unlock()
+	storage.links.Add(1)
+	storage.evict(token, fullURL)
 	return nil
 }
 
 func (storage *Inmemory) AlreadyExists(_ context.Context,
 	fullURL string,
 ) (token string, found bool, err error) {
-	storage.mutex.RLock()
-	defer storage.mutex.RUnlock()
-	token, found = storage.fullToShort[fullURL]
+	urls := storage.urlShard(fullURL)
+	urls.mutex.RLock()
+	defer urls.mutex.RUnlock()
+
+	token, found = urls.items[fullURL]
 	if found {
 		return token, found, nil
 	}
 	return "", found, nil
 }
 
+func (storage *Inmemory) UpdateShortURL(_ context.Context, token string,
+	fullURL string,
+) (found bool, err error) {
+	links := storage.tokenShard(token)
+	links.mutex.Lock()
+	oldURL, found := links.items[token]
+	if found {
+		storage.setLink(links, token, oldURL, true, fullURL)
+	}
+	links.mutex.Unlock()
+	if !found {
+		return false, nil
+	}
+	storage.evict(token, fullURL)
+	return true, nil
+}
+
+func (storage *Inmemory) DeleteShortURL(_ context.Context,
+	token string,
+) (found bool, err error) {
+	if storage.evictor != nil {
+		storage.evictor.remove(token)
+	}
+	return storage.deleteLink(token), nil
+}
+
+// evict accounts the written link and drops the links evicted for it.
+// No shard may be locked, a victim can be in any of them.
+func (storage *Inmemory) evict(token string, fullURL string) {
+	if storage.evictor == nil {
+		return
+	}
+	for _, victim := range storage.evictor.set(token, fullURL) {
+		storage.deleteLink(victim)
+	}
+}
+
+func (storage *Inmemory) deleteLink(token string) (found bool) {
+	links := storage.tokenShard(token)
+	links.mutex.Lock()
+	defer links.mutex.Unlock()
+
+	fullURL, found := links.items[token]
+	if !found {
+		return false
+	}
+	urls := storage.urlShard(fullURL)
+	urls.mutex.Lock()
+	if urls.items[fullURL] == token {
+		delete(urls.items, fullURL)
+	}
+	urls.mutex.Unlock()
+	delete(links.items, token)
+	delete(links.attrs, token)
+	storage.links.Add(-1)
+
+	clicks := &storage.clicks[shardIndex(token)]
+	clicks.mutex.Lock()
+	delete(clicks.items, token)
+	clicks.mutex.Unlock()
+	return true
+}
+
+// setLink points token to fullURL in both indexes, dropping the reverse
+// entry of oldURL if there was one. The token shard must be locked.
+func (storage *Inmemory) setLink(links *shard, token string, oldURL string, hadOld bool,
+	fullURL string,
+) {
+	newIndex := shardIndex(fullURL)
+	oldIndex := newIndex
+	if hadOld {
+		oldIndex = shardIndex(oldURL)
+	}
+	first, second := min(oldIndex, newIndex), max(oldIndex, newIndex)
+	storage.fullToShort[first].mutex.Lock()
+	if second != first {
+		storage.fullToShort[second].mutex.Lock()
+	}
+
+	if hadOld && storage.fullToShort[oldIndex].items[oldURL] == token {
+		delete(storage.fullToShort[oldIndex].items, oldURL)
+	}
+	storage.fullToShort[newIndex].items[fullURL] = token
+	links.items[token] = fullURL
+
+	if second != first {
+		storage.fullToShort[second].mutex.Unlock()
+	}
+	storage.fullToShort[first].mutex.Unlock()
+}
+
+// Range calls fn for every link, shard by shard, until fn returns false.
+// Links changed while it runs may be seen or not.
+func (storage *Inmemory) Range(fn func(token string, fullURL string) bool) {
+	storage.RangeWithAttributes(withoutAttributes(fn))
+}
+
+func withoutAttributes(fn func(token string, fullURL string) bool,
+) func(token string, fullURL string, attrs storage.Attributes) bool {
+	return func(token string, fullURL string, _ storage.Attributes) bool {
+		return fn(token, fullURL)
+	}
+}
+
+// RangeWithAttributes is Range that also passes attributes of links.
+func (storage *Inmemory) RangeWithAttributes(fn func(token string, fullURL string,
+	attrs storage.Attributes) bool,
+) {
+	for i := range storage.shortToFull {
+		links := &storage.shortToFull[i]
+		links.mutex.RLock()
+		for token, fullURL := range links.items {
+			if !fn(token, fullURL, links.attrs[token]) {
+				links.mutex.RUnlock()
+				return
+			}
+		}
+		links.mutex.RUnlock()
+	}
+}
+
+func (storage *Inmemory) used(token string) bool {
+	links := storage.tokenShard(token)
+	links.mutex.RLock()
+	defer links.mutex.RUnlock()
+
+	_, used := links.items[token]
+	return used
+}
+
+func (storage *Inmemory) AddClick(_ context.Context, token string) (err error) {
+	if !storage.used(token) {
+		return nil
+	}
+	clicks := &storage.clicks[shardIndex(token)]
+	clicks.mutex.Lock()
+	clicks.items[token]++
+	clicks.mutex.Unlock()
+
+	if storage.evictor != nil {
+		storage.evictor.click(token)
+	}
+	return nil
+}
+
+func (storage *Inmemory) Clicks(_ context.Context, token string) (count int64, err error) {
+	return storage.clickCount(token), nil
+}
+
+// Evicted reports if token was dropped to fit the limits. Only the last
+// Limits.MaxEvicted evicted tokens are remembered.
+func (storage *Inmemory) Evicted(_ context.Context, token string) (evicted bool, err error) {
+	if storage.evictor == nil {
+		return false, nil
+	}
+	return storage.evictor.wasEvicted(token), nil
+}
+
+func (storage *Inmemory) AddTokens(_ context.Context,
+	tokens []string,
+) (added int, err error) {
+	storage.poolMutex.Lock()
+	defer storage.poolMutex.Unlock()
+
+	for _, token := range tokens {
+		if storage.used(token) {
+			continue
+		}
+		if _, pooled := storage.tokenPool[token]; pooled {
+			continue
+		}
+		storage.tokenPool[token] = struct{}{}
+		added++
+	}
+	return added, nil
+}
+
+func (storage *Inmemory) ClaimToken(_ context.Context) (token string, found bool, err error) {
+	storage.poolMutex.Lock()
+	defer storage.poolMutex.Unlock()
+
+	for token = range storage.tokenPool {
+		delete(storage.tokenPool, token)
+		if !storage.used(token) {
+			return token, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (storage *Inmemory) PoolSize(_ context.Context) (size int, err error) {
+	storage.poolMutex.Lock()
+	defer storage.poolMutex.Unlock()
+
+	return len(storage.tokenPool), nil
+}
+
+func (storage *Inmemory) Count(_ context.Context) (count int, err error) {
+	return int(storage.links.Load()), nil
+}
+
 func (storage *Inmemory) Close() error {
 	return nil
 }
@@ -2,6 +2,8 @@ package inmemory
 
 import (
 	"context"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -66,4 +68,188 @@ func Test_StoreUrl(t *testing.T) {
 		require.NoError(t, err)
 		assert.True(t, found)
 	})
+	t.Run("count", func(t *testing.T) {
+		storage := New()
+		ctx := context.Background()
+
+		count, err := storage.Count(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, count)
+
+		err = storage.CreateShortURL(ctx, fullURL, token)
+		require.NoError(t, err)
+
+		count, err = storage.Count(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+}
+
+func Test_TokenPool(t *testing.T) {
+	t.Run("claim added tokens", func(t *testing.T) {
+		storage := New()
+		ctx := context.Background()
+
+		added, err := storage.AddTokens(ctx, []string{"a", "b", "a"})
+		require.NoError(t, err)
+		assert.Equal(t, 2, added)
+
+		size, err := storage.PoolSize(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, size)
+
+		claimed := map[string]bool{}
+		for i := 0; i < 2; i++ {
+			token, found, err := storage.ClaimToken(ctx)
+			require.NoError(t, err)
+			require.True(t, found)
+			claimed[token] = true
+		}
+		assert.Equal(t, map[string]bool{"a": true, "b": true}, claimed)
+
+		_, found, err := storage.ClaimToken(ctx)
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+	t.Run("skip used tokens", func(t *testing.T) {
+		storage := New()
+		ctx := context.Background()
+
+		err := storage.CreateShortURL(ctx, fullURL, token)
+		require.NoError(t, err)
+
+		added, err := storage.AddTokens(ctx, []string{token})
+		require.NoError(t, err)
+		assert.Zero(t, added)
+	})
+}
+
+func Test_Edit(t *testing.T) {
+	t.Run("update", func(t *testing.T) {
+		storage := New()
+		ctx := context.Background()
+		require.NoError(t, storage.CreateShortURL(ctx, fullURL, token))
+
+		found, err := storage.UpdateShortURL(ctx, token, "https://ya.ru")
+		require.NoError(t, err)
+		assert.True(t, found)
+
+		url, _, err := storage.GetFullURL(ctx, token)
+		require.NoError(t, err)
+		assert.Equal(t, "https://ya.ru", url)
+		_, found, err = storage.AlreadyExists(ctx, fullURL)
+		require.NoError(t, err)
+		assert.False(t, found)
+		existing, _, err := storage.AlreadyExists(ctx, "https://ya.ru")
+		require.NoError(t, err)
+		assert.Equal(t, token, existing)
+	})
+	t.Run("delete", func(t *testing.T) {
+		storage := New()
+		ctx := context.Background()
+		require.NoError(t, storage.CreateShortURL(ctx, fullURL, token))
+
+		found, err := storage.DeleteShortURL(ctx, token)
+		require.NoError(t, err)
+		assert.True(t, found)
+
+		_, found, err = storage.GetFullURL(ctx, token)
+		require.NoError(t, err)
+		assert.False(t, found)
+		_, found, err = storage.AlreadyExists(ctx, fullURL)
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+	t.Run("missing token", func(t *testing.T) {
+		storage := New()
+		ctx := context.Background()
+
+		found, err := storage.UpdateShortURL(ctx, token, fullURL)
+		require.NoError(t, err)
+		assert.False(t, found)
+		found, err = storage.DeleteShortURL(ctx, token)
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+}
+
+func Test_Parallel(t *testing.T) {
+	storage := New()
+	ctx := context.Background()
+	const workers, links = 8, 500
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < links; i++ {
+				token := strconv.Itoa(w*links + i)
+				url := "https://mai.ru/" + token
+				assert.NoError(t, storage.CreateShortURL(ctx, url, token))
+
+				got, found, err := storage.GetFullURL(ctx, token)
+				assert.NoError(t, err)
+				assert.True(t, found)
+				assert.Equal(t, url, got)
+				existing, found, err := storage.AlreadyExists(ctx, url)
+				assert.NoError(t, err)
+				assert.True(t, found)
+				assert.Equal(t, token, existing)
+
+				switch i % 3 {
+				case 1:
+					_, err = storage.UpdateShortURL(ctx, token, url+"/new")
+				case 2:
+					_, err = storage.DeleteShortURL(ctx, token)
+				}
+				assert.NoError(t, err)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	count, err := storage.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, workers*(links-links/3), count)
+
+	// Both indexes must agree after the concurrent changes.
+	indexed := 0
+	storage.Range(func(token string, fullURL string) bool {
+		existing, found, err := storage.AlreadyExists(ctx, fullURL)
+		assert.NoError(t, err)
+		assert.True(t, found, fullURL)
+		assert.Equal(t, token, existing)
+		indexed++
+		return true
+	})
+	assert.Equal(t, count, indexed)
+}
+
+func Test_ParallelSameURL(t *testing.T) {
+	storage := New()
+	ctx := context.Background()
+
+	// Tokens of one URL are created and repointed concurrently, which locks
+	// the same and different URL shards in every order.
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			token := strconv.Itoa(w)
+			assert.NoError(t, storage.CreateShortURL(ctx, fullURL, token))
+			for i := 0; i < 200; i++ {
+				_, err := storage.UpdateShortURL(ctx, token, fullURL+"/"+strconv.Itoa(i%5))
+				assert.NoError(t, err)
+				_, err = storage.UpdateShortURL(ctx, token, fullURL)
+				assert.NoError(t, err)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	count, err := storage.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 8, count)
 }
@@ -0,0 +1,157 @@
+package inmemory
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// Every record of the log and the snapshot is framed as
+//
+//	length uint32 | crc32c(payload) uint32 | payload
+//
+// and the payload is the operation byte followed by the token and the full
+// URL, each prefixed with its uvarint length. A create with attributes has
+// the encoded attributes as the third field.
+const (
+	recordHeaderSize = 8
+	maxRecordSize    = 1 << 20
+)
+
+type walOp byte
+
+const (
+	opCreate walOp = iota + 1
+	opUpdate
+	opDelete
+	opCreateWithAttributes
+)
+
+// errTornRecord means the record was not written completely, which happens
+// to the last record of the log when the process crashes mid-write.
+var errTornRecord = errors.New("torn record")
+
+// errCorruptRecord means a record followed by more data fails its checks, so
+// it was damaged after it had been written.
+var errCorruptRecord = errors.New("corrupted record")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+type walRecord struct {
+	op         walOp
+	token      string
+	fullURL    string
+	attributes string
+}
+
+func (record *walRecord) fields() []*string {
+	if record.op == opCreateWithAttributes {
+		return []*string{&record.token, &record.fullURL, &record.attributes}
+	}
+	return []*string{&record.token, &record.fullURL}
+}
+
+func appendRecord(buf []byte, record walRecord) []byte {
+	payloadSize := 1 + binary.MaxVarintLen64*3 + len(record.token) + len(record.fullURL) +
+		len(record.attributes)
+	payload := make([]byte, 0, payloadSize)
+	payload = append(payload, byte(record.op))
+	for _, field := range record.fields() {
+		payload = binary.AppendUvarint(payload, uint64(len(*field)))
+		payload = append(payload, *field...)
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(payload, crcTable))
+	return append(buf, payload...)
+}
+
+type recordReader struct {
+	reader *bufio.Reader
+	// offset is the end of the last record read successfully.
+	offset int64
+}
+
+func newRecordReader(r io.Reader) *recordReader {
+	return &recordReader{reader: bufio.NewReader(r)}
+}
+
+// next returns io.EOF at the clean end of the input, errTornRecord when the
+// rest of the input is not a valid record and errCorruptRecord when an invalid
+// record is followed by more data.
+func (reader *recordReader) next() (walRecord, error) {
+	var header [recordHeaderSize]byte
+	n, err := io.ReadFull(reader.reader, header[:])
+	if errors.Is(err, io.EOF) {
+		return walRecord{}, io.EOF
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return walRecord{}, errTornRecord
+	}
+	if err != nil {
+		return walRecord{}, err
+	}
+
+	size := binary.LittleEndian.Uint32(header[:4])
+	if size == 0 || size > maxRecordSize {
+		return walRecord{}, reader.invalid()
+	}
+	payload := make([]byte, size)
+	_, err = io.ReadFull(reader.reader, payload)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return walRecord{}, errTornRecord
+	}
+	if err != nil {
+		return walRecord{}, err
+	}
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:]) {
+		return walRecord{}, reader.invalid()
+	}
+
+	record, err := decodePayload(payload)
+	if err != nil {
+		return walRecord{}, err
+	}
+	reader.offset += int64(n) + int64(size)
+	return record, nil
+}
+
+// invalid returns the error of a record failing its checks: it is torn when
+// it ends the input, or only zero bytes follow it, which a crash can leave in
+// place of the data of an unfinished write.
+func (reader *recordReader) invalid() error {
+	for {
+		b, err := reader.reader.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return errTornRecord
+		}
+		if err != nil {
+			return err
+		}
+		if b != 0 {
+			return errCorruptRecord
+		}
+	}
+}
+
+func decodePayload(payload []byte) (walRecord, error) {
+	record := walRecord{op: walOp(payload[0])}
+	if record.op < opCreate || record.op > opCreateWithAttributes {
+		return walRecord{}, errCorruptRecord
+	}
+	rest := payload[1:]
+	for _, field := range record.fields() {
+		length, n := binary.Uvarint(rest)
+		if n <= 0 || length > uint64(len(rest)-n) {
+			return walRecord{}, errCorruptRecord
+		}
+		*field = string(rest[n : n+int(length)])
+		rest = rest[n+int(length):]
+	}
+	if len(rest) != 0 {
+		return walRecord{}, errCorruptRecord
+	}
+	return record, nil
+}
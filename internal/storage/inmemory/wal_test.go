@@ -0,0 +1,71 @@
+package inmemory
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+	records := []walRecord{
+		{op: opCreate, token: "abc", fullURL: "https://mai.ru"},
+		{op: opUpdate, token: "abc", fullURL: "https://ya.ru/?q=" + string(bytes.Repeat([]byte("x"), 300))},
+		{op: opDelete, token: "abc"},
+		{op: opCreateWithAttributes, token: "abd", fullURL: "https://mai.ru", attributes: `{"tags":["a"]}`},
+	}
+	var buf []byte
+	for _, record := range records {
+		buf = appendRecord(buf, record)
+	}
+
+	reader := newRecordReader(bytes.NewReader(buf))
+	for _, expected := range records {
+		record, err := reader.next()
+		require.NoError(t, err)
+		assert.Equal(t, expected, record)
+	}
+	_, err := reader.next()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, int64(len(buf)), reader.offset)
+}
+
+func TestTornRecord(t *testing.T) {
+	first := appendRecord(nil, walRecord{op: opCreate, token: "a", fullURL: "https://mai.ru"})
+	second := appendRecord(nil, walRecord{op: opCreate, token: "b", fullURL: "https://ya.ru"})
+
+	corrupted := bytes.Clone(second)
+	corrupted[len(corrupted)-1] ^= 0xff
+	cases := []struct {
+		name   string
+		tail   []byte
+		expect error
+	}{
+		{name: "partial header", tail: second[:3], expect: errTornRecord},
+		{name: "partial payload", tail: second[:len(second)-2], expect: errTornRecord},
+		{name: "bad checksum", tail: corrupted, expect: errTornRecord},
+		{name: "zeroed tail", tail: make([]byte, 32), expect: errTornRecord},
+		{name: "bad checksum before zeroes", tail: append(bytes.Clone(corrupted), 0, 0, 0), expect: errTornRecord},
+		{name: "garbage length", tail: []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}, expect: errTornRecord},
+		{name: "bad checksum before record", tail: append(bytes.Clone(corrupted), first...), expect: errCorruptRecord},
+		{
+			name:   "garbage length before data",
+			tail:   []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 1},
+			expect: errCorruptRecord,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := newRecordReader(bytes.NewReader(append(bytes.Clone(first), tc.tail...)))
+
+			_, err := reader.next()
+			require.NoError(t, err)
+			_, err = reader.next()
+			assert.True(t, errors.Is(err, tc.expect), "got %v", err)
+			assert.Equal(t, int64(len(first)), reader.offset)
+		})
+	}
+}
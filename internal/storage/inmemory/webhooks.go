@@ -0,0 +1,202 @@
+package inmemory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+// webhookStore keeps webhooks and their deliveries in maps under one lock,
+// there are few of them compared to links. Durable does not persist them.
+type webhookStore struct {
+	mutex      sync.Mutex
+	webhooks   map[string]storage.Webhook
+	deliveries map[string]storage.WebhookDelivery
+}
+
+func newWebhookStore() *webhookStore {
+	return &webhookStore{
+		webhooks:   make(map[string]storage.Webhook),
+		deliveries: make(map[string]storage.WebhookDelivery),
+	}
+}
+
+func (storage *Inmemory) CreateWebhook(_ context.Context, webhook *storage.Webhook) (err error) {
+	store := storage.webhooks
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, found := store.webhooks[webhook.ID]; found {
+		return errTokenExists
+	}
+	created := *webhook
+	created.Events = slices.Clone(webhook.Events)
+	store.webhooks[webhook.ID] = created
+	return nil
+}
+
+func (storage *Inmemory) Webhooks(_ context.Context, tenant string) (webhooks []storage.Webhook, err error) {
+	store := storage.webhooks
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for id := range store.webhooks {
+		webhook := store.webhooks[id]
+		if tenant == "" || webhook.Tenant == tenant {
+			webhook.Events = slices.Clone(webhook.Events)
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	sortWebhooks(webhooks)
+	return webhooks, nil
+}
+
+func (storage *Inmemory) DeleteWebhook(_ context.Context, tenant string, id string) (found bool, err error) {
+	store := storage.webhooks
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	webhook, found := store.webhooks[id]
+	if !found || webhook.Tenant != tenant {
+		return false, nil
+	}
+	delete(store.webhooks, id)
+	for deliveryID := range store.deliveries {
+		if store.deliveries[deliveryID].WebhookID == id {
+			delete(store.deliveries, deliveryID)
+		}
+	}
+	return true, nil
+}
+
+func (storage *Inmemory) EnqueueDeliveries(_ context.Context, deliveries []storage.WebhookDelivery) (err error) {
+	store := storage.webhooks
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for i := range deliveries {
+		if _, found := store.deliveries[deliveries[i].ID]; found {
+			return errTokenExists
+		}
+	}
+	for i := range deliveries {
+		delivery := deliveries[i]
+		delivery.Payload = slices.Clone(delivery.Payload)
+		store.deliveries[delivery.ID] = delivery
+	}
+	return nil
+}
+
+func (storage *Inmemory) ClaimDeliveries(_ context.Context, now time.Time, lease time.Duration,
+	limit int,
+) (deliveries []storage.WebhookDelivery, err error) {
+	store := storage.webhooks
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for id := range store.deliveries {
+		delivery := store.deliveries[id]
+		if !delivery.Dead && !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sortDue(deliveries)
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	for i := range deliveries {
+		claimed := store.deliveries[deliveries[i].ID]
+		claimed.NextAttemptAt = now.Add(lease)
+		store.deliveries[claimed.ID] = claimed
+		deliveries[i].Payload = slices.Clone(deliveries[i].Payload)
+	}
+	return deliveries, nil
+}
+
+func (storage *Inmemory) UpdateDelivery(_ context.Context, delivery *storage.WebhookDelivery) (err error) {
+	store := storage.webhooks
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	stored, found := store.deliveries[delivery.ID]
+	if !found {
+		return nil
+	}
+	stored.Attempts = delivery.Attempts
+	stored.NextAttemptAt = delivery.NextAttemptAt
+	stored.LastError = delivery.LastError
+	stored.Dead = delivery.Dead
+	store.deliveries[delivery.ID] = stored
+	return nil
+}
+
+func (storage *Inmemory) DeleteDelivery(_ context.Context, id string) (err error) {
+	store := storage.webhooks
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.deliveries, id)
+	return nil
+}
+
+func (storage *Inmemory) DeadDeliveries(_ context.Context, tenant string,
+	limit int,
+) (deliveries []storage.WebhookDelivery, err error) {
+	store := storage.webhooks
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for id := range store.deliveries {
+		delivery := store.deliveries[id]
+		if delivery.Dead && delivery.Tenant == tenant {
+			delivery.Payload = slices.Clone(delivery.Payload)
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sortNewest(deliveries)
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (storage *Inmemory) ReplayDelivery(_ context.Context, tenant string, id string,
+	now time.Time,
+) (found bool, err error) {
+	store := storage.webhooks
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delivery, found := store.deliveries[id]
+	if !found || !delivery.Dead || delivery.Tenant != tenant {
+		return false, nil
+	}
+	delivery.Dead = false
+	delivery.Attempts = 0
+	delivery.LastError = ""
+	delivery.NextAttemptAt = now
+	store.deliveries[id] = delivery
+	return true, nil
+}
+
+func sortWebhooks(webhooks []storage.Webhook) {
+	slices.SortFunc(webhooks, func(a, b storage.Webhook) int {
+		if order := a.CreatedAt.Compare(b.CreatedAt); order != 0 {
+			return order
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
+
+func sortDue(deliveries []storage.WebhookDelivery) {
+	slices.SortFunc(deliveries, func(a, b storage.WebhookDelivery) int {
+		if order := a.NextAttemptAt.Compare(b.NextAttemptAt); order != 0 {
+			return order
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
+
+func sortNewest(deliveries []storage.WebhookDelivery) {
+	slices.SortFunc(deliveries, func(a, b storage.WebhookDelivery) int {
+		if order := b.CreatedAt.Compare(a.CreatedAt); order != 0 {
+			return order
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+}
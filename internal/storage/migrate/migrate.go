@@ -0,0 +1,280 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrNothingToRollback = errors.New("no applied migrations to roll back")
+	ErrPendingMigrations = errors.New("database schema has pending migrations")
+
+	fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+)
+
+const templateMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version		BIGINT PRIMARY KEY,
+	name		VARCHAR(255) NOT NULL,
+	applied_at	TIMESTAMP NOT NULL
+)`
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Dialect describes what differs between databases for the migrator.
+type Dialect struct {
+	// Lock is held on conn while migrations run, so that replicas started
+	// together do not apply the same migration twice.
+	Lock func(ctx context.Context, conn *sql.Conn) (unlock func(ctx context.Context) error, err error)
+	// Placeholder returns the bind parameter with the 1-based index n.
+	Placeholder func(n int) string
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	dialect    Dialect
+}
+
+// Load reads migrations from files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql in the root of fsys.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		content, err := fs.ReadFile(fsys, path.Clean(entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, found := byVersion[version]
+		if !found {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names: %q and %q",
+				version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func New(db *sql.DB, migrations []Migration, dialect Dialect) *Migrator {
+	return &Migrator{db: db, migrations: migrations, dialect: dialect}
+}
+
+// Up applies all pending migrations in order of their versions.
+func (migrator *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := migrator.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := migrator.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrator.migrations {
+			if _, found := versions[migration.Version]; found {
+				continue
+			}
+			err = migrator.apply(ctx, conn, migration, true)
+			if err != nil {
+				return fmt.Errorf("apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the latest applied migration.
+func (migrator *Migrator) Down(ctx context.Context) (Migration, error) {
+	var rolledBack Migration
+	err := migrator.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := migrator.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrator.migrations) - 1; i >= 0; i-- {
+			migration := migrator.migrations[i]
+			if _, found := versions[migration.Version]; !found {
+				continue
+			}
+			err = migrator.apply(ctx, conn, migration, false)
+			if err != nil {
+				return fmt.Errorf("roll back migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			rolledBack = migration
+			return nil
+		}
+		return ErrNothingToRollback
+	})
+	return rolledBack, err
+}
+
+func (migrator *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := migrator.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := migrator.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrator.migrations {
+			appliedAt, applied := versions[migration.Version]
+			statuses = append(statuses, Status{
+				Migration: migration,
+				Applied:   applied,
+				AppliedAt: appliedAt,
+			})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// Check returns ErrPendingMigrations if some migration is not applied.
+func (migrator *Migrator) Check(ctx context.Context) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if !status.Applied {
+			return fmt.Errorf("%w: %d_%s", ErrPendingMigrations, status.Version, status.Name)
+		}
+	}
+	return nil
+}
+
+func (migrator *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) (err error) {
+	conn, err := migrator.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	unlock, err := migrator.dialect.Lock(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		unlockErr := unlock(context.WithoutCancel(ctx))
+		if unlockErr != nil {
+			// Do not return a connection still holding the lock to the pool.
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+			err = errors.Join(err, unlockErr)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, templateMigrationsTable)
+	if err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func (migrator *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	versions := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+	return versions, rows.Err()
+}
+
+func (migrator *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	p := migrator.dialect.Placeholder
+	if up {
+		_, err = tx.ExecContext(ctx, migration.Up)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO schema_migrations(version, name, applied_at) VALUES (`+p(1)+`, `+p(2)+`, `+p(3)+`)`,
+			migration.Version, migration.Name, time.Now().UTC())
+	} else {
+		if migration.Down == "" {
+			return fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+		}
+		_, err = tx.ExecContext(ctx, migration.Down)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = `+p(1), migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
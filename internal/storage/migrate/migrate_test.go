@@ -0,0 +1,164 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFS = fstest.MapFS{
+	"0001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id INT)")},
+	"0001_create_a.down.sql": {Data: []byte("DROP TABLE a")},
+	"0002_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id INT)")},
+	"0002_create_b.down.sql": {Data: []byte("DROP TABLE b")},
+	"README.md":              {Data: []byte("not a migration")},
+}
+
+var testDialect = Dialect{
+	Lock: func(ctx context.Context, conn *sql.Conn) (func(ctx context.Context) error, error) {
+		_, err := conn.ExecContext(ctx, "LOCK")
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context) error {
+			_, err := conn.ExecContext(ctx, "UNLOCK")
+			return err
+		}, nil
+	},
+	Placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+}
+
+func newTestMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	migrations, err := Load(testFS)
+	require.NoError(t, err)
+	return New(db, migrations, testDialect), mock
+}
+
+func expectLocked(mock sqlmock.Sqlmock, applied ...int64) {
+	mock.ExpectExec("LOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "applied_at"})
+	for _, version := range applied {
+		rows.AddRow(version, time.Unix(version, 0))
+	}
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").WillReturnRows(rows)
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("sorted by version", func(t *testing.T) {
+		migrations, err := Load(testFS)
+		require.NoError(t, err)
+		assert.Equal(t, []Migration{
+			{Version: 1, Name: "create_a", Up: "CREATE TABLE a (id INT)", Down: "DROP TABLE a"},
+			{Version: 2, Name: "create_b", Up: "CREATE TABLE b (id INT)", Down: "DROP TABLE b"},
+		}, migrations)
+	})
+	t.Run("missing up file", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{"0001_a.down.sql": {Data: []byte("DROP TABLE a")}})
+		require.Error(t, err)
+	})
+	t.Run("different names", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{
+			"0001_a.up.sql":   {Data: []byte("CREATE TABLE a (id INT)")},
+			"0001_b.down.sql": {Data: []byte("DROP TABLE a")},
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestUp(t *testing.T) {
+	t.Run("apply pending", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+		expectLocked(mock, 1)
+		mock.ExpectBegin()
+		mock.ExpectExec("CREATE TABLE b").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO schema_migrations").
+			WithArgs(int64(2), "create_b", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec("UNLOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		applied, err := migrator.Up(context.Background())
+		require.NoError(t, err)
+		require.Len(t, applied, 1)
+		assert.Equal(t, int64(2), applied[0].Version)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("roll back failed migration", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+		expectLocked(mock)
+		mock.ExpectBegin()
+		mock.ExpectExec("CREATE TABLE a").WillReturnError(errors.New("syntax error"))
+		mock.ExpectRollback()
+		mock.ExpectExec("UNLOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		applied, err := migrator.Up(context.Background())
+		require.Error(t, err)
+		assert.Empty(t, applied)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("lock error", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+		mock.ExpectExec("LOCK").WillReturnError(errors.New("any"))
+
+		_, err := migrator.Up(context.Background())
+		require.Error(t, err)
+	})
+}
+
+func TestDown(t *testing.T) {
+	t.Run("roll back latest", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+		expectLocked(mock, 1, 2)
+		mock.ExpectBegin()
+		mock.ExpectExec("DROP TABLE b").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM schema_migrations").
+			WithArgs(int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec("UNLOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		rolledBack, err := migrator.Down(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), rolledBack.Version)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("nothing to roll back", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+		expectLocked(mock)
+		mock.ExpectExec("UNLOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		_, err := migrator.Down(context.Background())
+		require.ErrorIs(t, err, ErrNothingToRollback)
+	})
+}
+
+func TestStatus(t *testing.T) {
+	migrator, mock := newTestMigrator(t)
+	expectLocked(mock, 1)
+	mock.ExpectExec("UNLOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	statuses, err := migrator.Status(context.Background())
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Applied)
+	assert.Equal(t, time.Unix(1, 0), statuses[0].AppliedAt)
+	assert.False(t, statuses[1].Applied)
+
+	expectLocked(mock, 1)
+	mock.ExpectExec("UNLOCK").WillReturnResult(sqlmock.NewResult(0, 0))
+	err = migrator.Check(context.Background())
+	require.ErrorIs(t, err, ErrPendingMigrations)
+}
@@ -11,8 +11,10 @@ package mock_storage
 
 import (
 	context "context"
+	io "io"
 	reflect "reflect"
 
+	storage "github.com/ilyakharev/url-short/internal/storage"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -98,3 +100,403 @@ func (mr *MockStoragerMockRecorder) GetFullURL(ctx, token any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFullURL", reflect.TypeOf((*MockStorager)(nil).GetFullURL), ctx, token)
 }
+
+// MockTokenPooler is a mock of TokenPooler interface.
+type MockTokenPooler struct {
+	ctrl     *gomock.Controller
+	recorder *MockTokenPoolerMockRecorder
+}
+
+// MockTokenPoolerMockRecorder is the mock recorder for MockTokenPooler.
+type MockTokenPoolerMockRecorder struct {
+	mock *MockTokenPooler
+}
+
+// NewMockTokenPooler creates a new mock instance.
+func NewMockTokenPooler(ctrl *gomock.Controller) *MockTokenPooler {
+	mock := &MockTokenPooler{ctrl: ctrl}
+	mock.recorder = &MockTokenPoolerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTokenPooler) EXPECT() *MockTokenPoolerMockRecorder {
+	return m.recorder
+}
+
+// AddTokens mocks base method.
+func (m *MockTokenPooler) AddTokens(ctx context.Context, tokens []string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddTokens", ctx, tokens)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddTokens indicates an expected call of AddTokens.
+func (mr *MockTokenPoolerMockRecorder) AddTokens(ctx, tokens any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddTokens", reflect.TypeOf((*MockTokenPooler)(nil).AddTokens), ctx, tokens)
+}
+
+// ClaimToken mocks base method.
+func (m *MockTokenPooler) ClaimToken(ctx context.Context) (string, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimToken", ctx)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ClaimToken indicates an expected call of ClaimToken.
+func (mr *MockTokenPoolerMockRecorder) ClaimToken(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimToken", reflect.TypeOf((*MockTokenPooler)(nil).ClaimToken), ctx)
+}
+
+// PoolSize mocks base method.
+func (m *MockTokenPooler) PoolSize(ctx context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PoolSize", ctx)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PoolSize indicates an expected call of PoolSize.
+func (mr *MockTokenPoolerMockRecorder) PoolSize(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PoolSize", reflect.TypeOf((*MockTokenPooler)(nil).PoolSize), ctx)
+}
+
+// MockCounter is a mock of Counter interface.
+type MockCounter struct {
+	ctrl     *gomock.Controller
+	recorder *MockCounterMockRecorder
+}
+
+// MockCounterMockRecorder is the mock recorder for MockCounter.
+type MockCounterMockRecorder struct {
+	mock *MockCounter
+}
+
+// NewMockCounter creates a new mock instance.
+func NewMockCounter(ctrl *gomock.Controller) *MockCounter {
+	mock := &MockCounter{ctrl: ctrl}
+	mock.recorder = &MockCounterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCounter) EXPECT() *MockCounterMockRecorder {
+	return m.recorder
+}
+
+// Count mocks base method.
+func (m *MockCounter) Count(ctx context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Count", ctx)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Count indicates an expected call of Count.
+func (mr *MockCounterMockRecorder) Count(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Count", reflect.TypeOf((*MockCounter)(nil).Count), ctx)
+}
+
+// MockEditor is a mock of Editor interface.
+type MockEditor struct {
+	ctrl     *gomock.Controller
+	recorder *MockEditorMockRecorder
+}
+
+// MockEditorMockRecorder is the mock recorder for MockEditor.
+type MockEditorMockRecorder struct {
+	mock *MockEditor
+}
+
+// NewMockEditor creates a new mock instance.
+func NewMockEditor(ctrl *gomock.Controller) *MockEditor {
+	mock := &MockEditor{ctrl: ctrl}
+	mock.recorder = &MockEditorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockEditor) EXPECT() *MockEditorMockRecorder {
+	return m.recorder
+}
+
+// DeleteShortURL mocks base method.
+func (m *MockEditor) DeleteShortURL(ctx context.Context, token string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteShortURL", ctx, token)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteShortURL indicates an expected call of DeleteShortURL.
+func (mr *MockEditorMockRecorder) DeleteShortURL(ctx, token any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteShortURL", reflect.TypeOf((*MockEditor)(nil).DeleteShortURL), ctx, token)
+}
+
+// UpdateShortURL mocks base method.
+func (m *MockEditor) UpdateShortURL(ctx context.Context, token, fullURL string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateShortURL", ctx, token, fullURL)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateShortURL indicates an expected call of UpdateShortURL.
+func (mr *MockEditorMockRecorder) UpdateShortURL(ctx, token, fullURL any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateShortURL", reflect.TypeOf((*MockEditor)(nil).UpdateShortURL), ctx, token, fullURL)
+}
+
+// MockClickCounter is a mock of ClickCounter interface.
+type MockClickCounter struct {
+	ctrl     *gomock.Controller
+	recorder *MockClickCounterMockRecorder
+}
+
+// MockClickCounterMockRecorder is the mock recorder for MockClickCounter.
+type MockClickCounterMockRecorder struct {
+	mock *MockClickCounter
+}
+
+// NewMockClickCounter creates a new mock instance.
+func NewMockClickCounter(ctrl *gomock.Controller) *MockClickCounter {
+	mock := &MockClickCounter{ctrl: ctrl}
+	mock.recorder = &MockClickCounterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockClickCounter) EXPECT() *MockClickCounterMockRecorder {
+	return m.recorder
+}
+
+// AddClick mocks base method.
+func (m *MockClickCounter) AddClick(ctx context.Context, token string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddClick", ctx, token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddClick indicates an expected call of AddClick.
+func (mr *MockClickCounterMockRecorder) AddClick(ctx, token any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddClick", reflect.TypeOf((*MockClickCounter)(nil).AddClick), ctx, token)
+}
+
+// Clicks mocks base method.
+func (m *MockClickCounter) Clicks(ctx context.Context, token string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Clicks", ctx, token)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Clicks indicates an expected call of Clicks.
+func (mr *MockClickCounterMockRecorder) Clicks(ctx, token any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Clicks", reflect.TypeOf((*MockClickCounter)(nil).Clicks), ctx, token)
+}
+
+// MockClickBatcher is a mock of ClickBatcher interface.
+type MockClickBatcher struct {
+	ctrl     *gomock.Controller
+	recorder *MockClickBatcherMockRecorder
+}
+
+// MockClickBatcherMockRecorder is the mock recorder for MockClickBatcher.
+type MockClickBatcherMockRecorder struct {
+	mock *MockClickBatcher
+}
+
+// NewMockClickBatcher creates a new mock instance.
+func NewMockClickBatcher(ctrl *gomock.Controller) *MockClickBatcher {
+	mock := &MockClickBatcher{ctrl: ctrl}
+	mock.recorder = &MockClickBatcherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockClickBatcher) EXPECT() *MockClickBatcherMockRecorder {
+	return m.recorder
+}
+
+// AddClicks mocks base method.
+func (m *MockClickBatcher) AddClicks(ctx context.Context, clicks map[string]int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddClicks", ctx, clicks)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddClicks indicates an expected call of AddClicks.
+func (mr *MockClickBatcherMockRecorder) AddClicks(ctx, clicks any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddClicks", reflect.TypeOf((*MockClickBatcher)(nil).AddClicks), ctx, clicks)
+}
+
+// MockTopLinker is a mock of TopLinker interface.
+type MockTopLinker struct {
+	ctrl     *gomock.Controller
+	recorder *MockTopLinkerMockRecorder
+}
+
+// MockTopLinkerMockRecorder is the mock recorder for MockTopLinker.
+type MockTopLinkerMockRecorder struct {
+	mock *MockTopLinker
+}
+
+// NewMockTopLinker creates a new mock instance.
+func NewMockTopLinker(ctrl *gomock.Controller) *MockTopLinker {
+	mock := &MockTopLinker{ctrl: ctrl}
+	mock.recorder = &MockTopLinkerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTopLinker) EXPECT() *MockTopLinkerMockRecorder {
+	return m.recorder
+}
+
+// TopLinks mocks base method.
+func (m *MockTopLinker) TopLinks(ctx context.Context, limit int) ([]storage.Link, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TopLinks", ctx, limit)
+	ret0, _ := ret[0].([]storage.Link)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TopLinks indicates an expected call of TopLinks.
+func (mr *MockTopLinkerMockRecorder) TopLinks(ctx, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TopLinks", reflect.TypeOf((*MockTopLinker)(nil).TopLinks), ctx, limit)
+}
+
+// MockEvictionReporter is a mock of EvictionReporter interface.
+type MockEvictionReporter struct {
+	ctrl     *gomock.Controller
+	recorder *MockEvictionReporterMockRecorder
+}
+
+// MockEvictionReporterMockRecorder is the mock recorder for MockEvictionReporter.
+type MockEvictionReporterMockRecorder struct {
+	mock *MockEvictionReporter
+}
+
+// NewMockEvictionReporter creates a new mock instance.
+func NewMockEvictionReporter(ctrl *gomock.Controller) *MockEvictionReporter {
+	mock := &MockEvictionReporter{ctrl: ctrl}
+	mock.recorder = &MockEvictionReporterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockEvictionReporter) EXPECT() *MockEvictionReporterMockRecorder {
+	return m.recorder
+}
+
+// Evicted mocks base method.
+func (m *MockEvictionReporter) Evicted(ctx context.Context, token string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Evicted", ctx, token)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Evicted indicates an expected call of Evicted.
+func (mr *MockEvictionReporterMockRecorder) Evicted(ctx, token any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Evicted", reflect.TypeOf((*MockEvictionReporter)(nil).Evicted), ctx, token)
+}
+
+// MockBackuper is a mock of Backuper interface.
+type MockBackuper struct {
+	ctrl     *gomock.Controller
+	recorder *MockBackuperMockRecorder
+}
+
+// MockBackuperMockRecorder is the mock recorder for MockBackuper.
+type MockBackuperMockRecorder struct {
+	mock *MockBackuper
+}
+
+// NewMockBackuper creates a new mock instance.
+func NewMockBackuper(ctrl *gomock.Controller) *MockBackuper {
+	mock := &MockBackuper{ctrl: ctrl}
+	mock.recorder = &MockBackuperMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBackuper) EXPECT() *MockBackuperMockRecorder {
+	return m.recorder
+}
+
+// Backup mocks base method.
+func (m *MockBackuper) Backup(ctx context.Context, w io.Writer) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Backup", ctx, w)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Backup indicates an expected call of Backup.
+func (mr *MockBackuperMockRecorder) Backup(ctx, w any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Backup", reflect.TypeOf((*MockBackuper)(nil).Backup), ctx, w)
+}
+
+// MockWrapper is a mock of Wrapper interface.
+type MockWrapper struct {
+	ctrl     *gomock.Controller
+	recorder *MockWrapperMockRecorder
+}
+
+// MockWrapperMockRecorder is the mock recorder for MockWrapper.
+type MockWrapperMockRecorder struct {
+	mock *MockWrapper
+}
+
+// NewMockWrapper creates a new mock instance.
+func NewMockWrapper(ctrl *gomock.Controller) *MockWrapper {
+	mock := &MockWrapper{ctrl: ctrl}
+	mock.recorder = &MockWrapperMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWrapper) EXPECT() *MockWrapperMockRecorder {
+	return m.recorder
+}
+
+// Unwrap mocks base method.
+func (m *MockWrapper) Unwrap() storage.Storager {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unwrap")
+	ret0, _ := ret[0].(storage.Storager)
+	return ret0
+}
+
+// Unwrap indicates an expected call of Unwrap.
+func (mr *MockWrapperMockRecorder) Unwrap() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unwrap", reflect.TypeOf((*MockWrapper)(nil).Unwrap))
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Types of the events recorded in the outbox.
+const (
+	OutboxLinkCreated = "link.created"
+	OutboxLinkUpdated = "link.updated"
+	OutboxLinkDeleted = "link.deleted"
+	OutboxLinkClicked = "link.clicked"
+)
+
+// OutboxEvent is a change of a link, recorded in the same transaction as
+// the change itself.
+type OutboxEvent struct {
+	// ID is unique, it is assigned when the event is recorded, so events
+	// can commit in another order.
+	ID    int64
+	Type  string
+	Token string
+	// Payload is JSON, see the storage for its fields.
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+// Outboxer is implemented by storages that record an event of every change
+// of a link along with the change, so that no event is lost when the
+// process stops between the change and publishing it.
+type Outboxer interface {
+	// RelayOutbox passes up to limit oldest events to publish and deletes
+	// them once it returns nil. The events are locked meanwhile, so that
+	// concurrent relays get different ones. An event is published again if
+	// the deletion fails.
+	RelayOutbox(ctx context.Context, limit int,
+		publish func(ctx context.Context, events []OutboxEvent) error) (relayed int, err error)
+}
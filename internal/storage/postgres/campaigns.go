@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+const campaignColumns = `tenant, name, utm_source, utm_medium, utm_campaign, utm_term, utm_content, updated_at`
+
+const (
+	templateSaveCampaign = `
+INSERT INTO campaigns(` + campaignColumns + `)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (tenant, name) DO UPDATE SET utm_source = EXCLUDED.utm_source, utm_medium = EXCLUDED.utm_medium,
+	utm_campaign = EXCLUDED.utm_campaign, utm_term = EXCLUDED.utm_term, utm_content = EXCLUDED.utm_content,
+	updated_at = EXCLUDED.updated_at`
+	templateCampaign       = `SELECT ` + campaignColumns + ` FROM campaigns WHERE tenant = $1 AND name = $2`
+	templateCampaigns      = `SELECT ` + campaignColumns + ` FROM campaigns WHERE tenant = $1 ORDER BY name`
+	templateDeleteCampaign = `DELETE FROM campaigns WHERE tenant = $1 AND name = $2`
+	// templateCampaignClicks is served by the urls_utm_campaign index.
+	templateCampaignClicks = `
+SELECT attributes->'utm'->>'campaign' AS campaign, COUNT(*), SUM(clicks) FROM urls
+WHERE attributes->'utm'->>'campaign' IS NOT NULL AND ($1 = '' OR attributes->>'tenant' = $1)
+GROUP BY campaign ORDER BY SUM(clicks) DESC, campaign`
+)
+
+func (st *Storage) SaveCampaign(ctx context.Context, campaign *storage.Campaign) (err error) {
+	utm := &campaign.UTM
+	_, err = st.saveCampaign.ExecContext(ctx, campaign.Tenant, campaign.Name, utm.Source, utm.Medium, utm.Campaign,
+		utm.Term, utm.Content, campaign.UpdatedAt)
+	return err
+}
+
+func (st *Storage) Campaign(ctx context.Context,
+	tenant string, name string,
+) (campaign storage.Campaign, found bool, err error) {
+	campaign, err = scanCampaign(st.campaign.QueryRowContext(ctx, tenant, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Campaign{}, false, nil
+	}
+	if err != nil {
+		return storage.Campaign{}, false, err
+	}
+	return campaign, true, nil
+}
+
+func (st *Storage) Campaigns(ctx context.Context, tenant string) (campaigns []storage.Campaign, err error) {
+	rows, err := st.campaigns.QueryContext(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var campaign storage.Campaign
+		campaign, err = scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	return campaigns, rows.Err()
+}
+
+func (st *Storage) DeleteCampaign(ctx context.Context, tenant string, name string) (found bool, err error) {
+	return affectedAny(st.deleteCampaign.ExecContext(ctx, tenant, name))
+}
+
+// CampaignClicks reads from a replica when there are healthy ones, as
+// TopLinks does.
+func (st *Storage) CampaignClicks(ctx context.Context, tenant string) (stats []storage.CampaignClicks, err error) {
+	err = st.replicas.read(ctx, func(stmts *replicaStatements) error {
+		var replicaErr error
+		stats, replicaErr = scanCampaignClicks(stmts.campaignClicks.QueryContext(ctx, tenant))
+		return replicaErr
+	})
+	if err == nil {
+		return stats, nil
+	}
+	return scanCampaignClicks(st.campaignClicks.QueryContext(ctx, tenant))
+}
+
+// rowScanner is *sql.Row or *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCampaign(row rowScanner) (campaign storage.Campaign, err error) {
+	utm := &campaign.UTM
+	err = row.Scan(&campaign.Tenant, &campaign.Name, &utm.Source, &utm.Medium, &utm.Campaign, &utm.Term,
+		&utm.Content, &campaign.UpdatedAt)
+	return campaign, err
+}
+
+func scanCampaignClicks(rows *sql.Rows, err error) ([]storage.CampaignClicks, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var stats []storage.CampaignClicks
+	for rows.Next() {
+		var campaign storage.CampaignClicks
+		err = rows.Scan(&campaign.Campaign, &campaign.Links, &campaign.Clicks)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, campaign)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+func TestCampaigns(t *testing.T) {
+	ctx := context.Background()
+	st, mock := newMockStorage(t)
+	now := time.Unix(1700000000, 0)
+	campaign := storage.Campaign{Tenant: "acme", Name: "spring", UpdatedAt: now,
+		UTM: storage.UTM{Source: "newsletter", Medium: "email", Campaign: "spring_sale"}}
+
+	mock.ExpectExec("ON CONFLICT").
+		WithArgs("acme", "spring", "newsletter", "email", "spring_sale", "", "", now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, st.SaveCampaign(ctx, &campaign))
+
+	mock.ExpectQuery("FROM campaigns").WithArgs("acme", "spring").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"tenant", "name", "utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content", "updated_at",
+		}).AddRow("acme", "spring", "newsletter", "email", "spring_sale", "", "", now))
+	saved, found, err := st.Campaign(ctx, "acme", "spring")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, campaign, saved)
+
+	mock.ExpectQuery("FROM campaigns").WithArgs("other", "spring").
+		WillReturnRows(sqlmock.NewRows([]string{"tenant"}))
+	_, found, err = st.Campaign(ctx, "other", "spring")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	mock.ExpectExec("DELETE FROM campaigns").WithArgs("acme", "spring").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	found, err = st.DeleteCampaign(ctx, "acme", "spring")
+	require.NoError(t, err)
+	assert.True(t, found)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCampaignClicks(t *testing.T) {
+	st, mock := newMockStorage(t)
+	mock.ExpectQuery("GROUP BY campaign").WithArgs("acme").
+		WillReturnRows(sqlmock.NewRows([]string{"campaign", "count", "sum"}).
+			AddRow("spring_sale", 3, []byte("42")).
+			AddRow("launch", 1, []byte("0")))
+
+	stats, err := st.CampaignClicks(context.Background(), "acme")
+	require.NoError(t, err)
+	assert.Equal(t, []storage.CampaignClicks{
+		{Campaign: "spring_sale", Links: 3, Clicks: 42},
+		{Campaign: "launch", Links: 1, Clicks: 0},
+	}, stats)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,82 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// ChangesChannel is notified with the token of every updated or deleted
+// link.
+const ChangesChannel = "url_changes"
+
+const (
+	minReconnectInterval = time.Second
+	maxReconnectInterval = time.Minute
+	// listenerPing checks the connection when no notifications come, a
+	// dead one would not be noticed otherwise.
+	listenerPing = 90 * time.Second
+)
+
+// listenerConn is the part of pq.Listener used by Listener.
+type listenerConn interface {
+	Listen(channel string) error
+	NotificationChannel() <-chan *pq.Notification
+	Ping() error
+	Close() error
+}
+
+// Listener receives tokens changed by any replica through LISTEN.
+type Listener struct {
+	conn   listenerConn
+	logger *zap.Logger
+}
+
+func NewListener(cfg Config, logger *zap.Logger) *Listener {
+	conn := pq.NewListener(cfg.URL, minReconnectInterval, maxReconnectInterval,
+		func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				logger.Error("error in postgres listener", zap.Error(err))
+			}
+		})
+	return &Listener{conn: conn, logger: logger}
+}
+
+// Listen calls invalidate with every changed token until ctx is done. After
+// the connection is lost notifications could be missed, so flush is called
+// once it is re-established.
+func (listener *Listener) Listen(ctx context.Context, invalidate func(token string),
+	flush func(),
+) error {
+	defer func() {
+		_ = listener.conn.Close()
+	}()
+	err := listener.conn.Listen(ChangesChannel)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(listenerPing)
+	defer ticker.Stop()
+	notifications := listener.conn.NotificationChannel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification := <-notifications:
+			if notification == nil {
+				listener.logger.Warn("postgres listener reconnected, flush cache")
+				flush()
+				continue
+			}
+			invalidate(notification.Extra)
+		case <-ticker.C:
+			err = listener.conn.Ping()
+			if err != nil {
+				listener.logger.Warn("postgres listener ping failed", zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeListenerConn struct {
+	notifications chan *pq.Notification
+	listenErr     error
+	channel       string
+	closed        bool
+}
+
+func (conn *fakeListenerConn) Listen(channel string) error {
+	conn.channel = channel
+	return conn.listenErr
+}
+
+func (conn *fakeListenerConn) NotificationChannel() <-chan *pq.Notification {
+	return conn.notifications
+}
+
+func (conn *fakeListenerConn) Ping() error {
+	return nil
+}
+
+func (conn *fakeListenerConn) Close() error {
+	conn.closed = true
+	return nil
+}
+
+func TestListener(t *testing.T) {
+	conn := &fakeListenerConn{notifications: make(chan *pq.Notification)}
+	listener := &Listener{conn: conn, logger: zap.NewNop()}
+
+	invalidated := make(chan string, 1)
+	flushed := make(chan struct{}, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- listener.Listen(ctx,
+			func(token string) { invalidated <- token },
+			func() { flushed <- struct{}{} })
+	}()
+
+	conn.notifications <- &pq.Notification{Channel: ChangesChannel, Extra: "1234567890"}
+	select {
+	case token := <-invalidated:
+		assert.Equal(t, "1234567890", token)
+	case <-time.After(time.Second):
+		t.Fatal("token is not invalidated")
+	}
+
+	// pq sends nil after the connection is re-established.
+	conn.notifications <- nil
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+		t.Fatal("cache is not flushed after reconnect")
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+	assert.Equal(t, ChangesChannel, conn.channel)
+	assert.True(t, conn.closed)
+}
+
+func TestListener_ListenError(t *testing.T) {
+	conn := &fakeListenerConn{listenErr: errors.New("connection refused")}
+	listener := &Listener{conn: conn, logger: zap.NewNop()}
+
+	err := listener.Listen(context.Background(), func(string) {}, func() {})
+	require.Error(t, err)
+	assert.True(t, conn.closed)
+}
@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"strconv"
+
+	"github.com/ilyakharev/url-short/internal/storage/migrate"
+)
+
+// migrationLockKey identifies the advisory lock taken while migrating.
+const migrationLockKey = 5_273_120_931
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrator returns a migrator of the postgres schema.
+func Migrator(db *sql.DB) (*migrate.Migrator, error) {
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	loaded, err := migrate.Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, loaded, migrate.Dialect{
+		Lock:        advisoryLock,
+		Placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+	}), nil
+}
+
+func migrateSchema(ctx context.Context, db *sql.DB, checkOnly bool) error {
+	migrator, err := Migrator(db)
+	if err != nil {
+		return err
+	}
+	if checkOnly {
+		return migrator.Check(ctx)
+	}
+	_, err = migrator.Up(ctx)
+	return err
+}
+
+func advisoryLock(ctx context.Context, conn *sql.Conn) (unlock func(ctx context.Context) error, err error) {
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+		return err
+	}, nil
+}
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS urls (
+	short_url	VARCHAR(32) PRIMARY KEY,
+	full_url    VARCHAR(1024)
+);
+
+-- Tables created before tokens could grow had 10 characters wide tokens.
+ALTER TABLE urls ALTER COLUMN short_url TYPE VARCHAR(32);
+
+CREATE INDEX IF NOT EXISTS idx ON urls USING hash(
+	full_url
+);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS token_pool (
+	token	VARCHAR(32) PRIMARY KEY
+);
+
+ALTER TABLE token_pool ALTER COLUMN token TYPE VARCHAR(32);
@@ -0,0 +1,3 @@
+-- Not indexed, the most clicked links are only read on start, while an index
+-- would slow down every redirect.
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS clicks BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- See storage.MarshalAttributes. NULL for links without attributes.
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS attributes JSONB;
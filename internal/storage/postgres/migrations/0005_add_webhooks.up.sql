@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+	id			VARCHAR(32) PRIMARY KEY,
+	tenant			VARCHAR(64) NOT NULL,
+	url			TEXT NOT NULL,
+	secret			TEXT NOT NULL,
+	-- Comma separated event names.
+	events			TEXT NOT NULL,
+	click_sample_rate	DOUBLE PRECISION NOT NULL DEFAULT 0,
+	created_at		TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webhooks_tenant ON webhooks (tenant);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id		VARCHAR(32) PRIMARY KEY,
+	webhook_id	VARCHAR(32) NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+	tenant		VARCHAR(64) NOT NULL,
+	event		VARCHAR(32) NOT NULL,
+	payload		BYTEA NOT NULL,
+	attempts	INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at	TIMESTAMPTZ NOT NULL,
+	last_error	TEXT NOT NULL DEFAULT '',
+	dead		BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at	TIMESTAMPTZ NOT NULL
+);
+-- The queue is polled by the due deliveries, the dead ones are listed by
+-- tenant.
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due
+	ON webhook_deliveries (next_attempt_at) WHERE NOT dead;
+CREATE INDEX IF NOT EXISTS webhook_deliveries_dead
+	ON webhook_deliveries (tenant, created_at) WHERE dead;
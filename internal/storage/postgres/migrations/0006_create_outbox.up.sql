@@ -0,0 +1,9 @@
+-- Events of link changes, written in the transaction of the change and
+-- deleted once published, see storage.Outboxer.
+CREATE TABLE IF NOT EXISTS outbox (
+	id		BIGSERIAL PRIMARY KEY,
+	event		VARCHAR(32) NOT NULL,
+	token		VARCHAR(32) NOT NULL,
+	payload		JSONB NOT NULL,
+	created_at	TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS urls_utm_campaign;
+DROP TABLE IF EXISTS campaigns;
@@ -0,0 +1,16 @@
+-- Templates of UTM parameters, see storage.Campaign.
+CREATE TABLE IF NOT EXISTS campaigns (
+	tenant		VARCHAR(64) NOT NULL,
+	name		VARCHAR(64) NOT NULL,
+	utm_source	TEXT NOT NULL DEFAULT '',
+	utm_medium	TEXT NOT NULL DEFAULT '',
+	utm_campaign	TEXT NOT NULL DEFAULT '',
+	utm_term	TEXT NOT NULL DEFAULT '',
+	utm_content	TEXT NOT NULL DEFAULT '',
+	updated_at	TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (tenant, name)
+);
+
+-- Clicks are grouped by the campaign the links are tagged with.
+CREATE INDEX IF NOT EXISTS urls_utm_campaign ON urls ((attributes->'utm'->>'campaign'))
+	WHERE attributes->'utm'->>'campaign' IS NOT NULL;
@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilyakharev/url-short/internal/storage/migrate"
+)
+
+func TestMigrations(t *testing.T) {
+	t.Run("every migration can be rolled back", func(t *testing.T) {
+		fsys, err := fs.Sub(migrations, "migrations")
+		require.NoError(t, err)
+		loaded, err := migrate.Load(fsys)
+		require.NoError(t, err)
+		require.NotEmpty(t, loaded)
+		for _, migration := range loaded {
+			assert.NotEmpty(t, migration.Down, migration.Name)
+		}
+	})
+	t.Run("check takes advisory lock", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		mock.ExpectExec("SELECT pg_advisory_lock").
+			WithArgs(migrationLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}))
+		mock.ExpectExec("SELECT pg_advisory_unlock").
+			WithArgs(migrationLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err = migrateSchema(context.Background(), db, true)
+		require.ErrorIs(t, err, migrate.ErrPendingMigrations)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
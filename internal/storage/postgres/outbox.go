@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/lib/pq"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+const (
+	templateInsertOutbox = `INSERT INTO outbox(event, token, payload) VALUES ($1, $2, $3)`
+	// templateLockOutbox skips the events locked by a relay in progress, so
+	// that replicas of the service publish different events.
+	templateLockOutbox = `
+SELECT id, event, token, payload, created_at FROM outbox
+ORDER BY id
+LIMIT $1
+FOR UPDATE SKIP LOCKED`
+	templateDeleteOutbox = `DELETE FROM outbox WHERE id = ANY($1)`
+)
+
+var _ storage.Outboxer = &Storage{}
+
+// outboxPayload is the payload of the events, the URL and the attributes
+// are set for the events that change them.
+type outboxPayload struct {
+	URL        string          `json:"url,omitempty"`
+	Attributes json.RawMessage `json:"attributes,omitempty"`
+}
+
+func encodePayload(fullURL string, encodedAttrs []byte) []byte {
+	payload, _ := json.Marshal(outboxPayload{URL: fullURL, Attributes: encodedAttrs})
+	return payload
+}
+
+// execRecorded runs stmt and records the event in one transaction when the
+// outbox is enabled. No event is recorded when stmt affects no rows.
+func (st *Storage) execRecorded(ctx context.Context, event string, token string, payload []byte,
+	stmt *sql.Stmt, args ...any,
+) error {
+	if !st.outbox {
+		_, err := stmt.ExecContext(ctx, args...)
+		return err
+	}
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	affected, err := affectedAny(tx.StmtContext(ctx, stmt).ExecContext(ctx, args...))
+	if err != nil || !affected {
+		return err
+	}
+	_, err = tx.StmtContext(ctx, st.insertOutbox).ExecContext(ctx, event, token, string(payload))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RelayOutbox publishes the oldest events first. Events of transactions
+// committed out of order may be published out of order too.
+func (st *Storage) RelayOutbox(ctx context.Context, limit int,
+	publish func(ctx context.Context, events []storage.OutboxEvent) error,
+) (relayed int, err error) {
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	events, err := scanOutbox(tx.StmtContext(ctx, st.lockOutbox).QueryContext(ctx, limit))
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+	err = publish(ctx, events)
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]int64, len(events))
+	for i := range events {
+		ids[i] = events[i].ID
+	}
+	_, err = tx.StmtContext(ctx, st.deleteOutbox).ExecContext(ctx, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
+
+func scanOutbox(rows *sql.Rows, err error) ([]storage.OutboxEvent, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var events []storage.OutboxEvent
+	for rows.Next() {
+		var event storage.OutboxEvent
+		err = rows.Scan(&event.ID, &event.Type, &event.Token, &event.Payload, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,194 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+func TestOutboxWrites(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("create", func(t *testing.T) {
+		st, mock := newMockStorage(t)
+		st.outbox = true
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO urls").WithArgs("a", "http://a.ru", `{"tags":["x"]}`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO outbox").
+			WithArgs(storage.OutboxLinkCreated, "a", `{"url":"http://a.ru","attributes":{"tags":["x"]}}`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := st.CreateWithAttributes(ctx, "http://a.ru", "a", storage.Attributes{Tags: []string{"x"}})
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("taken token", func(t *testing.T) {
+		st, mock := newMockStorage(t)
+		st.outbox = true
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO urls").WithArgs("a", "http://a.ru").
+			WillReturnError(&pq.Error{Code: uniqueViolation})
+		mock.ExpectRollback()
+
+		err := st.CreateShortURL(ctx, "http://a.ru", "a")
+		require.ErrorIs(t, err, storage.ErrTokenExists)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("click", func(t *testing.T) {
+		st, mock := newMockStorage(t)
+		st.outbox = true
+		mock.ExpectExec("UPDATE urls SET clicks").WithArgs("a").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		require.NoError(t, st.AddClick(ctx, "a"))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("recorded click", func(t *testing.T) {
+		st, mock := newMockStorage(t)
+		st.outbox, st.outboxClicks = true, true
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE urls SET clicks").WithArgs("a").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO outbox").WithArgs(storage.OutboxLinkClicked, "a", `{}`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, st.AddClick(ctx, "a"))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("click batch", func(t *testing.T) {
+		st, mock := newMockStorage(t)
+		st.outbox = true
+		mock.ExpectExec("UPDATE urls SET clicks").WithArgs(pq.Array([]string{"a", "b"}), pq.Array([]int64{2, 1})).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		require.NoError(t, st.AddClicks(ctx, map[string]int64{"a": 2, "b": 1}))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("recorded click batch", func(t *testing.T) {
+		st, mock := newMockStorage(t)
+		st.outbox, st.outboxClicks = true, true
+		mock.ExpectBegin()
+		mock.ExpectQuery("UPDATE urls SET clicks").WithArgs(pq.Array([]string{"a", "b"}), pq.Array([]int64{2, 1})).
+			WillReturnRows(sqlmock.NewRows([]string{"short_url", "clicks"}).AddRow("a", int64(2)))
+		for i := 0; i < 2; i++ {
+			mock.ExpectExec("INSERT INTO outbox").WithArgs(storage.OutboxLinkClicked, "a", `{}`).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+		}
+		mock.ExpectCommit()
+
+		require.NoError(t, st.AddClicks(ctx, map[string]int64{"a": 2, "b": 1}))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("click of missing link", func(t *testing.T) {
+		st, mock := newMockStorage(t)
+		st.outbox, st.outboxClicks = true, true
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE urls SET clicks").WithArgs("a").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		require.NoError(t, st.AddClick(ctx, "a"))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("delete", func(t *testing.T) {
+		st, mock := newMockStorage(t)
+		st.outbox = true
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM urls").WithArgs("a").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("pg_notify").WithArgs(ChangesChannel, "a").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO outbox").WithArgs(storage.OutboxLinkDeleted, "a", `{}`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		found, err := st.DeleteShortURL(ctx, "a")
+		require.NoError(t, err)
+		assert.True(t, found)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("batch", func(t *testing.T) {
+		st, mock := newMockStorage(t)
+		st.outbox = true
+		mock.ExpectBegin()
+		mock.ExpectExec("ON CONFLICT").WithArgs("a", "http://a.ru", nil).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("ON CONFLICT").WithArgs("b", "http://b.ru", nil).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO outbox").WithArgs(storage.OutboxLinkCreated, "b", `{"url":"http://b.ru"}`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		errs, err := st.CreateBatch(ctx, []storage.NewLink{
+			{Token: "a", FullURL: "http://a.ru"},
+			{Token: "b", FullURL: "http://b.ru"},
+		})
+		require.NoError(t, err)
+		assert.ErrorIs(t, errs[0], storage.ErrTokenExists)
+		assert.NoError(t, errs[1])
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRelayOutbox(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "event", "token", "payload", "created_at"}).
+			AddRow(int64(3), storage.OutboxLinkCreated, "a", []byte(`{"url":"http://a.ru"}`), now).
+			AddRow(int64(4), storage.OutboxLinkClicked, "a", []byte(`{}`), now)
+	}
+
+	t.Run("published", func(t *testing.T) {
+		st, mock := newMockStorage(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("FOR UPDATE SKIP LOCKED").WithArgs(10).WillReturnRows(rows())
+		mock.ExpectExec("DELETE FROM outbox").WithArgs(pq.Array([]int64{3, 4})).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		var published []storage.OutboxEvent
+		relayed, err := st.RelayOutbox(ctx, 10, func(_ context.Context, events []storage.OutboxEvent) error {
+			published = events
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, relayed)
+		require.Len(t, published, 2)
+		assert.Equal(t, storage.OutboxLinkClicked, published[1].Type)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("publish failed", func(t *testing.T) {
+		st, mock := newMockStorage(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("FOR UPDATE SKIP LOCKED").WithArgs(10).WillReturnRows(rows())
+		mock.ExpectRollback()
+
+		failed := errors.New("broker is down")
+		relayed, err := st.RelayOutbox(ctx, 10, func(context.Context, []storage.OutboxEvent) error {
+			return failed
+		})
+		require.ErrorIs(t, err, failed)
+		assert.Zero(t, relayed)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("empty", func(t *testing.T) {
+		st, mock := newMockStorage(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("FOR UPDATE SKIP LOCKED").WithArgs(10).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "event", "token", "payload", "created_at"}))
+		mock.ExpectRollback()
+
+		relayed, err := st.RelayOutbox(ctx, 10, func(context.Context, []storage.OutboxEvent) error {
+			t.Fatal("nothing to publish")
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Zero(t, relayed)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -3,112 +3,740 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
 
-	_ "github.com/lib/pq" // for database/sql
+	"github.com/lib/pq"
 
 	"github.com/ilyakharev/url-short/internal/storage"
 )
 
+// Storage writes to the primary database. Redirects and listings are read
+// from replicas when they are configured, see Config.ReplicaURLs.
 type Storage struct {
-	db *sql.DB
+	db       *sql.DB
+	replicas *replicaSet
+	// checkInterval is how often replicas are checked by Run.
+	checkInterval time.Duration
+	// outbox records an event of every change, see Config.Outbox.
+	outbox bool
+	// outboxClicks records clicks too, see Config.OutboxClicks.
+	outboxClicks bool
+
+	getFullURL  *sql.Stmt
+	getLink     *sql.Stmt
+	insertShort *sql.Stmt
+	insertLink  *sql.Stmt
+	insertBatch *sql.Stmt
+	checkExists *sql.Stmt
+	updateShort *sql.Stmt
+	deleteShort *sql.Stmt
+	notify      *sql.Stmt
+	addTokens   *sql.Stmt
+	claimToken  *sql.Stmt
+	poolSize    *sql.Stmt
+	count       *sql.Stmt
+	addClick    *sql.Stmt
+	addClicks   *sql.Stmt
+	clicks      *sql.Stmt
+	topLinks    *sql.Stmt
+
+	insertWebhook  *sql.Stmt
+	webhooks       *sql.Stmt
+	deleteWebhook  *sql.Stmt
+	insertDelivery *sql.Stmt
+	claimDelivery  *sql.Stmt
+	updateDelivery *sql.Stmt
+	deleteDelivery *sql.Stmt
+	deadDeliveries *sql.Stmt
+	replayDelivery *sql.Stmt
+
+	insertOutbox *sql.Stmt
+	lockOutbox   *sql.Stmt
+	deleteOutbox *sql.Stmt
+
+	saveCampaign   *sql.Stmt
+	campaign       *sql.Stmt
+	campaigns      *sql.Stmt
+	deleteCampaign *sql.Stmt
+	campaignClicks *sql.Stmt
 }
 
+type Config struct {
+	URL             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// ConnectAttempts is how many times the database is pinged on start,
+	// waiting ConnectBackoff after the first failure and twice as long
+	// after each next one.
+	ConnectAttempts int
+	ConnectBackoff  time.Duration
+	// SkipMigrations disables applying migrations on start. The storage
+	// then refuses to start until they are applied with "migrate up".
+	SkipMigrations bool
+	// ReplicaURLs are streaming replicas of URL. Links are read from them
+	// round-robin. For MaxReplicaLag after a link is created by this
+	// storage, a link not found on a replica is looked up on the primary
+	// too, so that a link is redirected to right after it is created.
+	ReplicaURLs []string
+	// MaxReplicaLag takes a replica lagging further behind out of rotation.
+	MaxReplicaLag time.Duration
+	// ReplicaCheckInterval is how often the lag of replicas is checked.
+	ReplicaCheckInterval time.Duration
+	// Outbox records an event of every created, updated and deleted link
+	// in the transaction of the change, to be published with RelayOutbox.
+	Outbox bool
+	// OutboxClicks records clicks as well when Outbox is set. A click then
+	// costs a transaction and an outbox row, so it is only for consumers
+	// needing every click.
+	OutboxClicks bool
+}
+
+const maxConnectBackoff = 30 * time.Second
+
+// uniqueViolation is the SQLSTATE of a duplicate primary key.
+const uniqueViolation = "23505"
+
 const (
-	templateTable = `
-CREATE TABLE IF NOT EXISTS urls (
-	short_url	VARCHAR(10) PRIMARY KEY,
-	full_url    VARCHAR(1024)
-);
-
-CREATE INDEX IF NOT EXISTS idx ON urls USING hash(
-	full_url
-);
-`
 	templateGetFullURL  = `SELECT full_url FROM urls WHERE short_url = $1`
+	templateGetLink     = `SELECT full_url, attributes FROM urls WHERE short_url = $1`
 	templateInsertShort = `INSERT INTO urls(short_url, full_url) VALUES ($1, $2)`
+	templateInsertLink  = `INSERT INTO urls(short_url, full_url, attributes) VALUES ($1, $2, $3)`
+	// templateInsertBatch skips taken tokens instead of failing, which would
+	// abort the whole transaction.
+	templateInsertBatch = templateInsertLink + ` ON CONFLICT (short_url) DO NOTHING`
 	templateCheckExists = `SELECT short_url FROM urls WHERE full_url = $1`
+	templateUpdateShort = `UPDATE urls SET full_url = $2 WHERE short_url = $1`
+	templateDeleteShort = `DELETE FROM urls WHERE short_url = $1`
+	templateNotify      = `SELECT pg_notify($1, $2)`
+	templateAddTokens   = `
+INSERT INTO token_pool(token)
+SELECT t FROM unnest($1::varchar[]) AS t
+WHERE NOT EXISTS (SELECT 1 FROM urls WHERE short_url = t)
+ON CONFLICT DO NOTHING`
+	templateClaimToken = `
+DELETE FROM token_pool WHERE token = (
+	SELECT p.token FROM token_pool p
+	WHERE NOT EXISTS (SELECT 1 FROM urls WHERE short_url = p.token)
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+) RETURNING token`
+	templatePoolSize  = `SELECT count(*) FROM token_pool`
+	templateCount     = `SELECT count(*) FROM urls`
+	templateAddClick  = `UPDATE urls SET clicks = clicks + 1 WHERE short_url = $1`
+	templateAddClicks = `UPDATE urls SET clicks = urls.clicks + c.clicks
+FROM unnest($1::text[], $2::bigint[]) AS c(token, clicks)
+WHERE urls.short_url = c.token
+RETURNING urls.short_url, c.clicks`
+	templateClicks   = `SELECT clicks FROM urls WHERE short_url = $1`
+	templateTopLinks = `SELECT short_url, full_url, clicks, attributes FROM urls ORDER BY clicks DESC LIMIT $1`
+)
+
+var (
+	_ storage.Storager    = &Storage{}
+	_ storage.TokenPooler = &Storage{}
+	_ storage.Counter     = &Storage{}
+	_ storage.Editor      = &Storage{}
+
+	_ storage.ClickCounter    = &Storage{}
+	_ storage.ClickBatcher    = &Storage{}
+	_ storage.TopLinker       = &Storage{}
+	_ storage.AttributeStorer = &Storage{}
+	_ storage.BatchCreator    = &Storage{}
+	_ storage.WebhookStorer   = &Storage{}
+	_ storage.CampaignStorer  = &Storage{}
+	_ storage.CampaignCounter = &Storage{}
 )
 
-var _ storage.Storager = &Storage{}
+func New(ctx context.Context, cfg Config) (*Storage, error) {
+	db, err := Open(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
 
-func New(url string) (*Storage, error) {
-	var err error
-	db, err := sql.Open("postgres", url)
+	err = migrateSchema(ctx, db, cfg.SkipMigrations)
 	if err != nil {
+		_ = db.Close()
 		return nil, err
 	}
 
-	_, err = db.Exec(templateTable)
+	st, err := newStorage(ctx, db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	st.replicas, err = openReplicas(ctx, cfg)
 	if err != nil {
+		_ = st.Close()
 		return nil, err
 	}
+	st.checkInterval = cfg.ReplicaCheckInterval
+	st.outbox = cfg.Outbox
+	st.outboxClicks = cfg.OutboxClicks
+	if st.checkInterval <= 0 {
+		st.checkInterval = defaultReplicaCheckInterval
+	}
+	return st, nil
+}
 
-	return &Storage{
-		db: db,
-	}, nil
+// openReplicas does not connect to replicas, a replica that is down on
+// start is put into rotation once it is up.
+func openReplicas(ctx context.Context, cfg Config) (*replicaSet, error) {
+	dbs := make([]*sql.DB, 0, len(cfg.ReplicaURLs))
+	for _, url := range cfg.ReplicaURLs {
+		db, err := sql.Open("postgres", url)
+		if err != nil {
+			for _, opened := range dbs {
+				_ = opened.Close()
+			}
+			return nil, err
+		}
+		configurePool(db, cfg)
+		dbs = append(dbs, db)
+	}
+	replicas := newReplicaSet(dbs, cfg.MaxReplicaLag)
+	replicas.check(ctx)
+	return replicas, nil
 }
 
-func (st *Storage) GetFullURL(_ context.Context,
-	token string,
-) (fullURL string, found bool, err error) {
-	rows, err := st.db.Query(templateGetFullURL, token)
+// Open connects to the database, retrying as configured.
+func Open(ctx context.Context, cfg Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.URL)
 	if err != nil {
-		return "", false, err
+		return nil, err
 	}
-	if rows.Err() != nil {
-		return "", false, err
+	configurePool(db, cfg)
+
+	err = ping(ctx, db, cfg.ConnectAttempts, cfg.ConnectBackoff)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
 	}
-	defer func() {
-		err = rows.Close()
+	return db, nil
+}
+
+func configurePool(db *sql.DB, cfg Config) {
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+}
+
+func newStorage(ctx context.Context, db *sql.DB) (st *Storage, err error) {
+	st = &Storage{db: db, replicas: newReplicaSet(nil, 0)}
+	for _, statement := range st.statements() {
+		*statement.stmt, err = db.PrepareContext(ctx, statement.query)
 		if err != nil {
-			return
+			st.closeStatements()
+			return nil, err
 		}
-	}()
-	if !rows.Next() {
+	}
+	return st, nil
+}
+
+func ping(ctx context.Context, db *sql.DB, attempts int, backoff time.Duration) error {
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("unable to connect to postgres after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxConnectBackoff)
+	}
+}
+
+type statement struct {
+	stmt  **sql.Stmt
+	query string
+}
+
+func (st *Storage) statements() []statement {
+	return []statement{
+		{stmt: &st.getFullURL, query: templateGetFullURL},
+		{stmt: &st.getLink, query: templateGetLink},
+		{stmt: &st.insertShort, query: templateInsertShort},
+		{stmt: &st.insertLink, query: templateInsertLink},
+		{stmt: &st.insertBatch, query: templateInsertBatch},
+		{stmt: &st.checkExists, query: templateCheckExists},
+		{stmt: &st.updateShort, query: templateUpdateShort},
+		{stmt: &st.deleteShort, query: templateDeleteShort},
+		{stmt: &st.notify, query: templateNotify},
+		{stmt: &st.addTokens, query: templateAddTokens},
+		{stmt: &st.claimToken, query: templateClaimToken},
+		{stmt: &st.poolSize, query: templatePoolSize},
+		{stmt: &st.count, query: templateCount},
+		{stmt: &st.addClick, query: templateAddClick},
+		{stmt: &st.addClicks, query: templateAddClicks},
+		{stmt: &st.clicks, query: templateClicks},
+		{stmt: &st.topLinks, query: templateTopLinks},
+
+		{stmt: &st.insertWebhook, query: templateInsertWebhook},
+		{stmt: &st.webhooks, query: templateWebhooks},
+		{stmt: &st.deleteWebhook, query: templateDeleteWebhook},
+		{stmt: &st.insertDelivery, query: templateInsertDelivery},
+		{stmt: &st.claimDelivery, query: templateClaimDeliveries},
+		{stmt: &st.updateDelivery, query: templateUpdateDelivery},
+		{stmt: &st.deleteDelivery, query: templateDeleteDelivery},
+		{stmt: &st.deadDeliveries, query: templateDeadDeliveries},
+		{stmt: &st.replayDelivery, query: templateReplayDelivery},
+
+		{stmt: &st.insertOutbox, query: templateInsertOutbox},
+		{stmt: &st.lockOutbox, query: templateLockOutbox},
+		{stmt: &st.deleteOutbox, query: templateDeleteOutbox},
+
+		{stmt: &st.saveCampaign, query: templateSaveCampaign},
+		{stmt: &st.campaign, query: templateCampaign},
+		{stmt: &st.campaigns, query: templateCampaigns},
+		{stmt: &st.deleteCampaign, query: templateDeleteCampaign},
+		{stmt: &st.campaignClicks, query: templateCampaignClicks},
+	}
+}
+
+func (st *Storage) GetFullURL(ctx context.Context,
+	token string,
+) (fullURL string, found bool, err error) {
+	err = st.replicas.read(ctx, func(stmts *replicaStatements) error {
+		var replicaErr error
+		fullURL, found, replicaErr = scanFullURL(stmts.getFullURL.QueryRowContext(ctx, token))
+		if replicaErr == nil && !found && st.replicas.replicating() {
+			return errNotReplicated
+		}
+		return replicaErr
+	})
+	if err == nil {
+		return fullURL, found, nil
+	}
+	return scanFullURL(st.getFullURL.QueryRowContext(ctx, token))
+}
+
+func scanFullURL(row *sql.Row) (fullURL string, found bool, err error) {
+	err = row.Scan(&fullURL)
+	if errors.Is(err, sql.ErrNoRows) {
 		return "", false, nil
 	}
-	err = rows.Scan(&fullURL)
 	if err != nil {
 		return "", false, err
 	}
 	return fullURL, true, nil
 }
 
-func (st *Storage) CreateShortURL(_ context.Context, fullURL string,
+func (st *Storage) GetWithAttributes(ctx context.Context,
+	token string,
+) (fullURL string, attrs storage.Attributes, found bool, err error) {
+	err = st.replicas.read(ctx, func(stmts *replicaStatements) error {
+		var replicaErr error
+		fullURL, attrs, found, replicaErr = scanLink(stmts.getLink.QueryRowContext(ctx, token))
+		if replicaErr == nil && !found && st.replicas.replicating() {
+			return errNotReplicated
+		}
+		return replicaErr
+	})
+	if err == nil {
+		return fullURL, attrs, found, nil
+	}
+	return scanLink(st.getLink.QueryRowContext(ctx, token))
+}
+
+func scanLink(row *sql.Row) (fullURL string, attrs storage.Attributes, found bool, err error) {
+	var encoded []byte
+	err = row.Scan(&fullURL, &encoded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", storage.Attributes{}, false, nil
+	}
+	if err != nil {
+		return "", storage.Attributes{}, false, err
+	}
+	attrs, err = storage.UnmarshalAttributes(encoded)
+	if err != nil {
+		return "", storage.Attributes{}, false, err
+	}
+	return fullURL, attrs, true, nil
+}
+
+func (st *Storage) CreateShortURL(ctx context.Context, fullURL string,
 	token string,
 ) (err error) {
-	_, err = st.db.Exec(templateInsertShort,
-		token, fullURL)
+	err = st.execRecorded(ctx, storage.OutboxLinkCreated, token, encodePayload(fullURL, nil),
+		st.insertShort, token, fullURL)
+	if err == nil {
+		st.replicas.created()
+	}
+	return insertError(err)
+}
+
+func (st *Storage) CreateWithAttributes(ctx context.Context, fullURL string,
+	token string, attrs storage.Attributes,
+) (err error) {
+	encoded, err := storage.MarshalAttributes(attrs)
+	if err != nil {
+		return err
+	}
+	err = st.execRecorded(ctx, storage.OutboxLinkCreated, token, encodePayload(fullURL, encoded),
+		st.insertLink, token, fullURL, nullable(encoded))
+	if err == nil {
+		st.replicas.created()
+	}
+	return insertError(err)
+}
+
+// CreateBatch inserts links in one transaction. Any error but a taken token
+// aborts a Postgres transaction, so then the links are inserted one by one
+// to find out which of them failed.
+func (st *Storage) CreateBatch(ctx context.Context,
+	links []storage.NewLink,
+) (errs []error, err error) {
+	errs, err = st.insertBatchTx(ctx, links)
+	if err == nil || ctx.Err() != nil {
+		return errs, err
+	}
+	errs = make([]error, len(links))
+	for i := range links {
+		errs[i] = st.CreateWithAttributes(ctx, links[i].FullURL, links[i].Token, links[i].Attributes)
+	}
+	return errs, nil
+}
+
+func (st *Storage) insertBatchTx(ctx context.Context,
+	links []storage.NewLink,
+) (errs []error, err error) {
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	stmt := tx.StmtContext(ctx, st.insertBatch)
+	var record *sql.Stmt
+	if st.outbox {
+		record = tx.StmtContext(ctx, st.insertOutbox)
+	}
+	errs = make([]error, len(links))
+	for i := range links {
+		link := &links[i]
+		var encoded []byte
+		encoded, err = storage.MarshalAttributes(link.Attributes)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		var inserted bool
+		inserted, err = affectedAny(stmt.ExecContext(ctx, link.Token, link.FullURL, nullable(encoded)))
+		if err != nil {
+			return nil, err
+		}
+		if !inserted {
+			errs[i] = storage.ErrTokenExists
+			continue
+		}
+		if record != nil {
+			_, err = record.ExecContext(ctx, storage.OutboxLinkCreated, link.Token,
+				string(encodePayload(link.FullURL, encoded)))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	st.replicas.created()
+	return errs, nil
+}
+
+// nullable keeps the attributes of a link without them NULL.
+func nullable(encoded []byte) any {
+	if encoded == nil {
+		return nil
+	}
+	return string(encoded)
+}
+
+func insertError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return fmt.Errorf("%w: %w", storage.ErrTokenExists, err)
+	}
 	return err
 }
 
-func (st *Storage) AlreadyExists(_ context.Context,
+// AlreadyExists is read from the primary, so that a link created moments
+// ago is not created twice.
+func (st *Storage) AlreadyExists(ctx context.Context,
 	fullURL string,
 ) (token string, found bool, err error) {
-	rows, err := st.db.Query(templateCheckExists, fullURL)
+	err = st.checkExists.QueryRowContext(ctx, fullURL).Scan(&token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
 	if err != nil {
 		return "", false, err
 	}
+	return token, true, nil
+}
+
+// UpdateShortURL notifies ChangesChannel, so other replicas drop token
+// from their caches.
+func (st *Storage) UpdateShortURL(ctx context.Context, token string,
+	fullURL string,
+) (found bool, err error) {
+	return st.changeAndNotify(ctx, token, storage.OutboxLinkUpdated, encodePayload(fullURL, nil),
+		st.updateShort, token, fullURL)
+}
+
+// DeleteShortURL notifies ChangesChannel, so other replicas drop token
+// from their caches.
+func (st *Storage) DeleteShortURL(ctx context.Context,
+	token string,
+) (found bool, err error) {
+	return st.changeAndNotify(ctx, token, storage.OutboxLinkDeleted, encodePayload("", nil),
+		st.deleteShort, token)
+}
+
+// changeAndNotify runs stmt, the notification and the outbox event in one
+// transaction, so that listeners get it only once the change is committed.
+func (st *Storage) changeAndNotify(ctx context.Context, token string, event string, payload []byte,
+	stmt *sql.Stmt, args ...any,
+) (found bool, err error) {
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
 	defer func() {
-		err = rows.Close()
+		_ = tx.Rollback()
+	}()
+
+	res, err := tx.StmtContext(ctx, stmt).ExecContext(ctx, args...)
+	found, err = affectedAny(res, err)
+	if err != nil || !found {
+		return false, err
+	}
+	_, err = tx.StmtContext(ctx, st.notify).ExecContext(ctx, ChangesChannel, token)
+	if err != nil {
+		return false, err
+	}
+	if st.outbox {
+		_, err = tx.StmtContext(ctx, st.insertOutbox).ExecContext(ctx, event, token, string(payload))
 		if err != nil {
-			return
+			return false, err
 		}
-	}()
+	}
+	return true, tx.Commit()
+}
 
-	if rows.Err() != nil {
-		return "", false, err
+func affectedAny(res sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (st *Storage) AddTokens(ctx context.Context,
+	tokens []string,
+) (added int, err error) {
+	res, err := st.addTokens.ExecContext(ctx, pq.Array(tokens))
+	if err != nil {
+		return 0, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
 	}
-	if !rows.Next() {
+	return int(affected), nil
+}
+
+func (st *Storage) ClaimToken(ctx context.Context) (token string, found bool, err error) {
+	err = st.claimToken.QueryRowContext(ctx).Scan(&token)
+	if errors.Is(err, sql.ErrNoRows) {
 		return "", false, nil
 	}
-	err = rows.Scan(&token)
 	if err != nil {
 		return "", false, err
 	}
 	return token, true, nil
 }
 
+func (st *Storage) PoolSize(ctx context.Context) (size int, err error) {
+	err = st.poolSize.QueryRowContext(ctx).Scan(&size)
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+func (st *Storage) Count(ctx context.Context) (count int, err error) {
+	err = st.replicas.read(ctx, func(stmts *replicaStatements) error {
+		return stmts.count.QueryRowContext(ctx).Scan(&count)
+	})
+	if err == nil {
+		return count, nil
+	}
+	err = st.count.QueryRowContext(ctx).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (st *Storage) AddClick(ctx context.Context, token string) (err error) {
+	if !st.outboxClicks {
+		_, err = st.addClick.ExecContext(ctx, token)
+		return err
+	}
+	return st.execRecorded(ctx, storage.OutboxLinkClicked, token, encodePayload("", nil), st.addClick, token)
+}
+
+// AddClicks updates the links of all tokens in one statement. With
+// OutboxClicks every click is recorded too, in the transaction of the update.
+func (st *Storage) AddClicks(ctx context.Context, clicks map[string]int64) (err error) {
+	tokens := make([]string, 0, len(clicks))
+	for token := range clicks {
+		tokens = append(tokens, token)
+	}
+	slices.Sort(tokens)
+	counts := make([]int64, len(tokens))
+	for i, token := range tokens {
+		counts[i] = clicks[token]
+	}
+	if !st.outbox || !st.outboxClicks {
+		_, err = st.addClicks.ExecContext(ctx, pq.Array(tokens), pq.Array(counts))
+		return err
+	}
+
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	rows, err := tx.StmtContext(ctx, st.addClicks).QueryContext(ctx, pq.Array(tokens), pq.Array(counts))
+	if err != nil {
+		return err
+	}
+	clicked := make(map[string]int64, len(tokens))
+	for rows.Next() {
+		var token string
+		var count int64
+		err = rows.Scan(&token, &count)
+		if err != nil {
+			_ = rows.Close()
+			return err
+		}
+		clicked[token] = count
+	}
+	err = errors.Join(rows.Err(), rows.Close())
+	if err != nil {
+		return err
+	}
+	record := tx.StmtContext(ctx, st.insertOutbox)
+	payload := string(encodePayload("", nil))
+	for token, count := range clicked {
+		for i := int64(0); i < count; i++ {
+			_, err = record.ExecContext(ctx, storage.OutboxLinkClicked, token, payload)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func (st *Storage) Clicks(ctx context.Context, token string) (clicks int64, err error) {
+	err = st.clicks.QueryRowContext(ctx, token).Scan(&clicks)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return clicks, nil
+}
+
+func (st *Storage) TopLinks(ctx context.Context, limit int) (links []storage.Link, err error) {
+	err = st.replicas.read(ctx, func(stmts *replicaStatements) error {
+		var replicaErr error
+		links, replicaErr = scanLinks(stmts.topLinks.QueryContext(ctx, limit))
+		return replicaErr
+	})
+	if err == nil {
+		return links, nil
+	}
+	return scanLinks(st.topLinks.QueryContext(ctx, limit))
+}
+
+func scanLinks(rows *sql.Rows, err error) ([]storage.Link, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var links []storage.Link
+	for rows.Next() {
+		var link storage.Link
+		var encoded []byte
+		err = rows.Scan(&link.Token, &link.FullURL, &link.Clicks, &encoded)
+		if err != nil {
+			return nil, err
+		}
+		link.Attributes, err = storage.UnmarshalAttributes(encoded)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// Run checks the lag of replicas until ctx is done.
+func (st *Storage) Run(ctx context.Context) {
+	if len(st.replicas.replicas) == 0 {
+		return
+	}
+	ticker := time.NewTicker(st.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			st.replicas.check(ctx)
+		}
+	}
+}
+
 func (st *Storage) Close() error {
-	return st.db.Close()
+	st.closeStatements()
+	return errors.Join(st.replicas.close(), st.db.Close())
+}
+
+func (st *Storage) closeStatements() {
+	for _, statement := range st.statements() {
+		if *statement.stmt != nil {
+			_ = (*statement.stmt).Close()
+		}
+	}
 }
@@ -3,13 +3,77 @@ package postgres
 import (
 	"context"
 	"errors"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ilyakharev/url-short/internal/storage"
 )
 
+func newMockStorage(t *testing.T) (*Storage, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	for _, statement := range (&Storage{}).statements() {
+		mock.ExpectPrepare(regexp.QuoteMeta(statement.query))
+	}
+
+	st, err := newStorage(context.Background(), db)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when preparing storage", err)
+	}
+	return st, mock
+}
+
+func TestPing(t *testing.T) {
+	t.Run("retry ping", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		require.NoError(t, err)
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		mock.ExpectPing()
+
+		err = ping(context.Background(), db, 3, time.Millisecond)
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("give up after attempts", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		require.NoError(t, err)
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+		err = ping(context.Background(), db, 2, time.Millisecond)
+		require.Error(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("stop on context", func(t *testing.T) {
+		db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+		require.NoError(t, err)
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err = ping(ctx, db, 10, time.Minute)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestPrepareError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	mock.ExpectPrepare("SELECT full_url").WillReturnError(errors.New("any"))
+
+	_, err = newStorage(context.Background(), db)
+	require.Error(t, err)
+}
+
 func TestSqlStorage_AlreadyExists(t *testing.T) {
 	tests := []*struct {
 		name         string
@@ -42,20 +106,10 @@ func TestSqlStorage_AlreadyExists(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			db, mock, err := sqlmock.New()
 			ctx := context.Background()
-			if err != nil {
-				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
-			}
-
-			st := &Storage{
-				db: db,
-			}
+			st, mock := newMockStorage(t)
 			defer func() {
-				err = st.Close()
-				if err != nil {
-					return
-				}
+				_ = st.Close()
 			}()
 
 			switch {
@@ -113,20 +167,10 @@ func TestSqlStorage_CreateShortURL(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			db, mock, err := sqlmock.New()
 			ctx := context.Background()
-			if err != nil {
-				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
-			}
-
-			st := &Storage{
-				db: db,
-			}
+			st, mock := newMockStorage(t)
 			defer func() {
-				err = st.Close()
-				if err != nil {
-					return
-				}
+				_ = st.Close()
 			}()
 
 			if tt.queryError {
@@ -139,7 +183,7 @@ func TestSqlStorage_CreateShortURL(t *testing.T) {
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			}
 
-			err = st.CreateShortURL(ctx, tt.fullURL, tt.token)
+			err := st.CreateShortURL(ctx, tt.fullURL, tt.token)
 			if tt.queryError {
 				require.Error(t, err)
 			} else {
@@ -149,6 +193,68 @@ func TestSqlStorage_CreateShortURL(t *testing.T) {
 	}
 }
 
+func TestSqlStorage_Edit(t *testing.T) {
+	tests := []*struct {
+		name       string
+		delete     bool
+		affected   int64
+		queryError bool
+		found      bool
+	}{
+		{name: "update", affected: 1, found: true},
+		{name: "update missing", affected: 0, found: false},
+		{name: "update error", queryError: true},
+		{name: "delete", delete: true, affected: 1, found: true},
+		{name: "delete missing", delete: true, affected: 0, found: false},
+		{name: "delete error", delete: true, queryError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			st, mock := newMockStorage(t)
+			defer func() {
+				_ = st.Close()
+			}()
+
+			mock.ExpectBegin()
+			var expect *sqlmock.ExpectedExec
+			if tt.delete {
+				expect = mock.ExpectExec("DELETE FROM urls").WithArgs("1234567890")
+			} else {
+				expect = mock.ExpectExec("UPDATE urls").WithArgs("1234567890", "http://ya.ru")
+			}
+			switch {
+			case tt.queryError:
+				expect.WillReturnError(errors.New("some"))
+				mock.ExpectRollback()
+			case tt.affected == 0:
+				expect.WillReturnResult(sqlmock.NewResult(0, tt.affected))
+				mock.ExpectRollback()
+			default:
+				expect.WillReturnResult(sqlmock.NewResult(0, tt.affected))
+				mock.ExpectExec("pg_notify").WithArgs(ChangesChannel, "1234567890").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}
+
+			var found bool
+			var err error
+			if tt.delete {
+				found, err = st.DeleteShortURL(ctx, "1234567890")
+			} else {
+				found, err = st.UpdateShortURL(ctx, "1234567890", "http://ya.ru")
+			}
+			require.NoError(t, mock.ExpectationsWereMet())
+			if tt.queryError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.found, found)
+		})
+	}
+}
+
 func TestSqlStorage_GetFullURL(t *testing.T) {
 	tests := []*struct {
 		name       string
@@ -181,20 +287,10 @@ func TestSqlStorage_GetFullURL(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			db, mock, err := sqlmock.New()
 			ctx := context.Background()
-			if err != nil {
-				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
-			}
-
-			st := &Storage{
-				db: db,
-			}
+			st, mock := newMockStorage(t)
 			defer func() {
-				err = st.Close()
-				if err != nil {
-					return
-				}
+				_ = st.Close()
 			}()
 
 			switch {
@@ -229,3 +325,219 @@ func TestSqlStorage_GetFullURL(t *testing.T) {
 		})
 	}
 }
+
+func TestSqlStorage_Clicks(t *testing.T) {
+	ctx := context.Background()
+	st, mock := newMockStorage(t)
+	defer func() {
+		_ = st.Close()
+	}()
+
+	mock.ExpectExec("UPDATE urls SET clicks = clicks \\+ 1").WithArgs("ya").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, st.AddClick(ctx, "ya"))
+
+	mock.ExpectQuery("SELECT clicks FROM urls").WithArgs("unknown").
+		WillReturnRows(sqlmock.NewRows([]string{"clicks"}))
+	clicks, err := st.Clicks(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Zero(t, clicks)
+
+	mock.ExpectQuery("SELECT short_url, full_url, clicks, attributes FROM urls ORDER BY clicks DESC").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"short_url", "full_url", "clicks", "attributes"}).
+			AddRow("ya", "http://ya.ru", 3, []byte(`{"tags":["search"]}`)).
+			AddRow("mai", "http://mai.ru", 1, nil))
+	links, err := st.TopLinks(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.Link{
+		{Token: "ya", FullURL: "http://ya.ru", Clicks: 3, Attributes: storage.Attributes{Tags: []string{"search"}}},
+		{Token: "mai", FullURL: "http://mai.ru", Clicks: 1},
+	}, links)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSqlStorage_Attributes(t *testing.T) {
+	st, mock := newMockStorage(t)
+	ctx := context.Background()
+	attrs := storage.Attributes{ExpiresAt: time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), Tags: []string{"a"}}
+	encoded := `{"expires_at":"2030-01-02T03:04:05Z","tags":["a"]}`
+
+	mock.ExpectExec("INSERT INTO urls\\(short_url, full_url, attributes\\)").
+		WithArgs("a", "http://a.ru", encoded).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, st.CreateWithAttributes(ctx, "http://a.ru", "a", attrs))
+
+	mock.ExpectQuery("SELECT full_url, attributes FROM urls").WithArgs("a").
+		WillReturnRows(sqlmock.NewRows([]string{"full_url", "attributes"}).AddRow("http://a.ru", []byte(encoded)))
+	fullURL, stored, found, err := st.GetWithAttributes(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "http://a.ru", fullURL)
+	assert.Equal(t, attrs, stored)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSqlStorage_CreateBatch(t *testing.T) {
+	ctx := context.Background()
+	links := []storage.NewLink{
+		{Token: "a", FullURL: "http://a.ru"},
+		{Token: "b", FullURL: "http://b.ru", Attributes: storage.Attributes{Tags: []string{"b"}}},
+	}
+
+	t.Run("taken token", func(t *testing.T) {
+		st, mock := newMockStorage(t)
+		mock.ExpectBegin()
+		mock.ExpectExec("ON CONFLICT").WithArgs("a", "http://a.ru", nil).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("ON CONFLICT").WithArgs("b", "http://b.ru", `{"tags":["b"]}`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		errs, err := st.CreateBatch(ctx, links)
+		require.NoError(t, err)
+		require.Len(t, errs, 2)
+		assert.ErrorIs(t, errs[0], storage.ErrTokenExists)
+		assert.NoError(t, errs[1])
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("failed insert", func(t *testing.T) {
+		st, mock := newMockStorage(t)
+		tooLong := &pq.Error{Code: "22001", Message: "value too long"}
+		mock.ExpectBegin()
+		mock.ExpectExec("ON CONFLICT").WithArgs("a", "http://a.ru", nil).WillReturnError(tooLong)
+		mock.ExpectRollback()
+		mock.ExpectExec("INSERT INTO urls").WithArgs("a", "http://a.ru", nil).WillReturnError(tooLong)
+		mock.ExpectExec("INSERT INTO urls").WithArgs("b", "http://b.ru", `{"tags":["b"]}`).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		errs, err := st.CreateBatch(ctx, links)
+		require.NoError(t, err)
+		require.Len(t, errs, 2)
+		assert.ErrorIs(t, errs[0], tooLong)
+		assert.NoError(t, errs[1])
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestSqlStorage_AddTokens(t *testing.T) {
+	tests := []*struct {
+		name       string
+		tokens     []string
+		queryError bool
+		added      int
+	}{
+		{
+			name:       "query error",
+			tokens:     []string{"1234567890"},
+			queryError: true,
+		},
+		{
+			name:   "success",
+			tokens: []string{"1234567890", "0987654321"},
+			added:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			st, mock := newMockStorage(t)
+			defer func() {
+				_ = st.Close()
+			}()
+
+			if tt.queryError {
+				mock.ExpectExec("INSERT INTO token_pool").
+					WithArgs(sqlmock.AnyArg()).
+					WillReturnError(errors.New("some"))
+			} else {
+				mock.ExpectExec("INSERT INTO token_pool").
+					WithArgs(sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, int64(tt.added)))
+			}
+
+			added, err := st.AddTokens(ctx, tt.tokens)
+			if tt.queryError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.added, added)
+			}
+		})
+	}
+}
+
+func TestSqlStorage_ClaimToken(t *testing.T) {
+	tests := []*struct {
+		name       string
+		queryError bool
+		found      bool
+		token      string
+	}{
+		{
+			name:       "query error",
+			queryError: true,
+		},
+		{
+			name:  "found",
+			found: true,
+			token: "1234567890",
+		},
+		{
+			name: "empty pool",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			st, mock := newMockStorage(t)
+			defer func() {
+				_ = st.Close()
+			}()
+
+			switch {
+			case tt.queryError:
+				mock.ExpectQuery("DELETE FROM token_pool").WillReturnError(errors.New("any"))
+			case tt.found:
+				rows := sqlmock.NewRows([]string{"token"}).AddRow(tt.token)
+				mock.ExpectQuery("DELETE FROM token_pool").WillReturnRows(rows)
+			default:
+				rows := sqlmock.NewRows([]string{"token"})
+				mock.ExpectQuery("DELETE FROM token_pool").WillReturnRows(rows)
+			}
+
+			token, found, err := st.ClaimToken(ctx)
+			switch {
+			case tt.queryError:
+				assert.False(t, found)
+				require.Error(t, err)
+			case tt.found:
+				assert.True(t, found)
+				assert.Equal(t, tt.token, token)
+				require.NoError(t, err)
+			default:
+				assert.False(t, found)
+				assert.Empty(t, token)
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSqlStorage_ContextCancel(t *testing.T) {
+	st, mock := newMockStorage(t)
+	defer func() {
+		_ = st.Close()
+	}()
+	rows := sqlmock.NewRows([]string{"full_url"}).AddRow("http://ya.ru")
+	mock.ExpectQuery("SELECT full_url").WithArgs("1234567890").
+		WillDelayFor(time.Second).WillReturnRows(rows)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, found, err := st.GetFullURL(ctx, "1234567890")
+	require.Error(t, err)
+	assert.False(t, found)
+	assert.Less(t, time.Since(start), time.Second)
+}
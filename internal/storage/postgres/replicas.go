@@ -0,0 +1,204 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"expvar"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMaxReplicaLag        = 10 * time.Second
+	defaultReplicaCheckInterval = 5 * time.Second
+	replicaCheckTimeout         = 2 * time.Second
+)
+
+// templateReplicaLag is zero on a replica that has replayed everything it
+// received, however long ago the last transaction was, and on a primary.
+const templateReplicaLag = `
+SELECT CASE
+	WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END`
+
+// replicaStats shows the state of every replica, "up", "lagging" or "down"
+// with the reason.
+var replicaStats = expvar.NewMap("postgres_replicas")
+
+var (
+	errNoReplica = errors.New("no healthy replica")
+	// errNotReplicated is returned by reads that could miss a row written
+	// to the primary moments ago.
+	errNotReplicated = errors.New("not found on replica")
+)
+
+type replica struct {
+	name string
+	db   *sql.DB
+	// stmts are prepared by the first check the replica passes, it is not
+	// healthy before.
+	stmts   atomic.Pointer[replicaStatements]
+	status  *expvar.String
+	healthy atomic.Bool
+}
+
+// replicaStatements are the reads served by replicas, prepared once on each
+// of them as the statements of the primary are.
+type replicaStatements struct {
+	getFullURL     *sql.Stmt
+	getLink        *sql.Stmt
+	count          *sql.Stmt
+	topLinks       *sql.Stmt
+	campaignClicks *sql.Stmt
+}
+
+func (stmts *replicaStatements) statements() []statement {
+	return []statement{
+		{stmt: &stmts.getFullURL, query: templateGetFullURL},
+		{stmt: &stmts.getLink, query: templateGetLink},
+		{stmt: &stmts.count, query: templateCount},
+		{stmt: &stmts.topLinks, query: templateTopLinks},
+		{stmt: &stmts.campaignClicks, query: templateCampaignClicks},
+	}
+}
+
+func prepareReplica(ctx context.Context, db *sql.DB) (stmts *replicaStatements, err error) {
+	stmts = &replicaStatements{}
+	for _, statement := range stmts.statements() {
+		*statement.stmt, err = db.PrepareContext(ctx, statement.query)
+		if err != nil {
+			_ = stmts.close()
+			return nil, err
+		}
+	}
+	return stmts, nil
+}
+
+func (stmts *replicaStatements) close() error {
+	var err error
+	for _, statement := range stmts.statements() {
+		if *statement.stmt != nil {
+			err = errors.Join(err, (*statement.stmt).Close())
+		}
+	}
+	return err
+}
+
+// replicaSet spreads reads over healthy replicas round-robin. A replica is
+// taken out of rotation when a read from it fails or it lags behind the
+// primary by more than maxLag, and is put back by the next check it passes.
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+	maxLag   time.Duration
+	// lastCreate is the time in nanoseconds the last link was created on
+	// the primary through this set.
+	lastCreate atomic.Int64
+}
+
+func newReplicaSet(dbs []*sql.DB, maxLag time.Duration) *replicaSet {
+	if maxLag <= 0 {
+		maxLag = defaultMaxReplicaLag
+	}
+	set := &replicaSet{maxLag: maxLag}
+	for i, db := range dbs {
+		replica := &replica{name: "replica" + strconv.Itoa(i), db: db, status: &expvar.String{}}
+		replica.status.Set("unchecked")
+		replicaStats.Set(replica.name, replica.status)
+		set.replicas = append(set.replicas, replica)
+	}
+	return set
+}
+
+func (set *replicaSet) pick() *replica {
+	count := uint64(len(set.replicas))
+	start := set.next.Add(1)
+	for i := uint64(0); i < count; i++ {
+		replica := set.replicas[(start+i)%count]
+		if replica.healthy.Load() {
+			return replica
+		}
+	}
+	return nil
+}
+
+// read runs fn with the statements of the next healthy replica. The caller
+// falls back to the primary on any error.
+func (set *replicaSet) read(ctx context.Context, fn func(stmts *replicaStatements) error) error {
+	replica := set.pick()
+	if replica == nil {
+		return errNoReplica
+	}
+	err := fn(replica.stmts.Load())
+	if err != nil && !errors.Is(err, errNotReplicated) && ctx.Err() == nil {
+		replica.down(err)
+	}
+	return err
+}
+
+// created records a link created on the primary, which replicas may not
+// have yet.
+func (set *replicaSet) created() {
+	set.lastCreate.Store(time.Now().UnixNano())
+}
+
+// replicating reports whether a link created on the primary could still be
+// missing on replicas in rotation, that is the last one was created less than
+// maxLag ago.
+func (set *replicaSet) replicating() bool {
+	return time.Since(time.Unix(0, set.lastCreate.Load())) < set.maxLag
+}
+
+func (set *replicaSet) check(ctx context.Context) {
+	for _, replica := range set.replicas {
+		replica.check(ctx, set.maxLag)
+	}
+}
+
+func (set *replicaSet) close() error {
+	var err error
+	for _, replica := range set.replicas {
+		if stmts := replica.stmts.Load(); stmts != nil {
+			err = errors.Join(err, stmts.close())
+		}
+		err = errors.Join(err, replica.db.Close())
+	}
+	return err
+}
+
+func (replica *replica) check(ctx context.Context, maxLag time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+	defer cancel()
+
+	var seconds float64
+	err := replica.db.QueryRowContext(ctx, templateReplicaLag).Scan(&seconds)
+	if err != nil {
+		replica.down(err)
+		return
+	}
+	lag := time.Duration(seconds * float64(time.Second))
+	if lag > maxLag {
+		replica.healthy.Store(false)
+		replica.status.Set("lagging " + lag.Round(time.Millisecond).String())
+		return
+	}
+	if replica.stmts.Load() == nil {
+		var stmts *replicaStatements
+		stmts, err = prepareReplica(ctx, replica.db)
+		if err != nil {
+			replica.down(err)
+			return
+		}
+		replica.stmts.Store(stmts)
+	}
+	replica.healthy.Store(true)
+	replica.status.Set("up")
+}
+
+func (replica *replica) down(err error) {
+	replica.healthy.Store(false)
+	replica.status.Set("down: " + err.Error())
+}
@@ -0,0 +1,170 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newReplicatedStorage returns a storage with healthy replicas.
+func newReplicatedStorage(t *testing.T, replicas int) (*Storage, sqlmock.Sqlmock, []sqlmock.Sqlmock) {
+	st, primary := newMockStorage(t)
+	var dbs []*sql.DB
+	var mocks []sqlmock.Sqlmock
+	for i := 0; i < replicas; i++ {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		mock.ExpectQuery("SELECT CASE").WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(0.0))
+		for _, statement := range (&replicaStatements{}).statements() {
+			mock.ExpectPrepare(regexp.QuoteMeta(statement.query))
+		}
+		dbs = append(dbs, db)
+		mocks = append(mocks, mock)
+	}
+	st.replicas = newReplicaSet(dbs, time.Second)
+	st.replicas.check(context.Background())
+	return st, primary, mocks
+}
+
+func expectFullURL(mock sqlmock.Sqlmock, token string, fullURL string) {
+	rows := sqlmock.NewRows([]string{"full_url"})
+	if fullURL != "" {
+		rows.AddRow(fullURL)
+	}
+	mock.ExpectQuery("SELECT full_url").WithArgs(token).WillReturnRows(rows)
+}
+
+func TestReplicas(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("round robin", func(t *testing.T) {
+		st, primary, replicas := newReplicatedStorage(t, 2)
+		expectFullURL(replicas[1], "a", "http://a.ru")
+		expectFullURL(replicas[0], "b", "http://b.ru")
+		expectFullURL(replicas[1], "c", "http://c.ru")
+
+		for _, token := range []string{"a", "b", "c"} {
+			fullURL, found, err := st.GetFullURL(ctx, token)
+			require.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, "http://"+token+".ru", fullURL)
+		}
+		for _, mock := range append(replicas, primary) {
+			require.NoError(t, mock.ExpectationsWereMet())
+		}
+	})
+	t.Run("not replicated yet", func(t *testing.T) {
+		st, primary, replicas := newReplicatedStorage(t, 1)
+		primary.ExpectExec("INSERT INTO urls").WithArgs("a", "http://a.ru").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectFullURL(replicas[0], "a", "")
+		expectFullURL(primary, "a", "http://a.ru")
+
+		require.NoError(t, st.CreateShortURL(ctx, "http://a.ru", "a"))
+		fullURL, found, err := st.GetFullURL(ctx, "a")
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "http://a.ru", fullURL)
+		assert.True(t, st.replicas.replicas[0].healthy.Load())
+		for _, mock := range append(replicas, primary) {
+			require.NoError(t, mock.ExpectationsWereMet())
+		}
+	})
+	t.Run("not found outside lag window", func(t *testing.T) {
+		st, primary, replicas := newReplicatedStorage(t, 1)
+		st.replicas.lastCreate.Store(time.Now().Add(-2 * time.Second).UnixNano())
+		expectFullURL(replicas[0], "a", "")
+
+		_, found, err := st.GetFullURL(ctx, "a")
+		require.NoError(t, err)
+		assert.False(t, found)
+		for _, mock := range append(replicas, primary) {
+			require.NoError(t, mock.ExpectationsWereMet())
+		}
+	})
+	t.Run("statements are prepared once healthy", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		set := newReplicaSet([]*sql.DB{db}, time.Second)
+		defer func() {
+			_ = set.close()
+		}()
+		mock.ExpectQuery("SELECT CASE").WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(0.0))
+		mock.ExpectPrepare("SELECT full_url").WillReturnError(errors.New("connection reset"))
+		set.check(ctx)
+		assert.False(t, set.replicas[0].healthy.Load())
+		assert.Contains(t, set.replicas[0].status.Value(), "connection reset")
+
+		mock.ExpectQuery("SELECT CASE").WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(0.0))
+		for _, statement := range (&replicaStatements{}).statements() {
+			mock.ExpectPrepare(regexp.QuoteMeta(statement.query))
+		}
+		set.check(ctx)
+		mock.ExpectQuery("SELECT CASE").WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(0.0))
+		set.check(ctx)
+		assert.True(t, set.replicas[0].healthy.Load())
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("failed replica leaves rotation", func(t *testing.T) {
+		st, primary, replicas := newReplicatedStorage(t, 2)
+		replicas[1].ExpectQuery("SELECT full_url").WillReturnError(errors.New("connection refused"))
+		expectFullURL(primary, "a", "http://a.ru")
+		expectFullURL(replicas[0], "b", "http://b.ru")
+		expectFullURL(replicas[0], "c", "http://c.ru")
+
+		for _, token := range []string{"a", "b", "c"} {
+			fullURL, found, err := st.GetFullURL(ctx, token)
+			require.NoError(t, err)
+			assert.True(t, found)
+			assert.Equal(t, "http://"+token+".ru", fullURL)
+		}
+		assert.Contains(t, st.replicas.replicas[1].status.Value(), "connection refused")
+		for _, mock := range append(replicas, primary) {
+			require.NoError(t, mock.ExpectationsWereMet())
+		}
+	})
+	t.Run("lagging replica leaves rotation", func(t *testing.T) {
+		st, primary, replicas := newReplicatedStorage(t, 1)
+		replicas[0].ExpectQuery("SELECT CASE").WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(3.5))
+		st.replicas.check(ctx)
+		assert.Equal(t, "lagging 3.5s", st.replicas.replicas[0].status.Value())
+
+		primary.ExpectQuery("SELECT count").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+		count, err := st.Count(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 7, count)
+
+		replicas[0].ExpectQuery("SELECT CASE").WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(0.2))
+		st.replicas.check(ctx)
+		replicas[0].ExpectQuery("SELECT count").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(8))
+		count, err = st.Count(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 8, count)
+
+		for _, mock := range append(replicas, primary) {
+			require.NoError(t, mock.ExpectationsWereMet())
+		}
+	})
+	t.Run("writes and existence checks go to primary", func(t *testing.T) {
+		st, primary, replicas := newReplicatedStorage(t, 1)
+		primary.ExpectQuery("SELECT short_url").WithArgs("http://a.ru").
+			WillReturnRows(sqlmock.NewRows([]string{"short_url"}))
+		primary.ExpectExec("INSERT INTO urls").WithArgs("a", "http://a.ru").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, found, err := st.AlreadyExists(ctx, "http://a.ru")
+		require.NoError(t, err)
+		assert.False(t, found)
+		require.NoError(t, st.CreateShortURL(ctx, "http://a.ru", "a"))
+		for _, mock := range append(replicas, primary) {
+			require.NoError(t, mock.ExpectationsWereMet())
+		}
+	})
+}
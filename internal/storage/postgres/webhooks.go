@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+const deliveryColumns = `id, webhook_id, tenant, event, payload, attempts, next_attempt_at, last_error, dead, created_at`
+
+const (
+	templateInsertWebhook = `
+INSERT INTO webhooks(id, tenant, url, secret, events, click_sample_rate, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	templateWebhooks = `
+SELECT id, tenant, url, secret, events, click_sample_rate, created_at FROM webhooks
+WHERE $1 = '' OR tenant = $1 ORDER BY created_at, id`
+	// templateDeleteWebhook deletes the deliveries too, by the foreign key.
+	templateDeleteWebhook  = `DELETE FROM webhooks WHERE id = $1 AND tenant = $2`
+	templateInsertDelivery = `
+INSERT INTO webhook_deliveries(` + deliveryColumns + `)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	// templateClaimDeliveries skips the rows locked by a claim in progress,
+	// so replicas of the service claim different deliveries. The rows are
+	// returned with the time they were due at, in no particular order.
+	templateClaimDeliveries = `
+WITH due AS (
+	SELECT id, next_attempt_at FROM webhook_deliveries
+	WHERE NOT dead AND next_attempt_at <= $1
+	ORDER BY next_attempt_at, id
+	LIMIT $3
+	FOR UPDATE SKIP LOCKED
+)
+UPDATE webhook_deliveries d SET next_attempt_at = $2 FROM due WHERE d.id = due.id
+RETURNING d.id, d.webhook_id, d.tenant, d.event, d.payload, d.attempts, due.next_attempt_at,
+	d.last_error, d.dead, d.created_at`
+	templateUpdateDelivery = `
+UPDATE webhook_deliveries SET attempts = $2, next_attempt_at = $3, last_error = $4, dead = $5
+WHERE id = $1`
+	templateDeleteDelivery = `DELETE FROM webhook_deliveries WHERE id = $1`
+	templateDeadDeliveries = `
+SELECT ` + deliveryColumns + ` FROM webhook_deliveries
+WHERE dead AND tenant = $1 ORDER BY created_at DESC, id DESC LIMIT $2`
+	templateReplayDelivery = `
+UPDATE webhook_deliveries SET dead = FALSE, attempts = 0, last_error = '', next_attempt_at = $3
+WHERE id = $1 AND tenant = $2 AND dead`
+)
+
+func (st *Storage) CreateWebhook(ctx context.Context, webhook *storage.Webhook) (err error) {
+	_, err = st.insertWebhook.ExecContext(ctx, webhook.ID, webhook.Tenant, webhook.URL, webhook.Secret,
+		strings.Join(webhook.Events, ","), webhook.ClickSampleRate, webhook.CreatedAt)
+	return insertError(err)
+}
+
+func (st *Storage) Webhooks(ctx context.Context, tenant string) (webhooks []storage.Webhook, err error) {
+	rows, err := st.webhooks.QueryContext(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var webhook storage.Webhook
+		var events string
+		err = rows.Scan(&webhook.ID, &webhook.Tenant, &webhook.URL, &webhook.Secret, &events,
+			&webhook.ClickSampleRate, &webhook.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		webhook.Events = strings.Split(events, ",")
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (st *Storage) DeleteWebhook(ctx context.Context, tenant string, id string) (found bool, err error) {
+	return affectedAny(st.deleteWebhook.ExecContext(ctx, id, tenant))
+}
+
+func (st *Storage) EnqueueDeliveries(ctx context.Context, deliveries []storage.WebhookDelivery) (err error) {
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	stmt := tx.StmtContext(ctx, st.insertDelivery)
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		_, err = stmt.ExecContext(ctx, delivery.ID, delivery.WebhookID, delivery.Tenant, delivery.Event,
+			delivery.Payload, delivery.Attempts, delivery.NextAttemptAt, delivery.LastError, delivery.Dead,
+			delivery.CreatedAt)
+		if err != nil {
+			return insertError(err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (st *Storage) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration,
+	limit int,
+) (deliveries []storage.WebhookDelivery, err error) {
+	deliveries, err = scanDeliveries(st.claimDelivery.QueryContext(ctx, now, now.Add(lease), limit))
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(deliveries, func(a, b storage.WebhookDelivery) int {
+		if order := a.NextAttemptAt.Compare(b.NextAttemptAt); order != 0 {
+			return order
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return deliveries, nil
+}
+
+func (st *Storage) UpdateDelivery(ctx context.Context, delivery *storage.WebhookDelivery) (err error) {
+	_, err = st.updateDelivery.ExecContext(ctx, delivery.ID, delivery.Attempts, delivery.NextAttemptAt,
+		delivery.LastError, delivery.Dead)
+	return err
+}
+
+func (st *Storage) DeleteDelivery(ctx context.Context, id string) (err error) {
+	_, err = st.deleteDelivery.ExecContext(ctx, id)
+	return err
+}
+
+func (st *Storage) DeadDeliveries(ctx context.Context, tenant string,
+	limit int,
+) (deliveries []storage.WebhookDelivery, err error) {
+	return scanDeliveries(st.deadDeliveries.QueryContext(ctx, tenant, limit))
+}
+
+func (st *Storage) ReplayDelivery(ctx context.Context, tenant string, id string,
+	now time.Time,
+) (found bool, err error) {
+	return affectedAny(st.replayDelivery.ExecContext(ctx, id, tenant, now))
+}
+
+func scanDeliveries(rows *sql.Rows, err error) ([]storage.WebhookDelivery, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	var deliveries []storage.WebhookDelivery
+	for rows.Next() {
+		var delivery storage.WebhookDelivery
+		err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Tenant, &delivery.Event,
+			&delivery.Payload, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastError,
+			&delivery.Dead, &delivery.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+var deliveryRows = []string{
+	"id", "webhook_id", "tenant", "event", "payload", "attempts", "next_attempt_at", "last_error", "dead",
+	"created_at",
+}
+
+func TestClaimDeliveries(t *testing.T) {
+	st, mock := newMockStorage(t)
+	now := time.Unix(1700000000, 0)
+	mock.ExpectQuery("FOR UPDATE SKIP LOCKED").WithArgs(now, now.Add(time.Minute), 10).
+		WillReturnRows(sqlmock.NewRows(deliveryRows).
+			AddRow("d2", "w1", "acme", "link.created", []byte(`{}`), 0, now, "", false, now).
+			AddRow("d1", "w1", "acme", "link.created", []byte(`{}`), 2, now.Add(-time.Second),
+				"502 Bad Gateway", false, now))
+
+	deliveries, err := st.ClaimDeliveries(context.Background(), now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, "d1", deliveries[0].ID, "returned rows are sorted by the due time")
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Equal(t, "502 Bad Gateway", deliveries[0].LastError)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebhooks(t *testing.T) {
+	ctx := context.Background()
+	st, mock := newMockStorage(t)
+	now := time.Unix(1700000000, 0)
+	webhook := storage.Webhook{ID: "w1", Tenant: "acme", URL: "https://acme.ru/hook", Secret: "s",
+		Events: []string{"link.created", "link.deleted"}, CreatedAt: now}
+
+	mock.ExpectExec("INSERT INTO webhooks").
+		WithArgs("w1", "acme", "https://acme.ru/hook", "s", "link.created,link.deleted", 0.0, now).
+		WillReturnError(&pq.Error{Code: uniqueViolation})
+	assert.ErrorIs(t, st.CreateWebhook(ctx, &webhook), storage.ErrTokenExists)
+
+	mock.ExpectQuery("FROM webhooks").WithArgs("acme").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "tenant", "url", "secret", "events", "click_sample_rate", "created_at",
+		}).AddRow("w1", "acme", "https://acme.ru/hook", "s", "link.created,link.deleted", 0.0, now))
+	webhooks, err := st.Webhooks(ctx, "acme")
+	require.NoError(t, err)
+	assert.Equal(t, []storage.Webhook{webhook}, webhooks)
+
+	mock.ExpectExec("DELETE FROM webhooks").WithArgs("w1", "other").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	found, err := st.DeleteWebhook(ctx, "other", "w1")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	mock.ExpectExec("UPDATE webhook_deliveries SET dead = FALSE").WithArgs("d1", "acme", now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	found, err = st.ReplayDelivery(ctx, "acme", "d1", now)
+	require.NoError(t, err)
+	assert.True(t, found)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,103 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+const (
+	templateSaveCampaign = `
+INSERT INTO campaigns(tenant, name, utm_source, utm_medium, utm_campaign, utm_term, utm_content, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (tenant, name) DO UPDATE SET utm_source = excluded.utm_source, utm_medium = excluded.utm_medium,
+	utm_campaign = excluded.utm_campaign, utm_term = excluded.utm_term, utm_content = excluded.utm_content,
+	updated_at = excluded.updated_at`
+	templateCampaign = `
+SELECT tenant, name, utm_source, utm_medium, utm_campaign, utm_term, utm_content, updated_at FROM campaigns
+WHERE tenant = ? AND name = ?`
+	templateCampaigns = `
+SELECT tenant, name, utm_source, utm_medium, utm_campaign, utm_term, utm_content, updated_at FROM campaigns
+WHERE tenant = ? ORDER BY name`
+	templateDeleteCampaign = `DELETE FROM campaigns WHERE tenant = ? AND name = ?`
+	templateCampaignClicks = `
+SELECT json_extract(attributes, '$.utm.campaign') AS campaign, COUNT(*), SUM(clicks) FROM urls
+WHERE json_extract(attributes, '$.utm.campaign') IS NOT NULL
+	AND (?1 = '' OR json_extract(attributes, '$.tenant') = ?1)
+GROUP BY campaign ORDER BY SUM(clicks) DESC, campaign`
+)
+
+func (st *Storage) SaveCampaign(ctx context.Context, campaign *storage.Campaign) (err error) {
+	utm := &campaign.UTM
+	_, err = st.saveCampaign.ExecContext(ctx, campaign.Tenant, campaign.Name, utm.Source, utm.Medium, utm.Campaign,
+		utm.Term, utm.Content, campaign.UpdatedAt.UnixNano())
+	return err
+}
+
+func (st *Storage) Campaign(ctx context.Context,
+	tenant string, name string,
+) (campaign storage.Campaign, found bool, err error) {
+	campaign, err = scanCampaign(st.campaign.QueryRowContext(ctx, tenant, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.Campaign{}, false, nil
+	}
+	if err != nil {
+		return storage.Campaign{}, false, err
+	}
+	return campaign, true, nil
+}
+
+func (st *Storage) Campaigns(ctx context.Context, tenant string) (campaigns []storage.Campaign, err error) {
+	rows, err := st.campaigns.QueryContext(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var campaign storage.Campaign
+		campaign, err = scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	return campaigns, rows.Err()
+}
+
+func (st *Storage) DeleteCampaign(ctx context.Context, tenant string, name string) (found bool, err error) {
+	return affectedAny(st.deleteCampaign.ExecContext(ctx, tenant, name))
+}
+
+func (st *Storage) CampaignClicks(ctx context.Context, tenant string) (stats []storage.CampaignClicks, err error) {
+	rows, err := st.campaignClicks.QueryContext(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var campaign storage.CampaignClicks
+		err = rows.Scan(&campaign.Campaign, &campaign.Links, &campaign.Clicks)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, campaign)
+	}
+	return stats, rows.Err()
+}
+
+// rowScanner is *sql.Row or *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCampaign(row rowScanner) (campaign storage.Campaign, err error) {
+	utm := &campaign.UTM
+	var updatedAt int64
+	err = row.Scan(&campaign.Tenant, &campaign.Name, &utm.Source, &utm.Medium, &utm.Campaign, &utm.Term,
+		&utm.Content, &updatedAt)
+	campaign.UpdatedAt = time.Unix(0, updatedAt)
+	return campaign, err
+}
@@ -0,0 +1,50 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+
+	"github.com/ilyakharev/url-short/internal/storage/migrate"
+)
+
+// migrations have the same versions and names as the postgres ones, only
+// the SQL is written for SQLite.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrator returns a migrator of the SQLite schema.
+func Migrator(db *sql.DB) (*migrate.Migrator, error) {
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	loaded, err := migrate.Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, loaded, migrate.Dialect{
+		Lock:        noLock,
+		Placeholder: func(int) string { return "?" },
+	}), nil
+}
+
+func migrateSchema(ctx context.Context, db *sql.DB, checkOnly bool) error {
+	migrator, err := Migrator(db)
+	if err != nil {
+		return err
+	}
+	if checkOnly {
+		return migrator.Check(ctx)
+	}
+	_, err = migrator.Up(ctx)
+	return err
+}
+
+// noLock does nothing: the database file belongs to a single process, and
+// SQLite already serializes the migration transactions.
+func noLock(context.Context, *sql.Conn) (unlock func(ctx context.Context) error, err error) {
+	return func(context.Context) error { return nil }, nil
+}
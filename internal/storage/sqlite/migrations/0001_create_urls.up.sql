@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS urls (
+	short_url	VARCHAR(32) PRIMARY KEY,
+	full_url    VARCHAR(1024)
+);
+
+CREATE INDEX IF NOT EXISTS idx ON urls(
+	full_url
+);
@@ -0,0 +1,3 @@
+CREATE TABLE IF NOT EXISTS token_pool (
+	token	VARCHAR(32) PRIMARY KEY
+);
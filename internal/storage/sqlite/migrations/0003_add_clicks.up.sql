@@ -0,0 +1 @@
+ALTER TABLE urls ADD COLUMN clicks INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- JSON, see storage.MarshalAttributes. NULL for links without attributes.
+ALTER TABLE urls ADD COLUMN attributes TEXT;
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+	id			VARCHAR(32) PRIMARY KEY,
+	tenant			VARCHAR(64) NOT NULL,
+	url			TEXT NOT NULL,
+	secret			TEXT NOT NULL,
+	-- Comma separated event names.
+	events			TEXT NOT NULL,
+	click_sample_rate	REAL NOT NULL DEFAULT 0,
+	-- Unix time in nanoseconds, as are the other times.
+	created_at		INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webhooks_tenant ON webhooks (tenant);
+
+-- Deliveries are deleted with their webhook by the storage, foreign keys are
+-- not enforced by SQLite by default.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id		VARCHAR(32) PRIMARY KEY,
+	webhook_id	VARCHAR(32) NOT NULL,
+	tenant		VARCHAR(64) NOT NULL,
+	event		VARCHAR(32) NOT NULL,
+	payload		BLOB NOT NULL,
+	attempts	INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at	INTEGER NOT NULL,
+	last_error	TEXT NOT NULL DEFAULT '',
+	dead		INTEGER NOT NULL DEFAULT 0,
+	created_at	INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due
+	ON webhook_deliveries (next_attempt_at) WHERE dead = 0;
+CREATE INDEX IF NOT EXISTS webhook_deliveries_dead
+	ON webhook_deliveries (tenant, created_at) WHERE dead = 1;
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook ON webhook_deliveries (webhook_id);
@@ -0,0 +1,9 @@
+-- Only the postgres storage writes the outbox, the table keeps the schemas
+-- of both databases at the same version.
+CREATE TABLE IF NOT EXISTS outbox (
+	id		INTEGER PRIMARY KEY AUTOINCREMENT,
+	event		VARCHAR(32) NOT NULL,
+	token		VARCHAR(32) NOT NULL,
+	payload		TEXT NOT NULL,
+	created_at	INTEGER NOT NULL
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS campaigns (
+	tenant		VARCHAR(64) NOT NULL,
+	name		VARCHAR(64) NOT NULL,
+	utm_source	TEXT NOT NULL DEFAULT '',
+	utm_medium	TEXT NOT NULL DEFAULT '',
+	utm_campaign	TEXT NOT NULL DEFAULT '',
+	utm_term	TEXT NOT NULL DEFAULT '',
+	utm_content	TEXT NOT NULL DEFAULT '',
+	updated_at	INTEGER NOT NULL,
+	PRIMARY KEY (tenant, name)
+);
+
+CREATE INDEX IF NOT EXISTS urls_utm_campaign ON urls (json_extract(attributes, '$.utm.campaign'))
+	WHERE json_extract(attributes, '$.utm.campaign') IS NOT NULL;
@@ -0,0 +1,480 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	// Pure Go driver, so the service still builds with CGO_ENABLED=0.
+	driver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+type Storage struct {
+	db *sql.DB
+
+	getFullURL  *sql.Stmt
+	getLink     *sql.Stmt
+	insertShort *sql.Stmt
+	insertLink  *sql.Stmt
+	checkExists *sql.Stmt
+	updateShort *sql.Stmt
+	deleteShort *sql.Stmt
+	addToken    *sql.Stmt
+	claimToken  *sql.Stmt
+	poolSize    *sql.Stmt
+	count       *sql.Stmt
+	addClick    *sql.Stmt
+	addClicks   *sql.Stmt
+	clicks      *sql.Stmt
+	topLinks    *sql.Stmt
+
+	insertWebhook           *sql.Stmt
+	webhooks                *sql.Stmt
+	deleteWebhook           *sql.Stmt
+	deleteWebhookDeliveries *sql.Stmt
+	insertDelivery          *sql.Stmt
+	dueDeliveries           *sql.Stmt
+	leaseDelivery           *sql.Stmt
+	updateDelivery          *sql.Stmt
+	deleteDelivery          *sql.Stmt
+	deadDeliveries          *sql.Stmt
+	replayDelivery          *sql.Stmt
+
+	saveCampaign   *sql.Stmt
+	campaign       *sql.Stmt
+	campaigns      *sql.Stmt
+	deleteCampaign *sql.Stmt
+	campaignClicks *sql.Stmt
+}
+
+type Config struct {
+	// Path is the database file, it is created if missing.
+	Path string
+	// BusyTimeout is how long a write waits for another one to finish.
+	BusyTimeout time.Duration
+	// SkipMigrations disables applying migrations on start. The storage
+	// then refuses to start until they are applied with "migrate up".
+	SkipMigrations bool
+}
+
+const defaultBusyTimeout = 5 * time.Second
+
+const (
+	templateGetFullURL  = `SELECT full_url FROM urls WHERE short_url = ?`
+	templateGetLink     = `SELECT full_url, attributes FROM urls WHERE short_url = ?`
+	templateInsertShort = `INSERT INTO urls(short_url, full_url) VALUES (?, ?)`
+	templateInsertLink  = `INSERT INTO urls(short_url, full_url, attributes) VALUES (?, ?, ?)`
+	templateCheckExists = `SELECT short_url FROM urls WHERE full_url = ?`
+	templateUpdateShort = `UPDATE urls SET full_url = ?2 WHERE short_url = ?1`
+	templateDeleteShort = `DELETE FROM urls WHERE short_url = ?`
+	templateAddToken    = `
+INSERT OR IGNORE INTO token_pool(token)
+SELECT ?1 WHERE NOT EXISTS (SELECT 1 FROM urls WHERE short_url = ?1)`
+	templateClaimToken = `
+DELETE FROM token_pool WHERE token = (
+	SELECT p.token FROM token_pool p
+	WHERE NOT EXISTS (SELECT 1 FROM urls WHERE short_url = p.token)
+	LIMIT 1
+) RETURNING token`
+	templatePoolSize  = `SELECT count(*) FROM token_pool`
+	templateCount     = `SELECT count(*) FROM urls`
+	templateAddClick  = `UPDATE urls SET clicks = clicks + 1 WHERE short_url = ?`
+	templateAddClicks = `UPDATE urls SET clicks = clicks + ? WHERE short_url = ?`
+	templateClicks    = `SELECT clicks FROM urls WHERE short_url = ?`
+	templateTopLinks  = `SELECT short_url, full_url, clicks, attributes FROM urls ORDER BY clicks DESC LIMIT ?`
+)
+
+var (
+	_ storage.Storager    = &Storage{}
+	_ storage.TokenPooler = &Storage{}
+	_ storage.Counter     = &Storage{}
+	_ storage.Editor      = &Storage{}
+
+	_ storage.ClickCounter    = &Storage{}
+	_ storage.ClickBatcher    = &Storage{}
+	_ storage.TopLinker       = &Storage{}
+	_ storage.AttributeStorer = &Storage{}
+	_ storage.BatchCreator    = &Storage{}
+	_ storage.WebhookStorer   = &Storage{}
+	_ storage.CampaignStorer  = &Storage{}
+	_ storage.CampaignCounter = &Storage{}
+)
+
+func New(ctx context.Context, cfg Config) (*Storage, error) {
+	db, err := Open(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrateSchema(ctx, db, cfg.SkipMigrations)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	st, err := newStorage(ctx, db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return st, nil
+}
+
+// Open opens the database file in WAL mode, so that reads are not blocked
+// by a write in progress.
+func Open(ctx context.Context, cfg Config) (*sql.DB, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("sqlite database path is empty")
+	}
+	busyTimeout := cfg.BusyTimeout
+	if busyTimeout <= 0 {
+		busyTimeout = defaultBusyTimeout
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "synchronous(NORMAL)")
+	params.Add("_pragma", "busy_timeout("+strconv.FormatInt(busyTimeout.Milliseconds(), 10)+")")
+	// Take the write lock on BEGIN, otherwise two transactions upgrading
+	// from read to write fail with SQLITE_BUSY instead of waiting.
+	params.Set("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+cfg.Path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	err = db.PingContext(ctx)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func newStorage(ctx context.Context, db *sql.DB) (st *Storage, err error) {
+	st = &Storage{db: db}
+	for _, statement := range st.statements() {
+		*statement.stmt, err = db.PrepareContext(ctx, statement.query)
+		if err != nil {
+			st.closeStatements()
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+type statement struct {
+	stmt  **sql.Stmt
+	query string
+}
+
+func (st *Storage) statements() []statement {
+	return []statement{
+		{stmt: &st.getFullURL, query: templateGetFullURL},
+		{stmt: &st.getLink, query: templateGetLink},
+		{stmt: &st.insertShort, query: templateInsertShort},
+		{stmt: &st.insertLink, query: templateInsertLink},
+		{stmt: &st.checkExists, query: templateCheckExists},
+		{stmt: &st.updateShort, query: templateUpdateShort},
+		{stmt: &st.deleteShort, query: templateDeleteShort},
+		{stmt: &st.addToken, query: templateAddToken},
+		{stmt: &st.claimToken, query: templateClaimToken},
+		{stmt: &st.poolSize, query: templatePoolSize},
+		{stmt: &st.count, query: templateCount},
+		{stmt: &st.addClick, query: templateAddClick},
+		{stmt: &st.addClicks, query: templateAddClicks},
+		{stmt: &st.clicks, query: templateClicks},
+		{stmt: &st.topLinks, query: templateTopLinks},
+
+		{stmt: &st.insertWebhook, query: templateInsertWebhook},
+		{stmt: &st.webhooks, query: templateWebhooks},
+		{stmt: &st.deleteWebhook, query: templateDeleteWebhook},
+		{stmt: &st.deleteWebhookDeliveries, query: templateDeleteWebhookDeliveries},
+		{stmt: &st.insertDelivery, query: templateInsertDelivery},
+		{stmt: &st.dueDeliveries, query: templateDueDeliveries},
+		{stmt: &st.leaseDelivery, query: templateLeaseDelivery},
+		{stmt: &st.updateDelivery, query: templateUpdateDelivery},
+		{stmt: &st.deleteDelivery, query: templateDeleteDelivery},
+		{stmt: &st.deadDeliveries, query: templateDeadDeliveries},
+		{stmt: &st.replayDelivery, query: templateReplayDelivery},
+
+		{stmt: &st.saveCampaign, query: templateSaveCampaign},
+		{stmt: &st.campaign, query: templateCampaign},
+		{stmt: &st.campaigns, query: templateCampaigns},
+		{stmt: &st.deleteCampaign, query: templateDeleteCampaign},
+		{stmt: &st.campaignClicks, query: templateCampaignClicks},
+	}
+}
+
+func (st *Storage) GetFullURL(ctx context.Context,
+	token string,
+) (fullURL string, found bool, err error) {
+	err = st.getFullURL.QueryRowContext(ctx, token).Scan(&fullURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return fullURL, true, nil
+}
+
+func (st *Storage) GetWithAttributes(ctx context.Context,
+	token string,
+) (fullURL string, attrs storage.Attributes, found bool, err error) {
+	var encoded []byte
+	err = st.getLink.QueryRowContext(ctx, token).Scan(&fullURL, &encoded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", storage.Attributes{}, false, nil
+	}
+	if err != nil {
+		return "", storage.Attributes{}, false, err
+	}
+	attrs, err = storage.UnmarshalAttributes(encoded)
+	if err != nil {
+		return "", storage.Attributes{}, false, err
+	}
+	return fullURL, attrs, true, nil
+}
+
+func (st *Storage) CreateShortURL(ctx context.Context, fullURL string,
+	token string,
+) (err error) {
+	_, err = st.insertShort.ExecContext(ctx, token, fullURL)
+	return insertError(err)
+}
+
+func (st *Storage) CreateWithAttributes(ctx context.Context, fullURL string,
+	token string, attrs storage.Attributes,
+) (err error) {
+	return st.insert(ctx, st.insertLink, &storage.NewLink{Token: token, FullURL: fullURL, Attributes: attrs})
+}
+
+// CreateBatch inserts links in one transaction. A failed insert only undoes
+// itself in SQLite, so the other links are still committed.
+func (st *Storage) CreateBatch(ctx context.Context,
+	links []storage.NewLink,
+) (errs []error, err error) {
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	stmt := tx.StmtContext(ctx, st.insertLink)
+	errs = make([]error, len(links))
+	for i := range links {
+		errs[i] = st.insert(ctx, stmt, &links[i])
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+func (st *Storage) insert(ctx context.Context, stmt *sql.Stmt, link *storage.NewLink) error {
+	encoded, err := storage.MarshalAttributes(link.Attributes)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, link.Token, link.FullURL, nullable(encoded))
+	return insertError(err)
+}
+
+// nullable keeps the attributes of a link without them NULL.
+func nullable(encoded []byte) any {
+	if encoded == nil {
+		return nil
+	}
+	return string(encoded)
+}
+
+func insertError(err error) error {
+	var sqliteErr *driver.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY {
+		return fmt.Errorf("%w: %w", storage.ErrTokenExists, err)
+	}
+	return err
+}
+
+func (st *Storage) AlreadyExists(ctx context.Context,
+	fullURL string,
+) (token string, found bool, err error) {
+	err = st.checkExists.QueryRowContext(ctx, fullURL).Scan(&token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return token, true, nil
+}
+
+func (st *Storage) UpdateShortURL(ctx context.Context, token string,
+	fullURL string,
+) (found bool, err error) {
+	res, err := st.updateShort.ExecContext(ctx, token, fullURL)
+	return affectedAny(res, err)
+}
+
+func (st *Storage) DeleteShortURL(ctx context.Context,
+	token string,
+) (found bool, err error) {
+	res, err := st.deleteShort.ExecContext(ctx, token)
+	return affectedAny(res, err)
+}
+
+func affectedAny(res sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// AddTokens inserts tokens one by one in a single transaction, SQLite has
+// no array parameters to do it in one statement.
+func (st *Storage) AddTokens(ctx context.Context,
+	tokens []string,
+) (added int, err error) {
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	stmt := tx.StmtContext(ctx, st.addToken)
+	var res sql.Result
+	var affected int64
+	for _, token := range tokens {
+		res, err = stmt.ExecContext(ctx, token)
+		if err != nil {
+			return 0, err
+		}
+		affected, err = res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		added += int(affected)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+func (st *Storage) ClaimToken(ctx context.Context) (token string, found bool, err error) {
+	err = st.claimToken.QueryRowContext(ctx).Scan(&token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return token, true, nil
+}
+
+func (st *Storage) PoolSize(ctx context.Context) (size int, err error) {
+	err = st.poolSize.QueryRowContext(ctx).Scan(&size)
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+func (st *Storage) Count(ctx context.Context) (count int, err error) {
+	err = st.count.QueryRowContext(ctx).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (st *Storage) AddClick(ctx context.Context, token string) (err error) {
+	_, err = st.addClick.ExecContext(ctx, token)
+	return err
+}
+
+// AddClicks updates the links of all tokens in one transaction, so that the
+// file is synced once.
+func (st *Storage) AddClicks(ctx context.Context, clicks map[string]int64) (err error) {
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	addClicks := tx.StmtContext(ctx, st.addClicks)
+	for token, count := range clicks {
+		_, err = addClicks.ExecContext(ctx, count, token)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (st *Storage) Clicks(ctx context.Context, token string) (clicks int64, err error) {
+	err = st.clicks.QueryRowContext(ctx, token).Scan(&clicks)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return clicks, nil
+}
+
+func (st *Storage) TopLinks(ctx context.Context, limit int) (links []storage.Link, err error) {
+	rows, err := st.topLinks.QueryContext(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	for rows.Next() {
+		var link storage.Link
+		var encoded []byte
+		err = rows.Scan(&link.Token, &link.FullURL, &link.Clicks, &encoded)
+		if err != nil {
+			return nil, err
+		}
+		link.Attributes, err = storage.UnmarshalAttributes(encoded)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (st *Storage) Close() error {
+	st.closeStatements()
+	return st.db.Close()
+}
+
+func (st *Storage) closeStatements() {
+	for _, statement := range st.statements() {
+		if *statement.stmt != nil {
+			_ = (*statement.stmt).Close()
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package sqlite
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilyakharev/url-short/internal/storage/migrate"
+)
+
+const (
+	fullURL = "https://mai.ru"
+	token   = "mai"
+)
+
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	st, err := New(context.Background(), Config{Path: filepath.Join(t.TempDir(), "url_short.db")})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = st.Close()
+	})
+	return st
+}
+
+func TestStorage(t *testing.T) {
+	t.Run("create and get", func(t *testing.T) {
+		st := newTestStorage(t)
+		ctx := context.Background()
+
+		_, found, err := st.GetFullURL(ctx, token)
+		require.NoError(t, err)
+		assert.False(t, found)
+
+		err = st.CreateShortURL(ctx, fullURL, token)
+		require.NoError(t, err)
+
+		url, found, err := st.GetFullURL(ctx, token)
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, fullURL, url)
+	})
+	t.Run("duplicate token", func(t *testing.T) {
+		st := newTestStorage(t)
+		ctx := context.Background()
+
+		require.NoError(t, st.CreateShortURL(ctx, fullURL, token))
+		assert.Error(t, st.CreateShortURL(ctx, "https://ya.ru", token))
+	})
+	t.Run("already exists", func(t *testing.T) {
+		st := newTestStorage(t)
+		ctx := context.Background()
+
+		_, found, err := st.AlreadyExists(ctx, fullURL)
+		require.NoError(t, err)
+		assert.False(t, found)
+
+		require.NoError(t, st.CreateShortURL(ctx, fullURL, token))
+
+		existing, found, err := st.AlreadyExists(ctx, fullURL)
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, token, existing)
+	})
+	t.Run("update and delete", func(t *testing.T) {
+		st := newTestStorage(t)
+		ctx := context.Background()
+
+		found, err := st.UpdateShortURL(ctx, token, fullURL)
+		require.NoError(t, err)
+		assert.False(t, found)
+
+		require.NoError(t, st.CreateShortURL(ctx, fullURL, token))
+		found, err = st.UpdateShortURL(ctx, token, "https://ya.ru")
+		require.NoError(t, err)
+		assert.True(t, found)
+		url, _, err := st.GetFullURL(ctx, token)
+		require.NoError(t, err)
+		assert.Equal(t, "https://ya.ru", url)
+
+		found, err = st.DeleteShortURL(ctx, token)
+		require.NoError(t, err)
+		assert.True(t, found)
+		_, found, err = st.GetFullURL(ctx, token)
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+	t.Run("count", func(t *testing.T) {
+		st := newTestStorage(t)
+		ctx := context.Background()
+
+		require.NoError(t, st.CreateShortURL(ctx, fullURL, token))
+		count, err := st.Count(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+	t.Run("persists after reopen", func(t *testing.T) {
+		ctx := context.Background()
+		cfg := Config{Path: filepath.Join(t.TempDir(), "url_short.db")}
+
+		st, err := New(ctx, cfg)
+		require.NoError(t, err)
+		require.NoError(t, st.CreateShortURL(ctx, fullURL, token))
+		require.NoError(t, st.Close())
+
+		st, err = New(ctx, cfg)
+		require.NoError(t, err)
+		defer func() {
+			_ = st.Close()
+		}()
+		url, found, err := st.GetFullURL(ctx, token)
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, fullURL, url)
+	})
+}
+
+func TestClicks(t *testing.T) {
+	st := newTestStorage(t)
+	ctx := context.Background()
+	require.NoError(t, st.CreateShortURL(ctx, fullURL, token))
+	require.NoError(t, st.CreateShortURL(ctx, "https://ya.ru", "ya"))
+	require.NoError(t, st.CreateShortURL(ctx, "https://go.dev", "go"))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, st.AddClick(ctx, "ya"))
+	}
+	require.NoError(t, st.AddClick(ctx, token))
+
+	clicks, err := st.Clicks(ctx, "ya")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), clicks)
+	clicks, err = st.Clicks(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Zero(t, clicks)
+
+	links, err := st.TopLinks(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	assert.Equal(t, "ya", links[0].Token)
+	assert.Equal(t, "https://ya.ru", links[0].FullURL)
+	assert.Equal(t, token, links[1].Token)
+	assert.Equal(t, int64(1), links[1].Clicks)
+}
+
+func TestTokenPool(t *testing.T) {
+	st := newTestStorage(t)
+	ctx := context.Background()
+	require.NoError(t, st.CreateShortURL(ctx, fullURL, "used"))
+
+	added, err := st.AddTokens(ctx, []string{"a", "b", "a", "used"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+
+	size, err := st.PoolSize(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, size)
+
+	claimed := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		claim, found, err := st.ClaimToken(ctx)
+		require.NoError(t, err)
+		require.True(t, found)
+		claimed[claim] = true
+	}
+	assert.Equal(t, map[string]bool{"a": true, "b": true}, claimed)
+
+	_, found, err := st.ClaimToken(ctx)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestWALMode(t *testing.T) {
+	st := newTestStorage(t)
+
+	var mode string
+	err := st.db.QueryRowContext(context.Background(), `PRAGMA journal_mode`).Scan(&mode)
+	require.NoError(t, err)
+	assert.Equal(t, "wal", mode)
+}
+
+func TestSkipMigrations(t *testing.T) {
+	ctx := context.Background()
+	_, err := New(ctx, Config{
+		Path:           filepath.Join(t.TempDir(), "url_short.db"),
+		SkipMigrations: true,
+	})
+	assert.ErrorIs(t, err, migrate.ErrPendingMigrations)
+}
+
+func TestMigrationsMatchPostgres(t *testing.T) {
+	sqliteFS, err := fs.Sub(migrations, "migrations")
+	require.NoError(t, err)
+	sqliteMigrations, err := migrate.Load(sqliteFS)
+	require.NoError(t, err)
+	postgresMigrations, err := migrate.Load(os.DirFS("../postgres/migrations"))
+	require.NoError(t, err)
+
+	require.Len(t, sqliteMigrations, len(postgresMigrations))
+	for i := range sqliteMigrations {
+		assert.Equal(t, postgresMigrations[i].Version, sqliteMigrations[i].Version)
+		assert.Equal(t, postgresMigrations[i].Name, sqliteMigrations[i].Name)
+		assert.NotEmpty(t, sqliteMigrations[i].Down)
+	}
+}
+
+func TestMigrateDown(t *testing.T) {
+	st := newTestStorage(t)
+	ctx := context.Background()
+
+	migrator, err := Migrator(st.db)
+	require.NoError(t, err)
+	for i := 0; i < 7; i++ {
+		_, err = migrator.Down(ctx)
+		require.NoError(t, err)
+	}
+	_, err = migrator.Down(ctx)
+	assert.ErrorIs(t, err, migrate.ErrNothingToRollback)
+
+	applied, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, 7)
+}
@@ -0,0 +1,182 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+const deliveryColumns = `id, webhook_id, tenant, event, payload, attempts, next_attempt_at, last_error, dead, created_at`
+
+const (
+	templateInsertWebhook = `
+INSERT INTO webhooks(id, tenant, url, secret, events, click_sample_rate, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)`
+	templateWebhooks = `
+SELECT id, tenant, url, secret, events, click_sample_rate, created_at FROM webhooks
+WHERE ?1 = '' OR tenant = ?1 ORDER BY created_at, id`
+	templateDeleteWebhook           = `DELETE FROM webhooks WHERE id = ? AND tenant = ?`
+	templateDeleteWebhookDeliveries = `DELETE FROM webhook_deliveries WHERE webhook_id = ?`
+	templateInsertDelivery          = `
+INSERT INTO webhook_deliveries(` + deliveryColumns + `)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	templateDueDeliveries = `
+SELECT ` + deliveryColumns + ` FROM webhook_deliveries
+WHERE dead = 0 AND next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?`
+	templateLeaseDelivery  = `UPDATE webhook_deliveries SET next_attempt_at = ?2 WHERE id = ?1`
+	templateUpdateDelivery = `
+UPDATE webhook_deliveries SET attempts = ?2, next_attempt_at = ?3, last_error = ?4, dead = ?5
+WHERE id = ?1`
+	templateDeleteDelivery = `DELETE FROM webhook_deliveries WHERE id = ?`
+	templateDeadDeliveries = `
+SELECT ` + deliveryColumns + ` FROM webhook_deliveries
+WHERE dead = 1 AND tenant = ? ORDER BY created_at DESC, id DESC LIMIT ?`
+	templateReplayDelivery = `
+UPDATE webhook_deliveries SET dead = 0, attempts = 0, last_error = '', next_attempt_at = ?3
+WHERE id = ?1 AND tenant = ?2 AND dead = 1`
+)
+
+func (st *Storage) CreateWebhook(ctx context.Context, webhook *storage.Webhook) (err error) {
+	_, err = st.insertWebhook.ExecContext(ctx, webhook.ID, webhook.Tenant, webhook.URL, webhook.Secret,
+		strings.Join(webhook.Events, ","), webhook.ClickSampleRate, webhook.CreatedAt.UnixNano())
+	return insertError(err)
+}
+
+func (st *Storage) Webhooks(ctx context.Context, tenant string) (webhooks []storage.Webhook, err error) {
+	rows, err := st.webhooks.QueryContext(ctx, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var webhook storage.Webhook
+		var events string
+		var createdAt int64
+		err = rows.Scan(&webhook.ID, &webhook.Tenant, &webhook.URL, &webhook.Secret, &events,
+			&webhook.ClickSampleRate, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		webhook.Events = strings.Split(events, ",")
+		webhook.CreatedAt = time.Unix(0, createdAt)
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (st *Storage) DeleteWebhook(ctx context.Context, tenant string, id string) (found bool, err error) {
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	found, err = affectedAny(tx.StmtContext(ctx, st.deleteWebhook).ExecContext(ctx, id, tenant))
+	if err != nil || !found {
+		return false, err
+	}
+	_, err = tx.StmtContext(ctx, st.deleteWebhookDeliveries).ExecContext(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (st *Storage) EnqueueDeliveries(ctx context.Context, deliveries []storage.WebhookDelivery) (err error) {
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	stmt := tx.StmtContext(ctx, st.insertDelivery)
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		_, err = stmt.ExecContext(ctx, delivery.ID, delivery.WebhookID, delivery.Tenant, delivery.Event,
+			delivery.Payload, delivery.Attempts, delivery.NextAttemptAt.UnixNano(), delivery.LastError,
+			delivery.Dead, delivery.CreatedAt.UnixNano())
+		if err != nil {
+			return insertError(err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ClaimDeliveries selects and leases the deliveries in one transaction,
+// which takes the write lock on BEGIN, so two claims never get the same
+// delivery.
+func (st *Storage) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration,
+	limit int,
+) (deliveries []storage.WebhookDelivery, err error) {
+	tx, err := st.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	deliveries, err = queryDeliveries(tx.StmtContext(ctx, st.dueDeliveries).QueryContext(ctx, now.UnixNano(), limit))
+	if err != nil {
+		return nil, err
+	}
+	stmt := tx.StmtContext(ctx, st.leaseDelivery)
+	for i := range deliveries {
+		_, err = stmt.ExecContext(ctx, deliveries[i].ID, now.Add(lease).UnixNano())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return deliveries, tx.Commit()
+}
+
+func (st *Storage) UpdateDelivery(ctx context.Context, delivery *storage.WebhookDelivery) (err error) {
+	_, err = st.updateDelivery.ExecContext(ctx, delivery.ID, delivery.Attempts,
+		delivery.NextAttemptAt.UnixNano(), delivery.LastError, delivery.Dead)
+	return err
+}
+
+func (st *Storage) DeleteDelivery(ctx context.Context, id string) (err error) {
+	_, err = st.deleteDelivery.ExecContext(ctx, id)
+	return err
+}
+
+func (st *Storage) DeadDeliveries(ctx context.Context, tenant string,
+	limit int,
+) (deliveries []storage.WebhookDelivery, err error) {
+	return queryDeliveries(st.deadDeliveries.QueryContext(ctx, tenant, limit))
+}
+
+func (st *Storage) ReplayDelivery(ctx context.Context, tenant string, id string,
+	now time.Time,
+) (found bool, err error) {
+	return affectedAny(st.replayDelivery.ExecContext(ctx, id, tenant, now.UnixNano()))
+}
+
+func queryDeliveries(rows *sql.Rows, err error) (deliveries []storage.WebhookDelivery, _ error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var delivery storage.WebhookDelivery
+		var nextAttemptAt, createdAt int64
+		err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Tenant, &delivery.Event,
+			&delivery.Payload, &delivery.Attempts, &nextAttemptAt, &delivery.LastError, &delivery.Dead,
+			&createdAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.NextAttemptAt = time.Unix(0, nextAttemptAt)
+		delivery.CreatedAt = time.Unix(0, createdAt)
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
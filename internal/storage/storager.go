@@ -1,6 +1,22 @@
 package storage
 
-import "context"
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrUnavailable is wrapped into errors of storages that can not reach the
+// backend they persist links to, so that clients can retry later.
+var ErrUnavailable = errors.New("storage is unavailable")
+
+// ErrTokenExists is wrapped into the error of CreateShortURL when the token
+// is already used by another link, the link is left unchanged.
+var ErrTokenExists = errors.New("token already exists")
+
+// ErrLinkTooLarge is returned by storages that bound the size of a link,
+// when its URL and attributes do not fit.
+var ErrLinkTooLarge = errors.New("link is too large")
 
 //go:generate mockgen -source=storager.go -destination=./mock/storager.go
 type Storager interface {
@@ -9,3 +25,87 @@ type Storager interface {
 	AlreadyExists(ctx context.Context, fullURL string) (token string, found bool, err error)
 	Close() error
 }
+
+// TokenPooler is implemented by storages able to keep a pool of
+// pre-generated tokens that are not used by any link yet.
+type TokenPooler interface {
+	// AddTokens puts tokens into the pool, skipping the ones that are
+	// already pooled or used by a link.
+	AddTokens(ctx context.Context, tokens []string) (added int, err error)
+	// ClaimToken atomically removes one unused token from the pool.
+	ClaimToken(ctx context.Context) (token string, found bool, err error)
+	PoolSize(ctx context.Context) (size int, err error)
+}
+
+// Counter is implemented by storages able to count stored links.
+type Counter interface {
+	Count(ctx context.Context) (count int, err error)
+}
+
+// Editor is implemented by storages able to change or remove existing links.
+type Editor interface {
+	// UpdateShortURL points token to another full URL.
+	UpdateShortURL(ctx context.Context, token string, fullURL string) (found bool, err error)
+	DeleteShortURL(ctx context.Context, token string) (found bool, err error)
+}
+
+// ClickCounter is implemented by storages that count redirects per link.
+type ClickCounter interface {
+	AddClick(ctx context.Context, token string) (err error)
+	Clicks(ctx context.Context, token string) (clicks int64, err error)
+}
+
+// ClickBatcher is implemented by click counters able to add the clicks of
+// many links in one write.
+type ClickBatcher interface {
+	AddClicks(ctx context.Context, clicks map[string]int64) (err error)
+}
+
+// Link is a stored link with the number of redirects to it.
+type Link struct {
+	Token      string
+	FullURL    string
+	Clicks     int64
+	Attributes Attributes
+}
+
+// TopLinker is implemented by storages that can list links by popularity.
+type TopLinker interface {
+	// TopLinks returns at most limit links, the most clicked first.
+	TopLinks(ctx context.Context, limit int) (links []Link, err error)
+}
+
+// EvictionReporter is implemented by storages that drop links when full.
+type EvictionReporter interface {
+	// Evicted reports if token is not found because it was evicted.
+	Evicted(ctx context.Context, token string) (evicted bool, err error)
+}
+
+// Backuper is implemented by storages able to write a consistent copy of
+// the database while serving requests.
+type Backuper interface {
+	Backup(ctx context.Context, w io.Writer) (written int64, err error)
+}
+
+// Wrapper is implemented by storages decorating another storage.
+type Wrapper interface {
+	Unwrap() Storager
+}
+
+// As finds the first storage in the chain of wrappers that implements T,
+// the way errors.As does for errors. Decorators hide optional interfaces of
+// the storage they wrap, so use As instead of a type assertion.
+func As[T any](st Storager) (T, bool) {
+	for st != nil {
+		if capable, ok := st.(T); ok {
+			return capable, true
+		}
+		wrapper, ok := st.(Wrapper)
+		if !ok {
+			break
+		}
+		st = wrapper.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
@@ -0,0 +1,721 @@
+// Package storagetest checks that a storage keeps the contract of
+// storage.Storager and of the optional interfaces it implements. Every
+// backend runs it from its own tests.
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+// eventually bounds waiting for clicks and counts, which storages may
+// update in the background.
+const eventually = 5 * time.Second
+
+// Factory returns a new empty storage. The suite closes it.
+type Factory func(t *testing.T) storage.Storager
+
+// Run checks the storages returned by newStorage. Optional interfaces are
+// found with storage.As and checked only if the storage has them.
+func Run(t *testing.T, newStorage Factory) {
+	open := func(t *testing.T) storage.Storager {
+		t.Helper()
+		st := newStorage(t)
+		t.Cleanup(func() {
+			_ = st.Close()
+		})
+		return st
+	}
+
+	t.Run("not found", func(t *testing.T) { testNotFound(t, open(t)) })
+	t.Run("create and get", func(t *testing.T) { testCreate(t, open(t)) })
+	t.Run("dedupe", func(t *testing.T) { testDedupe(t, open(t)) })
+	t.Run("collision", func(t *testing.T) { testCollision(t, open(t)) })
+	t.Run("concurrent", func(t *testing.T) { testConcurrent(t, open(t)) })
+	t.Run("concurrent collision", func(t *testing.T) { testConcurrentCollision(t, open(t)) })
+	t.Run("canceled context", func(t *testing.T) { testCanceled(t, open(t)) })
+	t.Run("close", func(t *testing.T) { testClose(t, newStorage(t)) })
+
+	optional := []struct {
+		name string
+		has  func(st storage.Storager) bool
+		test func(t *testing.T, st storage.Storager)
+	}{
+		{name: "edit", has: has[storage.Editor], test: testEdit},
+		{name: "count", has: has[storage.Counter], test: testCount},
+		{name: "token pool", has: has[storage.TokenPooler], test: testTokenPool},
+		{name: "clicks", has: has[storage.ClickCounter], test: testClicks},
+		{name: "click batches", has: has[storage.ClickCounter], test: testClickBatches},
+		{name: "top links", has: has[storage.TopLinker], test: testTopLinks},
+		{name: "backup", has: has[storage.Backuper], test: testBackup},
+		{name: "eviction", has: has[storage.EvictionReporter], test: testEviction},
+		{name: "attributes", has: has[storage.AttributeStorer], test: testAttributes},
+		{name: "batch", has: has[storage.BatchCreator], test: testBatch},
+		{name: "webhooks", has: has[storage.WebhookStorer], test: testWebhooks},
+		{name: "campaigns", has: has[storage.CampaignStorer], test: testCampaigns},
+		{name: "campaign clicks", has: has[storage.CampaignCounter], test: testCampaignClicks},
+	}
+	for _, tt := range optional {
+		t.Run(tt.name, func(t *testing.T) {
+			st := open(t)
+			if !tt.has(st) {
+				t.Skip("not implemented")
+			}
+			tt.test(t, st)
+		})
+	}
+}
+
+func has[T any](st storage.Storager) bool {
+	_, ok := storage.As[T](st)
+	return ok
+}
+
+func requireLink(t *testing.T, st storage.Storager, token string, expected string) {
+	t.Helper()
+	fullURL, found, err := st.GetFullURL(context.Background(), token)
+	require.NoError(t, err)
+	require.True(t, found, "token %q is not found", token)
+	assert.Equal(t, expected, fullURL)
+}
+
+func requireNoLink(t *testing.T, st storage.Storager, token string) {
+	t.Helper()
+	fullURL, found, err := st.GetFullURL(context.Background(), token)
+	require.NoError(t, err)
+	assert.False(t, found, "token %q is found", token)
+	assert.Empty(t, fullURL)
+}
+
+func testNotFound(t *testing.T, st storage.Storager) {
+	requireNoLink(t, st, "unknown")
+
+	token, found, err := st.AlreadyExists(context.Background(), "https://unknown.ru")
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Empty(t, token)
+}
+
+func testCreate(t *testing.T, st storage.Storager) {
+	ctx := context.Background()
+	require.NoError(t, st.CreateShortURL(ctx, "https://mai.ru", "mai"))
+	require.NoError(t, st.CreateShortURL(ctx, "https://ya.ru/search?q=go#top", "ya"))
+
+	requireLink(t, st, "mai", "https://mai.ru")
+	requireLink(t, st, "ya", "https://ya.ru/search?q=go#top")
+	requireNoLink(t, st, "MAI")
+}
+
+func testDedupe(t *testing.T, st storage.Storager) {
+	ctx := context.Background()
+	require.NoError(t, st.CreateShortURL(ctx, "https://mai.ru", "mai"))
+
+	token, found, err := st.AlreadyExists(ctx, "https://mai.ru")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "mai", token)
+
+	_, found, err = st.AlreadyExists(ctx, "https://mai.ru/other")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func testCollision(t *testing.T, st storage.Storager) {
+	ctx := context.Background()
+	require.NoError(t, st.CreateShortURL(ctx, "https://mai.ru", "mai"))
+
+	err := st.CreateShortURL(ctx, "https://ya.ru", "mai")
+	require.ErrorIs(t, err, storage.ErrTokenExists)
+	requireLink(t, st, "mai", "https://mai.ru")
+
+	_, found, err := st.AlreadyExists(ctx, "https://ya.ru")
+	require.NoError(t, err)
+	assert.False(t, found, "the URL of a failed create must not be indexed")
+}
+
+func testConcurrent(t *testing.T, st storage.Storager) {
+	const workers, links = 8, 25
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < links; i++ {
+				token := "w" + strconv.Itoa(w) + "l" + strconv.Itoa(i)
+				assert.NoError(t, st.CreateShortURL(ctx, "https://mai.ru/"+token, token))
+				fullURL, found, err := st.GetFullURL(ctx, token)
+				assert.NoError(t, err)
+				assert.True(t, found)
+				assert.Equal(t, "https://mai.ru/"+token, fullURL)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for w := 0; w < workers; w++ {
+		for i := 0; i < links; i++ {
+			token := "w" + strconv.Itoa(w) + "l" + strconv.Itoa(i)
+			requireLink(t, st, token, "https://mai.ru/"+token)
+		}
+	}
+	if counter, ok := storage.As[storage.Counter](st); ok {
+		requireCount(t, counter, workers*links)
+	}
+}
+
+func testConcurrentCollision(t *testing.T, st storage.Storager) {
+	const workers = 8
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make([]error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			errs[w] = st.CreateShortURL(ctx, "https://mai.ru/"+strconv.Itoa(w), "race")
+		}(w)
+	}
+	wg.Wait()
+
+	winner := -1
+	for w, err := range errs {
+		if err == nil {
+			require.Equal(t, -1, winner, "token is created twice")
+			winner = w
+			continue
+		}
+		assert.ErrorIs(t, err, storage.ErrTokenExists)
+	}
+	require.NotEqual(t, -1, winner, "token is not created")
+	requireLink(t, st, "race", "https://mai.ru/"+strconv.Itoa(winner))
+}
+
+func testCanceled(t *testing.T, st storage.Storager) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Storages that do not wait for anything may ignore the context, but a
+	// failed call must report the cancellation and change nothing.
+	_, _, err := st.GetFullURL(ctx, "mai")
+	if err != nil {
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+	_, _, err = st.AlreadyExists(ctx, "https://mai.ru")
+	if err != nil {
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+	err = st.CreateShortURL(ctx, "https://mai.ru", "mai")
+	if err != nil {
+		assert.ErrorIs(t, err, context.Canceled)
+		requireNoLink(t, st, "mai")
+		return
+	}
+	requireLink(t, st, "mai", "https://mai.ru")
+}
+
+func testClose(t *testing.T, st storage.Storager) {
+	require.NoError(t, st.CreateShortURL(context.Background(), "https://mai.ru", "mai"))
+	require.NoError(t, st.Close())
+
+	// Calls after Close may fail, but must not hang or panic.
+	assert.NotPanics(t, func() {
+		_ = st.Close()
+	})
+	assert.NotPanics(t, func() {
+		_, _, _ = st.GetFullURL(context.Background(), "mai")
+	})
+}
+
+func testEdit(t *testing.T, st storage.Storager) {
+	ctx := context.Background()
+	editor, _ := storage.As[storage.Editor](st)
+	require.NoError(t, st.CreateShortURL(ctx, "https://mai.ru", "mai"))
+
+	found, err := editor.UpdateShortURL(ctx, "unknown", "https://ya.ru")
+	require.NoError(t, err)
+	assert.False(t, found)
+	requireNoLink(t, st, "unknown")
+
+	found, err = editor.UpdateShortURL(ctx, "mai", "https://mai.ru/new")
+	require.NoError(t, err)
+	assert.True(t, found)
+	requireLink(t, st, "mai", "https://mai.ru/new")
+	_, found, err = st.AlreadyExists(ctx, "https://mai.ru")
+	require.NoError(t, err)
+	assert.False(t, found, "the old URL must not be indexed")
+	token, found, err := st.AlreadyExists(ctx, "https://mai.ru/new")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "mai", token)
+
+	found, err = editor.DeleteShortURL(ctx, "mai")
+	require.NoError(t, err)
+	assert.True(t, found)
+	requireNoLink(t, st, "mai")
+	_, found, err = st.AlreadyExists(ctx, "https://mai.ru/new")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	found, err = editor.DeleteShortURL(ctx, "mai")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// A deleted token is free again.
+	require.NoError(t, st.CreateShortURL(ctx, "https://ya.ru", "mai"))
+	requireLink(t, st, "mai", "https://ya.ru")
+}
+
+func requireCount(t *testing.T, counter storage.Counter, expected int) {
+	t.Helper()
+	var count int
+	var err error
+	assert.Eventually(t, func() bool {
+		count, err = counter.Count(context.Background())
+		return err == nil && count == expected
+	}, eventually, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, expected, count)
+}
+
+func testCount(t *testing.T, st storage.Storager) {
+	ctx := context.Background()
+	counter, _ := storage.As[storage.Counter](st)
+	requireCount(t, counter, 0)
+
+	require.NoError(t, st.CreateShortURL(ctx, "https://mai.ru", "mai"))
+	require.NoError(t, st.CreateShortURL(ctx, "https://ya.ru", "ya"))
+	requireCount(t, counter, 2)
+
+	if editor, ok := storage.As[storage.Editor](st); ok {
+		_, err := editor.DeleteShortURL(ctx, "ya")
+		require.NoError(t, err)
+		requireCount(t, counter, 1)
+	}
+}
+
+func testTokenPool(t *testing.T, st storage.Storager) {
+	ctx := context.Background()
+	pool, _ := storage.As[storage.TokenPooler](st)
+	require.NoError(t, st.CreateShortURL(ctx, "https://mai.ru", "used"))
+
+	_, found, err := pool.ClaimToken(ctx)
+	require.NoError(t, err)
+	assert.False(t, found, "empty pool")
+
+	added, err := pool.AddTokens(ctx, []string{"p1", "p2"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, added)
+	added, err = pool.AddTokens(ctx, []string{"p1", "p3", "used"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, added, "pooled and used tokens must not be added")
+	size, err := pool.PoolSize(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, size)
+
+	claimed := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		token, found, err := pool.ClaimToken(ctx)
+		require.NoError(t, err)
+		require.True(t, found)
+		claimed[token] = true
+	}
+	assert.Equal(t, map[string]bool{"p1": true, "p2": true, "p3": true}, claimed)
+
+	// A pooled token taken by a link in the meantime is not handed out.
+	_, err = pool.AddTokens(ctx, []string{"p4"})
+	require.NoError(t, err)
+	require.NoError(t, st.CreateShortURL(ctx, "https://ya.ru", "p4"))
+	_, found, err = pool.ClaimToken(ctx)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func testClicks(t *testing.T, st storage.Storager) {
+	const clicks = 20
+	ctx := context.Background()
+	counter, _ := storage.As[storage.ClickCounter](st)
+	require.NoError(t, st.CreateShortURL(ctx, "https://mai.ru", "mai"))
+	require.NoError(t, st.CreateShortURL(ctx, "https://ya.ru", "ya"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < clicks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, counter.AddClick(ctx, "mai"))
+		}()
+	}
+	wg.Wait()
+
+	requireClicks(t, counter, "mai", clicks)
+	requireClicks(t, counter, "ya", 0)
+}
+
+func testClickBatches(t *testing.T, st storage.Storager) {
+	ctx := context.Background()
+	counter, _ := storage.As[storage.ClickCounter](st)
+	batcher, ok := counter.(storage.ClickBatcher)
+	if !ok {
+		t.Skip("clicks are added one by one")
+	}
+	require.NoError(t, st.CreateShortURL(ctx, "https://mai.ru", "mai"))
+	require.NoError(t, st.CreateShortURL(ctx, "https://ya.ru", "ya"))
+	require.NoError(t, counter.AddClick(ctx, "ya"))
+
+	require.NoError(t, batcher.AddClicks(ctx, map[string]int64{"mai": 3, "ya": 2}))
+	require.NoError(t, batcher.AddClicks(ctx, map[string]int64{"mai": 1}))
+	requireClicks(t, counter, "mai", 4)
+	requireClicks(t, counter, "ya", 3)
+}
+
+func requireClicks(t *testing.T, counter storage.ClickCounter, token string, expected int64) {
+	t.Helper()
+	var clicks int64
+	var err error
+	assert.Eventually(t, func() bool {
+		clicks, err = counter.Clicks(context.Background(), token)
+		return err == nil && clicks == expected
+	}, eventually, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.Equal(t, expected, clicks, token)
+}
+
+func testTopLinks(t *testing.T, st storage.Storager) {
+	ctx := context.Background()
+	topLinker, _ := storage.As[storage.TopLinker](st)
+	counter, ok := storage.As[storage.ClickCounter](st)
+	if !ok {
+		t.Skip("clicks are not counted")
+	}
+	for token, clicks := range map[string]int{"a": 3, "b": 1, "c": 2} {
+		require.NoError(t, st.CreateShortURL(ctx, "https://"+token+".ru", token))
+		for i := 0; i < clicks; i++ {
+			require.NoError(t, counter.AddClick(ctx, token))
+		}
+	}
+	requireClicks(t, counter, "a", 3)
+	requireClicks(t, counter, "b", 1)
+	requireClicks(t, counter, "c", 2)
+
+	links, err := topLinker.TopLinks(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.Link{
+		{Token: "a", FullURL: "https://a.ru", Clicks: 3},
+		{Token: "c", FullURL: "https://c.ru", Clicks: 2},
+	}, links)
+
+	links, err = topLinker.TopLinks(ctx, 10)
+	require.NoError(t, err)
+	assert.Len(t, links, 3)
+}
+
+func testBackup(t *testing.T, st storage.Storager) {
+	ctx := context.Background()
+	backuper, _ := storage.As[storage.Backuper](st)
+	require.NoError(t, st.CreateShortURL(ctx, "https://mai.ru", "mai"))
+
+	var buf bytes.Buffer
+	written, err := backuper.Backup(ctx, &buf)
+	require.NoError(t, err)
+	assert.Positive(t, written)
+	assert.Equal(t, int64(buf.Len()), written)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = backuper.Backup(canceled, &bytes.Buffer{})
+	if err != nil {
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+}
+
+func testEviction(t *testing.T, st storage.Storager) {
+	ctx := context.Background()
+	reporter, _ := storage.As[storage.EvictionReporter](st)
+	require.NoError(t, st.CreateShortURL(ctx, "https://mai.ru", "mai"))
+
+	for _, token := range []string{"mai", "unknown"} {
+		evicted, err := reporter.Evicted(ctx, token)
+		require.NoError(t, err)
+		assert.False(t, evicted, token)
+	}
+}
+
+func testAttributes(t *testing.T, st storage.Storager) {
+	ctx := context.Background()
+	attributer, _ := storage.As[storage.AttributeStorer](st)
+	attrs := storage.Attributes{
+		ExpiresAt:    time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tags:         []string{"promo", "spring"},
+		Tenant:       "acme",
+		RedirectCode: http.StatusPermanentRedirect,
+
+		QueryPassthrough: storage.QueryAppend,
+		PathPassthrough:  true,
+		UTM:              storage.UTM{Source: "newsletter", Medium: "email", Campaign: "spring_sale"},
+	}
+
+	require.NoError(t, attributer.CreateWithAttributes(ctx, "https://a.ru", "a", attrs))
+	require.NoError(t, st.CreateShortURL(ctx, "https://b.ru", "b"))
+	err := attributer.CreateWithAttributes(ctx, "https://c.ru", "a", storage.Attributes{Tags: []string{"c"}})
+	require.ErrorIs(t, err, storage.ErrTokenExists)
+
+	fullURL, stored, found, err := attributer.GetWithAttributes(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "https://a.ru", fullURL)
+	assert.Equal(t, attrs, stored)
+	requireLink(t, st, "a", "https://a.ru")
+
+	_, stored, found, err = attributer.GetWithAttributes(ctx, "b")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.True(t, stored.IsZero())
+
+	_, _, found, err = attributer.GetWithAttributes(ctx, "missing")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	if editor, ok := storage.As[storage.Editor](st); ok {
+		_, err = editor.DeleteShortURL(ctx, "a")
+		require.NoError(t, err)
+		require.NoError(t, st.CreateShortURL(ctx, "https://a.ru", "a"))
+		_, stored, _, err = attributer.GetWithAttributes(ctx, "a")
+		require.NoError(t, err)
+		assert.True(t, stored.IsZero(), "attributes must be deleted with the link")
+	}
+}
+
+func testBatch(t *testing.T, st storage.Storager) {
+	ctx := context.Background()
+	batcher, _ := storage.As[storage.BatchCreator](st)
+	require.NoError(t, st.CreateShortURL(ctx, "https://taken.ru", "taken"))
+
+	links := []storage.NewLink{
+		{Token: "a", FullURL: "https://a.ru"},
+		{Token: "taken", FullURL: "https://b.ru"},
+		{Token: "c", FullURL: "https://c.ru"},
+		{Token: "a", FullURL: "https://d.ru"},
+	}
+	_, hasAttributes := storage.As[storage.AttributeStorer](st)
+	if hasAttributes {
+		links[2].Attributes = storage.Attributes{Tags: []string{"c"}}
+	}
+	errs, err := batcher.CreateBatch(ctx, links)
+	require.NoError(t, err)
+	require.Len(t, errs, len(links))
+	assert.NoError(t, errs[0])
+	assert.ErrorIs(t, errs[1], storage.ErrTokenExists)
+	assert.NoError(t, errs[2])
+	assert.ErrorIs(t, errs[3], storage.ErrTokenExists, "a token taken earlier in the batch")
+
+	requireLink(t, st, "a", "https://a.ru")
+	requireLink(t, st, "taken", "https://taken.ru")
+	requireLink(t, st, "c", "https://c.ru")
+	if hasAttributes {
+		_, attrs, _, err := storage.GetLink(ctx, st, "c")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"c"}, attrs.Tags)
+	}
+
+	errs, err = batcher.CreateBatch(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, errs)
+}
+
+func testWebhooks(t *testing.T, st storage.Storager) {
+	ctx := context.Background()
+	store, _ := storage.As[storage.WebhookStorer](st)
+	base := time.Unix(1700000000, 0)
+	webhooks := []storage.Webhook{
+		{ID: "w1", Tenant: "acme", URL: "https://acme.ru/hook", Secret: "s1",
+			Events: []string{"link.created", "link.clicked"}, ClickSampleRate: 0.5, CreatedAt: base},
+		{ID: "w2", Tenant: "other", URL: "https://other.ru/hook", Secret: "s2",
+			Events: []string{"link.deleted"}, CreatedAt: base.Add(time.Second)},
+	}
+	for i := range webhooks {
+		require.NoError(t, store.CreateWebhook(ctx, &webhooks[i]))
+	}
+	listed, err := store.Webhooks(ctx, "acme")
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.True(t, base.Equal(listed[0].CreatedAt))
+	listed[0].CreatedAt = base
+	assert.Equal(t, webhooks[0], listed[0])
+	listed, err = store.Webhooks(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, listed, 2)
+
+	deliveries := []storage.WebhookDelivery{
+		{ID: "d1", WebhookID: "w1", Tenant: "acme", Event: "link.created", Payload: []byte(`{"n":1}`),
+			NextAttemptAt: base, CreatedAt: base},
+		{ID: "d2", WebhookID: "w1", Tenant: "acme", Event: "link.created", Payload: []byte(`{"n":2}`),
+			NextAttemptAt: base.Add(time.Second), CreatedAt: base.Add(time.Second)},
+		{ID: "d3", WebhookID: "w1", Tenant: "acme", Event: "link.expired", Payload: []byte(`{"n":3}`),
+			NextAttemptAt: base.Add(time.Hour), CreatedAt: base},
+		{ID: "d4", WebhookID: "w2", Tenant: "other", Event: "link.deleted", Payload: []byte(`{"n":4}`),
+			NextAttemptAt: base, CreatedAt: base},
+	}
+	require.NoError(t, store.EnqueueDeliveries(ctx, deliveries))
+
+	now := base.Add(time.Minute)
+	claimed, err := store.ClaimDeliveries(ctx, now, time.Minute, 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"d1", "d4"}, deliveryIDs(claimed), "oldest due first")
+	assert.Equal(t, []byte(`{"n":1}`), claimed[0].Payload)
+	assert.Equal(t, "link.created", claimed[0].Event)
+	claimed, err = store.ClaimDeliveries(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"d2"}, deliveryIDs(claimed), "claimed deliveries are leased")
+
+	claimed[0].Attempts = 3
+	claimed[0].LastError = "500 Internal Server Error"
+	claimed[0].Dead = true
+	require.NoError(t, store.UpdateDelivery(ctx, &claimed[0]))
+	require.NoError(t, store.DeleteDelivery(ctx, "d1"))
+	claimed, err = store.ClaimDeliveries(ctx, now.Add(2*time.Minute), time.Hour, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d4"}, deliveryIDs(claimed), "dead and deleted deliveries are not claimed")
+
+	dead, err := store.DeadDeliveries(ctx, "acme", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"d2"}, deliveryIDs(dead))
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "500 Internal Server Error", dead[0].LastError)
+	dead, err = store.DeadDeliveries(ctx, "other", 10)
+	require.NoError(t, err)
+	assert.Empty(t, dead)
+
+	found, err := store.ReplayDelivery(ctx, "other", "d2", now)
+	require.NoError(t, err)
+	assert.False(t, found, "a delivery of another tenant")
+	found, err = store.ReplayDelivery(ctx, "acme", "d2", now.Add(3*time.Minute))
+	require.NoError(t, err)
+	assert.True(t, found)
+	claimed, err = store.ClaimDeliveries(ctx, now.Add(3*time.Minute), time.Minute, 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"d2"}, deliveryIDs(claimed))
+	assert.Zero(t, claimed[0].Attempts)
+	assert.False(t, claimed[0].Dead)
+	found, err = store.ReplayDelivery(ctx, "acme", "d2", now)
+	require.NoError(t, err)
+	assert.False(t, found, "only dead deliveries are replayed")
+
+	found, err = store.DeleteWebhook(ctx, "other", "w1")
+	require.NoError(t, err)
+	assert.False(t, found, "a webhook of another tenant")
+	found, err = store.DeleteWebhook(ctx, "acme", "w1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	claimed, err = store.ClaimDeliveries(ctx, base.Add(24*time.Hour), time.Minute, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d4"}, deliveryIDs(claimed), "deliveries are deleted with the webhook")
+	listed, err = store.Webhooks(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, "w2", listed[0].ID)
+}
+
+func testCampaigns(t *testing.T, st storage.Storager) {
+	ctx := context.Background()
+	store, _ := storage.As[storage.CampaignStorer](st)
+	base := time.Unix(1700000000, 0)
+	campaigns := []storage.Campaign{
+		{Tenant: "acme", Name: "spring", UTM: storage.UTM{Source: "newsletter", Campaign: "spring_sale"},
+			UpdatedAt: base},
+		{Tenant: "acme", Name: "autumn", UTM: storage.UTM{Medium: "cpc", Term: "shoes", Content: "banner"},
+			UpdatedAt: base},
+		{Tenant: "other", Name: "spring", UTM: storage.UTM{Source: "other"}, UpdatedAt: base},
+	}
+	for i := range campaigns {
+		require.NoError(t, store.SaveCampaign(ctx, &campaigns[i]))
+	}
+	updated := campaigns[0]
+	updated.UTM.Medium = "email"
+	updated.UpdatedAt = base.Add(time.Second)
+	require.NoError(t, store.SaveCampaign(ctx, &updated))
+
+	campaign, found, err := store.Campaign(ctx, "acme", "spring")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.True(t, updated.UpdatedAt.Equal(campaign.UpdatedAt))
+	campaign.UpdatedAt = updated.UpdatedAt
+	assert.Equal(t, updated, campaign, "saving a template again replaces it")
+
+	listed, err := store.Campaigns(ctx, "acme")
+	require.NoError(t, err)
+	require.Len(t, listed, 2)
+	assert.Equal(t, "autumn", listed[0].Name)
+	assert.Equal(t, campaigns[1].UTM, listed[0].UTM)
+
+	found, err = store.DeleteCampaign(ctx, "acme", "spring")
+	require.NoError(t, err)
+	assert.True(t, found)
+	found, err = store.DeleteCampaign(ctx, "acme", "spring")
+	require.NoError(t, err)
+	assert.False(t, found)
+	_, found, err = store.Campaign(ctx, "other", "spring")
+	require.NoError(t, err)
+	assert.True(t, found, "templates of other tenants are kept")
+}
+
+func testCampaignClicks(t *testing.T, st storage.Storager) {
+	ctx := context.Background()
+	campaigns, _ := storage.As[storage.CampaignCounter](st)
+	counter, ok := storage.As[storage.ClickCounter](st)
+	require.True(t, ok, "campaign clicks need click counts")
+	links := []storage.NewLink{
+		{Token: "a", FullURL: "https://a.ru", Attributes: storage.Attributes{Tenant: "acme",
+			UTM: storage.UTM{Source: "newsletter", Campaign: "spring_sale"}}},
+		{Token: "b", FullURL: "https://b.ru", Attributes: storage.Attributes{Tenant: "acme",
+			UTM: storage.UTM{Source: "ads", Campaign: "spring_sale"}}},
+		{Token: "c", FullURL: "https://c.ru", Attributes: storage.Attributes{Tenant: "acme",
+			UTM: storage.UTM{Campaign: "launch"}}},
+		{Token: "d", FullURL: "https://d.ru", Attributes: storage.Attributes{Tenant: "other",
+			UTM: storage.UTM{Campaign: "launch"}}},
+		{Token: "e", FullURL: "https://e.ru", Attributes: storage.Attributes{Tenant: "acme",
+			UTM: storage.UTM{Source: "no campaign"}}},
+	}
+	for i := range links {
+		require.NoError(t, storage.CreateLink(ctx, st, &links[i]))
+	}
+	for token, clicks := range map[string]int{"a": 2, "b": 1, "c": 1, "d": 4, "e": 5} {
+		for i := 0; i < clicks; i++ {
+			require.NoError(t, counter.AddClick(ctx, token))
+		}
+		requireClicks(t, counter, token, int64(clicks))
+	}
+
+	stats, err := campaigns.CampaignClicks(ctx, "acme")
+	require.NoError(t, err)
+	assert.Equal(t, []storage.CampaignClicks{
+		{Campaign: "spring_sale", Links: 2, Clicks: 3},
+		{Campaign: "launch", Links: 1, Clicks: 1},
+	}, stats)
+
+	stats, err = campaigns.CampaignClicks(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []storage.CampaignClicks{
+		{Campaign: "launch", Links: 2, Clicks: 5},
+		{Campaign: "spring_sale", Links: 2, Clicks: 3},
+	}, stats)
+}
+
+func deliveryIDs(deliveries []storage.WebhookDelivery) (ids []string) {
+	for i := range deliveries {
+		ids = append(ids, deliveries[i].ID)
+	}
+	return ids
+}
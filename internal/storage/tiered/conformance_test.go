@@ -0,0 +1,31 @@
+package tiered
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+	"github.com/ilyakharev/url-short/internal/storage/sqlite"
+	"github.com/ilyakharev/url-short/internal/storage/storagetest"
+)
+
+// The write-behind mode is not run, the cold tier only eventually has its
+// changes, so the token pool may hand out a token used moments ago.
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storager {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		cold, err := sqlite.New(ctx, sqlite.Config{Path: filepath.Join(t.TempDir(), "url_short.db")})
+		require.NoError(t, err)
+		st, err := New(ctx, inmemory.New(), cold, Config{ClickInterval: time.Millisecond}, zap.NewNop())
+		require.NoError(t, err)
+		go st.Run(ctx)
+		return st
+	})
+}
@@ -0,0 +1,643 @@
+package tiered
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/clicks"
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+)
+
+const (
+	defaultQueueSize     = 10_000
+	defaultWriteAttempts = 10
+	defaultRetryInterval = time.Second
+	maxRetryInterval     = 30 * time.Second
+
+	// writeTimeout bounds one attempt of a queued write.
+	writeTimeout = 5 * time.Second
+	// closeTimeout bounds flushing the queue on Close.
+	closeTimeout = 10 * time.Second
+)
+
+// WriteMode sets when a change is acknowledged.
+type WriteMode string
+
+const (
+	// WriteThrough acknowledges a change once the cold tier has it.
+	WriteThrough WriteMode = "write-through"
+	// WriteBehind acknowledges a change once the hot tier has it and queues
+	// it for the cold tier. Queued changes are lost on a crash.
+	WriteBehind WriteMode = "write-behind"
+)
+
+var tieredStats = expvar.NewMap("tiered")
+
+type Config struct {
+	// WarmLinks is how many of the most clicked links are loaded into the
+	// hot tier on start.
+	WarmLinks int
+	Mode      WriteMode
+	// QueueSize bounds the changes waiting for the cold tier.
+	QueueSize int
+	// WriteAttempts is how many times a queued change is tried before it is
+	// dropped.
+	WriteAttempts int
+	// RetryInterval is the first pause between attempts, it doubles after
+	// each failure. The cold tier is probed as often while it is down.
+	RetryInterval time.Duration
+	// ClickInterval is how often the clicks are written to the cold tier,
+	// every second when zero.
+	ClickInterval time.Duration
+}
+
+type writeKind uint8
+
+const (
+	writeCreate writeKind = iota
+	writeUpdate
+	writeDelete
+)
+
+func (kind writeKind) String() string {
+	return [...]string{"create", "update", "delete"}[kind]
+}
+
+type write struct {
+	kind    writeKind
+	token   string
+	fullURL string
+	attrs   storage.Attributes
+}
+
+// Tiered serves links from an in-memory hot tier and keeps them in a cold
+// persistent storage. Links missing in the hot tier are loaded from the cold
+// one on the first read. While the cold tier is down, links in the hot tier
+// are still redirected to, but changes fail with storage.ErrUnavailable.
+//
+// Clicks are always written to the cold tier in the background, summed per
+// token every Config.ClickInterval, and changes in the WriteBehind mode go
+// through a queue of their own, Run must be running for that. Clicks never
+// take room in the queue, so a burst of redirects does not fail creates.
+type Tiered struct {
+	hot    *inmemory.Inmemory
+	cold   storage.Storager
+	cfg    Config
+	logger *zap.Logger
+
+	// editor and clicks are nil when the cold tier does not support them.
+	editor storage.Editor
+	clicks storage.ClickCounter
+	// pendingClicks sums the clicks not written to the cold tier yet, it is
+	// nil when clicks stay in the hot tier.
+	pendingClicks *clicks.Counter
+
+	// fillMutex orders loading a link into the hot tier with changes of it,
+	// generation changes on every change, so that a link read from the cold
+	// tier before it is not put back.
+	fillMutex  sync.Mutex
+	generation uint64
+
+	// coldDown is set when a queued write fails and reset once the cold tier
+	// answers again.
+	coldDown atomic.Bool
+
+	// queueMutex guards sending to queue against closing it.
+	queueMutex sync.RWMutex
+	queue      chan write
+	closed     bool
+	closing    chan struct{}
+	running    atomic.Bool
+	stopped    chan struct{}
+}
+
+var (
+	_ storage.Storager     = &Tiered{}
+	_ storage.Editor       = &Tiered{}
+	_ storage.ClickCounter = &Tiered{}
+	_ storage.Wrapper      = &Tiered{}
+
+	_ storage.AttributeStorer = &Tiered{}
+	_ storage.BatchCreator    = &Tiered{}
+)
+
+// New warms hot with the most clicked links of cold. Both tiers are closed
+// with Tiered.
+func New(ctx context.Context, hot *inmemory.Inmemory, cold storage.Storager, cfg Config,
+	logger *zap.Logger,
+) (*Tiered, error) {
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = WriteThrough
+	case WriteThrough, WriteBehind:
+	default:
+		return nil, fmt.Errorf("unknown write mode %q", cfg.Mode)
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.WriteAttempts <= 0 {
+		cfg.WriteAttempts = defaultWriteAttempts
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaultRetryInterval
+	}
+
+	tiered := &Tiered{
+		hot:     hot,
+		cold:    cold,
+		cfg:     cfg,
+		logger:  logger,
+		queue:   make(chan write, cfg.QueueSize),
+		closing: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	tiered.editor, _ = storage.As[storage.Editor](cold)
+	tiered.clicks, _ = storage.As[storage.ClickCounter](cold)
+	if tiered.clicks != nil {
+		tiered.pendingClicks = clicks.NewCounter(tiered.clicks, cfg.ClickInterval, logger)
+	}
+	tiered.warm(ctx)
+	return tiered, nil
+}
+
+func (tiered *Tiered) warm(ctx context.Context) {
+	if tiered.cfg.WarmLinks <= 0 {
+		return
+	}
+	topLinker, ok := storage.As[storage.TopLinker](tiered.cold)
+	if !ok {
+		tiered.logger.Warn("cold storage can not list the most clicked links, hot tier starts empty")
+		return
+	}
+	links, err := topLinker.TopLinks(ctx, tiered.cfg.WarmLinks)
+	if err != nil {
+		tiered.logger.Warn("unable to warm hot tier", zap.Error(err))
+		return
+	}
+	for i := range links {
+		link := &links[i]
+		err = tiered.hot.CreateWithAttributes(ctx, link.FullURL, link.Token, link.Attributes)
+		if err != nil {
+			tiered.logger.Warn("unable to warm hot tier", zap.Error(err))
+			return
+		}
+	}
+	tiered.logger.Info("hot tier is warmed", zap.Int("links", len(links)))
+}
+
+func (tiered *Tiered) GetFullURL(ctx context.Context,
+	token string,
+) (fullURL string, found bool, err error) {
+	fullURL, _, found, err = tiered.GetWithAttributes(ctx, token)
+	return fullURL, found, err
+}
+
+func (tiered *Tiered) GetWithAttributes(ctx context.Context,
+	token string,
+) (fullURL string, attrs storage.Attributes, found bool, err error) {
+	fullURL, attrs, found, err = tiered.hot.GetWithAttributes(ctx, token)
+	if err != nil {
+		return "", storage.Attributes{}, false, err
+	}
+	if found {
+		tieredStats.Add("hot_hits", 1)
+		return fullURL, attrs, true, nil
+	}
+
+	generation := tiered.currentGeneration()
+	fullURL, attrs, found, err = storage.GetLink(ctx, tiered.cold, token)
+	if err != nil {
+		return "", storage.Attributes{}, false, unavailable(err)
+	}
+	tieredStats.Add("cold_loads", 1)
+	if !found {
+		return "", storage.Attributes{}, false, nil
+	}
+
+	tiered.fillMutex.Lock()
+	defer tiered.fillMutex.Unlock()
+	if generation == tiered.generation {
+		err = tiered.putHot(ctx, fullURL, token, attrs)
+	}
+	return fullURL, attrs, true, err
+}
+
+func (tiered *Tiered) CreateShortURL(ctx context.Context, fullURL string,
+	token string,
+) (err error) {
+	return tiered.CreateWithAttributes(ctx, fullURL, token, storage.Attributes{})
+}
+
+// CreateWithAttributes fails with storage.ErrNoAttributes if the cold tier
+// does not keep attributes.
+func (tiered *Tiered) CreateWithAttributes(ctx context.Context, fullURL string,
+	token string, attrs storage.Attributes,
+) (err error) {
+	link := storage.NewLink{Token: token, FullURL: fullURL, Attributes: attrs}
+	if tiered.cfg.Mode == WriteBehind {
+		if _, ok := storage.As[storage.AttributeStorer](tiered.cold); !ok && !attrs.IsZero() {
+			return storage.ErrNoAttributes
+		}
+		return tiered.changeHot(func() error {
+			// Only the hot tier can tell a collision before the write is
+			// acknowledged.
+			err := tiered.hot.CreateWithAttributes(ctx, fullURL, token, attrs)
+			if err != nil {
+				return err
+			}
+			err = tiered.enqueue(write{kind: writeCreate, token: token, fullURL: fullURL, attrs: attrs})
+			if err != nil {
+				_, _ = tiered.hot.DeleteShortURL(ctx, token)
+				return unavailable(err)
+			}
+			return nil
+		})
+	}
+
+	err = storage.CreateLink(ctx, tiered.cold, &link)
+	if err != nil {
+		return unavailable(err)
+	}
+	return tiered.changeHot(func() error {
+		return tiered.putHot(ctx, fullURL, token, attrs)
+	})
+}
+
+// CreateBatch writes links to the cold tier in one batch in the
+// WriteThrough mode and queues them one by one in the WriteBehind mode.
+func (tiered *Tiered) CreateBatch(ctx context.Context,
+	links []storage.NewLink,
+) (errs []error, err error) {
+	if tiered.cfg.Mode == WriteBehind {
+		errs = make([]error, len(links))
+		for i := range links {
+			link := &links[i]
+			errs[i] = tiered.CreateWithAttributes(ctx, link.FullURL, link.Token, link.Attributes)
+		}
+		return errs, nil
+	}
+
+	errs, err = storage.CreateLinks(ctx, tiered.cold, links)
+	if err != nil {
+		return nil, unavailable(err)
+	}
+	for i := range links {
+		if errs[i] != nil {
+			errs[i] = unavailable(errs[i])
+			continue
+		}
+		link := &links[i]
+		err = tiered.changeHot(func() error {
+			return tiered.putHot(ctx, link.FullURL, link.Token, link.Attributes)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return errs, nil
+}
+
+// putHot creates or replaces token in the hot tier, which may still have
+// a link deleted from the cold one.
+func (tiered *Tiered) putHot(ctx context.Context, fullURL string, token string,
+	attrs storage.Attributes,
+) error {
+	err := tiered.hot.CreateWithAttributes(ctx, fullURL, token, attrs)
+	if errors.Is(err, storage.ErrTokenExists) {
+		_, err = tiered.hot.DeleteShortURL(ctx, token)
+		if err != nil {
+			return err
+		}
+		err = tiered.hot.CreateWithAttributes(ctx, fullURL, token, attrs)
+	}
+	return err
+}
+
+func (tiered *Tiered) AlreadyExists(ctx context.Context,
+	fullURL string,
+) (token string, found bool, err error) {
+	token, found, err = tiered.hot.AlreadyExists(ctx, fullURL)
+	if err != nil || found {
+		return token, found, err
+	}
+	token, found, err = tiered.cold.AlreadyExists(ctx, fullURL)
+	if err != nil {
+		return "", false, unavailable(err)
+	}
+	return token, found, nil
+}
+
+func (tiered *Tiered) UpdateShortURL(ctx context.Context, token string,
+	fullURL string,
+) (found bool, err error) {
+	if tiered.editor == nil {
+		return false, errors.ErrUnsupported
+	}
+	if tiered.cfg.Mode == WriteBehind {
+		_, found, err = tiered.GetFullURL(ctx, token)
+		if err != nil || !found {
+			return false, err
+		}
+		err = tiered.enqueue(write{kind: writeUpdate, token: token, fullURL: fullURL})
+	} else {
+		found, err = tiered.editor.UpdateShortURL(ctx, token, fullURL)
+	}
+	if err != nil {
+		return false, unavailable(err)
+	}
+	err = tiered.changeHot(func() error {
+		if !found {
+			_, err := tiered.hot.DeleteShortURL(ctx, token)
+			return err
+		}
+		_, err := tiered.hot.UpdateShortURL(ctx, token, fullURL)
+		return err
+	})
+	return found, err
+}
+
+func (tiered *Tiered) DeleteShortURL(ctx context.Context,
+	token string,
+) (found bool, err error) {
+	if tiered.editor == nil {
+		return false, errors.ErrUnsupported
+	}
+	if tiered.cfg.Mode == WriteBehind {
+		_, found, err = tiered.GetFullURL(ctx, token)
+		if err != nil || !found {
+			return false, err
+		}
+		err = tiered.enqueue(write{kind: writeDelete, token: token})
+	} else {
+		found, err = tiered.editor.DeleteShortURL(ctx, token)
+	}
+	if err != nil {
+		return false, unavailable(err)
+	}
+	err = tiered.changeHot(func() error {
+		_, err := tiered.hot.DeleteShortURL(ctx, token)
+		return err
+	})
+	return found, err
+}
+
+// AddClick counts the click in the hot tier and adds it to the clicks
+// written to the cold one by Run. Clicks are kept while the cold tier is
+// down.
+func (tiered *Tiered) AddClick(ctx context.Context, token string) (err error) {
+	err = tiered.hot.AddClick(ctx, token)
+	if err != nil {
+		return err
+	}
+	tiered.pendingClicks.Add(token)
+	return nil
+}
+
+// Clicks are read from the cold tier when it counts them, so they do not
+// include the clicks not written yet.
+func (tiered *Tiered) Clicks(ctx context.Context, token string) (clicks int64, err error) {
+	if tiered.clicks == nil {
+		return tiered.hot.Clicks(ctx, token)
+	}
+	clicks, err = tiered.clicks.Clicks(ctx, token)
+	if err != nil {
+		return 0, unavailable(err)
+	}
+	return clicks, nil
+}
+
+// Invalidate drops token from the hot tier, so the next read loads it from
+// the cold one. It is called for links changed by other replicas.
+func (tiered *Tiered) Invalidate(token string) {
+	_ = tiered.changeHot(func() error {
+		_, err := tiered.hot.DeleteShortURL(context.Background(), token)
+		return err
+	})
+	tieredStats.Add("invalidations", 1)
+}
+
+// Flush drops every link from the hot tier, when changes of other replicas
+// could have been missed. In the WriteBehind mode links still queued for the
+// cold tier are not found until they are written.
+func (tiered *Tiered) Flush() {
+	_ = tiered.changeHot(func() error {
+		var tokens []string
+		tiered.hot.Range(func(token string, _ string) bool {
+			tokens = append(tokens, token)
+			return true
+		})
+		for _, token := range tokens {
+			_, _ = tiered.hot.DeleteShortURL(context.Background(), token)
+		}
+		return nil
+	})
+	tieredStats.Add("flushes", 1)
+}
+
+// Run writes queued changes and clicks to the cold tier until ctx is done
+// or Tiered is closed. It must be called once.
+func (tiered *Tiered) Run(ctx context.Context) {
+	tiered.running.Store(true)
+	defer close(tiered.stopped)
+
+	probe := time.NewTicker(tiered.cfg.RetryInterval)
+	defer probe.Stop()
+	clickInterval := tiered.cfg.ClickInterval
+	if clickInterval <= 0 {
+		clickInterval = time.Second
+	}
+	flushClicks := time.NewTicker(clickInterval)
+	defer flushClicks.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case queued, ok := <-tiered.queue:
+			if !ok {
+				return
+			}
+			tiered.write(ctx, queued)
+		case <-flushClicks.C:
+			tiered.writeClicks(ctx)
+		case <-probe.C:
+			if tiered.coldDown.Load() {
+				tiered.probe(ctx)
+			}
+		}
+	}
+}
+
+// Unwrap returns the cold tier, so that the capabilities Tiered does not
+// have itself, like the token pool, are found there.
+func (tiered *Tiered) Unwrap() storage.Storager {
+	return tiered.cold
+}
+
+// Close flushes the queue to the cold tier and closes both tiers.
+func (tiered *Tiered) Close() error {
+	tiered.queueMutex.Lock()
+	if tiered.closed {
+		tiered.queueMutex.Unlock()
+		return nil
+	}
+	tiered.closed = true
+	close(tiered.closing)
+	close(tiered.queue)
+	tiered.queueMutex.Unlock()
+
+	if tiered.running.Load() {
+		<-tiered.stopped
+	}
+	// Run has drained the queue, or stopped by its context before that, or
+	// was not started at all.
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	for queued := range tiered.queue {
+		tiered.write(ctx, queued)
+	}
+	tiered.writeClicks(ctx)
+	return errors.Join(tiered.cold.Close(), tiered.hot.Close())
+}
+
+func (tiered *Tiered) enqueue(queued write) error {
+	tiered.queueMutex.RLock()
+	defer tiered.queueMutex.RUnlock()
+
+	if tiered.closed {
+		return errors.New("storage is closed")
+	}
+	if tiered.coldDown.Load() {
+		return errors.New("cold storage is down")
+	}
+	select {
+	case tiered.queue <- queued:
+		tieredStats.Add("queued", 1)
+		return nil
+	default:
+		return errors.New("write queue is full")
+	}
+}
+
+// write applies queued to the cold tier, retrying a change with a backoff
+// unless Tiered is closing.
+func (tiered *Tiered) write(ctx context.Context, queued write) {
+	attempts := tiered.cfg.WriteAttempts
+	backoff := tiered.cfg.RetryInterval
+	for attempt := 1; ; attempt++ {
+		err := tiered.apply(ctx, queued)
+		if err == nil {
+			tiered.coldDown.Store(false)
+			return
+		}
+		tiered.coldDown.Store(true)
+		if attempt >= attempts || ctx.Err() != nil || tiered.isClosing() {
+			tiered.drop(queued, err)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-tiered.closing:
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRetryInterval)
+	}
+}
+
+func (tiered *Tiered) apply(ctx context.Context, queued write) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	switch queued.kind {
+	case writeCreate:
+		return storage.CreateLink(ctx, tiered.cold, &storage.NewLink{
+			Token: queued.token, FullURL: queued.fullURL, Attributes: queued.attrs,
+		})
+	case writeUpdate:
+		_, err = tiered.editor.UpdateShortURL(ctx, queued.token, queued.fullURL)
+	case writeDelete:
+		_, err = tiered.editor.DeleteShortURL(ctx, queued.token)
+	}
+	return err
+}
+
+// writeClicks writes the pending clicks to the cold tier, the ones that fail
+// are tried again next time.
+func (tiered *Tiered) writeClicks(ctx context.Context) {
+	if tiered.pendingClicks == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	err := tiered.pendingClicks.Flush(ctx)
+	if err != nil {
+		tiered.coldDown.Store(true)
+		tieredStats.Add("click_write_errors", 1)
+	}
+}
+
+func (tiered *Tiered) drop(queued write, err error) {
+	tieredStats.Add("dropped_writes", 1)
+	tiered.logger.Error("change is not written to cold storage",
+		zap.Stringer("write", queued.kind),
+		zap.String("token", queued.token),
+		zap.Error(err))
+}
+
+// probe checks if the cold tier answers again after a failed write.
+func (tiered *Tiered) probe(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	_, _, err := tiered.cold.GetFullURL(ctx, "")
+	if err == nil {
+		tiered.logger.Info("cold storage is up again")
+		tiered.coldDown.Store(false)
+	}
+}
+
+func (tiered *Tiered) isClosing() bool {
+	select {
+	case <-tiered.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// changeHot applies a change to the hot tier, so that a concurrent load of
+// the link from the cold tier does not overwrite it.
+func (tiered *Tiered) changeHot(change func() error) error {
+	tiered.fillMutex.Lock()
+	defer tiered.fillMutex.Unlock()
+
+	tiered.generation++
+	return change()
+}
+
+func (tiered *Tiered) currentGeneration() uint64 {
+	tiered.fillMutex.Lock()
+	defer tiered.fillMutex.Unlock()
+	return tiered.generation
+}
+
+// unavailable marks err of the cold tier, unless it is not about the cold
+// tier being down.
+func unavailable(err error) error {
+	if errors.Is(err, storage.ErrUnavailable) || errors.Is(err, storage.ErrTokenExists) ||
+		errors.Is(err, errors.ErrUnsupported) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", storage.ErrUnavailable, err)
+}
@@ -0,0 +1,329 @@
+package tiered
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+)
+
+var errDown = errors.New("connection refused")
+
+// coldStorage is Inmemory that can be turned off like a database.
+type coldStorage struct {
+	*inmemory.Inmemory
+	down atomic.Bool
+}
+
+func newColdStorage() *coldStorage {
+	return &coldStorage{Inmemory: inmemory.New()}
+}
+
+func (cold *coldStorage) GetFullURL(ctx context.Context,
+	token string,
+) (fullURL string, found bool, err error) {
+	if cold.down.Load() {
+		return "", false, errDown
+	}
+	return cold.Inmemory.GetFullURL(ctx, token)
+}
+
+func (cold *coldStorage) CreateShortURL(ctx context.Context, fullURL string,
+	token string,
+) (err error) {
+	if cold.down.Load() {
+		return errDown
+	}
+	return cold.Inmemory.CreateShortURL(ctx, fullURL, token)
+}
+
+func (cold *coldStorage) GetWithAttributes(ctx context.Context,
+	token string,
+) (fullURL string, attrs storage.Attributes, found bool, err error) {
+	if cold.down.Load() {
+		return "", storage.Attributes{}, false, errDown
+	}
+	return cold.Inmemory.GetWithAttributes(ctx, token)
+}
+
+func (cold *coldStorage) CreateWithAttributes(ctx context.Context, fullURL string,
+	token string, attrs storage.Attributes,
+) (err error) {
+	if cold.down.Load() {
+		return errDown
+	}
+	return cold.Inmemory.CreateWithAttributes(ctx, fullURL, token, attrs)
+}
+
+func (cold *coldStorage) AlreadyExists(ctx context.Context,
+	fullURL string,
+) (token string, found bool, err error) {
+	if cold.down.Load() {
+		return "", false, errDown
+	}
+	return cold.Inmemory.AlreadyExists(ctx, fullURL)
+}
+
+func (cold *coldStorage) UpdateShortURL(ctx context.Context, token string,
+	fullURL string,
+) (found bool, err error) {
+	if cold.down.Load() {
+		return false, errDown
+	}
+	return cold.Inmemory.UpdateShortURL(ctx, token, fullURL)
+}
+
+func (cold *coldStorage) DeleteShortURL(ctx context.Context,
+	token string,
+) (found bool, err error) {
+	if cold.down.Load() {
+		return false, errDown
+	}
+	return cold.Inmemory.DeleteShortURL(ctx, token)
+}
+
+func (cold *coldStorage) AddClick(ctx context.Context, token string) (err error) {
+	if cold.down.Load() {
+		return errDown
+	}
+	return cold.Inmemory.AddClick(ctx, token)
+}
+
+func (cold *coldStorage) TopLinks(ctx context.Context, limit int) (links []storage.Link, err error) {
+	if cold.down.Load() {
+		return nil, errDown
+	}
+	cold.RangeWithAttributes(func(token string, fullURL string, attrs storage.Attributes) bool {
+		clicks, _ := cold.Inmemory.Clicks(ctx, token)
+		links = append(links, storage.Link{Token: token, FullURL: fullURL, Clicks: clicks, Attributes: attrs})
+		return true
+	})
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Clicks > links[j].Clicks
+	})
+	return links[:min(limit, len(links))], nil
+}
+
+func newTiered(t *testing.T, cold *coldStorage, cfg Config) *Tiered {
+	t.Helper()
+	if cfg.RetryInterval == 0 {
+		cfg.RetryInterval = time.Millisecond
+	}
+	if cfg.ClickInterval == 0 {
+		cfg.ClickInterval = time.Millisecond
+	}
+	tiered, err := New(context.Background(), inmemory.New(), cold, cfg, zap.NewNop())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = tiered.Close()
+	})
+	return tiered
+}
+
+func requireLink(t *testing.T, st storage.Storager, token string, expected string) {
+	t.Helper()
+	fullURL, found, err := st.GetFullURL(context.Background(), token)
+	require.NoError(t, err)
+	require.True(t, found, token)
+	assert.Equal(t, expected, fullURL)
+}
+
+func TestWarm(t *testing.T) {
+	ctx := context.Background()
+	cold := newColdStorage()
+	for i, token := range []string{"a", "b", "c"} {
+		require.NoError(t, cold.CreateShortURL(ctx, "https://"+token+".ru", token))
+		for j := 0; j < 3-i; j++ {
+			require.NoError(t, cold.AddClick(ctx, token))
+		}
+	}
+
+	attrs := storage.Attributes{Tags: []string{"b"}}
+	require.NoError(t, cold.CreateWithAttributes(ctx, "https://b.ru/tagged", "bt", attrs))
+	for j := 0; j < 5; j++ {
+		require.NoError(t, cold.AddClick(ctx, "bt"))
+	}
+
+	tiered := newTiered(t, cold, Config{WarmLinks: 3})
+	cold.down.Store(true)
+
+	_, stored, found, err := tiered.GetWithAttributes(ctx, "bt")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, attrs, stored, "attributes must be warmed with the link")
+	requireLink(t, tiered, "a", "https://a.ru")
+	requireLink(t, tiered, "b", "https://b.ru")
+	_, _, err = tiered.GetFullURL(ctx, "c")
+	assert.ErrorIs(t, err, storage.ErrUnavailable)
+}
+
+func TestWriteThrough(t *testing.T) {
+	ctx := context.Background()
+	cold := newColdStorage()
+	tiered := newTiered(t, cold, Config{})
+
+	require.NoError(t, tiered.CreateShortURL(ctx, "https://a.ru", "a"))
+	requireLink(t, cold, "a", "https://a.ru")
+
+	t.Run("load from cold", func(t *testing.T) {
+		require.NoError(t, cold.CreateShortURL(ctx, "https://b.ru", "b"))
+		requireLink(t, tiered, "b", "https://b.ru")
+		requireLink(t, tiered.hot, "b", "https://b.ru")
+	})
+	t.Run("edit", func(t *testing.T) {
+		found, err := tiered.UpdateShortURL(ctx, "a", "https://a.ru/new")
+		require.NoError(t, err)
+		require.True(t, found)
+		requireLink(t, cold, "a", "https://a.ru/new")
+		requireLink(t, tiered, "a", "https://a.ru/new")
+
+		found, err = tiered.DeleteShortURL(ctx, "b")
+		require.NoError(t, err)
+		require.True(t, found)
+		_, found, err = tiered.GetFullURL(ctx, "b")
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+	t.Run("cold is down", func(t *testing.T) {
+		cold.down.Store(true)
+		defer cold.down.Store(false)
+
+		requireLink(t, tiered, "a", "https://a.ru/new")
+		err := tiered.CreateShortURL(ctx, "https://c.ru", "c")
+		assert.ErrorIs(t, err, storage.ErrUnavailable)
+		assert.ErrorIs(t, err, errDown)
+		_, found, err := tiered.hot.GetFullURL(ctx, "c")
+		require.NoError(t, err)
+		assert.False(t, found, "failed create must not reach the hot tier")
+
+		_, err = tiered.UpdateShortURL(ctx, "a", "https://a.ru")
+		assert.ErrorIs(t, err, storage.ErrUnavailable)
+	})
+}
+
+func TestWriteBehind(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cold := newColdStorage()
+	tiered := newTiered(t, cold, Config{Mode: WriteBehind, WriteAttempts: 1000})
+	go tiered.Run(ctx)
+
+	require.NoError(t, tiered.CreateShortURL(ctx, "https://a.ru", "a"))
+	requireLink(t, tiered, "a", "https://a.ru")
+	require.Eventually(t, func() bool {
+		_, found, _ := cold.GetFullURL(ctx, "a")
+		return found
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, tiered.AddClick(ctx, "a"))
+	require.Eventually(t, func() bool {
+		clicks, _ := tiered.Clicks(ctx, "a")
+		return clicks == 1
+	}, time.Second, time.Millisecond)
+
+	// The first write after the cold tier goes down is still accepted, the
+	// next ones fail until it is up again.
+	cold.down.Store(true)
+	require.NoError(t, tiered.CreateShortURL(ctx, "https://b.ru", "b"))
+	require.Eventually(t, tiered.coldDown.Load, time.Second, time.Millisecond)
+	err := tiered.CreateShortURL(ctx, "https://c.ru", "c")
+	assert.ErrorIs(t, err, storage.ErrUnavailable)
+	requireLink(t, tiered, "a", "https://a.ru")
+	requireLink(t, tiered, "b", "https://b.ru")
+
+	cold.down.Store(false)
+	require.Eventually(t, func() bool {
+		return !tiered.coldDown.Load()
+	}, time.Second, time.Millisecond)
+	require.Eventually(t, func() bool {
+		_, found, _ := cold.GetFullURL(ctx, "b")
+		return found
+	}, time.Second, time.Millisecond)
+	require.NoError(t, tiered.CreateShortURL(ctx, "https://c.ru", "c"))
+}
+
+func TestClicksDoNotFillQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cold := newColdStorage()
+	tiered := newTiered(t, cold, Config{Mode: WriteBehind, QueueSize: 2, ClickInterval: time.Hour})
+	require.NoError(t, tiered.CreateShortURL(ctx, "https://a.ru", "a"))
+
+	// Run is not started, so nothing leaves the queue.
+	for i := 0; i < 10; i++ {
+		require.NoError(t, tiered.AddClick(ctx, "a"))
+	}
+	require.NoError(t, tiered.CreateShortURL(ctx, "https://b.ru", "b"))
+	err := tiered.CreateShortURL(ctx, "https://c.ru", "c")
+	require.Error(t, err, "the queue holds two changes")
+
+	go tiered.Run(ctx)
+	require.NoError(t, tiered.Close())
+	clicks, err := cold.Clicks(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), clicks, "clicks are written on close")
+}
+
+func TestInvalidate(t *testing.T) {
+	ctx := context.Background()
+	cold := newColdStorage()
+	tiered := newTiered(t, cold, Config{})
+	require.NoError(t, tiered.CreateShortURL(ctx, "https://a.ru", "a"))
+	require.NoError(t, tiered.CreateShortURL(ctx, "https://b.ru", "b"))
+
+	// Another replica changes the links in the cold tier.
+	_, err := cold.UpdateShortURL(ctx, "a", "https://a.ru/new")
+	require.NoError(t, err)
+	_, err = cold.UpdateShortURL(ctx, "b", "https://b.ru/new")
+	require.NoError(t, err)
+	requireLink(t, tiered, "a", "https://a.ru")
+
+	tiered.Invalidate("a")
+	requireLink(t, tiered, "a", "https://a.ru/new")
+	requireLink(t, tiered, "b", "https://b.ru")
+
+	tiered.Flush()
+	requireLink(t, tiered, "b", "https://b.ru/new")
+}
+
+func TestCloseFlushesQueue(t *testing.T) {
+	ctx := context.Background()
+	cold := newColdStorage()
+	tiered, err := New(ctx, inmemory.New(), cold, Config{Mode: WriteBehind}, zap.NewNop())
+	require.NoError(t, err)
+
+	require.NoError(t, tiered.CreateShortURL(ctx, "https://a.ru", "a"))
+	found, err := tiered.DeleteShortURL(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.NoError(t, tiered.CreateShortURL(ctx, "https://b.ru", "b"))
+	require.NoError(t, tiered.Close())
+
+	_, found, err = cold.GetFullURL(ctx, "a")
+	require.NoError(t, err)
+	assert.False(t, found)
+	requireLink(t, cold, "b", "https://b.ru")
+
+	err = tiered.CreateShortURL(ctx, "https://c.ru", "c")
+	assert.ErrorIs(t, err, storage.ErrUnavailable)
+}
+
+func TestUnwrap(t *testing.T) {
+	cold := newColdStorage()
+	tiered := newTiered(t, cold, Config{})
+
+	_, ok := storage.As[storage.TokenPooler](tiered)
+	assert.True(t, ok, "token pool of the cold tier must be found")
+
+	_, err := New(context.Background(), inmemory.New(), cold, Config{Mode: "eventually"}, zap.NewNop())
+	assert.Error(t, err)
+}
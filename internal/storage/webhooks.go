@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Webhook is a subscription of a tenant to events of its links.
+type Webhook struct {
+	ID     string
+	Tenant string
+	URL    string
+	// Secret signs the payloads sent to URL.
+	Secret string
+	Events []string
+	// ClickSampleRate is the share of clicks sent as events, from 0 to 1.
+	ClickSampleRate float64
+	CreatedAt       time.Time
+}
+
+// WebhookDelivery is an event waiting to be sent to a webhook.
+type WebhookDelivery struct {
+	ID        string
+	WebhookID string
+	Tenant    string
+	Event     string
+	Payload   []byte
+	// Attempts is how many times sending failed.
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	// Dead is set when the delivery is out of attempts. It is not sent
+	// until replayed.
+	Dead      bool
+	CreatedAt time.Time
+}
+
+// WebhookStorer is implemented by storages able to keep webhooks and the
+// queue of their deliveries, so that queued events survive a restart.
+type WebhookStorer interface {
+	CreateWebhook(ctx context.Context, webhook *Webhook) (err error)
+	// Webhooks lists the webhooks of tenant, of every tenant when it is
+	// empty.
+	Webhooks(ctx context.Context, tenant string) (webhooks []Webhook, err error)
+	// DeleteWebhook deletes the webhook of tenant with its deliveries.
+	DeleteWebhook(ctx context.Context, tenant string, id string) (found bool, err error)
+
+	EnqueueDeliveries(ctx context.Context, deliveries []WebhookDelivery) (err error)
+	// ClaimDeliveries returns up to limit deliveries that are not dead and
+	// due at now, oldest first, and postpones them by lease, so that other
+	// replicas do not send them meanwhile.
+	ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration,
+		limit int) (deliveries []WebhookDelivery, err error)
+	// UpdateDelivery saves Attempts, NextAttemptAt, LastError and Dead of
+	// delivery.
+	UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) (err error)
+	DeleteDelivery(ctx context.Context, id string) (err error)
+	// DeadDeliveries lists up to limit dead deliveries of tenant, newest
+	// first.
+	DeadDeliveries(ctx context.Context, tenant string, limit int) (deliveries []WebhookDelivery, err error)
+	// ReplayDelivery makes the dead delivery of tenant due at now with no
+	// failed attempts.
+	ReplayDelivery(ctx context.Context, tenant string, id string, now time.Time) (found bool, err error)
+}
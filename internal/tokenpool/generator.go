@@ -0,0 +1,51 @@
+package tokenpool
+
+import (
+	"context"
+
+	"github.com/ilyakharev/url-short/internal/hasher"
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+// Generator hashes tokens on demand and checks each one against the
+// storage until it finds an unused one or runs out of attempts.
+type Generator struct {
+	storager    storage.Storager
+	hasher      hasher.Hasher
+	keyspace    *Keyspace
+	maxAttempts int
+}
+
+var _ Source = &Generator{}
+
+func NewGenerator(st storage.Storager, h hasher.Hasher, keyspace *Keyspace,
+	maxAttempts int,
+) *Generator {
+	return &Generator{
+		storager:    st,
+		hasher:      h,
+		keyspace:    keyspace,
+		maxAttempts: maxAttempts,
+	}
+}
+
+func (generator *Generator) Token(ctx context.Context, fullURL string) (token string, err error) {
+	var exists bool
+	for attempt := 0; attempt < generator.maxAttempts; attempt++ {
+		token, err = generator.hasher.GenerateToken(fullURL, attempt)
+		if err != nil {
+			return "", err
+		}
+		_, exists, err = generator.storager.GetFullURL(ctx, token)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			generator.keyspace.Record(attempt+1, attempt)
+			return token, nil
+		}
+	}
+	generator.keyspace.Record(generator.maxAttempts, generator.maxAttempts)
+	keyspaceStats.Add("exhausted", 1)
+	return "", ErrKeyspaceExhausted
+}
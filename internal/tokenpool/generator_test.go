@@ -0,0 +1,70 @@
+package tokenpool
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/hasher"
+	mock_hasher "github.com/ilyakharev/url-short/internal/hasher/mock"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+	mock_storage "github.com/ilyakharev/url-short/internal/storage/mock"
+)
+
+func newTestKeyspace() *Keyspace {
+	return NewKeyspace(hasher.New(), nil, 0, zap.NewNop())
+}
+
+func TestGenerator(t *testing.T) {
+	t.Run("retry on collision", func(t *testing.T) {
+		ctx := context.Background()
+		ctrl := gomock.NewController(t)
+		memory := inmemory.New()
+		require.NoError(t, memory.CreateShortURL(ctx, "http://ya.ru", "0123456789"))
+
+		h := mock_hasher.NewMockHasher(ctrl)
+		gomock.InOrder(
+			h.EXPECT().GenerateToken("http://wro.ng", 0).Return("0123456789", nil),
+			h.EXPECT().GenerateToken("http://wro.ng", 1).Return("9876543210", nil),
+		)
+
+		token, err := NewGenerator(memory, h, newTestKeyspace(), 10).Token(ctx, "http://wro.ng")
+		require.NoError(t, err)
+		assert.Equal(t, "9876543210", token)
+	})
+	t.Run("hasher error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		h := mock_hasher.NewMockHasher(ctrl)
+		h.EXPECT().GenerateToken(gomock.Any(), gomock.Any()).Return("", errors.New("any"))
+
+		_, err := NewGenerator(inmemory.New(), h, newTestKeyspace(), 10).Token(context.Background(), "http://wro.ng")
+		require.Error(t, err)
+	})
+	t.Run("storage error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		h := mock_hasher.NewMockHasher(ctrl)
+		h.EXPECT().GenerateToken(gomock.Any(), gomock.Any()).Return("0123456789", nil)
+		st := mock_storage.NewMockStorager(ctrl)
+		st.EXPECT().GetFullURL(gomock.Any(), "0123456789").Return("", false, errors.New("some"))
+
+		_, err := NewGenerator(st, h, newTestKeyspace(), 10).Token(context.Background(), "http://wro.ng")
+		require.Error(t, err)
+	})
+	t.Run("keyspace exhausted", func(t *testing.T) {
+		ctx := context.Background()
+		ctrl := gomock.NewController(t)
+		memory := inmemory.New()
+		require.NoError(t, memory.CreateShortURL(ctx, "http://ya.ru", "0123456789"))
+
+		h := mock_hasher.NewMockHasher(ctrl)
+		h.EXPECT().GenerateToken(gomock.Any(), gomock.Any()).Return("0123456789", nil).Times(3)
+
+		_, err := NewGenerator(memory, h, newTestKeyspace(), 3).Token(ctx, "http://wro.ng")
+		require.ErrorIs(t, err, ErrKeyspaceExhausted)
+	})
+}
@@ -0,0 +1,173 @@
+package tokenpool
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/hasher"
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+const (
+	// collisionWindow is the number of attempts the collision rate is
+	// computed over.
+	collisionWindow = 1000
+	usageRefresh    = time.Minute
+)
+
+var (
+	ErrKeyspaceExhausted = errors.New("unable to find free token, keyspace is exhausted")
+
+	keyspaceStats = expvar.NewMap("keyspace")
+)
+
+type Usage struct {
+	TokenLength   int     `json:"token_length"`
+	Links         int     `json:"links"`
+	Capacity      float64 `json:"capacity"`
+	Usage         float64 `json:"usage"`
+	CollisionRate float64 `json:"collision_rate"`
+}
+
+// Keyspace tracks how often generated tokens collide with existing ones and,
+// when growth is enabled, makes tokens one character longer once the
+// collision rate crosses the threshold. Tokens of a hasher with a fixed
+// length do not grow, attempts to find a free one run out with
+// ErrKeyspaceExhausted instead.
+type Keyspace struct {
+	hasher    hasher.Hasher
+	counter   storage.Counter
+	threshold float64
+	logger    *zap.Logger
+
+	mutex      sync.Mutex
+	attempts   int
+	collisions int
+	rate       float64
+}
+
+// NewKeyspace creates a keyspace tracker. counter may be nil if the storage
+// can not count links, threshold of zero disables token length growth.
+func NewKeyspace(h hasher.Hasher, counter storage.Counter, threshold float64,
+	logger *zap.Logger,
+) *Keyspace {
+	keyspace := &Keyspace{
+		hasher:    h,
+		counter:   counter,
+		threshold: threshold,
+		logger:    logger,
+	}
+	keyspace.publish()
+	return keyspace
+}
+
+// Record accounts attempts made to find free tokens, collisions of which hit
+// a token that was already taken.
+func (keyspace *Keyspace) Record(attempts, collisions int) {
+	keyspaceStats.Add("attempts", int64(attempts))
+	keyspaceStats.Add("collisions", int64(collisions))
+
+	keyspace.mutex.Lock()
+	defer keyspace.mutex.Unlock()
+
+	keyspace.attempts += attempts
+	keyspace.collisions += collisions
+	if keyspace.attempts < collisionWindow {
+		return
+	}
+	keyspace.rate = float64(keyspace.collisions) / float64(keyspace.attempts)
+	keyspace.attempts, keyspace.collisions = 0, 0
+	keyspace.publish()
+
+	if keyspace.threshold > 0 && keyspace.rate >= keyspace.threshold {
+		keyspace.grow()
+	}
+}
+
+// Usage reports how much of the keyspace of the current token length is used.
+func (keyspace *Keyspace) Usage(ctx context.Context) (usage Usage, err error) {
+	keyspace.mutex.Lock()
+	usage.CollisionRate = keyspace.rate
+	keyspace.mutex.Unlock()
+
+	usage.TokenLength = keyspace.tokenLength()
+	usage.Capacity = hasher.Capacity(usage.TokenLength)
+	if keyspace.counter != nil {
+		usage.Links, err = keyspace.counter.Count(ctx)
+		if err != nil {
+			return Usage{}, err
+		}
+		usage.Usage = float64(usage.Links) / usage.Capacity
+	}
+
+	links := new(expvar.Int)
+	links.Set(int64(usage.Links))
+	keyspaceStats.Set("links", links)
+	ratio := new(expvar.Float)
+	ratio.Set(usage.Usage)
+	keyspaceStats.Set("usage", ratio)
+
+	return usage, nil
+}
+
+// Run refreshes the usage metric until ctx is done.
+func (keyspace *Keyspace) Run(ctx context.Context) {
+	ticker := time.NewTicker(usageRefresh)
+	defer ticker.Stop()
+
+	for {
+		_, err := keyspace.Usage(ctx)
+		if err != nil && ctx.Err() == nil {
+			keyspace.logger.Error("error on get keyspace usage", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (keyspace *Keyspace) tokenLength() int {
+	if resizer, ok := keyspace.hasher.(hasher.Resizer); ok {
+		return resizer.TokenLength()
+	}
+	return hasher.DefaultTokenLength
+}
+
+func (keyspace *Keyspace) grow() {
+	resizer, ok := keyspace.hasher.(hasher.Resizer)
+	if !ok {
+		return
+	}
+	length := resizer.TokenLength()
+	if length >= hasher.MaxTokenLength {
+		keyspace.logger.Warn("collision rate is above threshold, but token length is already maximal",
+			zap.Float64("collision_rate", keyspace.rate))
+		return
+	}
+	resizer.SetTokenLength(length + 1)
+	if resizer.TokenLength() == length {
+		keyspace.logger.Warn("collision rate is above threshold, but token length is fixed",
+			zap.Float64("collision_rate", keyspace.rate))
+		return
+	}
+	keyspace.logger.Info("collision rate is above threshold, token length is increased",
+		zap.Float64("collision_rate", keyspace.rate),
+		zap.Int("token_length", length+1))
+	keyspace.publish()
+}
+
+func (keyspace *Keyspace) publish() {
+	rate := new(expvar.Float)
+	rate.Set(keyspace.rate)
+	keyspaceStats.Set("collision_rate", rate)
+	length := new(expvar.Int)
+	length.Set(int64(keyspace.tokenLength()))
+	keyspaceStats.Set("token_length", length)
+}
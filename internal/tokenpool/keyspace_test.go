@@ -0,0 +1,76 @@
+package tokenpool
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/hasher"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+	mock_storage "github.com/ilyakharev/url-short/internal/storage/mock"
+)
+
+func TestKeyspace(t *testing.T) {
+	t.Run("grow token length above threshold", func(t *testing.T) {
+		h := hasher.New()
+		keyspace := NewKeyspace(h, nil, 0.5, zap.NewNop())
+
+		keyspace.Record(collisionWindow/2, collisionWindow/4)
+		assert.Equal(t, hasher.DefaultTokenLength, h.TokenLength())
+
+		keyspace.Record(collisionWindow/2, 0)
+		assert.Equal(t, hasher.DefaultTokenLength, h.TokenLength())
+
+		keyspace.Record(collisionWindow, collisionWindow)
+		assert.Equal(t, hasher.DefaultTokenLength+1, h.TokenLength())
+	})
+	t.Run("fixed token length", func(t *testing.T) {
+		h, err := hasher.NewHMAC([]byte("secret"))
+		require.NoError(t, err)
+		filtered := hasher.NewFiltered(h, hasher.DefaultFilter())
+		keyspace := NewKeyspace(filtered, nil, 0.5, zap.NewNop())
+
+		keyspace.Record(collisionWindow, collisionWindow)
+		assert.Equal(t, hasher.DefaultTokenLength, filtered.TokenLength())
+	})
+	t.Run("growth disabled", func(t *testing.T) {
+		h := hasher.New()
+		keyspace := NewKeyspace(h, nil, 0, zap.NewNop())
+
+		keyspace.Record(collisionWindow, collisionWindow)
+		assert.Equal(t, hasher.DefaultTokenLength, h.TokenLength())
+	})
+	t.Run("usage", func(t *testing.T) {
+		ctx := context.Background()
+		h := hasher.New()
+		h.SetTokenLength(2)
+		memory := inmemory.New()
+		require.NoError(t, memory.CreateShortURL(ctx, "http://ya.ru", "01"))
+		keyspace := NewKeyspace(h, memory, 0, zap.NewNop())
+		keyspace.Record(collisionWindow, collisionWindow/4)
+
+		usage, err := keyspace.Usage(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, Usage{
+			TokenLength:   2,
+			Links:         1,
+			Capacity:      63 * 63,
+			Usage:         1.0 / (63 * 63),
+			CollisionRate: 0.25,
+		}, usage)
+	})
+	t.Run("usage error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		counter := mock_storage.NewMockCounter(ctrl)
+		counter.EXPECT().Count(gomock.Any()).Return(0, errors.New("some"))
+		keyspace := NewKeyspace(hasher.New(), counter, 0, zap.NewNop())
+
+		_, err := keyspace.Usage(context.Background())
+		require.Error(t, err)
+	})
+}
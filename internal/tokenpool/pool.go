@@ -0,0 +1,124 @@
+package tokenpool
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/hasher"
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+const (
+	refillBatch    = 1000
+	checkInterval  = 10 * time.Second
+	refillDeadline = time.Minute
+)
+
+// Pool hands out tokens generated ahead of time, so creating a link is a
+// single atomic claim instead of a hash-and-check loop. A background refill
+// tops the pool up to the high watermark once it drops below the low one.
+type Pool struct {
+	store    storage.TokenPooler
+	hasher   hasher.Hasher
+	fallback Source
+	keyspace *Keyspace
+	logger   *zap.Logger
+	low      int
+	high     int
+	refill   chan struct{}
+}
+
+var _ Source = &Pool{}
+
+// NewPool creates a pool kept in store. fallback is used when the pool runs
+// dry faster than it is refilled.
+func NewPool(store storage.TokenPooler, h hasher.Hasher, fallback Source,
+	keyspace *Keyspace, low, high int, logger *zap.Logger,
+) *Pool {
+	return &Pool{
+		store:    store,
+		hasher:   h,
+		fallback: fallback,
+		keyspace: keyspace,
+		logger:   logger,
+		low:      low,
+		high:     high,
+		refill:   make(chan struct{}, 1),
+	}
+}
+
+func (pool *Pool) Token(ctx context.Context, fullURL string) (token string, err error) {
+	token, found, err := pool.store.ClaimToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	pool.requestRefill()
+	if !found {
+		pool.logger.Warn("token pool is empty, generating token on demand")
+		return pool.fallback.Token(ctx, fullURL)
+	}
+	return token, nil
+}
+
+// Run refills the pool until ctx is done.
+func (pool *Pool) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		pool.fill(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-pool.refill:
+		}
+	}
+}
+
+func (pool *Pool) requestRefill() {
+	select {
+	case pool.refill <- struct{}{}:
+	default:
+	}
+}
+
+func (pool *Pool) fill(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, refillDeadline)
+	defer cancel()
+
+	size, err := pool.store.PoolSize(ctx)
+	if err != nil {
+		pool.logger.Error("error on get token pool size", zap.Error(err))
+		return
+	}
+	if size >= pool.low {
+		return
+	}
+
+	pool.logger.Debug("refill token pool", zap.Int("size", size))
+	for size < pool.high {
+		batch := make([]string, 0, min(refillBatch, pool.high-size))
+		for len(batch) < cap(batch) {
+			token, err := pool.hasher.GenerateToken("", len(batch))
+			if err != nil {
+				pool.logger.Error("error on generate token", zap.Error(err))
+				return
+			}
+			batch = append(batch, token)
+		}
+		added, err := pool.store.AddTokens(ctx, batch)
+		if err != nil {
+			pool.logger.Error("error on add tokens to pool", zap.Error(err))
+			return
+		}
+		pool.keyspace.Record(len(batch), len(batch)-added)
+		if added == 0 {
+			pool.logger.Warn("no new tokens added to pool")
+			return
+		}
+		size += added
+	}
+}
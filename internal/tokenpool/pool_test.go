@@ -0,0 +1,90 @@
+package tokenpool
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/hasher"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+	mock_storage "github.com/ilyakharev/url-short/internal/storage/mock"
+	mock_tokenpool "github.com/ilyakharev/url-short/internal/tokenpool/mock"
+)
+
+func TestPool(t *testing.T) {
+	t.Run("fill up to high watermark", func(t *testing.T) {
+		ctx := context.Background()
+		memory := inmemory.New()
+		pool := NewPool(memory, hasher.New(), nil, newTestKeyspace(), 10, 50, zap.NewNop())
+
+		pool.fill(ctx)
+		size, err := memory.PoolSize(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 50, size)
+	})
+	t.Run("no refill above low watermark", func(t *testing.T) {
+		ctx := context.Background()
+		memory := inmemory.New()
+		_, err := memory.AddTokens(ctx, []string{"0123456789", "9876543210"})
+		require.NoError(t, err)
+		pool := NewPool(memory, hasher.New(), nil, newTestKeyspace(), 2, 50, zap.NewNop())
+
+		pool.fill(ctx)
+		size, err := memory.PoolSize(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, size)
+	})
+	t.Run("claim tokens", func(t *testing.T) {
+		ctx := context.Background()
+		memory := inmemory.New()
+		pool := NewPool(memory, hasher.New(), nil, newTestKeyspace(), 10, 50, zap.NewNop())
+		pool.fill(ctx)
+
+		seen := map[string]bool{}
+		for i := 0; i < 50; i++ {
+			token, err := pool.Token(ctx, "http://ya.ru")
+			require.NoError(t, err)
+			assert.False(t, seen[token])
+			seen[token] = true
+		}
+		assert.Len(t, pool.refill, 1)
+	})
+	t.Run("fallback on empty pool", func(t *testing.T) {
+		ctx := context.Background()
+		ctrl := gomock.NewController(t)
+		fallback := mock_tokenpool.NewMockSource(ctrl)
+		fallback.EXPECT().Token(gomock.Any(), "http://ya.ru").Return("0123456789", nil)
+		pool := NewPool(inmemory.New(), hasher.New(), fallback, newTestKeyspace(), 10, 50, zap.NewNop())
+
+		token, err := pool.Token(ctx, "http://ya.ru")
+		require.NoError(t, err)
+		assert.Equal(t, "0123456789", token)
+	})
+	t.Run("claim error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		store := mock_storage.NewMockTokenPooler(ctrl)
+		store.EXPECT().ClaimToken(gomock.Any()).Return("", false, errors.New("some"))
+		pool := NewPool(store, hasher.New(), nil, newTestKeyspace(), 10, 50, zap.NewNop())
+
+		_, err := pool.Token(context.Background(), "http://ya.ru")
+		require.Error(t, err)
+	})
+	t.Run("run stops with context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		memory := inmemory.New()
+		pool := NewPool(memory, hasher.New(), nil, newTestKeyspace(), 10, 50, zap.NewNop())
+
+		done := make(chan struct{})
+		go func() {
+			pool.Run(ctx)
+			close(done)
+		}()
+		cancel()
+		<-done
+	})
+}
@@ -0,0 +1,9 @@
+package tokenpool
+
+import "context"
+
+//go:generate mockgen -source=source.go -destination=./mock/source.go
+type Source interface {
+	// Token returns a token that is not used by any link yet.
+	Token(ctx context.Context, fullURL string) (token string, err error)
+}
@@ -0,0 +1,270 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/ilyakharev/url-short/internal/clicks"
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+type payload struct {
+	ID        string        `json:"id"`
+	Event     string        `json:"event"`
+	CreatedAt time.Time     `json:"created_at"`
+	Tenant    string        `json:"tenant"`
+	Link      linkPayload   `json:"link"`
+	Click     *clickPayload `json:"click,omitempty"`
+}
+
+type linkPayload struct {
+	Token     string     `json:"token"`
+	URL       string     `json:"url,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+}
+
+type clickPayload struct {
+	Time           time.Time `json:"time"`
+	ReferrerHost   string    `json:"referrer_host,omitempty"`
+	UserAgentClass string    `json:"user_agent_class"`
+}
+
+func newLinkPayload(link *storage.NewLink) linkPayload {
+	payload := linkPayload{Token: link.Token, URL: link.FullURL, Tags: link.Attributes.Tags}
+	if !link.Attributes.ExpiresAt.IsZero() {
+		expiresAt := link.Attributes.ExpiresAt
+		payload.ExpiresAt = &expiresAt
+	}
+	return payload
+}
+
+// Sign returns the X-Webhook-Signature of body sent at timestamp, in the
+// form "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">". Receivers
+// compute it with the secret of the webhook and compare, and may reject old
+// timestamps to stop replays.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + unix + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run sends due deliveries and queues sampled clicks until ctx is done.
+func (dispatcher *Dispatcher) Run(ctx context.Context) error {
+	err := dispatcher.refresh(ctx)
+	if err != nil {
+		dispatcher.logger.Error("error on load webhooks", zap.Error(err))
+	}
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.Go(func() error {
+		dispatcher.deliverLoop(groupCtx)
+		return nil
+	})
+	if dispatcher.hub != nil {
+		subscription := dispatcher.hub.Subscribe(clicks.Filter{}, clickBuffer)
+		defer subscription.Close()
+		group.Go(func() error {
+			dispatcher.clickLoop(groupCtx, subscription)
+			return nil
+		})
+	}
+	return group.Wait()
+}
+
+func (dispatcher *Dispatcher) deliverLoop(ctx context.Context) {
+	poll := time.NewTicker(dispatcher.cfg.PollInterval)
+	defer poll.Stop()
+	refresh := time.NewTicker(dispatcher.cfg.RefreshInterval)
+	defer refresh.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-refresh.C:
+			err := dispatcher.refresh(ctx)
+			if err != nil {
+				dispatcher.logger.Error("error on load webhooks", zap.Error(err))
+			}
+		case <-poll.C:
+			dispatcher.deliverDue(ctx)
+		}
+	}
+}
+
+func (dispatcher *Dispatcher) clickLoop(ctx context.Context, subscription *clicks.Subscription) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, open := <-subscription.Events():
+			if !open {
+				return
+			}
+			dispatcher.notifyClick(ctx, &event)
+		}
+	}
+}
+
+// deliverDue sends the due deliveries, Concurrency at a time, until none are
+// left.
+func (dispatcher *Dispatcher) deliverDue(ctx context.Context) {
+	// A delivery is claimed for longer than sending it may take, so that it
+	// is sent again only if this replica stopped meanwhile.
+	lease := 2*dispatcher.cfg.Timeout + time.Minute
+	for ctx.Err() == nil {
+		deliveries, err := dispatcher.store.ClaimDeliveries(ctx, dispatcher.now(), lease,
+			dispatcher.cfg.Concurrency)
+		if err != nil {
+			dispatcher.logger.Error("error on claim webhook deliveries", zap.Error(err))
+			return
+		}
+		var group errgroup.Group
+		for i := range deliveries {
+			delivery := &deliveries[i]
+			group.Go(func() error {
+				dispatcher.deliver(ctx, delivery)
+				return nil
+			})
+		}
+		_ = group.Wait()
+		if len(deliveries) < dispatcher.cfg.Concurrency {
+			return
+		}
+	}
+}
+
+// deliver sends delivery and records the outcome.
+func (dispatcher *Dispatcher) deliver(ctx context.Context, delivery *storage.WebhookDelivery) {
+	webhook, found := dispatcher.webhook(delivery.Tenant, delivery.WebhookID)
+	if !found {
+		// The webhook could be created by another replica since the last
+		// refresh.
+		err := dispatcher.refresh(ctx)
+		if err != nil {
+			dispatcher.logger.Error("error on load webhooks", zap.Error(err))
+			return
+		}
+		webhook, found = dispatcher.webhook(delivery.Tenant, delivery.WebhookID)
+	}
+	if !found || (delivery.Event == EventLinkExpired && !dispatcher.stillExpired(ctx, delivery)) {
+		dispatcher.drop(ctx, delivery)
+		return
+	}
+
+	err := dispatcher.send(ctx, &webhook, delivery)
+	if ctx.Err() != nil {
+		// Shutting down, the lease runs out and the delivery is sent again.
+		return
+	}
+	if err == nil {
+		webhookStats.Add("delivered", 1)
+		dispatcher.drop(ctx, delivery)
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= dispatcher.cfg.MaxAttempts {
+		delivery.Dead = true
+		webhookStats.Add("dead", 1)
+		dispatcher.logger.Warn("webhook delivery is dead",
+			zap.String("delivery", delivery.ID), zap.String("webhook", webhook.ID), zap.Error(err))
+	} else {
+		delivery.NextAttemptAt = dispatcher.now().Add(dispatcher.backoff(delivery.Attempts))
+		webhookStats.Add("failed", 1)
+	}
+	err = dispatcher.store.UpdateDelivery(ctx, delivery)
+	if err != nil {
+		dispatcher.logger.Error("error on update webhook delivery", zap.Error(err))
+	}
+}
+
+// stillExpired checks that the link of a link.expired delivery was neither
+// deleted nor extended since the event was queued.
+func (dispatcher *Dispatcher) stillExpired(ctx context.Context, delivery *storage.WebhookDelivery) bool {
+	var queued payload
+	err := json.Unmarshal(delivery.Payload, &queued)
+	if err != nil || queued.Link.ExpiresAt == nil {
+		return false
+	}
+	_, attrs, found, err := storage.GetLink(ctx, dispatcher.links, queued.Link.Token)
+	if err != nil {
+		dispatcher.logger.Error("error on get link", zap.Error(err))
+		return true
+	}
+	return found && attrs.ExpiresAt.Equal(*queued.Link.ExpiresAt) && attrs.Expired(dispatcher.now())
+}
+
+func (dispatcher *Dispatcher) drop(ctx context.Context, delivery *storage.WebhookDelivery) {
+	err := dispatcher.store.DeleteDelivery(ctx, delivery.ID)
+	if err != nil {
+		dispatcher.logger.Error("error on delete webhook delivery", zap.Error(err))
+	}
+}
+
+// backoff is the wait after the failed attempt number attempts.
+func (dispatcher *Dispatcher) backoff(attempts int) time.Duration {
+	wait := dispatcher.cfg.RetryInterval
+	for i := 1; i < attempts && wait < dispatcher.cfg.MaxRetryInterval; i++ {
+		wait *= 2
+	}
+	return min(wait, dispatcher.cfg.MaxRetryInterval)
+}
+
+// send posts the payload of delivery to webhook, any response but 2xx is
+// an error. Only the status code of the response is kept, its body is the
+// data of whoever answers and is not shown back to the tenant.
+func (dispatcher *Dispatcher) send(ctx context.Context, webhook *storage.Webhook,
+	delivery *storage.WebhookDelivery,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, dispatcher.cfg.Timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "url-shortener-webhooks")
+	request.Header.Set(HeaderEvent, delivery.Event)
+	request.Header.Set(HeaderDelivery, delivery.ID)
+	request.Header.Set(HeaderSignature, Sign(webhook.Secret, dispatcher.now(), delivery.Payload))
+
+	response, err := dispatcher.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	// The body is read so that the connection is reused.
+	_, _ = io.Copy(io.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("status %d", response.StatusCode)
+	}
+	return nil
+}
+
+func randomFloat() float64 {
+	return rand.Float64() //nolint:gosec // sampling does not need a secure source
+}
@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+// Storage notifies the dispatcher of the links created, updated and deleted
+// through it. Other optional interfaces of the wrapped storage are found
+// with storage.As.
+type Storage struct {
+	storager   storage.Storager
+	dispatcher *Dispatcher
+}
+
+var (
+	_ storage.Storager        = &Storage{}
+	_ storage.Editor          = &Storage{}
+	_ storage.Wrapper         = &Storage{}
+	_ storage.AttributeStorer = &Storage{}
+	_ storage.BatchCreator    = &Storage{}
+)
+
+func NewStorage(st storage.Storager, dispatcher *Dispatcher) *Storage {
+	return &Storage{storager: st, dispatcher: dispatcher}
+}
+
+func (st *Storage) GetFullURL(ctx context.Context,
+	token string,
+) (fullURL string, found bool, err error) {
+	return st.storager.GetFullURL(ctx, token)
+}
+
+func (st *Storage) GetWithAttributes(ctx context.Context,
+	token string,
+) (fullURL string, attrs storage.Attributes, found bool, err error) {
+	return storage.GetLink(ctx, st.storager, token)
+}
+
+// CreateShortURL has no events, a link without attributes has no tenant.
+func (st *Storage) CreateShortURL(ctx context.Context, fullURL string,
+	token string,
+) (err error) {
+	return st.storager.CreateShortURL(ctx, fullURL, token)
+}
+
+func (st *Storage) CreateWithAttributes(ctx context.Context, fullURL string,
+	token string, attrs storage.Attributes,
+) (err error) {
+	link := storage.NewLink{Token: token, FullURL: fullURL, Attributes: attrs}
+	err = storage.CreateLink(ctx, st.storager, &link)
+	if err == nil {
+		st.dispatcher.Notify(ctx, EventLinkCreated, &link)
+	}
+	return err
+}
+
+func (st *Storage) CreateBatch(ctx context.Context,
+	links []storage.NewLink,
+) (errs []error, err error) {
+	errs, err = storage.CreateLinks(ctx, st.storager, links)
+	if err != nil {
+		return errs, err
+	}
+	for i := range links {
+		if errs[i] == nil {
+			st.dispatcher.Notify(ctx, EventLinkCreated, &links[i])
+		}
+	}
+	return errs, nil
+}
+
+func (st *Storage) AlreadyExists(ctx context.Context,
+	fullURL string,
+) (token string, found bool, err error) {
+	return st.storager.AlreadyExists(ctx, fullURL)
+}
+
+// UpdateShortURL reads the link first to know its tenant.
+func (st *Storage) UpdateShortURL(ctx context.Context, token string,
+	fullURL string,
+) (found bool, err error) {
+	editor, ok := storage.As[storage.Editor](st.storager)
+	if !ok {
+		return false, errors.ErrUnsupported
+	}
+	_, attrs, _, err := storage.GetLink(ctx, st.storager, token)
+	if err != nil {
+		return false, err
+	}
+	found, err = editor.UpdateShortURL(ctx, token, fullURL)
+	if err == nil && found {
+		st.dispatcher.Notify(ctx, EventLinkUpdated,
+			&storage.NewLink{Token: token, FullURL: fullURL, Attributes: attrs})
+	}
+	return found, err
+}
+
+// DeleteShortURL reads the link first to know its tenant.
+func (st *Storage) DeleteShortURL(ctx context.Context,
+	token string,
+) (found bool, err error) {
+	editor, ok := storage.As[storage.Editor](st.storager)
+	if !ok {
+		return false, errors.ErrUnsupported
+	}
+	fullURL, attrs, _, err := storage.GetLink(ctx, st.storager, token)
+	if err != nil {
+		return false, err
+	}
+	found, err = editor.DeleteShortURL(ctx, token)
+	if err == nil && found {
+		st.dispatcher.Notify(ctx, EventLinkDeleted,
+			&storage.NewLink{Token: token, FullURL: fullURL, Attributes: attrs})
+	}
+	return found, err
+}
+
+func (st *Storage) Unwrap() storage.Storager {
+	return st.storager
+}
+
+func (st *Storage) Close() error {
+	return st.storager.Close()
+}
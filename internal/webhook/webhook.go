@@ -0,0 +1,418 @@
+// Package webhook sends events of links to the HTTP endpoints their tenants
+// subscribed. Events are queued in the storage and sent by Dispatcher.Run,
+// failed deliveries are retried with exponential backoff and then kept as
+// dead letters until replayed.
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/clicks"
+	"github.com/ilyakharev/url-short/internal/storage"
+)
+
+const (
+	EventLinkCreated = "link.created"
+	EventLinkUpdated = "link.updated"
+	EventLinkDeleted = "link.deleted"
+	// EventLinkExpired is sent when the expiry time of a link comes, to the
+	// webhooks that existed when the link was created.
+	EventLinkExpired = "link.expired"
+	// EventLinkClicked is sent for ClickSampleRate of the clicks.
+	EventLinkClicked = "link.clicked"
+)
+
+// Events are the events a webhook can subscribe to.
+var Events = []string{EventLinkCreated, EventLinkUpdated, EventLinkDeleted, EventLinkExpired, EventLinkClicked}
+
+var webhookStats = expvar.NewMap("webhooks")
+
+// ErrInvalidWebhook is returned for a webhook that can not be created.
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+var errAddressNotAllowed = errors.New("address is not public")
+
+const (
+	defaultMaxAttempts      = 8
+	defaultRetryInterval    = 10 * time.Second
+	defaultMaxRetryInterval = time.Hour
+	defaultPollInterval     = time.Second
+	defaultRefreshInterval  = time.Minute
+	defaultTimeout          = 10 * time.Second
+	defaultConcurrency      = 8
+	// clickBuffer is how many clicks wait to be sampled before the next ones
+	// are dropped.
+	clickBuffer = 1024
+)
+
+type Config struct {
+	// MaxAttempts is how many times a delivery is sent before it is dead.
+	MaxAttempts int
+	// RetryInterval is the wait after the first failure, it doubles after
+	// each next one up to MaxRetryInterval.
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	// PollInterval is how often the queue is checked for due deliveries.
+	PollInterval time.Duration
+	// RefreshInterval is how often webhooks created by other replicas are
+	// loaded.
+	RefreshInterval time.Duration
+	// Timeout bounds one request to a webhook.
+	Timeout time.Duration
+	// Concurrency is how many deliveries are sent at once.
+	Concurrency int
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaultRetryInterval
+	}
+	if cfg.MaxRetryInterval <= 0 {
+		cfg.MaxRetryInterval = defaultMaxRetryInterval
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = defaultRefreshInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = defaultConcurrency
+	}
+}
+
+// Dispatcher queues the events of links for the webhooks of their tenants
+// and sends them. Links without a tenant have no events.
+type Dispatcher struct {
+	store   storage.WebhookStorer
+	links   storage.Storager
+	hub     *clicks.Hub
+	cfg     Config
+	now     func() time.Time
+	sampler func() float64
+	// allowed tells the addresses webhooks may be sent to, see publicAddress.
+	allowed func(netip.Addr) bool
+	client  *http.Client
+	logger  *zap.Logger
+
+	mutex sync.RWMutex
+	// webhooks are cached by tenant, the queue is read on every event.
+	webhooks map[string][]storage.Webhook
+}
+
+// New returns a dispatcher keeping webhooks in st, which has to implement
+// storage.WebhookStorer. Clicks published to hub are sent as link.clicked,
+// hub may be nil.
+func New(st storage.Storager, hub *clicks.Hub, cfg Config, logger *zap.Logger) (*Dispatcher, error) {
+	store, ok := storage.As[storage.WebhookStorer](st)
+	if !ok {
+		return nil, errors.New("webhooks are not supported by storage")
+	}
+	cfg.setDefaults()
+	dispatcher := &Dispatcher{
+		store:    store,
+		links:    st,
+		hub:      hub,
+		cfg:      cfg,
+		now:      time.Now,
+		sampler:  randomFloat,
+		allowed:  publicAddress,
+		logger:   logger,
+		webhooks: make(map[string][]storage.Webhook),
+	}
+	dispatcher.client = dispatcher.newClient()
+	return dispatcher, nil
+}
+
+// newClient sends webhooks without a proxy and without following
+// redirects, so that every request goes to an address checked by allowed
+// when it is dialed, after the name of the host is resolved.
+func (dispatcher *Dispatcher) newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_ string, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !dispatcher.allowed(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", errAddressNotAllowed, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// publicAddress refuses the addresses of the host and of private networks:
+// loopback, private, link-local, multicast and unspecified ones.
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
+
+// CreateWebhook subscribes url to events of the links of tenant. The
+// returned webhook has the secret its payloads are signed with.
+func (dispatcher *Dispatcher) CreateWebhook(ctx context.Context, tenant string, rawURL string,
+	events []string, clickSampleRate float64,
+) (webhook storage.Webhook, err error) {
+	if tenant == "" {
+		return webhook, fmt.Errorf("%w: tenant is empty", ErrInvalidWebhook)
+	}
+	err = storage.CheckTenant(tenant)
+	if err != nil {
+		return webhook, fmt.Errorf("%w: %w", ErrInvalidWebhook, err)
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return webhook, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	// Names are checked when they are resolved on delivery.
+	if addr, parseErr := netip.ParseAddr(parsed.Hostname()); parseErr == nil && !dispatcher.allowed(addr) {
+		return webhook, fmt.Errorf("%w: %w", ErrInvalidWebhook, errAddressNotAllowed)
+	}
+	if len(events) == 0 {
+		return webhook, fmt.Errorf("%w: no events", ErrInvalidWebhook)
+	}
+	for _, event := range events {
+		if !slices.Contains(Events, event) {
+			return webhook, fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, event)
+		}
+	}
+	if clickSampleRate < 0 || clickSampleRate > 1 {
+		return webhook, fmt.Errorf("%w: click sample rate must be from 0 to 1", ErrInvalidWebhook)
+	}
+	if slices.Contains(events, EventLinkClicked) && clickSampleRate == 0 {
+		clickSampleRate = 1
+	}
+
+	events = slices.Clone(events)
+	slices.Sort(events)
+	webhook = storage.Webhook{
+		ID:              newID(),
+		Tenant:          tenant,
+		URL:             rawURL,
+		Secret:          newSecret(),
+		Events:          slices.Compact(events),
+		ClickSampleRate: clickSampleRate,
+		CreatedAt:       dispatcher.now(),
+	}
+	err = dispatcher.store.CreateWebhook(ctx, &webhook)
+	if err != nil {
+		return storage.Webhook{}, err
+	}
+	dispatcher.mutex.Lock()
+	dispatcher.webhooks[tenant] = append(dispatcher.webhooks[tenant], webhook)
+	dispatcher.mutex.Unlock()
+	return webhook, nil
+}
+
+// Webhooks lists the webhooks of tenant.
+func (dispatcher *Dispatcher) Webhooks(ctx context.Context, tenant string) ([]storage.Webhook, error) {
+	return dispatcher.store.Webhooks(ctx, tenant)
+}
+
+// DeleteWebhook deletes the webhook of tenant and drops its queued
+// deliveries.
+func (dispatcher *Dispatcher) DeleteWebhook(ctx context.Context, tenant string, id string) (found bool, err error) {
+	found, err = dispatcher.store.DeleteWebhook(ctx, tenant, id)
+	if err != nil || !found {
+		return found, err
+	}
+	dispatcher.mutex.Lock()
+	dispatcher.webhooks[tenant] = slices.DeleteFunc(slices.Clone(dispatcher.webhooks[tenant]),
+		func(webhook storage.Webhook) bool { return webhook.ID == id })
+	dispatcher.mutex.Unlock()
+	return true, nil
+}
+
+// DeadLetters lists up to limit deliveries of tenant that ran out of
+// attempts, newest first.
+func (dispatcher *Dispatcher) DeadLetters(ctx context.Context, tenant string,
+	limit int,
+) ([]storage.WebhookDelivery, error) {
+	return dispatcher.store.DeadDeliveries(ctx, tenant, limit)
+}
+
+// Replay queues the dead delivery of tenant again with all its attempts.
+func (dispatcher *Dispatcher) Replay(ctx context.Context, tenant string, id string) (found bool, err error) {
+	found, err = dispatcher.store.ReplayDelivery(ctx, tenant, id, dispatcher.now())
+	if found {
+		webhookStats.Add("replayed", 1)
+	}
+	return found, err
+}
+
+// Notify queues event of link for the webhooks of its tenant subscribed to
+// it. Creating a link with an expiry time also queues its link.expired for
+// that time. Errors are logged, an event is never a reason to fail a change
+// of the link.
+func (dispatcher *Dispatcher) Notify(ctx context.Context, event string, link *storage.NewLink) {
+	tenant := link.Attributes.Tenant
+	if tenant == "" {
+		return
+	}
+	now := dispatcher.now()
+	var deliveries []storage.WebhookDelivery
+	for _, webhook := range dispatcher.subscribed(tenant, event) {
+		deliveries = dispatcher.appendDelivery(deliveries, webhook, event, now, newLinkPayload(link), nil)
+	}
+	if event == EventLinkCreated && !link.Attributes.ExpiresAt.IsZero() {
+		for _, webhook := range dispatcher.subscribed(tenant, EventLinkExpired) {
+			deliveries = dispatcher.appendDelivery(deliveries, webhook, EventLinkExpired,
+				link.Attributes.ExpiresAt, newLinkPayload(link), nil)
+		}
+	}
+	dispatcher.enqueue(ctx, deliveries)
+}
+
+// notifyClick queues a sample of clicks for the webhooks subscribed to
+// them, each webhook samples on its own.
+func (dispatcher *Dispatcher) notifyClick(ctx context.Context, event *clicks.Event) {
+	if event.Tenant == "" {
+		return
+	}
+	var deliveries []storage.WebhookDelivery
+	for _, webhook := range dispatcher.subscribed(event.Tenant, EventLinkClicked) {
+		if dispatcher.sampler() >= webhook.ClickSampleRate {
+			continue
+		}
+		deliveries = dispatcher.appendDelivery(deliveries, webhook, EventLinkClicked, dispatcher.now(),
+			linkPayload{Token: event.Token}, &clickPayload{
+				Time:           event.Time,
+				ReferrerHost:   event.ReferrerHost,
+				UserAgentClass: event.UserAgentClass,
+			})
+	}
+	dispatcher.enqueue(ctx, deliveries)
+}
+
+func (dispatcher *Dispatcher) appendDelivery(deliveries []storage.WebhookDelivery, webhook *storage.Webhook,
+	event string, due time.Time, link linkPayload, click *clickPayload,
+) []storage.WebhookDelivery {
+	now := dispatcher.now()
+	delivery := storage.WebhookDelivery{
+		ID:            newID(),
+		WebhookID:     webhook.ID,
+		Tenant:        webhook.Tenant,
+		Event:         event,
+		NextAttemptAt: due,
+		CreatedAt:     now,
+	}
+	var err error
+	delivery.Payload, err = json.Marshal(payload{
+		ID:        delivery.ID,
+		Event:     event,
+		CreatedAt: now,
+		Tenant:    webhook.Tenant,
+		Link:      link,
+		Click:     click,
+	})
+	if err != nil {
+		dispatcher.logger.Error("error on marshal webhook payload", zap.Error(err))
+		return deliveries
+	}
+	return append(deliveries, delivery)
+}
+
+func (dispatcher *Dispatcher) enqueue(ctx context.Context, deliveries []storage.WebhookDelivery) {
+	if len(deliveries) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), dispatcher.cfg.Timeout)
+	defer cancel()
+	err := dispatcher.store.EnqueueDeliveries(ctx, deliveries)
+	if err != nil {
+		dispatcher.logger.Error("error on enqueue webhook deliveries", zap.Error(err))
+		webhookStats.Add("lost", int64(len(deliveries)))
+		return
+	}
+	webhookStats.Add("enqueued", int64(len(deliveries)))
+}
+
+// subscribed returns the webhooks of tenant subscribed to event.
+func (dispatcher *Dispatcher) subscribed(tenant string, event string) (webhooks []*storage.Webhook) {
+	dispatcher.mutex.RLock()
+	defer dispatcher.mutex.RUnlock()
+	all := dispatcher.webhooks[tenant]
+	for i := range all {
+		if slices.Contains(all[i].Events, event) {
+			webhooks = append(webhooks, &all[i])
+		}
+	}
+	return webhooks
+}
+
+// webhook returns the cached webhook with id.
+func (dispatcher *Dispatcher) webhook(tenant string, id string) (storage.Webhook, bool) {
+	dispatcher.mutex.RLock()
+	defer dispatcher.mutex.RUnlock()
+	for _, webhook := range dispatcher.webhooks[tenant] {
+		if webhook.ID == id {
+			return webhook, true
+		}
+	}
+	return storage.Webhook{}, false
+}
+
+// refresh loads the webhooks of every tenant into the cache.
+func (dispatcher *Dispatcher) refresh(ctx context.Context) error {
+	all, err := dispatcher.store.Webhooks(ctx, "")
+	if err != nil {
+		return err
+	}
+	webhooks := make(map[string][]storage.Webhook)
+	for i := range all {
+		webhooks[all[i].Tenant] = append(webhooks[all[i].Tenant], all[i])
+	}
+	dispatcher.mutex.Lock()
+	dispatcher.webhooks = webhooks
+	dispatcher.mutex.Unlock()
+	return nil
+}
+
+func newID() string {
+	return randomHex(16)
+}
+
+func newSecret() string {
+	return "whsec_" + randomHex(32)
+}
+
+func randomHex(size int) string {
+	buf := make([]byte, size)
+	// crypto/rand does not fail on the supported platforms.
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
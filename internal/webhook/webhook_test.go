@@ -0,0 +1,371 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/ilyakharev/url-short/internal/clicks"
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/inmemory"
+)
+
+// receiver is a webhook endpoint answering with the queued status codes,
+// then with 204.
+type receiver struct {
+	t      *testing.T
+	server *httptest.Server
+	secret string
+
+	mutex    sync.Mutex
+	statuses []int
+	received []payload
+	// arrived gets every request, answered or not.
+	arrived chan struct{}
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rcv := &receiver{t: t, statuses: statuses, arrived: make(chan struct{}, 100)}
+	rcv.server = httptest.NewServer(http.HandlerFunc(rcv.serve))
+	t.Cleanup(rcv.server.Close)
+	return rcv
+}
+
+func (rcv *receiver) serve(writer http.ResponseWriter, request *http.Request) {
+	defer func() { rcv.arrived <- struct{}{} }()
+	body, err := io.ReadAll(request.Body)
+	assert.NoError(rcv.t, err)
+	signature := request.Header.Get(HeaderSignature)
+	unix, _, _ := strings.Cut(strings.TrimPrefix(signature, "t="), ",")
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	assert.NoError(rcv.t, err)
+	rcv.mutex.Lock()
+	assert.Equal(rcv.t, Sign(rcv.secret, time.Unix(seconds, 0), body), signature, "signature")
+	rcv.mutex.Unlock()
+
+	var received payload
+	assert.NoError(rcv.t, json.Unmarshal(body, &received))
+	assert.Equal(rcv.t, received.Event, request.Header.Get(HeaderEvent))
+	assert.Equal(rcv.t, received.ID, request.Header.Get(HeaderDelivery))
+
+	rcv.mutex.Lock()
+	defer rcv.mutex.Unlock()
+	status := http.StatusNoContent
+	if len(rcv.statuses) > 0 {
+		status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+	}
+	if status < 300 {
+		rcv.received = append(rcv.received, received)
+	}
+	writer.WriteHeader(status)
+}
+
+func (rcv *receiver) events() (events []string) {
+	rcv.mutex.Lock()
+	defer rcv.mutex.Unlock()
+	for i := range rcv.received {
+		events = append(events, rcv.received[i].Event)
+	}
+	return events
+}
+
+type fixture struct {
+	ctx        context.Context
+	memory     *inmemory.Inmemory
+	dispatcher *Dispatcher
+	links      *Storage
+	now        time.Time
+}
+
+func newFixture(t *testing.T, cfg Config) *fixture {
+	memory := inmemory.New()
+	dispatcher, err := New(memory, nil, cfg, zap.NewNop())
+	require.NoError(t, err)
+	fx := &fixture{
+		ctx:        context.Background(),
+		memory:     memory,
+		dispatcher: dispatcher,
+		links:      NewStorage(memory, dispatcher),
+		now:        time.Unix(1700000000, 0),
+	}
+	dispatcher.now = func() time.Time { return fx.now }
+	// Receivers listen on the loopback address.
+	dispatcher.allowed = func(netip.Addr) bool { return true }
+	return fx
+}
+
+func (fx *fixture) subscribe(t *testing.T, rcv *receiver, events ...string) storage.Webhook {
+	webhook, err := fx.dispatcher.CreateWebhook(fx.ctx, "acme", rcv.server.URL, events, 0)
+	require.NoError(t, err)
+	rcv.mutex.Lock()
+	rcv.secret = webhook.Secret
+	rcv.mutex.Unlock()
+	return webhook
+}
+
+func TestDeliver(t *testing.T) {
+	fx := newFixture(t, Config{})
+	rcv := newReceiver(t)
+	fx.subscribe(t, rcv, EventLinkCreated, EventLinkUpdated, EventLinkDeleted)
+
+	attrs := storage.Attributes{Tenant: "acme", Tags: []string{"promo"}}
+	require.NoError(t, fx.links.CreateWithAttributes(fx.ctx, "https://a.ru", "a", attrs))
+	require.NoError(t, fx.links.CreateWithAttributes(fx.ctx, "https://b.ru", "b",
+		storage.Attributes{Tags: []string{"no tenant"}}))
+	require.NoError(t, fx.links.CreateShortURL(fx.ctx, "https://c.ru", "c"))
+	found, err := fx.links.UpdateShortURL(fx.ctx, "a", "https://a.ru/new")
+	require.NoError(t, err)
+	require.True(t, found)
+	found, err = fx.links.DeleteShortURL(fx.ctx, "a")
+	require.NoError(t, err)
+	require.True(t, found)
+
+	fx.dispatcher.deliverDue(fx.ctx)
+	events := rcv.events()
+	assert.ElementsMatch(t, []string{EventLinkCreated, EventLinkUpdated, EventLinkDeleted}, events)
+	for _, received := range rcv.received {
+		assert.Equal(t, "acme", received.Tenant)
+		assert.Equal(t, "a", received.Link.Token)
+		assert.Equal(t, []string{"promo"}, received.Link.Tags)
+		if received.Event == EventLinkUpdated {
+			assert.Equal(t, "https://a.ru/new", received.Link.URL)
+		}
+	}
+
+	fx.dispatcher.deliverDue(fx.ctx)
+	assert.Len(t, rcv.events(), 3, "delivered events are not sent again")
+}
+
+func TestRetryAndDeadLetter(t *testing.T) {
+	fx := newFixture(t, Config{MaxAttempts: 3, RetryInterval: time.Minute})
+	rcv := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable)
+	fx.subscribe(t, rcv, EventLinkCreated)
+	require.NoError(t, fx.links.CreateWithAttributes(fx.ctx, "https://a.ru", "a", storage.Attributes{Tenant: "acme"}))
+
+	fx.dispatcher.deliverDue(fx.ctx)
+	require.Len(t, rcv.arrived, 1)
+	fx.now = fx.now.Add(59 * time.Second)
+	fx.dispatcher.deliverDue(fx.ctx)
+	require.Len(t, rcv.arrived, 1, "the retry waits for the backoff")
+	fx.now = fx.now.Add(time.Second)
+	fx.dispatcher.deliverDue(fx.ctx)
+	require.Len(t, rcv.arrived, 2)
+	fx.now = fx.now.Add(2 * time.Minute)
+	fx.dispatcher.deliverDue(fx.ctx)
+	require.Len(t, rcv.arrived, 3, "the backoff doubles")
+
+	dead, err := fx.dispatcher.DeadLetters(fx.ctx, "acme", 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "status 503", dead[0].LastError, "only the status code is kept")
+	fx.now = fx.now.Add(24 * time.Hour)
+	fx.dispatcher.deliverDue(fx.ctx)
+	require.Len(t, rcv.arrived, 3, "dead letters are not retried")
+
+	found, err := fx.dispatcher.Replay(fx.ctx, "other", dead[0].ID)
+	require.NoError(t, err)
+	assert.False(t, found)
+	found, err = fx.dispatcher.Replay(fx.ctx, "acme", dead[0].ID)
+	require.NoError(t, err)
+	require.True(t, found)
+	fx.dispatcher.deliverDue(fx.ctx)
+	assert.Equal(t, []string{EventLinkCreated}, rcv.events())
+	dead, err = fx.dispatcher.DeadLetters(fx.ctx, "acme", 10)
+	require.NoError(t, err)
+	assert.Empty(t, dead)
+}
+
+func TestBackoff(t *testing.T) {
+	fx := newFixture(t, Config{RetryInterval: time.Second, MaxRetryInterval: 10 * time.Second})
+	waits := make([]time.Duration, 0, 6)
+	for attempts := 1; attempts <= 6; attempts++ {
+		waits = append(waits, fx.dispatcher.backoff(attempts))
+	}
+	assert.Equal(t, []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second,
+	}, waits)
+}
+
+func TestExpired(t *testing.T) {
+	fx := newFixture(t, Config{})
+	rcv := newReceiver(t)
+	fx.subscribe(t, rcv, EventLinkExpired)
+	expiresAt := fx.now.Add(time.Hour)
+	for _, token := range []string{"a", "deleted"} {
+		require.NoError(t, fx.links.CreateWithAttributes(fx.ctx, "https://"+token+".ru", token,
+			storage.Attributes{Tenant: "acme", ExpiresAt: expiresAt}))
+	}
+	_, err := fx.links.DeleteShortURL(fx.ctx, "deleted")
+	require.NoError(t, err)
+
+	fx.dispatcher.deliverDue(fx.ctx)
+	assert.Empty(t, rcv.events(), "not expired yet")
+	fx.now = expiresAt
+	fx.dispatcher.deliverDue(fx.ctx)
+	require.Equal(t, []string{EventLinkExpired}, rcv.events(), "a deleted link does not expire")
+	assert.Equal(t, "a", rcv.received[0].Link.Token)
+}
+
+func TestClicks(t *testing.T) {
+	fx := newFixture(t, Config{})
+	rcv := newReceiver(t)
+	sampled, err := fx.dispatcher.CreateWebhook(fx.ctx, "acme", rcv.server.URL, []string{EventLinkClicked}, 0.5)
+	require.NoError(t, err)
+	rcv.secret = sampled.Secret
+	samples := []float64{0.7, 0.2}
+	fx.dispatcher.sampler = func() float64 {
+		sample := samples[0]
+		samples = samples[1:]
+		return sample
+	}
+
+	now := time.Now()
+	fx.dispatcher.notifyClick(fx.ctx, clicks.NewEvent(now, "a", "acme", "https://t.me/channel", ""))
+	fx.dispatcher.notifyClick(fx.ctx, clicks.NewEvent(now, "b", "", "", ""))
+	fx.dispatcher.notifyClick(fx.ctx, clicks.NewEvent(now, "c", "acme", "https://t.me/channel", ""))
+	fx.dispatcher.deliverDue(fx.ctx)
+
+	require.Equal(t, []string{EventLinkClicked}, rcv.events())
+	received := rcv.received[0]
+	assert.Equal(t, "c", received.Link.Token, "the first click is not sampled")
+	require.NotNil(t, received.Click)
+	assert.Equal(t, "t.me", received.Click.ReferrerHost)
+}
+
+func TestRun(t *testing.T) {
+	memory := inmemory.New()
+	hub := clicks.NewHub(0)
+	dispatcher, err := New(memory, hub, Config{PollInterval: 10 * time.Millisecond}, zap.NewNop())
+	require.NoError(t, err)
+	dispatcher.allowed = func(netip.Addr) bool { return true }
+	rcv := newReceiver(t)
+	webhook, err := dispatcher.CreateWebhook(context.Background(), "acme", rcv.server.URL,
+		[]string{EventLinkClicked}, 1)
+	require.NoError(t, err)
+	rcv.secret = webhook.Secret
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- dispatcher.Run(ctx) }()
+	// Clicks published before Run subscribes are not seen.
+	publish := time.NewTicker(10 * time.Millisecond)
+	defer publish.Stop()
+	timeout := time.After(5 * time.Second)
+	for delivered := false; !delivered; {
+		select {
+		case <-publish.C:
+			hub.Publish(clicks.NewEvent(time.Now(), "a", "acme", "", ""))
+		case <-rcv.arrived:
+			delivered = true
+		case <-timeout:
+			t.Fatal("no click was delivered")
+		}
+	}
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestPrivateAddresses(t *testing.T) {
+	fx := newFixture(t, Config{MaxAttempts: 1})
+	rcv := newReceiver(t)
+	fx.subscribe(t, rcv, EventLinkCreated)
+	fx.dispatcher.allowed = publicAddress
+	require.NoError(t, fx.links.CreateWithAttributes(fx.ctx, "https://a.ru", "a", storage.Attributes{Tenant: "acme"}))
+
+	fx.dispatcher.deliverDue(fx.ctx)
+	assert.Empty(t, rcv.arrived, "the loopback address is not dialed")
+	dead, err := fx.dispatcher.DeadLetters(fx.ctx, "acme", 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Contains(t, dead[0].LastError, errAddressNotAllowed.Error())
+
+	for _, raw := range []string{"127.0.0.1", "::1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"fe80::1", "fc00::1", "0.0.0.0", "::", "224.0.0.1", "::ffff:127.0.0.1"} {
+		assert.False(t, publicAddress(netip.MustParseAddr(raw)), raw)
+	}
+	for _, raw := range []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"} {
+		assert.True(t, publicAddress(netip.MustParseAddr(raw)), raw)
+	}
+}
+
+func TestRedirectsAreNotFollowed(t *testing.T) {
+	fx := newFixture(t, Config{MaxAttempts: 1})
+	target := newReceiver(t)
+	redirect := httptest.NewServer(http.RedirectHandler(target.server.URL, http.StatusTemporaryRedirect))
+	t.Cleanup(redirect.Close)
+	_, err := fx.dispatcher.CreateWebhook(fx.ctx, "acme", redirect.URL, []string{EventLinkCreated}, 0)
+	require.NoError(t, err)
+	require.NoError(t, fx.links.CreateWithAttributes(fx.ctx, "https://a.ru", "a", storage.Attributes{Tenant: "acme"}))
+
+	fx.dispatcher.deliverDue(fx.ctx)
+	assert.Empty(t, target.arrived)
+	dead, err := fx.dispatcher.DeadLetters(fx.ctx, "acme", 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "status 307", dead[0].LastError)
+}
+
+func TestCreateWebhook(t *testing.T) {
+	fx := newFixture(t, Config{})
+	fx.dispatcher.allowed = publicAddress
+	cases := []struct {
+		name   string
+		tenant string
+		url    string
+		events []string
+		rate   float64
+	}{
+		{name: "no tenant", url: "https://a.ru", events: []string{EventLinkCreated}},
+		{name: "bad tenant", tenant: "a b", url: "https://a.ru", events: []string{EventLinkCreated}},
+		{name: "relative url", tenant: "acme", url: "/hook", events: []string{EventLinkCreated}},
+		{name: "ftp url", tenant: "acme", url: "ftp://a.ru", events: []string{EventLinkCreated}},
+		{name: "no events", tenant: "acme", url: "https://a.ru"},
+		{name: "unknown event", tenant: "acme", url: "https://a.ru", events: []string{"link.viewed"}},
+		{name: "bad rate", tenant: "acme", url: "https://a.ru", events: []string{EventLinkClicked}, rate: 2},
+		{name: "loopback url", tenant: "acme", url: "http://127.0.0.1:8080/hook", events: []string{EventLinkCreated}},
+		{name: "private url", tenant: "acme", url: "https://10.0.0.1", events: []string{EventLinkCreated}},
+		{name: "metadata url", tenant: "acme", url: "http://169.254.169.254/latest", events: []string{EventLinkCreated}},
+		{name: "link-local url", tenant: "acme", url: "http://[fe80::1]/", events: []string{EventLinkCreated}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := fx.dispatcher.CreateWebhook(fx.ctx, tc.tenant, tc.url, tc.events, tc.rate)
+			assert.ErrorIs(t, err, ErrInvalidWebhook)
+		})
+	}
+
+	webhook, err := fx.dispatcher.CreateWebhook(fx.ctx, "acme", "https://a.ru",
+		[]string{EventLinkClicked, EventLinkCreated, EventLinkClicked}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{EventLinkClicked, EventLinkCreated}, webhook.Events)
+	assert.Equal(t, 1.0, webhook.ClickSampleRate, "every click by default")
+	assert.True(t, strings.HasPrefix(webhook.Secret, "whsec_"))
+
+	found, err := fx.dispatcher.DeleteWebhook(fx.ctx, "acme", webhook.ID)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Empty(t, fx.dispatcher.subscribed("acme", EventLinkCreated))
+}
+
+func TestNewRequiresWebhookStorer(t *testing.T) {
+	_, err := New(noWebhooks{inmemory.New()}, nil, Config{}, zap.NewNop())
+	assert.Error(t, err)
+}
+
+// noWebhooks hides the optional interfaces of a storage.
+type noWebhooks struct {
+	storage.Storager
+}
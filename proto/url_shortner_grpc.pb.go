@@ -24,6 +24,8 @@ const _ = grpc.SupportPackageIsVersion7
 type GrpcHandlerClient interface {
 	CreateShortURL(ctx context.Context, in *CreateShortURLRequest, opts ...grpc.CallOption) (*CreateShortURLResponse, error)
 	GetFullURL(ctx context.Context, in *GetFullURLRequest, opts ...grpc.CallOption) (*GetFullURLResponse, error)
+	BatchCreateShortURL(ctx context.Context, opts ...grpc.CallOption) (GrpcHandler_BatchCreateShortURLClient, error)
+	WatchClicks(ctx context.Context, in *WatchClicksRequest, opts ...grpc.CallOption) (GrpcHandler_WatchClicksClient, error)
 }
 
 type grpcHandlerClient struct {
@@ -52,12 +54,77 @@ func (c *grpcHandlerClient) GetFullURL(ctx context.Context, in *GetFullURLReques
 	return out, nil
 }
 
+func (c *grpcHandlerClient) BatchCreateShortURL(ctx context.Context, opts ...grpc.CallOption) (GrpcHandler_BatchCreateShortURLClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GrpcHandler_ServiceDesc.Streams[0], "/url_shortener.GrpcHandler/BatchCreateShortURL", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpcHandlerBatchCreateShortURLClient{stream}
+	return x, nil
+}
+
+type GrpcHandler_BatchCreateShortURLClient interface {
+	Send(*BatchCreateShortURLRequest) error
+	Recv() (*BatchCreateShortURLResponse, error)
+	grpc.ClientStream
+}
+
+type grpcHandlerBatchCreateShortURLClient struct {
+	grpc.ClientStream
+}
+
+func (x *grpcHandlerBatchCreateShortURLClient) Send(m *BatchCreateShortURLRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *grpcHandlerBatchCreateShortURLClient) Recv() (*BatchCreateShortURLResponse, error) {
+	m := new(BatchCreateShortURLResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *grpcHandlerClient) WatchClicks(ctx context.Context, in *WatchClicksRequest, opts ...grpc.CallOption) (GrpcHandler_WatchClicksClient, error) {
+	stream, err := c.cc.NewStream(ctx, &GrpcHandler_ServiceDesc.Streams[1], "/url_shortener.GrpcHandler/WatchClicks", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpcHandlerWatchClicksClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type GrpcHandler_WatchClicksClient interface {
+	Recv() (*WatchClicksResponse, error)
+	grpc.ClientStream
+}
+
+type grpcHandlerWatchClicksClient struct {
+	grpc.ClientStream
+}
+
+func (x *grpcHandlerWatchClicksClient) Recv() (*WatchClicksResponse, error) {
+	m := new(WatchClicksResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // GrpcHandlerServer is the server API for GrpcHandler service.
 // All implementations must embed UnimplementedGrpcHandlerServer
 // for forward compatibility
 type GrpcHandlerServer interface {
 	CreateShortURL(context.Context, *CreateShortURLRequest) (*CreateShortURLResponse, error)
 	GetFullURL(context.Context, *GetFullURLRequest) (*GetFullURLResponse, error)
+	BatchCreateShortURL(GrpcHandler_BatchCreateShortURLServer) error
+	WatchClicks(*WatchClicksRequest, GrpcHandler_WatchClicksServer) error
 	mustEmbedUnimplementedGrpcHandlerServer()
 }
 
@@ -71,6 +138,12 @@ func (UnimplementedGrpcHandlerServer) CreateShortURL(context.Context, *CreateSho
 func (UnimplementedGrpcHandlerServer) GetFullURL(context.Context, *GetFullURLRequest) (*GetFullURLResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetFullURL not implemented")
 }
+func (UnimplementedGrpcHandlerServer) BatchCreateShortURL(GrpcHandler_BatchCreateShortURLServer) error {
+	return status.Errorf(codes.Unimplemented, "method BatchCreateShortURL not implemented")
+}
+func (UnimplementedGrpcHandlerServer) WatchClicks(*WatchClicksRequest, GrpcHandler_WatchClicksServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchClicks not implemented")
+}
 func (UnimplementedGrpcHandlerServer) mustEmbedUnimplementedGrpcHandlerServer() {}
 
 // UnsafeGrpcHandlerServer may be embedded to opt out of forward compatibility for this service.
@@ -120,6 +193,53 @@ func _GrpcHandler_GetFullURL_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _GrpcHandler_BatchCreateShortURL_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GrpcHandlerServer).BatchCreateShortURL(&grpcHandlerBatchCreateShortURLServer{stream})
+}
+
+type GrpcHandler_BatchCreateShortURLServer interface {
+	Send(*BatchCreateShortURLResponse) error
+	Recv() (*BatchCreateShortURLRequest, error)
+	grpc.ServerStream
+}
+
+type grpcHandlerBatchCreateShortURLServer struct {
+	grpc.ServerStream
+}
+
+func (x *grpcHandlerBatchCreateShortURLServer) Send(m *BatchCreateShortURLResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *grpcHandlerBatchCreateShortURLServer) Recv() (*BatchCreateShortURLRequest, error) {
+	m := new(BatchCreateShortURLRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _GrpcHandler_WatchClicks_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchClicksRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GrpcHandlerServer).WatchClicks(m, &grpcHandlerWatchClicksServer{stream})
+}
+
+type GrpcHandler_WatchClicksServer interface {
+	Send(*WatchClicksResponse) error
+	grpc.ServerStream
+}
+
+type grpcHandlerWatchClicksServer struct {
+	grpc.ServerStream
+}
+
+func (x *grpcHandlerWatchClicksServer) Send(m *WatchClicksResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // GrpcHandler_ServiceDesc is the grpc.ServiceDesc for GrpcHandler service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -136,6 +256,18 @@ var GrpcHandler_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _GrpcHandler_GetFullURL_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "BatchCreateShortURL",
+			Handler:       _GrpcHandler_BatchCreateShortURL_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchClicks",
+			Handler:       _GrpcHandler_WatchClicks_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "proto/url_shortner.proto",
 }
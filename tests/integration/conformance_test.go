@@ -0,0 +1,38 @@
+//go:build integration
+// +build integration
+
+package integration
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ilyakharev/url-short/internal/storage"
+	"github.com/ilyakharev/url-short/internal/storage/postgres"
+	"github.com/ilyakharev/url-short/internal/storage/storagetest"
+)
+
+func TestPostgresConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storager {
+		ctx := context.Background()
+		cfg := postgres.Config{
+			URL:             os.Getenv("POSTGRES_URL"),
+			ConnectAttempts: 1,
+		}
+		st, err := postgres.New(ctx, cfg)
+		require.NoError(t, err)
+
+		// Every run of the suite expects an empty storage.
+		db, err := postgres.Open(ctx, cfg)
+		require.NoError(t, err)
+		defer func() {
+			_ = db.Close()
+		}()
+		_, err = db.ExecContext(ctx, `TRUNCATE urls, token_pool`)
+		require.NoError(t, err)
+		return st
+	})
+}
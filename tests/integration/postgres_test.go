@@ -7,9 +7,11 @@ import (
 	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 
 	"github.com/ilyakharev/url-short/internal/storage/postgres"
 )
@@ -25,7 +27,10 @@ func TestPostgres(t *testing.T) {
 		}
 
 		ctx := context.Background()
-		st, err := postgres.New(os.Getenv("POSTGRES_URL"))
+		st, err := postgres.New(ctx, postgres.Config{
+			URL:             os.Getenv("POSTGRES_URL"),
+			ConnectAttempts: 1,
+		})
 		require.NoError(t, err)
 		defer func() {
 			err = st.Close()
@@ -57,4 +62,103 @@ func TestPostgres(t *testing.T) {
 		assert.Equal(t, tt.fullURL, fullURL)
 		require.NoError(t, err)
 	})
+	t.Run("Test postgres token pool", func(t *testing.T) {
+		ctx := context.Background()
+		st, err := postgres.New(ctx, postgres.Config{
+			URL:             os.Getenv("POSTGRES_URL"),
+			ConnectAttempts: 1,
+		})
+		require.NoError(t, err)
+		defer func() {
+			err = st.Close()
+			if err != nil {
+				return
+			}
+		}()
+
+		err = st.CreateShortURL(ctx, "http://ozon.ru/pool", "poolused01")
+		require.NoError(t, err)
+
+		added, err := st.AddTokens(ctx, []string{"poolfree01", "poolused01", "poolfree01"})
+		require.NoError(t, err)
+		assert.Equal(t, 1, added)
+
+		token, found, err := st.ClaimToken(ctx)
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, "poolfree01", token)
+
+		_, found, err = st.ClaimToken(ctx)
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+	t.Run("Test postgres migrations", func(t *testing.T) {
+		ctx := context.Background()
+		cfg := postgres.Config{
+			URL:             os.Getenv("POSTGRES_URL"),
+			ConnectAttempts: 1,
+		}
+		st, err := postgres.New(ctx, cfg)
+		require.NoError(t, err)
+		require.NoError(t, st.Close())
+
+		db, err := postgres.Open(ctx, cfg)
+		require.NoError(t, err)
+		defer func() {
+			err = db.Close()
+			if err != nil {
+				return
+			}
+		}()
+		migrator, err := postgres.Migrator(db)
+		require.NoError(t, err)
+		require.NoError(t, migrator.Check(ctx))
+
+		applied, err := migrator.Up(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, applied)
+
+		cfg.SkipMigrations = true
+		st, err = postgres.New(ctx, cfg)
+		require.NoError(t, err)
+		require.NoError(t, st.Close())
+	})
+	t.Run("Test postgres change notifications", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cfg := postgres.Config{
+			URL:             os.Getenv("POSTGRES_URL"),
+			ConnectAttempts: 1,
+		}
+		st, err := postgres.New(ctx, cfg)
+		require.NoError(t, err)
+		defer func() {
+			err = st.Close()
+			if err != nil {
+				return
+			}
+		}()
+
+		changed := make(chan string, 1)
+		go func() {
+			_ = postgres.NewListener(cfg, zap.NewNop()).Listen(ctx,
+				func(token string) { changed <- token },
+				func() {})
+		}()
+		// Give the listener time to subscribe.
+		time.Sleep(time.Second)
+
+		err = st.CreateShortURL(ctx, "http://ozon.ru/notify", "notify0001")
+		require.NoError(t, err)
+		found, err := st.UpdateShortURL(ctx, "notify0001", "http://ozon.ru/notified")
+		require.NoError(t, err)
+		require.True(t, found)
+
+		select {
+		case token := <-changed:
+			assert.Equal(t, "notify0001", token)
+		case <-time.After(5 * time.Second):
+			t.Fatal("change is not notified")
+		}
+	})
 }